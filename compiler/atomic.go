@@ -0,0 +1,141 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/go-interpreter/wagon/disasm"
+
+	"github.com/perlin-network/life/compiler/opcodes"
+)
+
+// AtomicKind classifies atomic memory instructions by their operands.
+type AtomicKind int
+
+const (
+	AtomicLoad    AtomicKind = iota // value = op(address)
+	AtomicStore                     // op(address, value)
+	AtomicRmw                       // old value = op(address, operand)
+	AtomicCmpxchg                   // old value = op(address, expected, replacement)
+	AtomicNotify                    // i32 = op(address, count)
+	AtomicWait                      // i32 = op(address, expected, timeout)
+	AtomicFence                     // op()
+)
+
+// AtomicOp describes an atomic memory instruction. Size is the size in bytes
+// of the memory access, to which its effective address must be aligned.
+type AtomicOp struct {
+	Name string
+	Kind AtomicKind
+	Size int
+}
+
+// NumValues returns the number of operands of the instruction.
+func (op AtomicOp) NumValues() int {
+	switch op.Kind {
+	case AtomicLoad:
+		return 1
+	case AtomicStore, AtomicRmw, AtomicNotify:
+		return 2
+	case AtomicCmpxchg, AtomicWait:
+		return 3
+	}
+	return 0
+}
+
+// HasResult tells whether the instruction produces a value.
+func (op AtomicOp) HasResult() bool {
+	return op.Kind != AtomicStore && op.Kind != AtomicFence
+}
+
+// AtomicOps are the atomic memory instructions of the threads proposal,
+// indexed by their sub-opcode. The read-modify-write instructions are added
+// by init.
+var AtomicOps = map[opcodes.AtomicOpcode]AtomicOp{
+	opcodes.MemoryAtomicNotify: {Name: "memory.atomic.notify", Kind: AtomicNotify, Size: 4},
+	opcodes.MemoryAtomicWait32: {Name: "memory.atomic.wait32", Kind: AtomicWait, Size: 4},
+	opcodes.MemoryAtomicWait64: {Name: "memory.atomic.wait64", Kind: AtomicWait, Size: 8},
+	opcodes.AtomicFence:        {Name: "atomic.fence", Kind: AtomicFence},
+
+	opcodes.I32AtomicLoad:    {Name: "i32.atomic.load", Kind: AtomicLoad, Size: 4},
+	opcodes.I64AtomicLoad:    {Name: "i64.atomic.load", Kind: AtomicLoad, Size: 8},
+	opcodes.I32AtomicLoad8U:  {Name: "i32.atomic.load8_u", Kind: AtomicLoad, Size: 1},
+	opcodes.I32AtomicLoad16U: {Name: "i32.atomic.load16_u", Kind: AtomicLoad, Size: 2},
+	opcodes.I64AtomicLoad8U:  {Name: "i64.atomic.load8_u", Kind: AtomicLoad, Size: 1},
+	opcodes.I64AtomicLoad16U: {Name: "i64.atomic.load16_u", Kind: AtomicLoad, Size: 2},
+	opcodes.I64AtomicLoad32U: {Name: "i64.atomic.load32_u", Kind: AtomicLoad, Size: 4},
+	opcodes.I32AtomicStore:   {Name: "i32.atomic.store", Kind: AtomicStore, Size: 4},
+	opcodes.I64AtomicStore:   {Name: "i64.atomic.store", Kind: AtomicStore, Size: 8},
+	opcodes.I32AtomicStore8:  {Name: "i32.atomic.store8", Kind: AtomicStore, Size: 1},
+	opcodes.I32AtomicStore16: {Name: "i32.atomic.store16", Kind: AtomicStore, Size: 2},
+	opcodes.I64AtomicStore8:  {Name: "i64.atomic.store8", Kind: AtomicStore, Size: 1},
+	opcodes.I64AtomicStore16: {Name: "i64.atomic.store16", Kind: AtomicStore, Size: 2},
+	opcodes.I64AtomicStore32: {Name: "i64.atomic.store32", Kind: AtomicStore, Size: 4},
+}
+
+// atomicRmwOps are the operations of the read-modify-write instructions,
+// whose sub-opcodes come in groups of seven in this order.
+var atomicRmwOps = []string{"add", "sub", "and", "or", "xor", "xchg", "cmpxchg"}
+
+// atomicOpcodes maps the names of the atomic instructions to their
+// sub-opcodes.
+var atomicOpcodes = make(map[string]opcodes.AtomicOpcode)
+
+func init() {
+	for i, name := range atomicRmwOps {
+		kind := AtomicRmw
+		if name == "cmpxchg" {
+			kind = AtomicCmpxchg
+		}
+
+		code := opcodes.I32AtomicRmwAdd + opcodes.AtomicOpcode(7*i)
+		AtomicOps[code] = AtomicOp{Name: "i32.atomic.rmw." + name, Kind: kind, Size: 4}
+		AtomicOps[code+1] = AtomicOp{Name: "i64.atomic.rmw." + name, Kind: kind, Size: 8}
+		AtomicOps[code+2] = AtomicOp{Name: "i32.atomic.rmw8." + name + "_u", Kind: kind, Size: 1}
+		AtomicOps[code+3] = AtomicOp{Name: "i32.atomic.rmw16." + name + "_u", Kind: kind, Size: 2}
+		AtomicOps[code+4] = AtomicOp{Name: "i64.atomic.rmw8." + name + "_u", Kind: kind, Size: 1}
+		AtomicOps[code+5] = AtomicOp{Name: "i64.atomic.rmw16." + name + "_u", Kind: kind, Size: 2}
+		AtomicOps[code+6] = AtomicOp{Name: "i64.atomic.rmw32." + name + "_u", Kind: kind, Size: 4}
+	}
+
+	for code, op := range AtomicOps {
+		atomicOpcodes[op.Name] = code
+	}
+}
+
+// atomicOp returns the atomic instruction named name, if any.
+func atomicOp(name string) (opcodes.AtomicOpcode, AtomicOp, bool) {
+	code, ok := atomicOpcodes[name]
+	if !ok {
+		return 0, AtomicOp{}, false
+	}
+	return code, AtomicOps[code], true
+}
+
+// compileAtomic compiles the atomic instruction ins, returning false if ins
+// is not an atomic instruction. Its immediates are those of memArg, the
+// alignment being the natural alignment of the access.
+func (c *SSAFunctionCompiler) compileAtomic(ins disasm.Instr) bool {
+	_, op, ok := atomicOp(ins.Op.Name)
+	if !ok {
+		return false
+	}
+
+	var immediates []int64
+	if op.Kind != AtomicFence {
+		immediates = c.memArg(ins)
+		if align := immediates[0]; align >= 4 || 1<<uint(align) != op.Size {
+			panic(fmt.Errorf("invalid alignment %d for %s", align, op.Name))
+		}
+	}
+
+	values := c.PopStack(op.NumValues())
+	if !op.HasResult() {
+		c.Code = append(c.Code, buildInstr(0, op.Name, immediates, values))
+		return true
+	}
+
+	retID := c.NextValueID()
+	c.Code = append(c.Code, buildInstr(retID, op.Name, immediates, values))
+	c.PushStack(retID)
+	return true
+}
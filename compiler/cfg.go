@@ -1,5 +1,7 @@
 package compiler
 
+import "sort"
+
 type CFGraph struct {
 	Blocks []BasicBlock
 }
@@ -9,8 +11,9 @@ type BasicBlock struct {
 	JmpKind    TyJmpKind
 	JmpTargets []int
 
-	JmpCond    TyValueID
-	YieldValue TyValueID
+	JmpCond      TyValueID
+	YieldValue   TyValueID
+	ReturnValues []TyValueID // values returned by a JmpReturn block
 }
 
 type TyJmpKind uint8
@@ -57,9 +60,7 @@ func (g *CFGraph) ToInsSeq() []Instr {
 			jmpIns.Values = []TyValueID{bb.JmpCond, bb.YieldValue}
 		case JmpReturn:
 			jmpIns.Op = "return"
-			if bb.YieldValue != 0 {
-				jmpIns.Values = []TyValueID{bb.YieldValue}
-			}
+			jmpIns.Values = bb.ReturnValues
 		default:
 			panic("unreachable")
 		}
@@ -94,9 +95,26 @@ func (c *SSAFunctionCompiler) NewCFGraph() *CFGraph {
 				insLabels[i+1] = nextLabel
 				nextLabel++
 			}
+		case "catch":
+			// Catch clauses are entered by unwinding the stack.
+			if _, ok := insLabels[i]; !ok {
+				insLabels[i] = nextLabel
+				nextLabel++
+			}
 		}
 	}
 
+	// Blocks are numbered in code order, which ToInsSeq preserves, so that
+	// the bodies of try blocks remain contiguous.
+	positions := make([]int, 0, len(insLabels))
+	for pos := range insLabels {
+		positions = append(positions, pos)
+	}
+	sort.Ints(positions)
+	for label, pos := range positions {
+		insLabels[pos] = label
+	}
+
 	g.Blocks = make([]BasicBlock, nextLabel)
 
 	var currentBlock *BasicBlock
@@ -145,6 +163,7 @@ func (c *SSAFunctionCompiler) NewCFGraph() *CFGraph {
 
 			if len(ins.Values) > 0 {
 				currentBlock.YieldValue = ins.Values[0]
+				currentBlock.ReturnValues = ins.Values
 			}
 
 			currentBlock = nil
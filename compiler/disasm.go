@@ -0,0 +1,369 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/go-interpreter/wagon/disasm"
+	"github.com/go-interpreter/wagon/wasm"
+	"github.com/go-interpreter/wagon/wasm/leb128"
+	ops "github.com/go-interpreter/wagon/wasm/operators"
+
+	"github.com/perlin-network/life/compiler/opcodes"
+)
+
+// postMVPOps are the single-byte operators of post-MVP proposals, which the
+// operators package does not know about.
+var postMVPOps = map[byte]ops.Op{
+	0xc0: {Code: 0xc0, Name: "i32.extend8_s", Args: []wasm.ValueType{wasm.ValueTypeI32}, Returns: wasm.ValueTypeI32},
+	0xc1: {Code: 0xc1, Name: "i32.extend16_s", Args: []wasm.ValueType{wasm.ValueTypeI32}, Returns: wasm.ValueTypeI32},
+	0xc2: {Code: 0xc2, Name: "i64.extend8_s", Args: []wasm.ValueType{wasm.ValueTypeI64}, Returns: wasm.ValueTypeI64},
+	0xc3: {Code: 0xc3, Name: "i64.extend16_s", Args: []wasm.ValueType{wasm.ValueTypeI64}, Returns: wasm.ValueTypeI64},
+	0xc4: {Code: 0xc4, Name: "i64.extend32_s", Args: []wasm.ValueType{wasm.ValueTypeI64}, Returns: wasm.ValueTypeI64},
+
+	0x1c: {Code: 0x1c, Name: "select", Args: []wasm.ValueType{noReturn, noReturn, wasm.ValueTypeI32}, Returns: noReturn, Polymorphic: true},
+	0x25: {Code: 0x25, Name: "table.get", Args: []wasm.ValueType{wasm.ValueTypeI32}, Returns: noReturn, Polymorphic: true},
+	0x26: {Code: 0x26, Name: "table.set", Args: []wasm.ValueType{wasm.ValueTypeI32, noReturn}, Returns: noReturn, Polymorphic: true},
+	0xd0: {Code: 0xd0, Name: "ref.null", Returns: noReturn, Polymorphic: true},
+	0xd1: {Code: 0xd1, Name: "ref.is_null", Args: []wasm.ValueType{noReturn}, Returns: wasm.ValueTypeI32, Polymorphic: true},
+	0xd2: {Code: 0xd2, Name: "ref.func", Returns: ValueTypeFuncRef},
+
+	0x12: {Code: 0x12, Name: "return_call", Returns: noReturn},
+	0x13: {Code: 0x13, Name: "return_call_indirect", Returns: noReturn},
+
+	0x06: {Code: 0x06, Name: "try", Returns: noReturn},
+	0x07: {Code: 0x07, Name: "catch", Returns: noReturn},
+	0x08: {Code: 0x08, Name: "throw", Returns: noReturn},
+	0x09: {Code: 0x09, Name: "rethrow", Returns: noReturn},
+	0x18: {Code: 0x18, Name: "delegate", Returns: noReturn},
+	0x19: {Code: 0x19, Name: "catch_all", Returns: noReturn},
+}
+
+// prefixFCOps are the operators prefixed by 0xfc, indexed by their sub-opcode.
+var prefixFCOps = map[uint32]ops.Op{
+	0: {Code: 0xfc, Name: "i32.trunc_s:sat/f32", Args: []wasm.ValueType{wasm.ValueTypeF32}, Returns: wasm.ValueTypeI32},
+	1: {Code: 0xfc, Name: "i32.trunc_u:sat/f32", Args: []wasm.ValueType{wasm.ValueTypeF32}, Returns: wasm.ValueTypeI32},
+	2: {Code: 0xfc, Name: "i32.trunc_s:sat/f64", Args: []wasm.ValueType{wasm.ValueTypeF64}, Returns: wasm.ValueTypeI32},
+	3: {Code: 0xfc, Name: "i32.trunc_u:sat/f64", Args: []wasm.ValueType{wasm.ValueTypeF64}, Returns: wasm.ValueTypeI32},
+	4: {Code: 0xfc, Name: "i64.trunc_s:sat/f32", Args: []wasm.ValueType{wasm.ValueTypeF32}, Returns: wasm.ValueTypeI64},
+	5: {Code: 0xfc, Name: "i64.trunc_u:sat/f32", Args: []wasm.ValueType{wasm.ValueTypeF32}, Returns: wasm.ValueTypeI64},
+	6: {Code: 0xfc, Name: "i64.trunc_s:sat/f64", Args: []wasm.ValueType{wasm.ValueTypeF64}, Returns: wasm.ValueTypeI64},
+	7: {Code: 0xfc, Name: "i64.trunc_u:sat/f64", Args: []wasm.ValueType{wasm.ValueTypeF64}, Returns: wasm.ValueTypeI64},
+
+	8:  {Code: 0xfc, Name: "memory.init", Args: []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32, wasm.ValueTypeI32}, Returns: noReturn},
+	9:  {Code: 0xfc, Name: "data.drop", Returns: noReturn},
+	10: {Code: 0xfc, Name: "memory.copy", Args: []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32, wasm.ValueTypeI32}, Returns: noReturn},
+	11: {Code: 0xfc, Name: "memory.fill", Args: []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32, wasm.ValueTypeI32}, Returns: noReturn},
+	12: {Code: 0xfc, Name: "table.init", Args: []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32, wasm.ValueTypeI32}, Returns: noReturn},
+	13: {Code: 0xfc, Name: "elem.drop", Returns: noReturn},
+	14: {Code: 0xfc, Name: "table.copy", Args: []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32, wasm.ValueTypeI32}, Returns: noReturn},
+	15: {Code: 0xfc, Name: "table.grow", Args: []wasm.ValueType{noReturn, wasm.ValueTypeI32}, Returns: wasm.ValueTypeI32, Polymorphic: true},
+	16: {Code: 0xfc, Name: "table.size", Returns: wasm.ValueTypeI32},
+	17: {Code: 0xfc, Name: "table.fill", Args: []wasm.ValueType{wasm.ValueTypeI32, noReturn, wasm.ValueTypeI32}, Returns: noReturn, Polymorphic: true},
+}
+
+const noReturn = wasm.ValueType(wasm.BlockTypeEmpty)
+
+// TypeIndex is the immediate of blocks whose type is given by an entry of
+// the type section, as introduced by the multi-value proposal. Other blocks
+// have a wasm.BlockType immediate.
+type TypeIndex uint32
+
+// Disassemble decodes the code of a function body. Unlike disasm.Disassemble,
+// it supports the instruction encodings of post-MVP proposals.
+func Disassemble(code []byte) ([]disasm.Instr, error) {
+	reader := bytes.NewReader(code)
+	var out []disasm.Instr
+	for {
+		op, err := reader.ReadByte()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		opStr, ok := postMVPOps[op]
+		var subOp uint32
+		if op == 0xfc || op == 0xfd || op == 0xfe {
+			subOp, err = leb128.ReadVarUint32(reader)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if op == 0xfc {
+			if opStr, ok = prefixFCOps[subOp]; !ok {
+				return nil, fmt.Errorf("disasm: invalid opcode 0xfc %d", subOp)
+			}
+		} else if op == 0xfd {
+			simd, ok := SIMDOps[opcodes.SIMDOpcode(subOp)]
+			if subOp > 0xff || !ok {
+				return nil, fmt.Errorf("disasm: invalid opcode 0xfd %d", subOp)
+			}
+			opStr = ops.Op{Code: 0xfd, Name: simd.Name}
+		} else if op == 0xfe {
+			atomic, ok := AtomicOps[opcodes.AtomicOpcode(subOp)]
+			if subOp > 0xff || !ok {
+				return nil, fmt.Errorf("disasm: invalid opcode 0xfe %d", subOp)
+			}
+			opStr = ops.Op{Code: 0xfe, Name: atomic.Name}
+		} else if !ok {
+			opStr, err = ops.New(op)
+			if err != nil {
+				return nil, err
+			}
+		}
+		instr := disasm.Instr{
+			Op: opStr,
+		}
+
+		switch op {
+		case ops.Block, ops.Loop, ops.If, 0x06: // block, loop, if, try
+			sig, err := readBlockType(reader)
+			if err != nil {
+				return nil, err
+			}
+			instr.Immediates = append(instr.Immediates, sig)
+		case ops.Br, ops.BrIf, 0x09, 0x18: // br, br_if, rethrow, delegate
+			depth, err := leb128.ReadVarUint32(reader)
+			if err != nil {
+				return nil, err
+			}
+			instr.Immediates = append(instr.Immediates, depth)
+		case ops.BrTable:
+			targetCount, err := leb128.ReadVarUint32(reader)
+			if err != nil {
+				return nil, err
+			}
+			instr.Immediates = append(instr.Immediates, targetCount)
+			for i := uint32(0); i < targetCount; i++ {
+				entry, err := leb128.ReadVarUint32(reader)
+				if err != nil {
+					return nil, err
+				}
+				instr.Immediates = append(instr.Immediates, entry)
+			}
+
+			defaultTarget, err := leb128.ReadVarUint32(reader)
+			if err != nil {
+				return nil, err
+			}
+			instr.Immediates = append(instr.Immediates, defaultTarget)
+		case ops.Call, ops.CallIndirect, 0x12, 0x13: // call, call_indirect, return_call, return_call_indirect
+			index, err := leb128.ReadVarUint32(reader)
+			if err != nil {
+				return nil, err
+			}
+			instr.Immediates = append(instr.Immediates, index)
+			if op == ops.CallIndirect || op == 0x13 {
+				table, err := leb128.ReadVarUint32(reader)
+				if err != nil {
+					return nil, err
+				}
+				instr.Immediates = append(instr.Immediates, table)
+			}
+		case 0x1c: // typed select
+			n, err := leb128.ReadVarUint32(reader)
+			if err != nil {
+				return nil, err
+			}
+			if n != 1 {
+				return nil, errors.New("disasm: typed select must have a single result")
+			}
+			if _, err := wasm.ReadByte(reader); err != nil {
+				return nil, err
+			}
+		case 0x25, 0x26, 0xd2, 0x07, 0x08: // table.get, table.set, ref.func, catch, throw
+			index, err := leb128.ReadVarUint32(reader)
+			if err != nil {
+				return nil, err
+			}
+			instr.Immediates = append(instr.Immediates, index)
+		case 0xd0: // ref.null
+			t, err := wasm.ReadByte(reader)
+			if err != nil {
+				return nil, err
+			}
+			instr.Immediates = append(instr.Immediates, wasm.ValueType(t))
+		case ops.GetLocal, ops.SetLocal, ops.TeeLocal, ops.GetGlobal, ops.SetGlobal:
+			index, err := leb128.ReadVarUint32(reader)
+			if err != nil {
+				return nil, err
+			}
+			instr.Immediates = append(instr.Immediates, index)
+		case ops.I32Const:
+			i, err := leb128.ReadVarint32(reader)
+			if err != nil {
+				return nil, err
+			}
+			instr.Immediates = append(instr.Immediates, i)
+		case ops.I64Const:
+			i, err := leb128.ReadVarint64(reader)
+			if err != nil {
+				return nil, err
+			}
+			instr.Immediates = append(instr.Immediates, i)
+		case ops.F32Const:
+			var b [4]byte
+			if _, err := io.ReadFull(reader, b[:]); err != nil {
+				return nil, err
+			}
+			i := binary.LittleEndian.Uint32(b[:])
+			instr.Immediates = append(instr.Immediates, math.Float32frombits(i))
+		case ops.F64Const:
+			var b [8]byte
+			if _, err := io.ReadFull(reader, b[:]); err != nil {
+				return nil, err
+			}
+			i := binary.LittleEndian.Uint64(b[:])
+			instr.Immediates = append(instr.Immediates, math.Float64frombits(i))
+		case ops.I32Load, ops.I64Load, ops.F32Load, ops.F64Load, ops.I32Load8s, ops.I32Load8u, ops.I32Load16s, ops.I32Load16u, ops.I64Load8s, ops.I64Load8u, ops.I64Load16s, ops.I64Load16u, ops.I64Load32s, ops.I64Load32u, ops.I32Store, ops.I64Store, ops.F32Store, ops.F64Store, ops.I32Store8, ops.I32Store16, ops.I64Store8, ops.I64Store16, ops.I64Store32:
+			if instr.Immediates, err = readMemArg(reader); err != nil {
+				return nil, err
+			}
+		case ops.CurrentMemory, ops.GrowMemory:
+			index, err := leb128.ReadVarUint32(reader)
+			if err != nil {
+				return nil, err
+			}
+			instr.Immediates = append(instr.Immediates, index)
+		case 0xfc:
+			if instr.Immediates, err = readPrefixFCImmediates(reader, subOp); err != nil {
+				return nil, err
+			}
+		case 0xfd:
+			if instr.Immediates, err = readPrefixFDImmediates(reader, SIMDOps[opcodes.SIMDOpcode(subOp)]); err != nil {
+				return nil, err
+			}
+		case 0xfe:
+			if instr.Immediates, err = readPrefixFEImmediates(reader, AtomicOps[opcodes.AtomicOpcode(subOp)]); err != nil {
+				return nil, err
+			}
+		}
+		out = append(out, instr)
+	}
+	return out, nil
+}
+
+// readMemArg reads the immediates of a memory access: the alignment, the
+// offset and the memory index, which the multi-memory proposal encodes after
+// the alignment when its bit 6 is set. They are returned as uint32, uint64
+// and uint32 values.
+func readMemArg(r io.Reader) ([]interface{}, error) {
+	align, err := leb128.ReadVarUint32(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var memory uint32
+	if align&0x40 != 0 {
+		align &^= 0x40
+		if memory, err = leb128.ReadVarUint32(r); err != nil {
+			return nil, err
+		}
+	}
+
+	offset, err := readVarUint64(r)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{align, offset, memory}, nil
+}
+
+// readPrefixFCImmediates reads the immediates of the 0xfc operator subOp,
+// which are segment, table and memory indices.
+func readPrefixFCImmediates(r io.Reader, subOp uint32) ([]interface{}, error) {
+	var numIndices int
+	switch subOp {
+	case 8, 10, 12, 14: // memory.init, memory.copy, table.init, table.copy
+		numIndices = 2
+	case 9, 11, 13, 15, 16, 17: // data.drop, memory.fill, elem.drop, table.grow, table.size, table.fill
+		numIndices = 1
+	}
+
+	var immediates []interface{}
+	for i := 0; i < numIndices; i++ {
+		index, err := leb128.ReadVarUint32(r)
+		if err != nil {
+			return nil, err
+		}
+		immediates = append(immediates, index)
+	}
+	return immediates, nil
+}
+
+// readPrefixFDImmediates reads the immediates of the SIMD instruction op:
+// those of memory accesses, as read by readMemArg, followed by the lane index of
+// lane accesses, or the lane index of lane instructions. The 16 bytes of
+// v128.const and i8x16.shuffle are returned as two little-endian uint64
+// values.
+func readPrefixFDImmediates(r io.Reader, op SIMDOp) ([]interface{}, error) {
+	var immediates []interface{}
+	switch op.Kind {
+	case SIMDLoad, SIMDStore, SIMDLoadLane, SIMDStoreLane:
+		var err error
+		if immediates, err = readMemArg(r); err != nil {
+			return nil, err
+		}
+	case SIMDConst, SIMDShuffle:
+		var b [16]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return nil, err
+		}
+		return append(immediates, binary.LittleEndian.Uint64(b[:8]), binary.LittleEndian.Uint64(b[8:])), nil
+	}
+
+	switch op.Kind {
+	case SIMDLoadLane, SIMDStoreLane, SIMDExtractLane, SIMDReplaceLane:
+		lane, err := wasm.ReadByte(r)
+		if err != nil {
+			return nil, err
+		}
+		if int(lane) >= op.Lanes {
+			return nil, fmt.Errorf("disasm: invalid lane index %d", lane)
+		}
+		immediates = append(immediates, lane)
+	}
+	return immediates, nil
+}
+
+// readPrefixFEImmediates reads the immediates of the atomic instruction op,
+// those of memory accesses as read by readMemArg. The reserved byte of
+// atomic.fence is checked to be zero.
+func readPrefixFEImmediates(r io.Reader, op AtomicOp) ([]interface{}, error) {
+	if op.Kind == AtomicFence {
+		b, err := wasm.ReadByte(r)
+		if err != nil {
+			return nil, err
+		}
+		if b != 0x00 {
+			return nil, errors.New("disasm: invalid atomic.fence immediate")
+		}
+		return nil, nil
+	}
+	return readMemArg(r)
+}
+
+// readBlockType reads the type of a block, encoded as a signed 33-bit integer
+// which is either negative for the MVP block types or a type index.
+func readBlockType(r io.Reader) (interface{}, error) {
+	v, err := leb128.ReadVarint64(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if v >= 0 {
+		if v > math.MaxUint32 {
+			return nil, fmt.Errorf("disasm: invalid block type index %d", v)
+		}
+		return TypeIndex(v), nil
+	}
+
+	if v < -0x40 {
+		return nil, fmt.Errorf("disasm: invalid block type %d", v)
+	}
+	return wasm.BlockType(byte(v) & 0x7f), nil
+}
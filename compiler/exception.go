@@ -0,0 +1,163 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/go-interpreter/wagon/disasm"
+	"github.com/go-interpreter/wagon/wasm"
+)
+
+// ExceptionHandler describes a try block of a function compiled for the
+// interpreter. Start and End delimit the code of its body, and Catches holds
+// its catch clauses in order. Exceptions it does not catch are passed on to
+// the handler Parent of the same function, or to the caller if Parent is -1.
+// The parent of a try block ending with delegate is the handler it delegates
+// to.
+//
+// Handlers are numbered in the order their try blocks open, so that the
+// innermost handler of an instruction is the last one whose body holds it.
+type ExceptionHandler struct {
+	Start   int
+	End     int
+	Parent  int
+	Catches []CatchClause
+}
+
+// CatchClause is a catch clause of an exception handler. Tag is the index of
+// the tag it catches, or -1 for catch_all, and Target is the offset of the
+// catch instruction the execution resumes at.
+type CatchClause struct {
+	Tag    int
+	Target int
+}
+
+// isHandlerMarker tells whether ins is one of the markers delimiting the
+// bodies of try blocks, which serialize to no code.
+func isHandlerMarker(ins Instr) bool {
+	switch ins.Op {
+	case "try", "try_end", "delegate":
+		return true
+	}
+	return false
+}
+
+// tagParams returns the parameter types of a tag.
+func (c *SSAFunctionCompiler) tagParams(tag uint32) []wasm.ValueType {
+	if int(tag) >= len(c.Tags) {
+		panic(fmt.Errorf("invalid tag index %d", tag))
+	}
+	return c.Module.Types.Entries[c.Tags[tag]].ParamTypes
+}
+
+// enclosingHandler returns the handler of the innermost try block enclosing
+// the location at index i, i included, whose body holds the location, or -1
+// if there is none.
+func (c *SSAFunctionCompiler) enclosingHandler(i int) int64 {
+	for ; i >= 0; i-- {
+		if loc := c.Locations[i]; loc.TryBlock && !loc.Catching {
+			return int64(loc.Handler)
+		}
+	}
+	return -1
+}
+
+// compileTry opens a try block, emitting a marker holding its handler and
+// the handler of the enclosing try block.
+func (c *SSAFunctionCompiler) compileTry(ins disasm.Instr) {
+	loc := c.newBlockLocation(ins)
+	loc.StackDepth = len(c.Stack) - loc.NumParams
+	loc.TryBlock = true
+	loc.Handler = c.numHandlers
+	c.numHandlers++
+
+	parent := c.enclosingHandler(len(c.Locations) - 1)
+	c.Locations = append(c.Locations, loc)
+	c.Code = append(c.Code, buildInstr(0, "try", []int64{int64(loc.Handler), parent}, nil))
+}
+
+// compileCatch starts a catch or catch_all clause of the current try block.
+// The previous body or clause jumps to the end of the block, and the first
+// clause closes the body with a marker. The clause begins with a catch
+// instruction receiving the exception, whose payload is pushed like the
+// results of a call.
+func (c *SSAFunctionCompiler) compileCatch(ins disasm.Instr, wasUnreachable bool) {
+	loc := c.Locations[len(c.Locations)-1]
+	if !loc.TryBlock {
+		panic("expected try block")
+	}
+
+	var yieldValue TyValueID
+	if !wasUnreachable {
+		if len(c.Stack) != loc.StackDepth+loc.NumResults {
+			panic(fmt.Errorf("inconsistent stack pattern: nr = %d, ls = %d, sd = %d", loc.NumResults, len(c.Stack), loc.StackDepth))
+		}
+		yieldValue = c.YieldValues(c.PopStack(loc.NumResults))
+	}
+
+	loc.FixupList = append(loc.FixupList, FixupInfo{
+		CodePos: len(c.Code),
+	})
+	c.Code = append(c.Code, buildInstr(0, "jmp", []int64{-1}, []TyValueID{yieldValue}))
+	c.Stack = c.Stack[:loc.StackDepth] // unwind stack
+
+	if !loc.Catching {
+		c.Code = append(c.Code, buildInstr(0, "try_end", []int64{int64(loc.Handler)}, nil))
+		loc.Catching = true
+	}
+
+	tag := int64(-1)
+	var params []wasm.ValueType
+	if ins.Op.Name == "catch" {
+		tag = int64(ins.Immediates[0].(uint32))
+		params = c.tagParams(uint32(tag))
+	}
+
+	targetValueID := TyValueID(0)
+	if len(params) > 0 {
+		targetValueID = c.NextValueID()
+	}
+	c.Code = append(c.Code, buildInstr(targetValueID, "catch", []int64{int64(loc.Handler), tag}, nil))
+	c.pushCallResults(targetValueID, params)
+}
+
+// compileDelegate closes the body of the current try block, which passes the
+// exceptions it does not catch on to the try block enclosing the label of the
+// delegate instruction, the label being relative to the try block's parent.
+func (c *SSAFunctionCompiler) compileDelegate(ins disasm.Instr) {
+	loc := c.Locations[len(c.Locations)-1]
+	if !loc.TryBlock || loc.Catching {
+		panic("expected try block")
+	}
+
+	index := len(c.Locations) - 2 - int(ins.Immediates[0].(uint32))
+	if index < 0 {
+		panic(fmt.Errorf("invalid delegate label %d", ins.Immediates[0]))
+	}
+	c.Code = append(c.Code, buildInstr(0, "delegate", []int64{int64(loc.Handler), c.enclosingHandler(index)}, nil))
+}
+
+// compileThrow throws an exception of the given tag, its payload being
+// popped from the stack.
+func (c *SSAFunctionCompiler) compileThrow(ins disasm.Instr) {
+	tag := ins.Immediates[0].(uint32)
+	values := c.PopStack(NumSlots(c.tagParams(tag)))
+	if len(values) == 0 {
+		values = nil
+	}
+	c.Code = append(c.Code, buildInstr(0, "throw", []int64{int64(tag)}, values))
+}
+
+// compileRethrow throws again the exception caught by the catch clause of
+// the given label.
+func (c *SSAFunctionCompiler) compileRethrow(ins disasm.Instr) {
+	label := int(ins.Immediates[0].(uint32))
+	if label >= len(c.Locations) {
+		panic(fmt.Errorf("invalid rethrow label %d", label))
+	}
+
+	loc := c.Locations[len(c.Locations)-1-label]
+	if !loc.TryBlock || !loc.Catching {
+		panic(fmt.Errorf("rethrow label %d does not refer to a catch clause", label))
+	}
+	c.Code = append(c.Code, buildInstr(0, "rethrow", []int64{int64(loc.Handler)}, nil))
+}
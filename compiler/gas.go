@@ -2,24 +2,56 @@ package compiler
 
 func (c *SSAFunctionCompiler) InsertGasCounters(gp GasPolicy) {
 	cfg := c.NewCFGraph()
+	sgp, _ := gp.(ScaledGasPolicy)
 
 	for i := range cfg.Blocks {
 		totalCost := int64(1)
 
 		blk := &cfg.Blocks[i]
+		code := make([]Instr, 0, len(blk.Code)+1)
 		for _, ins := range blk.Code {
+			if isHandlerMarker(ins) {
+				code = append(code, ins)
+				continue
+			}
+
 			totalCost += gp.GetCost(ins)
 			if totalCost < 0 {
 				panic("total cost overflow")
 			}
+
+			// The length operand of bulk instructions is only known at run time.
+			if sgp != nil && isBulkInstr(ins) {
+				if cost := sgp.GetCostPerUnit(ins); cost > 0 {
+					code = append(code, buildInstr(0, "add_gas_scaled", []int64{cost}, []TyValueID{ins.Values[2]}))
+				}
+			}
+			code = append(code, ins)
 		}
 
 		if totalCost != 0 {
-			blk.Code = append([]Instr{
+			// Catch clauses start with the catch instruction, which the
+			// stack is unwound to.
+			pos := 0
+			if len(code) > 0 && code[0].Op == "catch" {
+				pos = 1
+			}
+			code = append(code[:pos], append([]Instr{
 				buildInstr(0, "add_gas", []int64{totalCost}, []TyValueID{}),
-			}, blk.Code...)
+			}, code[pos:]...)...)
 		}
+		blk.Code = code
 	}
 
 	c.Code = cfg.ToInsSeq()
 }
+
+// isBulkInstr tells whether ins is a bulk memory or table instruction taking
+// a length operand.
+func isBulkInstr(ins Instr) bool {
+	switch ins.Op {
+	case "memory.init", "memory.copy", "memory.fill", "table.init", "table.copy", "table.fill":
+		return true
+	}
+	return false
+}
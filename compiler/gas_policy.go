@@ -4,10 +4,23 @@ type GasPolicy interface {
 	GetCost(key Instr) int64
 }
 
+// ScaledGasPolicy may be implemented by gas policies to charge the bulk
+// memory and table instructions for each byte or element they write, in
+// addition to the cost returned by GetCost.
+type ScaledGasPolicy interface {
+	GasPolicy
+	GetCostPerUnit(key Instr) int64
+}
+
 type SimpleGasPolicy struct {
 	GasPerInstruction int64
+	GasPerUnit        int64 // cost of each byte or element written by bulk instructions
 }
 
 func (p *SimpleGasPolicy) GetCost(key Instr) int64 {
 	return p.GasPerInstruction
 }
+
+func (p *SimpleGasPolicy) GetCostPerUnit(key Instr) int64 {
+	return p.GasPerUnit
+}
@@ -2,44 +2,332 @@
 
 package compiler
 
-// FIXME: The current RegAlloc is based on wasm stack info and we probably
-// want a real one (in addition to this) with liveness analysis.
+import (
+	"container/heap"
+	"sort"
+)
+
+// liveRange is the range of positions over which a value is live, the hull of
+// its definitions, its uses and the blocks it is live across. Positions are
+// numbered in code order: instruction i reads its first operand at position
+// 2i, and reads its other operands and writes its result at position 2i+1, so
+// that its result may only reuse the register of its first operand.
+type liveRange struct {
+	Value      TyValueID
+	Start, End int
+}
+
+// RegAlloc assigns registers to the values of the function by linear scan
+// over their live ranges, reusing the registers of the values which are no
+// longer live. Register 0 is reserved for the absent values.
 // Returns the total number of registers used.
 func (c *SSAFunctionCompiler) RegAlloc() int {
-	regID := TyValueID(1)
-	valueRelocs := make(map[TyValueID]TyValueID)
+	ranges := c.NewCFGraph().liveRanges()
+	sort.Slice(ranges, func(i, j int) bool {
+		if ranges[i].Start != ranges[j].Start {
+			return ranges[i].Start < ranges[j].Start
+		}
+		return ranges[i].Value < ranges[j].Value
+	})
 
-	for _, values := range c.StackValueSets {
-		for _, v := range values {
-			valueRelocs[v] = regID
+	numValues := 1
+	for _, r := range ranges {
+		if int(r.Value) >= numValues {
+			numValues = int(r.Value) + 1
 		}
+	}
+
+	valueRelocs := make([]TyValueID, numValues)
+	active := &activeRanges{}
+	free := &freeRegs{}
+	numRegs := 1
 
-		regID++
+	for _, r := range ranges {
+		for active.Len() > 0 && active.ranges[0].End < r.Start {
+			heap.Push(free, valueRelocs[heap.Pop(active).(liveRange).Value])
+		}
+
+		var reg TyValueID
+		if free.Len() > 0 {
+			reg = heap.Pop(free).(TyValueID)
+		} else {
+			reg = TyValueID(numRegs)
+			numRegs++
+		}
+		valueRelocs[r.Value] = reg
+		heap.Push(active, r)
 	}
 
 	for i := range c.Code {
 		ins := &c.Code[i]
 
 		if ins.Target != 0 {
-			if reg, ok := valueRelocs[ins.Target]; ok {
-				ins.Target = reg
-			} else {
-				panic("Register not found for target")
+			ins.Target = valueRelocs[ins.Target]
+		}
+
+		// Operands may share their backing arrays with other instructions.
+		if len(ins.Values) > 0 {
+			values := make([]TyValueID, len(ins.Values))
+			for j, v := range ins.Values {
+				if v != 0 {
+					values[j] = valueRelocs[v]
+				}
+			}
+			ins.Values = values
+		}
+	}
+
+	return numRegs
+}
+
+// liveRanges computes the live ranges of the values of the function whose
+// basic blocks are those of g, in code order.
+//
+// A value is live at the entry of a block if it is used in the block before
+// being defined, or if it is live at the exit of the block and not defined in
+// it. It is live at the exit of a block if it is live at the entry of one of
+// its successors, which include the catch clauses of the try blocks whose
+// bodies hold the instructions of the block, as these may throw.
+func (g *CFGraph) liveRanges() []liveRange {
+	starts := make([]int, len(g.Blocks)) // position of the first instruction of each block
+	ends := make([]int, len(g.Blocks))   // position of the jump ending each block
+	pos := 0
+	for i, bb := range g.Blocks {
+		starts[i] = pos
+		pos += len(bb.Code)
+		ends[i] = pos
+		pos++
+	}
+
+	preds := make([][]int, len(g.Blocks))
+	for i, succs := range g.successors() {
+		for _, succ := range succs {
+			preds[succ] = append(preds[succ], i)
+		}
+	}
+
+	numValues := 1
+	bump := func(v TyValueID) {
+		if int(v) >= numValues {
+			numValues = int(v) + 1
+		}
+	}
+	for _, bb := range g.Blocks {
+		for _, ins := range bb.Code {
+			bump(ins.Target)
+			for _, v := range ins.Values {
+				bump(v)
+			}
+		}
+		bump(bb.JmpCond)
+		bump(bb.YieldValue)
+		for _, v := range bb.ReturnValues {
+			bump(v)
+		}
+	}
+
+	ranges := make([]liveRange, numValues)
+	for v := range ranges {
+		ranges[v] = liveRange{Value: TyValueID(v), Start: -1}
+	}
+	defBlocks := make([]int, numValues) // block defining each value, last first
+	for v := range defBlocks {
+		defBlocks[v] = -1
+	}
+	moreDefBlocks := make(map[TyValueID][]int) // other blocks defining a value
+	defines := func(v TyValueID, block int) bool {
+		if defBlocks[v] == block {
+			return true
+		}
+		for _, b := range moreDefBlocks[v] {
+			if b == block {
+				return true
+			}
+		}
+		return false
+	}
+
+	type liveIn struct {
+		Value TyValueID
+		Block int
+	}
+	var liveIns []liveIn // uses of values before their definition in a block
+
+	occur := func(v TyValueID, p int) {
+		r := &ranges[v]
+		if r.Start < 0 {
+			r.Start, r.End = p, p
+		}
+		if p < r.Start {
+			r.Start = p
+		}
+		if p > r.End {
+			r.End = p
+		}
+	}
+	use := func(v TyValueID, p int, block int) {
+		if v == 0 {
+			return
+		}
+		occur(v, p)
+		if defBlocks[v] != block {
+			if n := len(liveIns); n == 0 || liveIns[n-1] != (liveIn{v, block}) {
+				liveIns = append(liveIns, liveIn{v, block})
 			}
 		}
+	}
 
-		for j, v := range ins.Values {
-			if v != 0 {
-				if reg, ok := valueRelocs[v]; ok {
-					ins.Values[j] = reg
+	for i, bb := range g.Blocks {
+		for j, ins := range bb.Code {
+			p := 2 * (starts[i] + j)
+			for k, v := range ins.Values {
+				if k == 0 {
+					use(v, p, i)
 				} else {
-					panic("Register not found for value")
+					use(v, p+1, i)
+				}
+			}
+			if v := ins.Target; v != 0 {
+				occur(v, p+1)
+				if defBlocks[v] >= 0 && defBlocks[v] != i {
+					moreDefBlocks[v] = append(moreDefBlocks[v], defBlocks[v])
+				}
+				defBlocks[v] = i
+			}
+		}
+
+		p := 2 * ends[i]
+		use(bb.JmpCond, p, i)
+		use(bb.YieldValue, p, i)
+		for _, v := range bb.ReturnValues {
+			use(v, p, i)
+		}
+	}
+
+	// Values are propagated backwards from the blocks they are live at the
+	// entry of, until the blocks defining them.
+	sort.SliceStable(liveIns, func(i, j int) bool {
+		return liveIns[i].Value < liveIns[j].Value
+	})
+	visited := make([]TyValueID, len(g.Blocks))
+	var work []int
+	for i := 0; i < len(liveIns); {
+		v := liveIns[i].Value
+		r := &ranges[v]
+		work = work[:0]
+		for ; i < len(liveIns) && liveIns[i].Value == v; i++ {
+			if b := liveIns[i].Block; visited[b] != v {
+				visited[b] = v
+				work = append(work, b)
+			}
+		}
+
+		for len(work) > 0 {
+			b := work[len(work)-1]
+			work = work[:len(work)-1]
+			if p := 2 * starts[b]; p < r.Start {
+				r.Start = p
+			}
+
+			for _, pred := range preds[b] {
+				if p := 2*ends[pred] + 1; p > r.End {
+					r.End = p
+				}
+				if visited[pred] == v || defines(v, pred) {
+					continue
+				}
+				visited[pred] = v
+				work = append(work, pred)
+			}
+		}
+	}
+
+	ret := make([]liveRange, 0, len(ranges))
+	for _, r := range ranges {
+		if r.Start >= 0 {
+			ret = append(ret, r)
+		}
+	}
+	return ret
+}
+
+// successors returns the successors of each block of g: the targets of its
+// jump, and the catch clauses which may receive the exceptions thrown by its
+// instructions. These are the clauses of the innermost try block whose body
+// holds the instruction, and of the handlers it passes exceptions on to.
+func (g *CFGraph) successors() [][]int {
+	parents := make(map[int]int)
+	catches := make(map[int][]int)
+	for i, bb := range g.Blocks {
+		for _, ins := range bb.Code {
+			switch ins.Op {
+			case "try", "delegate":
+				parents[int(ins.Immediates[0])] = int(ins.Immediates[1])
+			case "catch":
+				catches[int(ins.Immediates[0])] = append(catches[int(ins.Immediates[0])], i)
+			}
+		}
+	}
+
+	ret := make([][]int, len(g.Blocks))
+	var handlers []int // try blocks whose bodies are open, innermost last
+	for i, bb := range g.Blocks {
+		ret[i] = append(ret[i], bb.JmpTargets...)
+
+		reached := make(map[int]struct{})
+		for _, ins := range bb.Code {
+			switch ins.Op {
+			case "try":
+				handlers = append(handlers, int(ins.Immediates[0]))
+				continue
+			case "try_end", "delegate":
+				if len(handlers) > 0 {
+					handlers = handlers[:len(handlers)-1]
 				}
+				continue
+			}
+
+			if len(handlers) == 0 {
+				continue
+			}
+			for h := handlers[len(handlers)-1]; h >= 0; h = parents[h] {
+				if _, ok := reached[h]; ok {
+					break
+				}
+				reached[h] = struct{}{}
+				ret[i] = append(ret[i], catches[h]...)
 			}
 		}
 	}
+	return ret
+}
+
+// activeRanges is a heap of the live ranges holding a register, by end.
+type activeRanges struct {
+	ranges []liveRange
+}
+
+func (a *activeRanges) Len() int           { return len(a.ranges) }
+func (a *activeRanges) Less(i, j int) bool { return a.ranges[i].End < a.ranges[j].End }
+func (a *activeRanges) Swap(i, j int)      { a.ranges[i], a.ranges[j] = a.ranges[j], a.ranges[i] }
+func (a *activeRanges) Push(x interface{}) { a.ranges = append(a.ranges, x.(liveRange)) }
+func (a *activeRanges) Pop() interface{} {
+	r := a.ranges[len(a.ranges)-1]
+	a.ranges = a.ranges[:len(a.ranges)-1]
+	return r
+}
+
+// freeRegs is a heap of the registers available for reuse, lowest first.
+type freeRegs []TyValueID
 
-	return int(regID)
+func (f freeRegs) Len() int            { return len(f) }
+func (f freeRegs) Less(i, j int) bool  { return f[i] < f[j] }
+func (f freeRegs) Swap(i, j int)       { f[i], f[j] = f[j], f[i] }
+func (f *freeRegs) Push(x interface{}) { *f = append(*f, x.(TyValueID)) }
+func (f *freeRegs) Pop() interface{} {
+	reg := (*f)[len(*f)-1]
+	*f = (*f)[:len(*f)-1]
+	return reg
 }
 
 func (ins *Instr) BranchTargets() []int {
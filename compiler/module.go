@@ -3,6 +3,7 @@ package compiler
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"strings"
 
 	"github.com/go-interpreter/wagon/disasm"
@@ -17,19 +18,67 @@ type Module struct {
 	Base                 *wasm.Module
 	FunctionNames        map[int]string
 	DisableFloatingPoint bool
+	DisableSIMD          bool
+
+	// Optimizations selects the optimization passes run over the compiled
+	// code of each function.
+	Optimizations Optimizations
+
+	// DataSegments and ElemSegments hold all the data and element segments
+	// in index order, including the passive ones Base does not know about.
+	DataSegments []DataSegment
+	ElemSegments []ElemSegment
+
+	// TableTypes holds the element types of the imported and declared
+	// tables, in index order. Base describes all tables as funcref tables.
+	TableTypes []wasm.ValueType
+
+	// V128Globals holds the v128 globals declared by the module, in index
+	// order. Base describes them as globals initialized with the low half of
+	// their value, the high half being held by a global following all the
+	// globals of the module.
+	V128Globals []V128Global
+
+	// MemoryTypes holds the types of the imported and declared memories, in
+	// index order. Base describes them as unshared 32-bit memories, whose
+	// sizes are clamped to 65536 pages.
+	MemoryTypes []MemoryType
+
+	// Tags holds the type indices of the parameters of the imported and
+	// declared tags, in index order. TagImports describes the imported
+	// ones, and TagExports maps the names of the exported tags to their
+	// indices. Base knows about none of them.
+	Tags       []uint32
+	TagImports []TagImport
+	TagExports map[string]uint32
 }
 
+// V128Global is a v128 global declared by a module.
+type V128Global struct {
+	Index int   // index of the global, which holds the low half of the value
+	High  int64 // high half of the initial value of the global
+}
+
+// InterpreterCode is the code of a function compiled for the interpreter.
+// Its numbers of parameters, locals and results are numbers of value slots,
+// v128 values taking two slots.
 type InterpreterCode struct {
 	NumRegs    int
 	NumParams  int
 	NumLocals  int
 	NumReturns int
 	Bytes      []byte
+	Handlers   []ExceptionHandler
 	JITInfo    interface{}
 	JITDone    bool
 }
 
 func LoadModule(raw []byte) (*Module, error) {
+	raw, ext, err := rewriteSections(raw)
+	if err != nil {
+		return nil, err
+	}
+
 	reader := bytes.NewReader(raw)
 
 	m, err := wasm.ReadModule(reader, nil)
@@ -108,18 +157,149 @@ func LoadModule(raw []byte) (*Module, error) {
 		}
 	}
 
+	v128Globals := ext.V128Globals
+	if numImported := numImportedGlobals(m); numImported != 0 {
+		for i := range v128Globals {
+			v128Globals[i].Index += numImported
+		}
+	}
+
+	tags := make([]uint32, 0, len(ext.TagImports)+len(ext.Tags))
+	for _, imp := range ext.TagImports {
+		tags = append(tags, imp.Type)
+	}
+	tags = append(tags, ext.Tags...)
+	for _, typeID := range tags {
+		if m.Types == nil || int(typeID) >= len(m.Types.Entries) {
+			return nil, fmt.Errorf("invalid tag type index %d", typeID)
+		}
+		if len(m.Types.Entries[typeID].ReturnTypes) != 0 {
+			return nil, fmt.Errorf("type %d of tag must not have results", typeID)
+		}
+	}
+	for i, seg := range ext.DataSegments {
+		if seg.Offset != nil && int(seg.MemoryIndex) >= len(ext.MemoryTypes) {
+			return nil, fmt.Errorf("data segment %d: invalid memory index %d", i, seg.MemoryIndex)
+		}
+	}
+	for name, index := range ext.TagExports {
+		if int(index) >= len(tags) {
+			return nil, fmt.Errorf("export %s: invalid tag index %d", name, index)
+		}
+	}
+
 	return &Module{
 		Base:          m,
 		FunctionNames: functionNames,
+		DataSegments:  ext.DataSegments,
+		ElemSegments:  ext.ElemSegments,
+		TableTypes:    ext.TableTypes,
+		V128Globals:   v128Globals,
+		MemoryTypes:   ext.MemoryTypes,
+		Tags:          tags,
+		TagImports:    ext.TagImports,
+		TagExports:    ext.TagExports,
 	}, nil
 }
 
-func (m *Module) CompileWithNGen(gp GasPolicy, numGlobals uint64) (string, error) {
-	var (
-		out    string
-		retErr error
-	)
+// TagParams returns the parameter types of the tag `index`.
+func (m *Module) TagParams(index int) []wasm.ValueType {
+	return m.Base.Types.Entries[m.Tags[index]].ParamTypes
+}
+
+// UsesSharedMemory tells whether the module imports or declares a shared
+// memory, which AOT-compiled code does not support.
+func (m *Module) UsesSharedMemory() bool {
+	for _, t := range m.MemoryTypes {
+		if t.Shared {
+			return true
+		}
+	}
+	return false
+}
+
+// UsesExceptionHandling tells whether the module imports or declares tags, or
+// has functions holding try blocks, which AOT-compiled code does not support.
+func (m *Module) UsesExceptionHandling() bool {
+	if len(m.Tags) != 0 {
+		return true
+	}
+
+	for i := range m.Base.FunctionIndexSpace {
+		instrs, err := Disassemble(m.Base.FunctionIndexSpace[i].Body.Code)
+		if err != nil {
+			return false // reported by the compilers
+		}
+		for _, ins := range instrs {
+			if ins.Op.Name == "try" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func numImportedGlobals(m *wasm.Module) int {
+	n := 0
+	if m.Import != nil {
+		for _, e := range m.Import.Entries {
+			if e.Type.Kind() == wasm.ExternalGlobal {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// globalHighs returns the indices of the globals holding the high halves of
+// the v128 globals, by index of the v128 globals.
+func (m *Module) globalHighs() map[int]int {
+	numGlobals := numImportedGlobals(m.Base) + len(m.Base.GlobalIndexSpace)
+	ret := make(map[int]int, len(m.V128Globals))
+	for i, g := range m.V128Globals {
+		ret[g.Index] = numGlobals + i
+	}
+	return ret
+}
+
+// newFunctionCompiler returns a compiler for the function f, which is not an
+// import.
+func (m *Module) newFunctionCompiler(f *wasm.Function, code []disasm.Instr, numFuncImports int, globalHighs map[int]int) *SSAFunctionCompiler {
+	d := disasm.Disassembly{
+		Code:     code,
+		MaxDepth: 512,
+	}
+
+	compiler := NewSSAFunctionCompiler(m.Base, &d)
+	compiler.CallIndexOffset = numFuncImports
+	compiler.ReturnTypes = f.Sig.ReturnTypes
+	compiler.LocalTypes = append([]wasm.ValueType{}, f.Sig.ParamTypes...)
+	for _, v := range f.Body.Locals {
+		for i := uint32(0); i < v.Count; i++ {
+			compiler.LocalTypes = append(compiler.LocalTypes, v.Type)
+		}
+	}
+	compiler.GlobalHighs = globalHighs
+	compiler.NumDataSegments = len(m.DataSegments)
+	compiler.NumElemSegments = len(m.ElemSegments)
+	compiler.NumTables = len(m.TableTypes)
+	compiler.MemoryTypes = m.MemoryTypes
+	compiler.Tags = m.Tags
+	return compiler
+}
+
+// filter applies the restrictions of the module to the compiled code of a
+// function.
+func (m *Module) filter(compiler *SSAFunctionCompiler) {
+	if m.DisableFloatingPoint {
+		compiler.FilterFloatingPoint()
+	}
+	if m.DisableSIMD {
+		compiler.FilterSIMD()
+	}
+}
 
+func (m *Module) CompileWithNGen(gp GasPolicy, numGlobals uint64) (out string, retErr error) {
 	defer utils.CatchPanic(&retErr)
 
 	importStubBuilder := &strings.Builder{}
@@ -136,25 +316,27 @@ func (m *Module) CompileWithNGen(gp GasPolicy, numGlobals uint64) (string, error
 			tyID := e.Type.(wasm.FuncImport).Type
 			ty := &m.Base.Types.Entries[int(tyID)]
 
+			numParams := NumSlots(ty.ParamTypes)
+
 			bSprintf(importStubBuilder, "uint64_t %s%d(struct VirtualMachine *vm", NGEN_FUNCTION_PREFIX, i)
 
-			for j := 0; j < len(ty.ParamTypes); j++ {
+			for j := 0; j < numParams; j++ {
 				bSprintf(importStubBuilder, ",uint64_t %s%d", NGEN_LOCAL_PREFIX, j)
 			}
 
 			importStubBuilder.WriteString(") {\n")
 			importStubBuilder.WriteString("uint64_t params[] = {")
 
-			for j := 0; j < len(ty.ParamTypes); j++ {
+			for j := 0; j < numParams; j++ {
 				bSprintf(importStubBuilder, "%s%d", NGEN_LOCAL_PREFIX, j)
 
-				if j != len(ty.ParamTypes)-1 {
+				if j != numParams-1 {
 					importStubBuilder.WriteByte(',')
 				}
 			}
 
 			importStubBuilder.WriteString("};\n")
-			bSprintf(importStubBuilder, "return %sinvoke_import(vm, %d, %d, params);\n", NGEN_ENV_API_PREFIX, numFuncImports, len(ty.ParamTypes))
+			bSprintf(importStubBuilder, "return %sinvoke_import(vm, %d, %d, params);\n", NGEN_ENV_API_PREFIX, numFuncImports, numParams)
 			importStubBuilder.WriteString("}\n")
 
 			importTypeIDs = append(importTypeIDs, int(tyID))
@@ -163,52 +345,38 @@ func (m *Module) CompileWithNGen(gp GasPolicy, numGlobals uint64) (string, error
 	}
 
 	out += importStubBuilder.String()
+	globalHighs := m.globalHighs()
 
-	for i, f := range m.Base.FunctionIndexSpace {
+	for i := range m.Base.FunctionIndexSpace {
+		f := &m.Base.FunctionIndexSpace[i]
 		//fmt.Printf("Compiling function %d (%+v) with %d locals\n", i, f.Sig, len(f.Body.Locals))
-		instrs, err := disasm.Disassemble(f.Body.Code)
+		instrs, err := Disassemble(f.Body.Code)
 		if err != nil {
 			panic(err)
 		}
 
-		d := disasm.Disassembly{
-			Code:     instrs,
-			MaxDepth: 512,
-		}
-		compiler := NewSSAFunctionCompiler(m.Base, &d)
-		compiler.CallIndexOffset = numFuncImports
-
+		compiler := m.newFunctionCompiler(f, instrs, numFuncImports, globalHighs)
 		compiler.Compile(importTypeIDs)
-
-		if m.DisableFloatingPoint {
-			compiler.FilterFloatingPoint()
-		}
+		m.filter(compiler)
 
 		if gp != nil {
 			compiler.InsertGasCounters(gp)
 		}
+		compiler.Optimize(m.Optimizations)
 		//fmt.Println(compiler.Code)
 		//fmt.Printf("%+v\n", compiler.NewCFGraph())
 		//numRegs := compiler.RegAlloc()
 		//fmt.Println(compiler.Code)
-		numLocals := 0
-
-		for _, v := range f.Body.Locals {
-			numLocals += int(v.Count)
-		}
+		numParams := NumSlots(f.Sig.ParamTypes)
+		numLocals := NumSlots(compiler.LocalTypes) - numParams
 
-		out += compiler.NGen(uint64(numFuncImports+i), uint64(len(f.Sig.ParamTypes)), uint64(numLocals), numGlobals)
+		out += compiler.NGen(uint64(numFuncImports+i), uint64(numParams), uint64(numLocals), numGlobals)
 	}
 
 	return out, retErr
 }
 
-func (m *Module) CompileForInterpreter(gp GasPolicy) ([]InterpreterCode, error) {
-	var (
-		ret    []InterpreterCode
-		retErr error
-	)
-
+func (m *Module) CompileForInterpreter(gp GasPolicy) (ret []InterpreterCode, retErr error) {
 	defer utils.CatchPanic(&retErr)
 
 	importTypeIDs := make([]int, 0)
@@ -243,9 +411,9 @@ func (m *Module) CompileForInterpreter(gp GasPolicy) ([]InterpreterCode, error)
 
 			ret = append(ret, InterpreterCode{
 				NumRegs:    2,
-				NumParams:  len(ty.ParamTypes),
+				NumParams:  NumSlots(ty.ParamTypes),
 				NumLocals:  0,
-				NumReturns: len(ty.ReturnTypes),
+				NumReturns: NumSlots(ty.ReturnTypes),
 				Bytes:      code,
 			})
 
@@ -256,46 +424,38 @@ func (m *Module) CompileForInterpreter(gp GasPolicy) ([]InterpreterCode, error)
 
 	numFuncImports := len(ret)
 	ret = append(ret, make([]InterpreterCode, len(m.Base.FunctionIndexSpace))...)
+	globalHighs := m.globalHighs()
 
-	for i, f := range m.Base.FunctionIndexSpace {
+	for i := range m.Base.FunctionIndexSpace {
+		f := &m.Base.FunctionIndexSpace[i]
 		//fmt.Printf("Compiling function %d (%+v) with %d locals\n", i, f.Sig, len(f.Body.Locals))
-		instrs, err := disasm.Disassemble(f.Body.Code)
+		instrs, err := Disassemble(f.Body.Code)
 		if err != nil {
 			panic(err)
 		}
 
-		d := disasm.Disassembly{
-			Code:     instrs,
-			MaxDepth: 512,
-		}
-
-		compiler := NewSSAFunctionCompiler(m.Base, &d)
-		compiler.CallIndexOffset = numFuncImports
+		compiler := m.newFunctionCompiler(f, instrs, numFuncImports, globalHighs)
 		compiler.Compile(importTypeIDs)
-
-		if m.DisableFloatingPoint {
-			compiler.FilterFloatingPoint()
-		}
+		m.filter(compiler)
 
 		if gp != nil {
 			compiler.InsertGasCounters(gp)
 		}
+		compiler.Optimize(m.Optimizations)
 		//fmt.Println(compiler.Code)
 		//fmt.Printf("%+v\n", compiler.NewCFGraph())
 		numRegs := compiler.RegAlloc()
 		//fmt.Println(compiler.Code)
-		numLocals := 0
-
-		for _, v := range f.Body.Locals {
-			numLocals += int(v.Count)
-		}
+		numParams := NumSlots(f.Sig.ParamTypes)
+		code := compiler.Serialize()
 
 		ret[numFuncImports+i] = InterpreterCode{
 			NumRegs:    numRegs,
-			NumParams:  len(f.Sig.ParamTypes),
-			NumLocals:  numLocals,
-			NumReturns: len(f.Sig.ReturnTypes),
-			Bytes:      compiler.Serialize(),
+			NumParams:  numParams,
+			NumLocals:  NumSlots(compiler.LocalTypes) - numParams,
+			NumReturns: NumSlots(f.Sig.ReturnTypes),
+			Bytes:      code,
+			Handlers:   compiler.Handlers,
 		}
 	}
 
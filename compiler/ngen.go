@@ -14,13 +14,19 @@ const NGEN_HEADER = `
 //static const uint64_t UINT32_MASK = 0xffffffffull;
 struct VirtualMachine;
 typedef uint64_t (*ExternalFunction)(struct VirtualMachine *vm, uint64_t import_id, uint64_t num_params, uint64_t *params);
+struct Memory {
+	uint64_t size;
+	uint8_t *data;
+};
 struct VirtualMachine {
 	void (*throw_s)(struct VirtualMachine *vm, const char *s);
 	ExternalFunction (*resolve_import)(struct VirtualMachine *vm, const char *module_name, const char *field_name);
 	uint64_t mem_size;
 	uint8_t *mem;
-	void (*grow_memory)(struct VirtualMachine *vm, uint64_t inc_size);
+	int (*grow_memory)(struct VirtualMachine *vm, uint64_t index, uint64_t inc_size); // 0 if the memory cannot grow
 	void *userdata;
+	struct Memory *memories; // memories after the first one, from index 1
+	uint64_t num_memories;
 };
 
 #define V_uint32_t vu32
@@ -30,6 +36,18 @@ struct VirtualMachine {
 #define V_float vf32
 #define V_double vf64
 
+// Tail calls to functions taking as many parameters as the caller are
+// guaranteed where supported; the others are left to sibling call
+// optimization.
+#if defined(__has_attribute)
+#if __has_attribute(musttail)
+#define MUST_TAIL_CALL __attribute__((musttail))
+#endif
+#endif
+#ifndef MUST_TAIL_CALL
+#define MUST_TAIL_CALL
+#endif
+
 union Value {
 	uint32_t vu32;
 	uint64_t vu64;
@@ -38,12 +56,43 @@ union Value {
 	float vf32;
 	double vf64;
 };
-static uint8_t * __attribute__((always_inline)) mem_translate(struct VirtualMachine *vm, union Value start, uint32_t offset, uint32_t size) {
-	start.vu32 += offset;
-	#ifndef POLYMERASE_NO_MEM_BOUND_CHECK
-	if(start.vu32 + size < start.vu32 || start.vu32 + size > vm->mem_size) vm->throw_s(vm, "memory access out of bounds");
+static uint64_t __attribute__((always_inline)) memory_size(struct VirtualMachine *vm, uint32_t index) {
+	return index == 0 ? vm->mem_size : vm->memories[index].size;
+}
+static uint8_t * __attribute__((always_inline)) memory_data(struct VirtualMachine *vm, uint32_t index) {
+	return index == 0 ? vm->mem : vm->memories[index].data;
+}
+static int __attribute__((always_inline)) mem_in_bounds(struct VirtualMachine *vm, uint32_t index, uint64_t start, uint64_t n) {
+	return start + n >= start && start + n <= memory_size(vm, index);
+}
+// Accesses to the first memory at 32-bit addresses and offsets are not checked
+// by runtimes guarding the 8GiB following it.
+static uint8_t * __attribute__((always_inline)) mem_translate(struct VirtualMachine *vm, uint32_t index, uint64_t start, uint64_t offset, uint32_t size) {
+	uint64_t addr = start + offset;
+	#ifdef POLYMERASE_NO_MEM_BOUND_CHECK
+	if(index == 0 && start <= UINT32_MAX && offset <= UINT32_MAX) return &vm->mem[addr];
 	#endif
-	return &vm->mem[start.vu32];
+	if(addr < start || !mem_in_bounds(vm, index, addr, size)) vm->throw_s(vm, "memory access out of bounds");
+	return &memory_data(vm, index)[addr];
+}
+static uint64_t __attribute__((always_inline)) mem_grow(struct VirtualMachine *vm, uint32_t index, uint64_t n) {
+	uint64_t pages = memory_size(vm, index) / 65536;
+	if(n > UINT64_MAX / 65536 - pages || !vm->grow_memory(vm, index, n * 65536)) return (uint64_t) -1;
+	return pages;
+}
+static void __attribute__((always_inline)) mem_copy(struct VirtualMachine *vm, uint32_t dst, uint32_t src, uint64_t d, uint64_t s, uint64_t n) {
+	if(!mem_in_bounds(vm, src, s, n) || !mem_in_bounds(vm, dst, d, n)) vm->throw_s(vm, "memory access out of bounds");
+	__builtin_memmove(&memory_data(vm, dst)[d], &memory_data(vm, src)[s], n);
+}
+static uint8_t * __attribute__((always_inline)) atomic_translate(struct VirtualMachine *vm, uint32_t index, uint64_t start, uint64_t offset, uint32_t size) {
+	uint64_t addr = start + offset;
+	if(addr < start || !mem_in_bounds(vm, index, addr, size)) vm->throw_s(vm, "memory access out of bounds");
+	if(addr % size != 0) vm->throw_s(vm, "unaligned atomic");
+	return &memory_data(vm, index)[addr];
+}
+static void __attribute__((always_inline)) mem_fill(struct VirtualMachine *vm, uint32_t index, uint64_t d, uint8_t val, uint64_t n) {
+	if(!mem_in_bounds(vm, index, d, n)) vm->throw_s(vm, "memory access out of bounds");
+	__builtin_memset(&memory_data(vm, index)[d], val, n);
 }
 static uint64_t __attribute__((always_inline)) clz32(uint32_t x) {
 	return __builtin_clz(x);
@@ -105,6 +154,32 @@ static double __attribute__((always_inline)) fneg64(double x) {
 	return -x;
 }
 
+static uint64_t __attribute__((always_inline)) trunc_sat_i32_s(double x) {
+	if(x != x) return 0;
+	if(x <= -2147483648.0) return (uint32_t) INT32_MIN;
+	if(x >= 2147483647.0) return INT32_MAX;
+	return (uint32_t) (int32_t) x;
+}
+
+static uint64_t __attribute__((always_inline)) trunc_sat_i32_u(double x) {
+	if(!(x > -1.0)) return 0;
+	if(x >= 4294967295.0) return UINT32_MAX;
+	return (uint32_t) x;
+}
+
+static uint64_t __attribute__((always_inline)) trunc_sat_i64_s(double x) {
+	if(x != x) return 0;
+	if(x <= -9223372036854775808.0) return (uint64_t) INT64_MIN;
+	if(x >= 9223372036854775808.0) return INT64_MAX;
+	return (uint64_t) (int64_t) x;
+}
+
+static uint64_t __attribute__((always_inline)) trunc_sat_i64_u(double x) {
+	if(!(x > -1.0)) return 0;
+	if(x >= 18446744073709551616.0) return UINT64_MAX;
+	return (uint64_t) x;
+}
+
 #define fsqrt32 sqrtf
 #define fsqrt64 sqrt
 #define fceil32 ceilf
@@ -125,6 +200,18 @@ func bSprintf(builder *strings.Builder, format string, args ...interface{}) { //
 	builder.WriteString(fmt.Sprintf(format, args...))
 }
 
+// writeTailCallReturn opens the block returning the result of a tail call
+// passing numArgs arguments from a function taking numParams parameters. The
+// block keeps the attribute of the return statement from applying to the
+// label of the instruction.
+func writeTailCallReturn(b *strings.Builder, numArgs int, numParams uint64) {
+	b.WriteString("{ ")
+	if uint64(numArgs) == numParams {
+		b.WriteString("MUST_TAIL_CALL ")
+	}
+	b.WriteString("return ")
+}
+
 func writeDivZeroRvCheck(b *strings.Builder, ins Instr) {
 	bSprintf(b, "if(%s%d.vu64 == 0) vm->throw_s(vm, \"divide by zero\"); ", NGEN_VALUE_PREFIX, ins.Values[1]) // TODO: fix
 }
@@ -146,6 +233,15 @@ func writeUnOp_Fcall(b *strings.Builder, ins Instr, f string, ty string, retTy s
 	)
 }
 
+func writeSignExtend(b *strings.Builder, ins Instr, fromTy string, ty string) {
+	bSprintf(b,
+		"%s%d.vu64 = (%s) (%s) %s%d.V_%s;",
+		NGEN_VALUE_PREFIX, ins.Target,
+		ty, fromTy,
+		NGEN_VALUE_PREFIX, ins.Values[0], ty,
+	)
+}
+
 func writeBinOp_Shift(b *strings.Builder, ins Instr, op string, ty string, rounding uint64) {
 	bSprintf(b,
 		"%s%d.vu64 = (%s%d.V_%s) %s (%s%d.V_%s %% %d);",
@@ -191,23 +287,37 @@ func writeBinOp(b *strings.Builder, ins Instr, op string, ty string) {
 	writeBinOp2(b, ins, op, ty, ty)
 }
 
-func writeMemLoad(b *strings.Builder, ins Instr, ty string) {
+// memAddress returns the address operand `value` of an instruction accessing
+// the memory `memory`, as an i32 or an i64 value.
+func (c *SSAFunctionCompiler) memAddress(memory int64, value TyValueID) string {
+	if c.MemoryTypes[memory].Memory64 {
+		return fmt.Sprintf("%s%d.vu64", NGEN_VALUE_PREFIX, value)
+	}
+	return fmt.Sprintf("%s%d.vu32", NGEN_VALUE_PREFIX, value)
+}
+
+// memArgs returns the memory index, address and offset arguments passed to
+// mem_translate and atomic_translate by the memory access ins, whose
+// immediates are those of memArg and whose address is its first operand.
+func (c *SSAFunctionCompiler) memArgs(ins Instr) string {
+	return fmt.Sprintf("%d, %s, %dull", ins.Immediates[2], c.memAddress(ins.Immediates[2], ins.Values[0]), uint64(ins.Immediates[1]))
+}
+
+func (c *SSAFunctionCompiler) writeMemLoad(b *strings.Builder, ins Instr, ty string) {
 	bSprintf(b,
-		"%s%d.vi64 = * (%s *) mem_translate(vm, %s%d, %du, sizeof(%s));", // TODO: any missing conversions?
+		"%s%d.vi64 = * (%s *) mem_translate(vm, %s, sizeof(%s));", // TODO: any missing conversions?
 		NGEN_VALUE_PREFIX, ins.Target,
 		ty,
-		NGEN_VALUE_PREFIX, ins.Values[0],
-		uint64(ins.Immediates[1]),
+		c.memArgs(ins),
 		ty,
 	)
 }
 
-func writeMemStore(b *strings.Builder, ins Instr, ty string) {
+func (c *SSAFunctionCompiler) writeMemStore(b *strings.Builder, ins Instr, ty string) {
 	bSprintf(b,
-		"* (%s *) mem_translate(vm, %s%d, %du, sizeof(%s)) = %s%d.vu64;",
+		"* (%s *) mem_translate(vm, %s, sizeof(%s)) = %s%d.vu64;",
 		ty,
-		NGEN_VALUE_PREFIX, ins.Values[0],
-		uint64(ins.Immediates[1]),
+		c.memArgs(ins),
 		ty,
 		NGEN_VALUE_PREFIX, ins.Values[1],
 	)
@@ -238,10 +348,15 @@ func (c *SSAFunctionCompiler) NGen(selfID uint64, numParams uint64, numLocals ui
 		switch ins.Op {
 		case "unreachable":
 			bSprintf(body, "vm->throw_s(vm, \"unreachable executed\");")
+		case "try", "try_end", "delegate", "catch", "throw", "rethrow":
+			panic("exception handling is not supported by AOT-compiled code")
 		case "return":
 			if len(ins.Values) == 0 {
 				body.WriteString("return 0;")
 			} else {
+				for j := 1; j < len(ins.Values); j++ {
+					bSprintf(body, "%syielded[%d] = %s%d.vu64; ", NGEN_ENV_API_PREFIX, j-1, NGEN_VALUE_PREFIX, ins.Values[j])
+				}
 				bSprintf(body, "return %s%d.vu64;", NGEN_VALUE_PREFIX, ins.Values[0])
 			}
 		case "get_local":
@@ -276,31 +391,37 @@ func (c *SSAFunctionCompiler) NGen(selfID uint64, numParams uint64, numLocals ui
 				uint64(ins.Immediates[0]),
 				NGEN_VALUE_PREFIX, ins.Values[0],
 			)
-		case "call":
-			bSprintf(body,
-				"%s%d.vu64 = %s%d(vm",
-				NGEN_VALUE_PREFIX, ins.Target,
-				NGEN_FUNCTION_PREFIX, ins.Immediates[0],
-			)
+		case "call", "return_call":
+			if ins.Op == "call" {
+				bSprintf(body, "%s%d.vu64 = ", NGEN_VALUE_PREFIX, ins.Target)
+			} else {
+				writeTailCallReturn(body, len(ins.Values), numParams)
+			}
+			bSprintf(body, "%s%d(vm", NGEN_FUNCTION_PREFIX, ins.Immediates[0])
 
 			for _, v := range ins.Values {
 				bSprintf(body, ",%s%d.vu64", NGEN_VALUE_PREFIX, v)
 			}
 
 			body.WriteString(");")
-		case "call_indirect":
-			bSprintf(body,
-				"%s%d.vu64 = ((uint64_t (*)(struct VirtualMachine *",
-				NGEN_VALUE_PREFIX, ins.Target,
-			)
+			if ins.Op == "return_call" {
+				body.WriteString(" }")
+			}
+		case "call_indirect", "return_call_indirect":
+			if ins.Op == "call_indirect" {
+				bSprintf(body, "%s%d.vu64 = ", NGEN_VALUE_PREFIX, ins.Target)
+			} else {
+				writeTailCallReturn(body, len(ins.Values)-1, numParams)
+			}
+			body.WriteString("((uint64_t (*)(struct VirtualMachine *")
 
 			for range ins.Values[:len(ins.Values)-1] {
 				bSprintf(body, ",uint64_t")
 			}
 
 			bSprintf(body,
-				")) %sresolve_indirect(vm, %s%d.vu32, %d)) (vm",
-				NGEN_ENV_API_PREFIX,
+				")) %sresolve_indirect(vm, %d, %s%d.vu32, %d)) (vm",
+				NGEN_ENV_API_PREFIX, ins.Immediates[1],
 				NGEN_VALUE_PREFIX, ins.Values[len(ins.Values)-1],
 				len(ins.Values)-1,
 			)
@@ -310,6 +431,9 @@ func (c *SSAFunctionCompiler) NGen(selfID uint64, numParams uint64, numLocals ui
 			}
 
 			body.WriteString(");")
+			if ins.Op == "return_call_indirect" {
+				body.WriteString(" }")
+			}
 		case "jmp":
 			bSprintf(body,
 				"phi = %s%d; goto %s%d;",
@@ -346,11 +470,25 @@ func (c *SSAFunctionCompiler) NGen(selfID uint64, numParams uint64, numLocals ui
 			}
 
 			bSprintf(body, "}")
-		case "phi":
+		case "yield":
 			bSprintf(body,
-				"%s%d = phi;",
-				NGEN_VALUE_PREFIX, ins.Target,
+				"%syielded[%d] = %s%d.vu64;",
+				NGEN_ENV_API_PREFIX, ins.Immediates[0]-1,
+				NGEN_VALUE_PREFIX, ins.Values[0],
 			)
+		case "phi":
+			if len(ins.Immediates) != 0 {
+				bSprintf(body,
+					"%s%d.vu64 = %syielded[%d];",
+					NGEN_VALUE_PREFIX, ins.Target,
+					NGEN_ENV_API_PREFIX, ins.Immediates[0]-1,
+				)
+			} else {
+				bSprintf(body,
+					"%s%d = phi;",
+					NGEN_VALUE_PREFIX, ins.Target,
+				)
+			}
 		case "select":
 			bSprintf(body,
 				"%s%d = %s%d.vu32 ? %s%d : %s%d;",
@@ -581,10 +719,36 @@ func (c *SSAFunctionCompiler) NGen(selfID uint64, numParams uint64, numLocals ui
 			writeUnOp_Fcall(body, ins, "", "int32_t", "int64_t")
 		case "i32.wrap/i64":
 			writeUnOp_Fcall(body, ins, "", "uint32_t", "uint64_t")
+		case "i32.extend8_s":
+			writeSignExtend(body, ins, "int8_t", "uint32_t")
+		case "i32.extend16_s":
+			writeSignExtend(body, ins, "int16_t", "uint32_t")
+		case "i64.extend8_s":
+			writeSignExtend(body, ins, "int8_t", "uint64_t")
+		case "i64.extend16_s":
+			writeSignExtend(body, ins, "int16_t", "uint64_t")
+		case "i64.extend32_s":
+			writeSignExtend(body, ins, "int32_t", "uint64_t")
 		case "i32.trunc_s/f32", "i64.trunc_s/f32", "i32.trunc_u/f32", "i64.trunc_u/f32":
 			writeUnOp_Fcall(body, ins, "ftrunc32", "float", "int64_t")
 		case "i32.trunc_s/f64", "i64.trunc_s/f64", "i32.trunc_u/f64", "i64.trunc_u/f64":
 			writeUnOp_Fcall(body, ins, "ftrunc64", "double", "int64_t")
+		case "i32.trunc_s:sat/f32":
+			writeUnOp_Fcall(body, ins, "trunc_sat_i32_s", "float", "uint64_t")
+		case "i32.trunc_u:sat/f32":
+			writeUnOp_Fcall(body, ins, "trunc_sat_i32_u", "float", "uint64_t")
+		case "i64.trunc_s:sat/f32":
+			writeUnOp_Fcall(body, ins, "trunc_sat_i64_s", "float", "uint64_t")
+		case "i64.trunc_u:sat/f32":
+			writeUnOp_Fcall(body, ins, "trunc_sat_i64_u", "float", "uint64_t")
+		case "i32.trunc_s:sat/f64":
+			writeUnOp_Fcall(body, ins, "trunc_sat_i32_s", "double", "uint64_t")
+		case "i32.trunc_u:sat/f64":
+			writeUnOp_Fcall(body, ins, "trunc_sat_i32_u", "double", "uint64_t")
+		case "i64.trunc_s:sat/f64":
+			writeUnOp_Fcall(body, ins, "trunc_sat_i64_s", "double", "uint64_t")
+		case "i64.trunc_u:sat/f64":
+			writeUnOp_Fcall(body, ins, "trunc_sat_i64_u", "double", "uint64_t")
 		case "f32.demote/f64":
 			writeUnOp_Fcall(body, ins, "", "double", "float")
 		case "f64.promote/f32":
@@ -607,43 +771,132 @@ func (c *SSAFunctionCompiler) NGen(selfID uint64, numParams uint64, numLocals ui
 			writeUnOp_Fcall(body, ins, "", "uint64_t", "double")
 		case "i32.reinterpret/f32", "i64.reinterpret/f64", "f32.reinterpret/i32", "f64.reinterpret/i64":
 		case "i32.load", "f32.load", "i64.load32_u":
-			writeMemLoad(body, ins, "uint32_t")
+			c.writeMemLoad(body, ins, "uint32_t")
 		case "i32.load8_s", "i64.load8_s":
-			writeMemLoad(body, ins, "int8_t")
+			c.writeMemLoad(body, ins, "int8_t")
 		case "i32.load8_u", "i64.load8_u":
-			writeMemLoad(body, ins, "uint8_t")
+			c.writeMemLoad(body, ins, "uint8_t")
 		case "i32.load16_s", "i64.load16_s":
-			writeMemLoad(body, ins, "int16_t")
+			c.writeMemLoad(body, ins, "int16_t")
 		case "i32.load16_u", "i64.load16_u":
-			writeMemLoad(body, ins, "uint16_t")
+			c.writeMemLoad(body, ins, "uint16_t")
 		case "i64.load32_s":
-			writeMemLoad(body, ins, "int32_t")
+			c.writeMemLoad(body, ins, "int32_t")
 		case "i64.load", "f64.load":
-			writeMemLoad(body, ins, "uint64_t")
+			c.writeMemLoad(body, ins, "uint64_t")
 		case "i32.store", "f32.store", "i64.store32":
-			writeMemStore(body, ins, "uint32_t")
+			c.writeMemStore(body, ins, "uint32_t")
 		case "i32.store8", "i64.store8":
-			writeMemStore(body, ins, "uint8_t")
+			c.writeMemStore(body, ins, "uint8_t")
 		case "i32.store16", "i64.store16":
-			writeMemStore(body, ins, "uint16_t")
+			c.writeMemStore(body, ins, "uint16_t")
 		case "i64.store", "f64.store":
-			writeMemStore(body, ins, "uint64_t")
+			c.writeMemStore(body, ins, "uint64_t")
 		case "memory.size":
 			bSprintf(body,
-				"%s%d.vu64 = vm->mem_size / 65536;",
-				NGEN_VALUE_PREFIX, ins.Target,
+				"%s%d.vu64 = memory_size(vm, %d) / 65536;",
+				NGEN_VALUE_PREFIX, ins.Target, ins.Immediates[0],
 			)
 		case "memory.grow":
 			bSprintf(body,
-				"%s%d.vu64 = vm->mem_size / 65536; vm->grow_memory(vm, %s%d.vu32 * 65536);",
+				"%s%d.vu64 = mem_grow(vm, %d, %s);",
+				NGEN_VALUE_PREFIX, ins.Target, ins.Immediates[0],
+				c.memAddress(ins.Immediates[0], ins.Values[0]),
+			)
+		case "memory.init":
+			bSprintf(body,
+				"%smemory_init(vm, %d, %d, %s, %s%d.vu32, %s%d.vu32);",
+				NGEN_ENV_API_PREFIX, ins.Immediates[0], ins.Immediates[1],
+				c.memAddress(ins.Immediates[1], ins.Values[0]),
+				NGEN_VALUE_PREFIX, ins.Values[1],
+				NGEN_VALUE_PREFIX, ins.Values[2],
+			)
+		case "data.drop":
+			bSprintf(body, "%sdata_drop(%d);", NGEN_ENV_API_PREFIX, ins.Immediates[0])
+		case "memory.copy":
+			// The length is an i64 if both memories are 64-bit.
+			n := fmt.Sprintf("%s%d.vu32", NGEN_VALUE_PREFIX, ins.Values[2])
+			if c.MemoryTypes[ins.Immediates[0]].Memory64 && c.MemoryTypes[ins.Immediates[1]].Memory64 {
+				n = fmt.Sprintf("%s%d.vu64", NGEN_VALUE_PREFIX, ins.Values[2])
+			}
+			bSprintf(body,
+				"mem_copy(vm, %d, %d, %s, %s, %s);",
+				ins.Immediates[0], ins.Immediates[1],
+				c.memAddress(ins.Immediates[0], ins.Values[0]),
+				c.memAddress(ins.Immediates[1], ins.Values[1]),
+				n,
+			)
+		case "memory.fill":
+			bSprintf(body,
+				"mem_fill(vm, %d, %s, %s%d.vu32, %s);",
+				ins.Immediates[0],
+				c.memAddress(ins.Immediates[0], ins.Values[0]),
+				NGEN_VALUE_PREFIX, ins.Values[1],
+				c.memAddress(ins.Immediates[0], ins.Values[2]),
+			)
+		case "table.init":
+			bSprintf(body,
+				"%stable_init(vm, %d, %d, %s%d.vu32, %s%d.vu32, %s%d.vu32);",
+				NGEN_ENV_API_PREFIX, ins.Immediates[0], ins.Immediates[1],
+				NGEN_VALUE_PREFIX, ins.Values[0],
+				NGEN_VALUE_PREFIX, ins.Values[1],
+				NGEN_VALUE_PREFIX, ins.Values[2],
+			)
+		case "elem.drop":
+			bSprintf(body, "%selem_drop(%d);", NGEN_ENV_API_PREFIX, ins.Immediates[0])
+		case "table.copy":
+			bSprintf(body,
+				"%stable_copy(vm, %d, %d, %s%d.vu32, %s%d.vu32, %s%d.vu32);",
+				NGEN_ENV_API_PREFIX, ins.Immediates[0], ins.Immediates[1],
+				NGEN_VALUE_PREFIX, ins.Values[0],
+				NGEN_VALUE_PREFIX, ins.Values[1],
+				NGEN_VALUE_PREFIX, ins.Values[2],
+			)
+		case "table.get":
+			bSprintf(body,
+				"%s%d.vu64 = %stable_get(vm, %d, %s%d.vu32);",
+				NGEN_VALUE_PREFIX, ins.Target,
+				NGEN_ENV_API_PREFIX, ins.Immediates[0],
+				NGEN_VALUE_PREFIX, ins.Values[0],
+			)
+		case "table.set":
+			bSprintf(body,
+				"%stable_set(vm, %d, %s%d.vu32, %s%d.vu32);",
+				NGEN_ENV_API_PREFIX, ins.Immediates[0],
+				NGEN_VALUE_PREFIX, ins.Values[0],
+				NGEN_VALUE_PREFIX, ins.Values[1],
+			)
+		case "table.size":
+			bSprintf(body,
+				"%s%d.vu64 = %stable_size(%d);",
+				NGEN_VALUE_PREFIX, ins.Target,
+				NGEN_ENV_API_PREFIX, ins.Immediates[0],
+			)
+		case "table.grow":
+			bSprintf(body,
+				"%s%d.vu64 = %stable_grow(vm, %d, %s%d.vu32, %s%d.vu32);",
 				NGEN_VALUE_PREFIX, ins.Target,
+				NGEN_ENV_API_PREFIX, ins.Immediates[0],
 				NGEN_VALUE_PREFIX, ins.Values[0],
+				NGEN_VALUE_PREFIX, ins.Values[1],
 			)
-		case "add_gas": // TODO: Implement
+		case "table.fill":
+			bSprintf(body,
+				"%stable_fill(vm, %d, %s%d.vu32, %s%d.vu32, %s%d.vu32);",
+				NGEN_ENV_API_PREFIX, ins.Immediates[0],
+				NGEN_VALUE_PREFIX, ins.Values[0],
+				NGEN_VALUE_PREFIX, ins.Values[1],
+				NGEN_VALUE_PREFIX, ins.Values[2],
+			)
+		case "add_gas", "add_gas_scaled": // TODO: Implement
 		case "fp_disabled_error":
 			bSprintf(body, "vm->throw_s(vm, \"floating point disabled\");")
+		case "simd_disabled_error":
+			bSprintf(body, "vm->throw_s(vm, \"simd disabled\");")
 		default:
-			panic(ins.Op)
+			if !c.writeSIMD(body, ins) && !c.writeAtomic(body, ins) {
+				panic(ins.Op)
+			}
 		}
 
 		body.WriteByte('\n')
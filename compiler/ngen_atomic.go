@@ -0,0 +1,61 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// atomicTypes are the C types of the memory accesses of atomic
+// instructions, by size.
+var atomicTypes = map[int]string{
+	1: "uint8_t",
+	2: "uint16_t",
+	4: "uint32_t",
+	8: "uint64_t",
+}
+
+// writeAtomic writes the C code of the atomic instruction ins, returning
+// false if ins is not an atomic instruction.
+//
+// AOT-compiled code does not support shared memories, so memory.atomic.wait
+// traps as it does on unshared memories and memory.atomic.notify never wakes
+// up any waiter.
+func (c *SSAFunctionCompiler) writeAtomic(b *strings.Builder, ins Instr) bool {
+	_, op, ok := atomicOp(ins.Op)
+	if !ok {
+		return false
+	}
+
+	if op.Kind == AtomicFence {
+		b.WriteString("__atomic_thread_fence(__ATOMIC_SEQ_CST);")
+		return true
+	}
+
+	ty := atomicTypes[op.Size]
+	ptr := fmt.Sprintf("((%s *) atomic_translate(vm, %s, %d))", ty, c.memArgs(ins), op.Size)
+
+	switch op.Kind {
+	case AtomicLoad:
+		bSprintf(b, "%s%d.vu64 = __atomic_load_n(%s, __ATOMIC_SEQ_CST);", NGEN_VALUE_PREFIX, ins.Target, ptr)
+	case AtomicStore:
+		bSprintf(b, "__atomic_store_n(%s, (%s) %s%d.vu64, __ATOMIC_SEQ_CST);", ptr, ty, NGEN_VALUE_PREFIX, ins.Values[1])
+	case AtomicRmw:
+		fn := "__atomic_exchange_n"
+		if name := op.Name[strings.LastIndexByte(op.Name, '.')+1:]; name != "xchg" && name != "xchg_u" {
+			fn = "__atomic_fetch_" + strings.TrimSuffix(name, "_u")
+		}
+		bSprintf(b, "%s%d.vu64 = %s(%s, (%s) %s%d.vu64, __ATOMIC_SEQ_CST);",
+			NGEN_VALUE_PREFIX, ins.Target, fn, ptr, ty, NGEN_VALUE_PREFIX, ins.Values[1])
+	case AtomicCmpxchg:
+		// On failure, the expected value is replaced by the loaded one.
+		bSprintf(b, "{ %s expected = (%s) %s%d.vu64; __atomic_compare_exchange_n(%s, &expected, (%s) %s%d.vu64, 0, __ATOMIC_SEQ_CST, __ATOMIC_SEQ_CST); %s%d.vu64 = expected; }",
+			ty, ty, NGEN_VALUE_PREFIX, ins.Values[1],
+			ptr, ty, NGEN_VALUE_PREFIX, ins.Values[2],
+			NGEN_VALUE_PREFIX, ins.Target)
+	case AtomicNotify:
+		bSprintf(b, "(void) %s; %s%d.vu64 = 0;", ptr, NGEN_VALUE_PREFIX, ins.Target)
+	case AtomicWait:
+		bSprintf(b, "(void) %s; vm->throw_s(vm, \"expected shared memory\");", ptr)
+	}
+	return true
+}
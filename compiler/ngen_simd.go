@@ -0,0 +1,402 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NGEN_SIMD_HEADER holds the definitions used by the code generated for SIMD
+// instructions. v128 values are handled as GCC vectors, which clang also
+// supports.
+const NGEN_SIMD_HEADER = `
+typedef uint8_t u8x16 __attribute__((vector_size(16)));
+typedef int8_t i8x16 __attribute__((vector_size(16)));
+typedef uint16_t u16x8 __attribute__((vector_size(16)));
+typedef int16_t i16x8 __attribute__((vector_size(16)));
+typedef uint32_t u32x4 __attribute__((vector_size(16)));
+typedef int32_t i32x4 __attribute__((vector_size(16)));
+typedef uint64_t u64x2 __attribute__((vector_size(16)));
+typedef int64_t i64x2 __attribute__((vector_size(16)));
+typedef float f32x4 __attribute__((vector_size(16)));
+typedef double f64x2 __attribute__((vector_size(16)));
+
+#define SIMD_SELECT(m, x, y) (((u64x2) (m) & (u64x2) (x)) | (~(u64x2) (m) & (u64x2) (y)))
+
+static int64_t __attribute__((always_inline)) simd_sat(int64_t x, int64_t min, int64_t max) {
+	return x < min ? min : x > max ? max : x;
+}
+
+static uint32_t __attribute__((always_inline)) simd_trunc_sat_s32(double x) {
+	if(x != x) return 0;
+	if(x <= -2147483648.0) return (uint32_t) INT32_MIN;
+	if(x >= 2147483647.0) return INT32_MAX;
+	return (uint32_t) (int32_t) x;
+}
+
+static uint32_t __attribute__((always_inline)) simd_trunc_sat_u32(double x) {
+	if(!(x > -1.0)) return 0;
+	if(x >= 4294967295.0) return UINT32_MAX;
+	return (uint32_t) x;
+}
+
+static float __attribute__((always_inline)) simd_fmin32(float a, float b) {
+	if(a != a || b != b) return __builtin_nanf("");
+	if(a == b) return __builtin_signbit(a) ? a : b;
+	return a < b ? a : b;
+}
+
+static float __attribute__((always_inline)) simd_fmax32(float a, float b) {
+	if(a != a || b != b) return __builtin_nanf("");
+	if(a == b) return __builtin_signbit(a) ? b : a;
+	return a > b ? a : b;
+}
+
+static double __attribute__((always_inline)) simd_fmin64(double a, double b) {
+	if(a != a || b != b) return __builtin_nan("");
+	if(a == b) return __builtin_signbit(a) ? a : b;
+	return a < b ? a : b;
+}
+
+static double __attribute__((always_inline)) simd_fmax64(double a, double b) {
+	if(a != a || b != b) return __builtin_nan("");
+	if(a == b) return __builtin_signbit(a) ? b : a;
+	return a > b ? a : b;
+}
+
+#define SIMD_UNARY(name, R, S, n, expr) \
+static u64x2 __attribute__((always_inline)) simd_##name(u64x2 a_) { \
+	S a = (S) a_; R r = {0}; \
+	for(int i = 0; i < n; i++) r[i] = (expr); \
+	return (u64x2) r; \
+}
+
+#define SIMD_BINARY(name, R, S, n, expr) \
+static u64x2 __attribute__((always_inline)) simd_##name(u64x2 a_, u64x2 b_) { \
+	S a = (S) a_, b = (S) b_; R r = {0}; \
+	for(int i = 0; i < n; i++) r[i] = (expr); \
+	return (u64x2) r; \
+}
+
+#define SIMD_ALL_TRUE(name, S, n) \
+static uint64_t __attribute__((always_inline)) simd_##name(u64x2 a_) { \
+	S a = (S) a_; \
+	for(int i = 0; i < n; i++) if(a[i] == 0) return 0; \
+	return 1; \
+}
+
+#define SIMD_BITMASK(name, S, n) \
+static uint64_t __attribute__((always_inline)) simd_##name(u64x2 a_) { \
+	S a = (S) a_; uint64_t r = 0; \
+	for(int i = 0; i < n; i++) r |= (uint64_t) (a[i] < 0) << i; \
+	return r; \
+}
+
+#define SIMD_LOAD_EXTEND(name, R, T, n) \
+static u64x2 __attribute__((always_inline)) simd_##name(const uint8_t *p) { \
+	T x[n]; R r; \
+	__builtin_memcpy(x, p, sizeof(x)); \
+	for(int i = 0; i < n; i++) r[i] = x[i]; \
+	return (u64x2) r; \
+}
+
+#define SIMD_LOAD_SPLAT(name, R, T, n) \
+static u64x2 __attribute__((always_inline)) simd_##name(const uint8_t *p) { \
+	T x; R r; \
+	__builtin_memcpy(&x, p, sizeof(x)); \
+	for(int i = 0; i < n; i++) r[i] = x; \
+	return (u64x2) r; \
+}
+
+#define SIMD_LOAD_ZERO(name, n) \
+static u64x2 __attribute__((always_inline)) simd_##name(const uint8_t *p) { \
+	u64x2 r = {0, 0}; \
+	__builtin_memcpy(&r, p, n); \
+	return r; \
+}
+
+static u64x2 __attribute__((always_inline)) simd_v128_load(const uint8_t *p) {
+	u64x2 r;
+	__builtin_memcpy(&r, p, 16);
+	return r;
+}
+SIMD_LOAD_EXTEND(v128_load8x8_s, i16x8, int8_t, 8)
+SIMD_LOAD_EXTEND(v128_load8x8_u, u16x8, uint8_t, 8)
+SIMD_LOAD_EXTEND(v128_load16x4_s, i32x4, int16_t, 4)
+SIMD_LOAD_EXTEND(v128_load16x4_u, u32x4, uint16_t, 4)
+SIMD_LOAD_EXTEND(v128_load32x2_s, i64x2, int32_t, 2)
+SIMD_LOAD_EXTEND(v128_load32x2_u, u64x2, uint32_t, 2)
+SIMD_LOAD_SPLAT(v128_load8_splat, u8x16, uint8_t, 16)
+SIMD_LOAD_SPLAT(v128_load16_splat, u16x8, uint16_t, 8)
+SIMD_LOAD_SPLAT(v128_load32_splat, u32x4, uint32_t, 4)
+SIMD_LOAD_SPLAT(v128_load64_splat, u64x2, uint64_t, 2)
+SIMD_LOAD_ZERO(v128_load32_zero, 4)
+SIMD_LOAD_ZERO(v128_load64_zero, 8)
+
+SIMD_UNARY(i8x16_abs, u8x16, i8x16, 16, a[i] < 0 ? -(uint8_t) a[i] : (uint8_t) a[i])
+SIMD_UNARY(i16x8_abs, u16x8, i16x8, 8, a[i] < 0 ? -(uint16_t) a[i] : (uint16_t) a[i])
+SIMD_UNARY(i32x4_abs, u32x4, i32x4, 4, a[i] < 0 ? -(uint32_t) a[i] : (uint32_t) a[i])
+SIMD_UNARY(i64x2_abs, u64x2, i64x2, 2, a[i] < 0 ? -(uint64_t) a[i] : (uint64_t) a[i])
+SIMD_UNARY(i8x16_popcnt, u8x16, u8x16, 16, __builtin_popcount(a[i]))
+SIMD_UNARY(i16x8_extadd_pairwise_i8x16_s, i16x8, i8x16, 8, a[2*i] + a[2*i+1])
+SIMD_UNARY(i16x8_extadd_pairwise_i8x16_u, u16x8, u8x16, 8, a[2*i] + a[2*i+1])
+SIMD_UNARY(i32x4_extadd_pairwise_i16x8_s, i32x4, i16x8, 4, a[2*i] + a[2*i+1])
+SIMD_UNARY(i32x4_extadd_pairwise_i16x8_u, u32x4, u16x8, 4, a[2*i] + a[2*i+1])
+SIMD_UNARY(i16x8_extend_low_i8x16_s, i16x8, i8x16, 8, a[i])
+SIMD_UNARY(i16x8_extend_high_i8x16_s, i16x8, i8x16, 8, a[i+8])
+SIMD_UNARY(i16x8_extend_low_i8x16_u, u16x8, u8x16, 8, a[i])
+SIMD_UNARY(i16x8_extend_high_i8x16_u, u16x8, u8x16, 8, a[i+8])
+SIMD_UNARY(i32x4_extend_low_i16x8_s, i32x4, i16x8, 4, a[i])
+SIMD_UNARY(i32x4_extend_high_i16x8_s, i32x4, i16x8, 4, a[i+4])
+SIMD_UNARY(i32x4_extend_low_i16x8_u, u32x4, u16x8, 4, a[i])
+SIMD_UNARY(i32x4_extend_high_i16x8_u, u32x4, u16x8, 4, a[i+4])
+SIMD_UNARY(i64x2_extend_low_i32x4_s, i64x2, i32x4, 2, a[i])
+SIMD_UNARY(i64x2_extend_high_i32x4_s, i64x2, i32x4, 2, a[i+2])
+SIMD_UNARY(i64x2_extend_low_i32x4_u, u64x2, u32x4, 2, a[i])
+SIMD_UNARY(i64x2_extend_high_i32x4_u, u64x2, u32x4, 2, a[i+2])
+SIMD_UNARY(f32x4_sqrt, f32x4, f32x4, 4, __builtin_sqrtf(a[i]))
+SIMD_UNARY(f32x4_ceil, f32x4, f32x4, 4, __builtin_ceilf(a[i]))
+SIMD_UNARY(f32x4_floor, f32x4, f32x4, 4, __builtin_floorf(a[i]))
+SIMD_UNARY(f32x4_trunc, f32x4, f32x4, 4, __builtin_truncf(a[i]))
+SIMD_UNARY(f32x4_nearest, f32x4, f32x4, 4, __builtin_rintf(a[i]))
+SIMD_UNARY(f64x2_sqrt, f64x2, f64x2, 2, __builtin_sqrt(a[i]))
+SIMD_UNARY(f64x2_ceil, f64x2, f64x2, 2, __builtin_ceil(a[i]))
+SIMD_UNARY(f64x2_floor, f64x2, f64x2, 2, __builtin_floor(a[i]))
+SIMD_UNARY(f64x2_trunc, f64x2, f64x2, 2, __builtin_trunc(a[i]))
+SIMD_UNARY(f64x2_nearest, f64x2, f64x2, 2, __builtin_rint(a[i]))
+SIMD_UNARY(i32x4_trunc_sat_f32x4_s, u32x4, f32x4, 4, simd_trunc_sat_s32(a[i]))
+SIMD_UNARY(i32x4_trunc_sat_f32x4_u, u32x4, f32x4, 4, simd_trunc_sat_u32(a[i]))
+SIMD_UNARY(i32x4_trunc_sat_f64x2_s_zero, u32x4, f64x2, 2, simd_trunc_sat_s32(a[i]))
+SIMD_UNARY(i32x4_trunc_sat_f64x2_u_zero, u32x4, f64x2, 2, simd_trunc_sat_u32(a[i]))
+SIMD_UNARY(f64x2_convert_low_i32x4_s, f64x2, i32x4, 2, a[i])
+SIMD_UNARY(f64x2_convert_low_i32x4_u, f64x2, u32x4, 2, a[i])
+SIMD_UNARY(f32x4_demote_f64x2_zero, f32x4, f64x2, 2, a[i])
+SIMD_UNARY(f64x2_promote_low_f32x4, f64x2, f32x4, 2, a[i])
+
+SIMD_BINARY(i8x16_swizzle, u8x16, u8x16, 16, b[i] < 16 ? a[b[i]] : 0)
+SIMD_BINARY(i8x16_narrow_i16x8_s, i8x16, i16x8, 16, simd_sat(i < 8 ? a[i] : b[i-8], INT8_MIN, INT8_MAX))
+SIMD_BINARY(i8x16_narrow_i16x8_u, u8x16, i16x8, 16, simd_sat(i < 8 ? a[i] : b[i-8], 0, UINT8_MAX))
+SIMD_BINARY(i16x8_narrow_i32x4_s, i16x8, i32x4, 8, simd_sat(i < 4 ? a[i] : b[i-4], INT16_MIN, INT16_MAX))
+SIMD_BINARY(i16x8_narrow_i32x4_u, u16x8, i32x4, 8, simd_sat(i < 4 ? a[i] : b[i-4], 0, UINT16_MAX))
+SIMD_BINARY(i8x16_add_sat_s, i8x16, i8x16, 16, simd_sat(a[i] + b[i], INT8_MIN, INT8_MAX))
+SIMD_BINARY(i8x16_add_sat_u, u8x16, u8x16, 16, simd_sat(a[i] + b[i], 0, UINT8_MAX))
+SIMD_BINARY(i8x16_sub_sat_s, i8x16, i8x16, 16, simd_sat(a[i] - b[i], INT8_MIN, INT8_MAX))
+SIMD_BINARY(i8x16_sub_sat_u, u8x16, u8x16, 16, simd_sat(a[i] - b[i], 0, UINT8_MAX))
+SIMD_BINARY(i16x8_add_sat_s, i16x8, i16x8, 8, simd_sat(a[i] + b[i], INT16_MIN, INT16_MAX))
+SIMD_BINARY(i16x8_add_sat_u, u16x8, u16x8, 8, simd_sat(a[i] + b[i], 0, UINT16_MAX))
+SIMD_BINARY(i16x8_sub_sat_s, i16x8, i16x8, 8, simd_sat(a[i] - b[i], INT16_MIN, INT16_MAX))
+SIMD_BINARY(i16x8_sub_sat_u, u16x8, u16x8, 8, simd_sat(a[i] - b[i], 0, UINT16_MAX))
+SIMD_BINARY(i8x16_avgr_u, u8x16, u8x16, 16, (a[i] + b[i] + 1) / 2)
+SIMD_BINARY(i16x8_avgr_u, u16x8, u16x8, 8, (a[i] + b[i] + 1) / 2)
+SIMD_BINARY(i16x8_q15mulr_sat_s, i16x8, i16x8, 8, simd_sat((a[i] * b[i] + 0x4000) >> 15, INT16_MIN, INT16_MAX))
+SIMD_BINARY(i32x4_dot_i16x8_s, u32x4, i16x8, 4, (uint32_t) ((int64_t) a[2*i] * b[2*i] + (int64_t) a[2*i+1] * b[2*i+1]))
+SIMD_BINARY(i16x8_extmul_low_i8x16_s, i16x8, i8x16, 8, a[i] * b[i])
+SIMD_BINARY(i16x8_extmul_high_i8x16_s, i16x8, i8x16, 8, a[i+8] * b[i+8])
+SIMD_BINARY(i16x8_extmul_low_i8x16_u, u16x8, u8x16, 8, a[i] * b[i])
+SIMD_BINARY(i16x8_extmul_high_i8x16_u, u16x8, u8x16, 8, a[i+8] * b[i+8])
+SIMD_BINARY(i32x4_extmul_low_i16x8_s, i32x4, i16x8, 4, a[i] * b[i])
+SIMD_BINARY(i32x4_extmul_high_i16x8_s, i32x4, i16x8, 4, a[i+4] * b[i+4])
+SIMD_BINARY(i32x4_extmul_low_i16x8_u, u32x4, u16x8, 4, (uint32_t) a[i] * b[i])
+SIMD_BINARY(i32x4_extmul_high_i16x8_u, u32x4, u16x8, 4, (uint32_t) a[i+4] * b[i+4])
+SIMD_BINARY(i64x2_extmul_low_i32x4_s, i64x2, i32x4, 2, (int64_t) a[i] * b[i])
+SIMD_BINARY(i64x2_extmul_high_i32x4_s, i64x2, i32x4, 2, (int64_t) a[i+2] * b[i+2])
+SIMD_BINARY(i64x2_extmul_low_i32x4_u, u64x2, u32x4, 2, (uint64_t) a[i] * b[i])
+SIMD_BINARY(i64x2_extmul_high_i32x4_u, u64x2, u32x4, 2, (uint64_t) a[i+2] * b[i+2])
+SIMD_BINARY(f32x4_min, f32x4, f32x4, 4, simd_fmin32(a[i], b[i]))
+SIMD_BINARY(f32x4_max, f32x4, f32x4, 4, simd_fmax32(a[i], b[i]))
+SIMD_BINARY(f32x4_pmin, f32x4, f32x4, 4, b[i] < a[i] ? b[i] : a[i])
+SIMD_BINARY(f32x4_pmax, f32x4, f32x4, 4, a[i] < b[i] ? b[i] : a[i])
+SIMD_BINARY(f64x2_min, f64x2, f64x2, 2, simd_fmin64(a[i], b[i]))
+SIMD_BINARY(f64x2_max, f64x2, f64x2, 2, simd_fmax64(a[i], b[i]))
+SIMD_BINARY(f64x2_pmin, f64x2, f64x2, 2, b[i] < a[i] ? b[i] : a[i])
+SIMD_BINARY(f64x2_pmax, f64x2, f64x2, 2, a[i] < b[i] ? b[i] : a[i])
+
+SIMD_ALL_TRUE(i8x16_all_true, u8x16, 16)
+SIMD_ALL_TRUE(i16x8_all_true, u16x8, 8)
+SIMD_ALL_TRUE(i32x4_all_true, u32x4, 4)
+SIMD_ALL_TRUE(i64x2_all_true, u64x2, 2)
+SIMD_BITMASK(i8x16_bitmask, i8x16, 16)
+SIMD_BITMASK(i16x8_bitmask, i16x8, 8)
+SIMD_BITMASK(i32x4_bitmask, i32x4, 4)
+SIMD_BITMASK(i64x2_bitmask, i64x2, 2)
+`
+
+// simdShapes are the integer lane shapes, with the unsigned and signed
+// vector types of the SIMD header and the lane width in bits.
+var simdShapes = []struct {
+	name, u, s string
+	bits       int
+}{
+	{"i8x16", "u8x16", "i8x16", 8},
+	{"i16x8", "u16x8", "i16x8", 16},
+	{"i32x4", "u32x4", "i32x4", 32},
+	{"i64x2", "u64x2", "i64x2", 64},
+}
+
+// simdExprs holds the C expressions computing the SIMD instructions which
+// map to vector operators, in terms of the u64x2 operands a, b and c and the
+// shift count n. The other instructions call the simd_ functions of the
+// SIMD header.
+var simdExprs = map[string]string{
+	"v128.not":       "~a",
+	"v128.and":       "a & b",
+	"v128.andnot":    "a & ~b",
+	"v128.or":        "a | b",
+	"v128.xor":       "a ^ b",
+	"v128.bitselect": "(a & c) | (b & ~c)",
+	"v128.any_true":  "(a[0] | a[1]) != 0",
+
+	"f32x4.abs":             "(u32x4) a & 0x7fffffffu",
+	"f32x4.neg":             "(u32x4) a ^ 0x80000000u",
+	"f64x2.abs":             "a & 0x7fffffffffffffffull",
+	"f64x2.neg":             "a ^ 0x8000000000000000ull",
+	"f32x4.convert_i32x4_s": "__builtin_convertvector((i32x4) a, f32x4)",
+	"f32x4.convert_i32x4_u": "__builtin_convertvector((u32x4) a, f32x4)",
+}
+
+func init() {
+	for _, sh := range simdShapes {
+		u, s := sh.u, sh.s
+		simdExprs[sh.name+".add"] = fmt.Sprintf("(%s) a + (%s) b", u, u)
+		simdExprs[sh.name+".sub"] = fmt.Sprintf("(%s) a - (%s) b", u, u)
+		simdExprs[sh.name+".neg"] = fmt.Sprintf("-(%s) a", u)
+		if sh.bits != 8 {
+			simdExprs[sh.name+".mul"] = fmt.Sprintf("(%s) a * (%s) b", u, u)
+		}
+
+		simdExprs[sh.name+".eq"] = fmt.Sprintf("(%s) a == (%s) b", s, s)
+		simdExprs[sh.name+".ne"] = fmt.Sprintf("(%s) a != (%s) b", s, s)
+		for _, cmp := range []struct{ name, op string }{{"lt", "<"}, {"gt", ">"}, {"le", "<="}, {"ge", ">="}} {
+			simdExprs[sh.name+"."+cmp.name+"_s"] = fmt.Sprintf("(%s) a %s (%s) b", s, cmp.op, s)
+			if sh.bits != 64 {
+				simdExprs[sh.name+"."+cmp.name+"_u"] = fmt.Sprintf("(%s) a %s (%s) b", u, cmp.op, u)
+			}
+		}
+		if sh.bits != 64 {
+			simdExprs[sh.name+".min_s"] = fmt.Sprintf("SIMD_SELECT((%s) a < (%s) b, a, b)", s, s)
+			simdExprs[sh.name+".min_u"] = fmt.Sprintf("SIMD_SELECT((%s) a < (%s) b, a, b)", u, u)
+			simdExprs[sh.name+".max_s"] = fmt.Sprintf("SIMD_SELECT((%s) a > (%s) b, a, b)", s, s)
+			simdExprs[sh.name+".max_u"] = fmt.Sprintf("SIMD_SELECT((%s) a > (%s) b, a, b)", u, u)
+		}
+
+		simdExprs[sh.name+".shl"] = fmt.Sprintf("(%s) a << (n & %d)", u, sh.bits-1)
+		simdExprs[sh.name+".shr_s"] = fmt.Sprintf("(%s) a >> (n & %d)", s, sh.bits-1)
+		simdExprs[sh.name+".shr_u"] = fmt.Sprintf("(%s) a >> (n & %d)", u, sh.bits-1)
+	}
+
+	for _, sh := range []struct{ name, f, mask string }{{"f32x4", "f32x4", "u32x4"}, {"f64x2", "f64x2", "u64x2"}} {
+		for _, op := range []struct{ name, op string }{{"add", "+"}, {"sub", "-"}, {"mul", "*"}, {"div", "/"}} {
+			simdExprs[sh.name+"."+op.name] = fmt.Sprintf("(%s) a %s (%s) b", sh.f, op.op, sh.f)
+		}
+		for _, cmp := range []struct{ name, op string }{{"eq", "=="}, {"ne", "!="}, {"lt", "<"}, {"gt", ">"}, {"le", "<="}, {"ge", ">="}} {
+			simdExprs[sh.name+"."+cmp.name] = fmt.Sprintf("(%s) a %s (%s) b", sh.f, cmp.op, sh.f)
+		}
+	}
+}
+
+// simdLaneTypes holds the vector and C lane types of the splat, extract_lane
+// and replace_lane instructions by shape, floating point lanes being handled
+// as their bits.
+var simdLaneTypes = map[string][2]string{
+	"i8x16": {"u8x16", "uint8_t"},
+	"i16x8": {"u16x8", "uint16_t"},
+	"i32x4": {"u32x4", "uint32_t"},
+	"i64x2": {"u64x2", "uint64_t"},
+	"f32x4": {"u32x4", "uint32_t"},
+	"f64x2": {"u64x2", "uint64_t"},
+}
+
+// writeSIMD writes the C code of the SIMD instruction ins, returning false
+// if ins is not a SIMD instruction. v128 results are assigned as in the
+// interpreter: the low half to the target of ins and the high half to the
+// first yielded value.
+func (c *SSAFunctionCompiler) writeSIMD(b *strings.Builder, ins Instr) bool {
+	_, op, ok := simdOp(ins.Op)
+	if !ok {
+		return false
+	}
+
+	value := func(i int) string {
+		return fmt.Sprintf("%s%d", NGEN_VALUE_PREFIX, ins.Values[i])
+	}
+	operand := func(name string, i int) string {
+		return fmt.Sprintf("u64x2 %s = {%s.vu64, %s.vu64}; ", name, value(i), value(i+1))
+	}
+	fn := "simd_" + strings.Replace(op.Name, ".", "_", -1)
+	shape := op.Name[:strings.IndexByte(op.Name, '.')]
+
+	b.WriteString("{ ")
+
+	switch op.Kind {
+	case SIMDLoad:
+		bSprintf(b, "u64x2 r = %s(mem_translate(vm, %s, %d)); ", fn, c.memArgs(ins), simdLoadSizes[op.Name])
+	case SIMDLoadLane:
+		n := 16 / op.Lanes
+		b.WriteString(operand("r", 1))
+		bSprintf(b, "__builtin_memcpy((uint8_t *) &r + %d, mem_translate(vm, %s, %d), %d); ", int(ins.Immediates[3])*n, c.memArgs(ins), n, n)
+	case SIMDStore:
+		b.WriteString(operand("a", 1))
+		bSprintf(b, "__builtin_memcpy(mem_translate(vm, %s, 16), &a, 16); ", c.memArgs(ins))
+	case SIMDStoreLane:
+		n := 16 / op.Lanes
+		b.WriteString(operand("a", 1))
+		bSprintf(b, "__builtin_memcpy(mem_translate(vm, %s, %d), (uint8_t *) &a + %d, %d); ", c.memArgs(ins), n, int(ins.Immediates[3])*n, n)
+	case SIMDShuffle:
+		b.WriteString(operand("a", 0))
+		b.WriteString(operand("b", 2))
+		b.WriteString("u64x2 r = (u64x2) __builtin_shufflevector((u8x16) a, (u8x16) b")
+		for i := 0; i < 16; i++ {
+			bSprintf(b, ", %d", byte(uint64(ins.Immediates[i/8])>>uint(8*(i%8))))
+		}
+		b.WriteString("); ")
+	case SIMDSplat:
+		types := simdLaneTypes[shape]
+		bSprintf(b, "u64x2 r = (u64x2) ((%s) {0} + (%s) %s.vu64); ", types[0], types[1], value(0))
+	case SIMDExtractLane:
+		b.WriteString(operand("a", 0))
+		lane := ins.Immediates[0]
+		switch op.Name {
+		case "i8x16.extract_lane_s":
+			bSprintf(b, "%s%d.vu64 = (uint32_t) ((i8x16) a)[%d]; ", NGEN_VALUE_PREFIX, ins.Target, lane)
+		case "i16x8.extract_lane_s":
+			bSprintf(b, "%s%d.vu64 = (uint32_t) ((i16x8) a)[%d]; ", NGEN_VALUE_PREFIX, ins.Target, lane)
+		default:
+			bSprintf(b, "%s%d.vu64 = ((%s) a)[%d]; ", NGEN_VALUE_PREFIX, ins.Target, simdLaneTypes[shape][0], lane)
+		}
+	case SIMDReplaceLane:
+		types := simdLaneTypes[shape]
+		b.WriteString(operand("a", 0))
+		bSprintf(b, "%s l = (%s) a; l[%d] = (%s) %s.vu64; u64x2 r = (u64x2) l; ", types[0], types[0], ins.Immediates[0], types[1], value(2))
+	case SIMDUnary, SIMDBinary, SIMDTernary, SIMDShift:
+		names := []string{"a", "b", "c"}
+		args := []string{}
+		switch op.Kind {
+		case SIMDShift:
+			b.WriteString(operand("a", 0))
+			bSprintf(b, "uint32_t n = %s.vu32; ", value(2))
+		default:
+			for i := 0; i < op.NumValues()/2; i++ {
+				b.WriteString(operand(names[i], 2*i))
+				args = append(args, names[i])
+			}
+		}
+
+		expr, ok := simdExprs[op.Name]
+		if !ok {
+			expr = fmt.Sprintf("%s(%s)", fn, strings.Join(args, ", "))
+		}
+		bSprintf(b, "u64x2 r = (u64x2) (%s); ", expr)
+	case SIMDTest:
+		b.WriteString(operand("a", 0))
+		expr, ok := simdExprs[op.Name]
+		if !ok {
+			expr = fn + "(a)"
+		}
+		bSprintf(b, "%s%d.vu64 = %s; ", NGEN_VALUE_PREFIX, ins.Target, expr)
+	}
+
+	if op.HasV128Result() {
+		bSprintf(b, "%s%d.vu64 = r[0]; %syielded[0] = r[1]; ", NGEN_VALUE_PREFIX, ins.Target, NGEN_ENV_API_PREFIX)
+	}
+	b.WriteString("}")
+	return true
+}
@@ -0,0 +1,84 @@
+package opcodes
+
+// AtomicOpcode is the sub-opcode of an atomic memory instruction, following
+// the Atomic opcode in the serialized code. Its values are the sub-opcodes of
+// the 0xfe prefix of the WebAssembly binary format.
+type AtomicOpcode byte
+
+const (
+	MemoryAtomicNotify AtomicOpcode = 0x00
+	MemoryAtomicWait32 AtomicOpcode = 0x01
+	MemoryAtomicWait64 AtomicOpcode = 0x02
+	AtomicFence        AtomicOpcode = 0x03
+
+	I32AtomicLoad    AtomicOpcode = 0x10
+	I64AtomicLoad    AtomicOpcode = 0x11
+	I32AtomicLoad8U  AtomicOpcode = 0x12
+	I32AtomicLoad16U AtomicOpcode = 0x13
+	I64AtomicLoad8U  AtomicOpcode = 0x14
+	I64AtomicLoad16U AtomicOpcode = 0x15
+	I64AtomicLoad32U AtomicOpcode = 0x16
+	I32AtomicStore   AtomicOpcode = 0x17
+	I64AtomicStore   AtomicOpcode = 0x18
+	I32AtomicStore8  AtomicOpcode = 0x19
+	I32AtomicStore16 AtomicOpcode = 0x1a
+	I64AtomicStore8  AtomicOpcode = 0x1b
+	I64AtomicStore16 AtomicOpcode = 0x1c
+	I64AtomicStore32 AtomicOpcode = 0x1d
+
+	I32AtomicRmwAdd    AtomicOpcode = 0x1e
+	I64AtomicRmwAdd    AtomicOpcode = 0x1f
+	I32AtomicRmw8AddU  AtomicOpcode = 0x20
+	I32AtomicRmw16AddU AtomicOpcode = 0x21
+	I64AtomicRmw8AddU  AtomicOpcode = 0x22
+	I64AtomicRmw16AddU AtomicOpcode = 0x23
+	I64AtomicRmw32AddU AtomicOpcode = 0x24
+
+	I32AtomicRmwSub    AtomicOpcode = 0x25
+	I64AtomicRmwSub    AtomicOpcode = 0x26
+	I32AtomicRmw8SubU  AtomicOpcode = 0x27
+	I32AtomicRmw16SubU AtomicOpcode = 0x28
+	I64AtomicRmw8SubU  AtomicOpcode = 0x29
+	I64AtomicRmw16SubU AtomicOpcode = 0x2a
+	I64AtomicRmw32SubU AtomicOpcode = 0x2b
+
+	I32AtomicRmwAnd    AtomicOpcode = 0x2c
+	I64AtomicRmwAnd    AtomicOpcode = 0x2d
+	I32AtomicRmw8AndU  AtomicOpcode = 0x2e
+	I32AtomicRmw16AndU AtomicOpcode = 0x2f
+	I64AtomicRmw8AndU  AtomicOpcode = 0x30
+	I64AtomicRmw16AndU AtomicOpcode = 0x31
+	I64AtomicRmw32AndU AtomicOpcode = 0x32
+
+	I32AtomicRmwOr    AtomicOpcode = 0x33
+	I64AtomicRmwOr    AtomicOpcode = 0x34
+	I32AtomicRmw8OrU  AtomicOpcode = 0x35
+	I32AtomicRmw16OrU AtomicOpcode = 0x36
+	I64AtomicRmw8OrU  AtomicOpcode = 0x37
+	I64AtomicRmw16OrU AtomicOpcode = 0x38
+	I64AtomicRmw32OrU AtomicOpcode = 0x39
+
+	I32AtomicRmwXor    AtomicOpcode = 0x3a
+	I64AtomicRmwXor    AtomicOpcode = 0x3b
+	I32AtomicRmw8XorU  AtomicOpcode = 0x3c
+	I32AtomicRmw16XorU AtomicOpcode = 0x3d
+	I64AtomicRmw8XorU  AtomicOpcode = 0x3e
+	I64AtomicRmw16XorU AtomicOpcode = 0x3f
+	I64AtomicRmw32XorU AtomicOpcode = 0x40
+
+	I32AtomicRmwXchg    AtomicOpcode = 0x41
+	I64AtomicRmwXchg    AtomicOpcode = 0x42
+	I32AtomicRmw8XchgU  AtomicOpcode = 0x43
+	I32AtomicRmw16XchgU AtomicOpcode = 0x44
+	I64AtomicRmw8XchgU  AtomicOpcode = 0x45
+	I64AtomicRmw16XchgU AtomicOpcode = 0x46
+	I64AtomicRmw32XchgU AtomicOpcode = 0x47
+
+	I32AtomicRmwCmpxchg    AtomicOpcode = 0x48
+	I64AtomicRmwCmpxchg    AtomicOpcode = 0x49
+	I32AtomicRmw8CmpxchgU  AtomicOpcode = 0x4a
+	I32AtomicRmw16CmpxchgU AtomicOpcode = 0x4b
+	I64AtomicRmw8CmpxchgU  AtomicOpcode = 0x4c
+	I64AtomicRmw16CmpxchgU AtomicOpcode = 0x4d
+	I64AtomicRmw32CmpxchgU AtomicOpcode = 0x4e
+)
@@ -188,5 +188,51 @@ const (
 
 	FPDisabledError
 
+	Yield
+	PhiIndex
+	ReturnValues
+
+	I32Extend8S
+	I32Extend16S
+	I64Extend8S
+	I64Extend16S
+	I64Extend32S
+
+	I32TruncSatSF32
+	I32TruncSatUF32
+	I32TruncSatSF64
+	I32TruncSatUF64
+	I64TruncSatSF32
+	I64TruncSatUF32
+	I64TruncSatSF64
+	I64TruncSatUF64
+
+	MemoryInit
+	DataDrop
+	MemoryCopy
+	MemoryFill
+	TableInit
+	ElemDrop
+	TableCopy
+	AddGasScaled
+
+	TableGet
+	TableSet
+	TableSize
+	TableGrow
+	TableFill
+
+	SIMD
+	SIMDDisabledError
+
+	Atomic
+
+	ReturnCall
+	ReturnCallIndirect
+
+	Catch
+	Throw
+	Rethrow
+
 	Unknown
 )
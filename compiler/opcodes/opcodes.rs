@@ -162,5 +162,42 @@ pub enum Opcode {
     Phi = 158,
     AddGas = 159,
     FPDisabledError = 160,
-    Unknown = 161,
+    Yield = 161,
+    PhiIndex = 162,
+    ReturnValues = 163,
+    I32Extend8S = 164,
+    I32Extend16S = 165,
+    I64Extend8S = 166,
+    I64Extend16S = 167,
+    I64Extend32S = 168,
+    I32TruncSatSF32 = 169,
+    I32TruncSatUF32 = 170,
+    I32TruncSatSF64 = 171,
+    I32TruncSatUF64 = 172,
+    I64TruncSatSF32 = 173,
+    I64TruncSatUF32 = 174,
+    I64TruncSatSF64 = 175,
+    I64TruncSatUF64 = 176,
+    MemoryInit = 177,
+    DataDrop = 178,
+    MemoryCopy = 179,
+    MemoryFill = 180,
+    TableInit = 181,
+    ElemDrop = 182,
+    TableCopy = 183,
+    AddGasScaled = 184,
+    TableGet = 185,
+    TableSet = 186,
+    TableSize = 187,
+    TableGrow = 188,
+    TableFill = 189,
+    SIMD = 190,
+    SIMDDisabledError = 191,
+    Atomic = 192,
+    ReturnCall = 193,
+    ReturnCallIndirect = 194,
+    Catch = 195,
+    Throw = 196,
+    Rethrow = 197,
+    Unknown = 198,
 }
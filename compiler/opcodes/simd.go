@@ -0,0 +1,257 @@
+package opcodes
+
+// SIMDOpcode is the sub-opcode of a fixed-width SIMD instruction, following
+// the SIMD opcode in the serialized code. Its values are the sub-opcodes of
+// the 0xfd prefix of the WebAssembly binary format.
+type SIMDOpcode byte
+
+const (
+	V128Load        SIMDOpcode = 0x00
+	V128Load8x8S    SIMDOpcode = 0x01
+	V128Load8x8U    SIMDOpcode = 0x02
+	V128Load16x4S   SIMDOpcode = 0x03
+	V128Load16x4U   SIMDOpcode = 0x04
+	V128Load32x2S   SIMDOpcode = 0x05
+	V128Load32x2U   SIMDOpcode = 0x06
+	V128Load8Splat  SIMDOpcode = 0x07
+	V128Load16Splat SIMDOpcode = 0x08
+	V128Load32Splat SIMDOpcode = 0x09
+	V128Load64Splat SIMDOpcode = 0x0a
+	V128Store       SIMDOpcode = 0x0b
+	V128Const       SIMDOpcode = 0x0c
+	I8x16Shuffle    SIMDOpcode = 0x0d
+	I8x16Swizzle    SIMDOpcode = 0x0e
+	I8x16Splat      SIMDOpcode = 0x0f
+	I16x8Splat      SIMDOpcode = 0x10
+	I32x4Splat      SIMDOpcode = 0x11
+	I64x2Splat      SIMDOpcode = 0x12
+	F32x4Splat      SIMDOpcode = 0x13
+	F64x2Splat      SIMDOpcode = 0x14
+
+	I8x16ExtractLaneS SIMDOpcode = 0x15
+	I8x16ExtractLaneU SIMDOpcode = 0x16
+	I8x16ReplaceLane  SIMDOpcode = 0x17
+	I16x8ExtractLaneS SIMDOpcode = 0x18
+	I16x8ExtractLaneU SIMDOpcode = 0x19
+	I16x8ReplaceLane  SIMDOpcode = 0x1a
+	I32x4ExtractLane  SIMDOpcode = 0x1b
+	I32x4ReplaceLane  SIMDOpcode = 0x1c
+	I64x2ExtractLane  SIMDOpcode = 0x1d
+	I64x2ReplaceLane  SIMDOpcode = 0x1e
+	F32x4ExtractLane  SIMDOpcode = 0x1f
+	F32x4ReplaceLane  SIMDOpcode = 0x20
+	F64x2ExtractLane  SIMDOpcode = 0x21
+	F64x2ReplaceLane  SIMDOpcode = 0x22
+
+	I8x16Eq  SIMDOpcode = 0x23
+	I8x16Ne  SIMDOpcode = 0x24
+	I8x16LtS SIMDOpcode = 0x25
+	I8x16LtU SIMDOpcode = 0x26
+	I8x16GtS SIMDOpcode = 0x27
+	I8x16GtU SIMDOpcode = 0x28
+	I8x16LeS SIMDOpcode = 0x29
+	I8x16LeU SIMDOpcode = 0x2a
+	I8x16GeS SIMDOpcode = 0x2b
+	I8x16GeU SIMDOpcode = 0x2c
+	I16x8Eq  SIMDOpcode = 0x2d
+	I16x8Ne  SIMDOpcode = 0x2e
+	I16x8LtS SIMDOpcode = 0x2f
+	I16x8LtU SIMDOpcode = 0x30
+	I16x8GtS SIMDOpcode = 0x31
+	I16x8GtU SIMDOpcode = 0x32
+	I16x8LeS SIMDOpcode = 0x33
+	I16x8LeU SIMDOpcode = 0x34
+	I16x8GeS SIMDOpcode = 0x35
+	I16x8GeU SIMDOpcode = 0x36
+	I32x4Eq  SIMDOpcode = 0x37
+	I32x4Ne  SIMDOpcode = 0x38
+	I32x4LtS SIMDOpcode = 0x39
+	I32x4LtU SIMDOpcode = 0x3a
+	I32x4GtS SIMDOpcode = 0x3b
+	I32x4GtU SIMDOpcode = 0x3c
+	I32x4LeS SIMDOpcode = 0x3d
+	I32x4LeU SIMDOpcode = 0x3e
+	I32x4GeS SIMDOpcode = 0x3f
+	I32x4GeU SIMDOpcode = 0x40
+	F32x4Eq  SIMDOpcode = 0x41
+	F32x4Ne  SIMDOpcode = 0x42
+	F32x4Lt  SIMDOpcode = 0x43
+	F32x4Gt  SIMDOpcode = 0x44
+	F32x4Le  SIMDOpcode = 0x45
+	F32x4Ge  SIMDOpcode = 0x46
+	F64x2Eq  SIMDOpcode = 0x47
+	F64x2Ne  SIMDOpcode = 0x48
+	F64x2Lt  SIMDOpcode = 0x49
+	F64x2Gt  SIMDOpcode = 0x4a
+	F64x2Le  SIMDOpcode = 0x4b
+	F64x2Ge  SIMDOpcode = 0x4c
+
+	V128Not       SIMDOpcode = 0x4d
+	V128And       SIMDOpcode = 0x4e
+	V128AndNot    SIMDOpcode = 0x4f
+	V128Or        SIMDOpcode = 0x50
+	V128Xor       SIMDOpcode = 0x51
+	V128Bitselect SIMDOpcode = 0x52
+	V128AnyTrue   SIMDOpcode = 0x53
+
+	V128Load8Lane   SIMDOpcode = 0x54
+	V128Load16Lane  SIMDOpcode = 0x55
+	V128Load32Lane  SIMDOpcode = 0x56
+	V128Load64Lane  SIMDOpcode = 0x57
+	V128Store8Lane  SIMDOpcode = 0x58
+	V128Store16Lane SIMDOpcode = 0x59
+	V128Store32Lane SIMDOpcode = 0x5a
+	V128Store64Lane SIMDOpcode = 0x5b
+	V128Load32Zero  SIMDOpcode = 0x5c
+	V128Load64Zero  SIMDOpcode = 0x5d
+
+	F32x4DemoteF64x2Zero SIMDOpcode = 0x5e
+	F64x2PromoteLowF32x4 SIMDOpcode = 0x5f
+
+	I8x16Abs          SIMDOpcode = 0x60
+	I8x16Neg          SIMDOpcode = 0x61
+	I8x16Popcnt       SIMDOpcode = 0x62
+	I8x16AllTrue      SIMDOpcode = 0x63
+	I8x16Bitmask      SIMDOpcode = 0x64
+	I8x16NarrowI16x8S SIMDOpcode = 0x65
+	I8x16NarrowI16x8U SIMDOpcode = 0x66
+	F32x4Ceil         SIMDOpcode = 0x67
+	F32x4Floor        SIMDOpcode = 0x68
+	F32x4Trunc        SIMDOpcode = 0x69
+	F32x4Nearest      SIMDOpcode = 0x6a
+	I8x16Shl          SIMDOpcode = 0x6b
+	I8x16ShrS         SIMDOpcode = 0x6c
+	I8x16ShrU         SIMDOpcode = 0x6d
+	I8x16Add          SIMDOpcode = 0x6e
+	I8x16AddSatS      SIMDOpcode = 0x6f
+	I8x16AddSatU      SIMDOpcode = 0x70
+	I8x16Sub          SIMDOpcode = 0x71
+	I8x16SubSatS      SIMDOpcode = 0x72
+	I8x16SubSatU      SIMDOpcode = 0x73
+	F64x2Ceil         SIMDOpcode = 0x74
+	F64x2Floor        SIMDOpcode = 0x75
+	I8x16MinS         SIMDOpcode = 0x76
+	I8x16MinU         SIMDOpcode = 0x77
+	I8x16MaxS         SIMDOpcode = 0x78
+	I8x16MaxU         SIMDOpcode = 0x79
+	F64x2Trunc        SIMDOpcode = 0x7a
+	I8x16AvgrU        SIMDOpcode = 0x7b
+
+	I16x8ExtaddPairwiseI8x16S SIMDOpcode = 0x7c
+	I16x8ExtaddPairwiseI8x16U SIMDOpcode = 0x7d
+	I32x4ExtaddPairwiseI16x8S SIMDOpcode = 0x7e
+	I32x4ExtaddPairwiseI16x8U SIMDOpcode = 0x7f
+
+	I16x8Abs              SIMDOpcode = 0x80
+	I16x8Neg              SIMDOpcode = 0x81
+	I16x8Q15mulrSatS      SIMDOpcode = 0x82
+	I16x8AllTrue          SIMDOpcode = 0x83
+	I16x8Bitmask          SIMDOpcode = 0x84
+	I16x8NarrowI32x4S     SIMDOpcode = 0x85
+	I16x8NarrowI32x4U     SIMDOpcode = 0x86
+	I16x8ExtendLowI8x16S  SIMDOpcode = 0x87
+	I16x8ExtendHighI8x16S SIMDOpcode = 0x88
+	I16x8ExtendLowI8x16U  SIMDOpcode = 0x89
+	I16x8ExtendHighI8x16U SIMDOpcode = 0x8a
+	I16x8Shl              SIMDOpcode = 0x8b
+	I16x8ShrS             SIMDOpcode = 0x8c
+	I16x8ShrU             SIMDOpcode = 0x8d
+	I16x8Add              SIMDOpcode = 0x8e
+	I16x8AddSatS          SIMDOpcode = 0x8f
+	I16x8AddSatU          SIMDOpcode = 0x90
+	I16x8Sub              SIMDOpcode = 0x91
+	I16x8SubSatS          SIMDOpcode = 0x92
+	I16x8SubSatU          SIMDOpcode = 0x93
+	F64x2Nearest          SIMDOpcode = 0x94
+	I16x8Mul              SIMDOpcode = 0x95
+	I16x8MinS             SIMDOpcode = 0x96
+	I16x8MinU             SIMDOpcode = 0x97
+	I16x8MaxS             SIMDOpcode = 0x98
+	I16x8MaxU             SIMDOpcode = 0x99
+	I16x8AvgrU            SIMDOpcode = 0x9b
+	I16x8ExtmulLowI8x16S  SIMDOpcode = 0x9c
+	I16x8ExtmulHighI8x16S SIMDOpcode = 0x9d
+	I16x8ExtmulLowI8x16U  SIMDOpcode = 0x9e
+	I16x8ExtmulHighI8x16U SIMDOpcode = 0x9f
+
+	I32x4Abs              SIMDOpcode = 0xa0
+	I32x4Neg              SIMDOpcode = 0xa1
+	I32x4AllTrue          SIMDOpcode = 0xa3
+	I32x4Bitmask          SIMDOpcode = 0xa4
+	I32x4ExtendLowI16x8S  SIMDOpcode = 0xa7
+	I32x4ExtendHighI16x8S SIMDOpcode = 0xa8
+	I32x4ExtendLowI16x8U  SIMDOpcode = 0xa9
+	I32x4ExtendHighI16x8U SIMDOpcode = 0xaa
+	I32x4Shl              SIMDOpcode = 0xab
+	I32x4ShrS             SIMDOpcode = 0xac
+	I32x4ShrU             SIMDOpcode = 0xad
+	I32x4Add              SIMDOpcode = 0xae
+	I32x4Sub              SIMDOpcode = 0xb1
+	I32x4Mul              SIMDOpcode = 0xb5
+	I32x4MinS             SIMDOpcode = 0xb6
+	I32x4MinU             SIMDOpcode = 0xb7
+	I32x4MaxS             SIMDOpcode = 0xb8
+	I32x4MaxU             SIMDOpcode = 0xb9
+	I32x4DotI16x8S        SIMDOpcode = 0xba
+	I32x4ExtmulLowI16x8S  SIMDOpcode = 0xbc
+	I32x4ExtmulHighI16x8S SIMDOpcode = 0xbd
+	I32x4ExtmulLowI16x8U  SIMDOpcode = 0xbe
+	I32x4ExtmulHighI16x8U SIMDOpcode = 0xbf
+
+	I64x2Abs              SIMDOpcode = 0xc0
+	I64x2Neg              SIMDOpcode = 0xc1
+	I64x2AllTrue          SIMDOpcode = 0xc3
+	I64x2Bitmask          SIMDOpcode = 0xc4
+	I64x2ExtendLowI32x4S  SIMDOpcode = 0xc7
+	I64x2ExtendHighI32x4S SIMDOpcode = 0xc8
+	I64x2ExtendLowI32x4U  SIMDOpcode = 0xc9
+	I64x2ExtendHighI32x4U SIMDOpcode = 0xca
+	I64x2Shl              SIMDOpcode = 0xcb
+	I64x2ShrS             SIMDOpcode = 0xcc
+	I64x2ShrU             SIMDOpcode = 0xcd
+	I64x2Add              SIMDOpcode = 0xce
+	I64x2Sub              SIMDOpcode = 0xd1
+	I64x2Mul              SIMDOpcode = 0xd5
+	I64x2Eq               SIMDOpcode = 0xd6
+	I64x2Ne               SIMDOpcode = 0xd7
+	I64x2LtS              SIMDOpcode = 0xd8
+	I64x2GtS              SIMDOpcode = 0xd9
+	I64x2LeS              SIMDOpcode = 0xda
+	I64x2GeS              SIMDOpcode = 0xdb
+	I64x2ExtmulLowI32x4S  SIMDOpcode = 0xdc
+	I64x2ExtmulHighI32x4S SIMDOpcode = 0xdd
+	I64x2ExtmulLowI32x4U  SIMDOpcode = 0xde
+	I64x2ExtmulHighI32x4U SIMDOpcode = 0xdf
+
+	F32x4Abs  SIMDOpcode = 0xe0
+	F32x4Neg  SIMDOpcode = 0xe1
+	F32x4Sqrt SIMDOpcode = 0xe3
+	F32x4Add  SIMDOpcode = 0xe4
+	F32x4Sub  SIMDOpcode = 0xe5
+	F32x4Mul  SIMDOpcode = 0xe6
+	F32x4Div  SIMDOpcode = 0xe7
+	F32x4Min  SIMDOpcode = 0xe8
+	F32x4Max  SIMDOpcode = 0xe9
+	F32x4Pmin SIMDOpcode = 0xea
+	F32x4Pmax SIMDOpcode = 0xeb
+	F64x2Abs  SIMDOpcode = 0xec
+	F64x2Neg  SIMDOpcode = 0xed
+	F64x2Sqrt SIMDOpcode = 0xef
+	F64x2Add  SIMDOpcode = 0xf0
+	F64x2Sub  SIMDOpcode = 0xf1
+	F64x2Mul  SIMDOpcode = 0xf2
+	F64x2Div  SIMDOpcode = 0xf3
+	F64x2Min  SIMDOpcode = 0xf4
+	F64x2Max  SIMDOpcode = 0xf5
+	F64x2Pmin SIMDOpcode = 0xf6
+	F64x2Pmax SIMDOpcode = 0xf7
+
+	I32x4TruncSatF32x4S     SIMDOpcode = 0xf8
+	I32x4TruncSatF32x4U     SIMDOpcode = 0xf9
+	F32x4ConvertI32x4S      SIMDOpcode = 0xfa
+	F32x4ConvertI32x4U      SIMDOpcode = 0xfb
+	I32x4TruncSatF64x2SZero SIMDOpcode = 0xfc
+	I32x4TruncSatF64x2UZero SIMDOpcode = 0xfd
+	F64x2ConvertLowI32x4S   SIMDOpcode = 0xfe
+	F64x2ConvertLowI32x4U   SIMDOpcode = 0xff
+)
@@ -0,0 +1,696 @@
+package compiler
+
+import "math/bits"
+
+// Optimizations selects the optimization passes run over the code of each
+// function. Passes run once gas counters are inserted, and keep charging the
+// gas of the original code, so that the gas used by a function does not
+// depend on the optimizations. All passes are disabled by default.
+type Optimizations struct {
+	// CopyPropagation replaces the values read by get_local with the values
+	// the local was last set to, or read as, in the same basic block.
+	CopyPropagation bool
+
+	// ConstantFolding evaluates the integer instructions and selects whose
+	// operands are constants, unless they trap.
+	ConstantFolding bool
+
+	// DeadCodeElimination removes the instructions without side effects
+	// whose values are unused, and the instructions following those which
+	// never complete.
+	DeadCodeElimination bool
+
+	// SimplifyCFG resolves branches on constants, threads jumps through
+	// empty blocks, merges blocks into their only predecessor and removes
+	// unreachable blocks.
+	SimplifyCFG bool
+}
+
+// AllOptimizations enables all the optimization passes.
+var AllOptimizations = Optimizations{
+	CopyPropagation:     true,
+	ConstantFolding:     true,
+	DeadCodeElimination: true,
+	SimplifyCFG:         true,
+}
+
+// Optimize runs the optimization passes enabled in opts over the code of the
+// function, in the order of the fields of Optimizations. The markers of try
+// blocks are kept in place, and the catch clauses, which are only entered by
+// unwinding the stack, are kept along with the code they reach.
+func (c *SSAFunctionCompiler) Optimize(opts Optimizations) {
+	if opts == (Optimizations{}) {
+		return
+	}
+
+	g := c.NewCFGraph()
+	if opts.CopyPropagation {
+		g.PropagateCopies()
+	}
+	if opts.ConstantFolding {
+		g.FoldConstants()
+	}
+	if opts.DeadCodeElimination {
+		g.EliminateDeadCode()
+	}
+	if opts.SimplifyCFG {
+		g.Simplify()
+	}
+	c.Code = g.ToInsSeq()
+}
+
+// PropagateCopies replaces the values read by get_local with the values the
+// local was last set to, or read as, in the same basic block. Other blocks
+// may be entered with the local holding any value.
+func (g *CFGraph) PropagateCopies() {
+	renames := make(map[TyValueID]TyValueID)
+	for i := range g.Blocks {
+		known := make(map[int64]TyValueID)
+		for _, ins := range g.Blocks[i].Code {
+			switch ins.Op {
+			case "set_local":
+				known[ins.Immediates[0]] = ins.Values[0]
+			case "get_local":
+				if v, ok := known[ins.Immediates[0]]; ok {
+					renames[ins.Target] = v
+				} else {
+					known[ins.Immediates[0]] = ins.Target
+				}
+			}
+		}
+	}
+	g.renameValues(renames)
+}
+
+// FoldConstants evaluates the integer instructions whose operands are
+// constants into constants, and replaces the selects on constants with the
+// value they select. Instructions which would trap are left to trap at run
+// time.
+func (g *CFGraph) FoldConstants() {
+	consts := g.constants()
+	renames := make(map[TyValueID]TyValueID)
+
+	for changed := true; changed; {
+		changed = false
+		for i := range g.Blocks {
+			code := g.Blocks[i].Code
+			for j := range code {
+				ins := &code[j]
+				if ins.Target == 0 {
+					continue
+				}
+				if _, ok := consts[ins.Target]; ok {
+					continue
+				}
+
+				if ins.Op == "select" {
+					if cond, ok := consts[ins.Values[2]]; ok {
+						if _, ok := renames[ins.Target]; !ok {
+							if uint32(cond) != 0 {
+								renames[ins.Target] = ins.Values[0]
+							} else {
+								renames[ins.Target] = ins.Values[1]
+							}
+						}
+					}
+					continue
+				}
+
+				operands := make([]int64, len(ins.Values))
+				folded := len(ins.Values) > 0
+				for k, v := range ins.Values {
+					if operands[k], folded = consts[v]; !folded {
+						break
+					}
+				}
+				if !folded {
+					continue
+				}
+
+				if op, value, ok := foldInstr(ins.Op, operands); ok {
+					*ins = buildInstr(ins.Target, op, []int64{value}, nil)
+					consts[ins.Target] = value
+					changed = true
+				}
+			}
+		}
+	}
+	g.renameValues(renames)
+}
+
+// constants returns the values of the integer constants defined in g.
+func (g *CFGraph) constants() map[TyValueID]int64 {
+	consts := make(map[TyValueID]int64)
+	for _, bb := range g.Blocks {
+		for _, ins := range bb.Code {
+			if ins.Op == "i32.const" || ins.Op == "i64.const" {
+				consts[ins.Target] = ins.Immediates[0]
+			}
+		}
+	}
+	return consts
+}
+
+// foldInstr evaluates the integer instruction op on constant operands, and
+// returns the constant instruction and the immediate its result is held by.
+func foldInstr(op string, operands []int64) (string, int64, bool) {
+	i32 := func(v uint32) (string, int64, bool) { return "i32.const", int64(int32(v)), true }
+	i64 := func(v uint64) (string, int64, bool) { return "i64.const", int64(v), true }
+	bool32 := func(b bool) (string, int64, bool) {
+		if b {
+			return i32(1)
+		}
+		return i32(0)
+	}
+
+	if len(operands) == 1 {
+		a32, a64 := uint32(operands[0]), uint64(operands[0])
+		switch op {
+		case "i32.clz":
+			return i32(uint32(bits.LeadingZeros32(a32)))
+		case "i32.ctz":
+			return i32(uint32(bits.TrailingZeros32(a32)))
+		case "i32.popcnt":
+			return i32(uint32(bits.OnesCount32(a32)))
+		case "i32.eqz":
+			return bool32(a32 == 0)
+		case "i32.extend8_s":
+			return i32(uint32(int8(a32)))
+		case "i32.extend16_s":
+			return i32(uint32(int16(a32)))
+		case "i64.clz":
+			return i64(uint64(bits.LeadingZeros64(a64)))
+		case "i64.ctz":
+			return i64(uint64(bits.TrailingZeros64(a64)))
+		case "i64.popcnt":
+			return i64(uint64(bits.OnesCount64(a64)))
+		case "i64.eqz":
+			return bool32(a64 == 0)
+		case "i64.extend8_s":
+			return i64(uint64(int8(a64)))
+		case "i64.extend16_s":
+			return i64(uint64(int16(a64)))
+		case "i64.extend32_s", "i64.extend_s/i32":
+			return i64(uint64(int32(a64)))
+		case "i64.extend_u/i32":
+			return i64(uint64(uint32(a64)))
+		case "i32.wrap/i64":
+			return i32(uint32(a64))
+		}
+		return "", 0, false
+	}
+
+	if len(operands) != 2 {
+		return "", 0, false
+	}
+
+	a32, b32 := uint32(operands[0]), uint32(operands[1])
+	a64, b64 := uint64(operands[0]), uint64(operands[1])
+	switch op {
+	case "i32.add":
+		return i32(a32 + b32)
+	case "i32.sub":
+		return i32(a32 - b32)
+	case "i32.mul":
+		return i32(a32 * b32)
+	case "i32.div_s":
+		if b32 != 0 && !(int32(a32) == -1<<31 && int32(b32) == -1) {
+			return i32(uint32(int32(a32) / int32(b32)))
+		}
+	case "i32.div_u":
+		if b32 != 0 {
+			return i32(a32 / b32)
+		}
+	case "i32.rem_s":
+		if b32 != 0 {
+			if int32(b32) == -1 {
+				return i32(0)
+			}
+			return i32(uint32(int32(a32) % int32(b32)))
+		}
+	case "i32.rem_u":
+		if b32 != 0 {
+			return i32(a32 % b32)
+		}
+	case "i32.and":
+		return i32(a32 & b32)
+	case "i32.or":
+		return i32(a32 | b32)
+	case "i32.xor":
+		return i32(a32 ^ b32)
+	case "i32.shl":
+		return i32(a32 << (b32 & 31))
+	case "i32.shr_s":
+		return i32(uint32(int32(a32) >> (b32 & 31)))
+	case "i32.shr_u":
+		return i32(a32 >> (b32 & 31))
+	case "i32.rotl":
+		return i32(bits.RotateLeft32(a32, int(b32&31)))
+	case "i32.rotr":
+		return i32(bits.RotateLeft32(a32, -int(b32&31)))
+	case "i32.eq":
+		return bool32(a32 == b32)
+	case "i32.ne":
+		return bool32(a32 != b32)
+	case "i32.lt_s":
+		return bool32(int32(a32) < int32(b32))
+	case "i32.lt_u":
+		return bool32(a32 < b32)
+	case "i32.le_s":
+		return bool32(int32(a32) <= int32(b32))
+	case "i32.le_u":
+		return bool32(a32 <= b32)
+	case "i32.gt_s":
+		return bool32(int32(a32) > int32(b32))
+	case "i32.gt_u":
+		return bool32(a32 > b32)
+	case "i32.ge_s":
+		return bool32(int32(a32) >= int32(b32))
+	case "i32.ge_u":
+		return bool32(a32 >= b32)
+
+	case "i64.add":
+		return i64(a64 + b64)
+	case "i64.sub":
+		return i64(a64 - b64)
+	case "i64.mul":
+		return i64(a64 * b64)
+	case "i64.div_s":
+		if b64 != 0 && !(int64(a64) == -1<<63 && int64(b64) == -1) {
+			return i64(uint64(int64(a64) / int64(b64)))
+		}
+	case "i64.div_u":
+		if b64 != 0 {
+			return i64(a64 / b64)
+		}
+	case "i64.rem_s":
+		if b64 != 0 {
+			if int64(b64) == -1 {
+				return i64(0)
+			}
+			return i64(uint64(int64(a64) % int64(b64)))
+		}
+	case "i64.rem_u":
+		if b64 != 0 {
+			return i64(a64 % b64)
+		}
+	case "i64.and":
+		return i64(a64 & b64)
+	case "i64.or":
+		return i64(a64 | b64)
+	case "i64.xor":
+		return i64(a64 ^ b64)
+	case "i64.shl":
+		return i64(a64 << (b64 & 63))
+	case "i64.shr_s":
+		return i64(uint64(int64(a64) >> (b64 & 63)))
+	case "i64.shr_u":
+		return i64(a64 >> (b64 & 63))
+	case "i64.rotl":
+		return i64(bits.RotateLeft64(a64, int(b64&63)))
+	case "i64.rotr":
+		return i64(bits.RotateLeft64(a64, -int(b64&63)))
+	case "i64.eq":
+		return bool32(a64 == b64)
+	case "i64.ne":
+		return bool32(a64 != b64)
+	case "i64.lt_s":
+		return bool32(int64(a64) < int64(b64))
+	case "i64.lt_u":
+		return bool32(a64 < b64)
+	case "i64.le_s":
+		return bool32(int64(a64) <= int64(b64))
+	case "i64.le_u":
+		return bool32(a64 <= b64)
+	case "i64.gt_s":
+		return bool32(int64(a64) > int64(b64))
+	case "i64.gt_u":
+		return bool32(a64 > b64)
+	case "i64.ge_s":
+		return bool32(int64(a64) >= int64(b64))
+	case "i64.ge_u":
+		return bool32(a64 >= b64)
+	}
+	return "", 0, false
+}
+
+// pureOps holds the instructions without side effects which never trap,
+// and may thus be removed when their values are unused.
+var pureOps = makeOpSet(
+	"i32.const", "i64.const", "f32.const", "f64.const",
+	"get_local", "get_global", "phi", "select", "memory.size", "table.size",
+	"i32.add", "i32.sub", "i32.mul", "i32.and", "i32.or", "i32.xor", "i32.shl", "i32.shr_s", "i32.shr_u", "i32.rotl", "i32.rotr",
+	"i32.eq", "i32.ne", "i32.lt_s", "i32.lt_u", "i32.le_s", "i32.le_u", "i32.gt_s", "i32.gt_u", "i32.ge_s", "i32.ge_u",
+	"i64.add", "i64.sub", "i64.mul", "i64.and", "i64.or", "i64.xor", "i64.shl", "i64.shr_s", "i64.shr_u", "i64.rotl", "i64.rotr",
+	"i64.eq", "i64.ne", "i64.lt_s", "i64.lt_u", "i64.le_s", "i64.le_u", "i64.gt_s", "i64.gt_u", "i64.ge_s", "i64.ge_u",
+	"f32.add", "f32.sub", "f32.mul", "f32.div", "f32.min", "f32.max", "f32.copysign",
+	"f32.eq", "f32.ne", "f32.lt", "f32.le", "f32.gt", "f32.ge",
+	"f64.add", "f64.sub", "f64.mul", "f64.div", "f64.min", "f64.max", "f64.copysign",
+	"f64.eq", "f64.ne", "f64.lt", "f64.le", "f64.gt", "f64.ge",
+	"i32.clz", "i32.ctz", "i32.popcnt", "i32.eqz",
+	"i64.clz", "i64.ctz", "i64.popcnt", "i64.eqz",
+	"f32.sqrt", "f32.ceil", "f32.floor", "f32.trunc", "f32.nearest", "f32.abs", "f32.neg",
+	"f64.sqrt", "f64.ceil", "f64.floor", "f64.trunc", "f64.nearest", "f64.abs", "f64.neg",
+	"i32.wrap/i64", "i64.extend_u/i32", "i64.extend_s/i32",
+	"i32.extend8_s", "i32.extend16_s", "i64.extend8_s", "i64.extend16_s", "i64.extend32_s",
+	"i32.trunc_u:sat/f32", "i32.trunc_u:sat/f64", "i64.trunc_u:sat/f32", "i64.trunc_u:sat/f64",
+	"i32.trunc_s:sat/f32", "i32.trunc_s:sat/f64", "i64.trunc_s:sat/f32", "i64.trunc_s:sat/f64",
+	"f32.demote/f64", "f64.promote/f32",
+	"f32.convert_u/i32", "f32.convert_u/i64", "f64.convert_u/i32", "f64.convert_u/i64",
+	"f32.convert_s/i32", "f32.convert_s/i64", "f64.convert_s/i32", "f64.convert_s/i64",
+	"i32.reinterpret/f32", "i64.reinterpret/f64",
+	"f32.reinterpret/i32", "f64.reinterpret/i64",
+)
+
+func makeOpSet(ops ...string) map[string]struct{} {
+	ret := make(map[string]struct{}, len(ops))
+	for _, op := range ops {
+		ret[op] = struct{}{}
+	}
+	return ret
+}
+
+// EliminateDeadCode removes the instructions following those which never
+// complete in each block, and the pure instructions whose values are unused.
+func (g *CFGraph) EliminateDeadCode() {
+	for i := range g.Blocks {
+		bb := &g.Blocks[i]
+		for j, ins := range bb.Code {
+			if neverCompletes(ins) {
+				code := append([]Instr(nil), bb.Code[:j+1]...)
+				for _, ins := range bb.Code[j+1:] {
+					if isHandlerMarker(ins) {
+						code = append(code, ins)
+					}
+				}
+				bb.Code = code
+				break
+			}
+		}
+	}
+
+	uses := make(map[TyValueID]int)
+	for _, bb := range g.Blocks {
+		for _, ins := range bb.Code {
+			for _, v := range ins.Values {
+				uses[v]++
+			}
+		}
+		uses[bb.JmpCond]++
+		uses[bb.YieldValue]++
+		for _, v := range bb.ReturnValues {
+			uses[v]++
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for i := len(g.Blocks) - 1; i >= 0; i-- {
+			bb := &g.Blocks[i]
+			code := bb.Code[:0:0]
+			for j := len(bb.Code) - 1; j >= 0; j-- {
+				ins := bb.Code[j]
+				if _, ok := pureOps[ins.Op]; ok && ins.Target != 0 && uses[ins.Target] == 0 {
+					for _, v := range ins.Values {
+						uses[v]--
+					}
+					changed = true
+					continue
+				}
+				code = append(code, ins)
+			}
+			for l, r := 0, len(code)-1; l < r; l, r = l+1, r-1 {
+				code[l], code[r] = code[r], code[l]
+			}
+			bb.Code = code
+		}
+	}
+}
+
+// neverCompletes tells whether the execution never proceeds past ins.
+func neverCompletes(ins Instr) bool {
+	switch ins.Op {
+	case "unreachable", "throw", "rethrow", "return_call", "return_call_indirect", "fp_disabled_error", "simd_disabled_error":
+		return true
+	}
+	return false
+}
+
+// Simplify simplifies the control flow of g: branches on constants are
+// replaced with jumps, jumps to empty blocks are redirected to the targets of
+// these, unreachable blocks are removed, and blocks are merged into their
+// only predecessor when they follow it.
+func (g *CFGraph) Simplify() {
+	g.foldBranches()
+	g.threadJumps()
+	g.removeUnreachableBlocks()
+	g.mergeBlocks()
+}
+
+// foldBranches replaces the conditional branches on constants with jumps.
+func (g *CFGraph) foldBranches() {
+	consts := g.constants()
+	for i := range g.Blocks {
+		bb := &g.Blocks[i]
+		cond, ok := consts[bb.JmpCond]
+		if !ok || bb.JmpCond == 0 {
+			continue
+		}
+
+		var target int
+		switch bb.JmpKind {
+		case JmpEither:
+			if uint32(cond) != 0 {
+				target = bb.JmpTargets[0]
+			} else {
+				target = bb.JmpTargets[1]
+			}
+		case JmpTable:
+			if index := uint32(cond); index < uint32(len(bb.JmpTargets)-1) {
+				target = bb.JmpTargets[index]
+			} else {
+				target = bb.JmpTargets[len(bb.JmpTargets)-1]
+			}
+		default:
+			continue
+		}
+		bb.JmpKind = JmpUncond
+		bb.JmpTargets = []int{target}
+		bb.JmpCond = 0
+	}
+}
+
+// threadJumps redirects the jumps to empty blocks ending with a jump to the
+// targets of these. The value passed along the jump of the empty block is
+// passed along the redirected jump instead, which must thus either pass no
+// other value or lead to a block not receiving it.
+//
+// Blocks only charging gas are considered empty by the blocks jumping to them
+// unconditionally, which charge the gas themselves before their jump.
+func (g *CFGraph) threadJumps() {
+	for i := range g.Blocks {
+		bb := &g.Blocks[i]
+		for j := range bb.JmpTargets {
+			for hops := 0; hops < len(g.Blocks); hops++ {
+				next := &g.Blocks[bb.JmpTargets[j]]
+				if next.JmpKind != JmpUncond || next.JmpTargets[0] == bb.JmpTargets[j] {
+					break
+				}
+				if len(next.Code) != 0 && (bb.JmpKind != JmpUncond || !next.chargesGasOnly()) {
+					break
+				}
+
+				target := next.JmpTargets[0]
+				switch {
+				case bb.JmpKind == JmpUncond:
+					bb.YieldValue = next.YieldValue
+				case bb.YieldValue == next.YieldValue, !g.Blocks[target].receivesValue():
+				default:
+					target = bb.JmpTargets[j]
+				}
+				if target == bb.JmpTargets[j] {
+					break
+				}
+				bb.Code = append(bb.Code[:len(bb.Code):len(bb.Code)], next.Code...)
+				bb.JmpTargets[j] = target
+			}
+		}
+
+		if bb.JmpKind == JmpEither && bb.JmpTargets[0] == bb.JmpTargets[1] {
+			bb.JmpKind = JmpUncond
+			bb.JmpTargets = bb.JmpTargets[:1]
+			bb.JmpCond = 0
+		}
+	}
+}
+
+// chargesGasOnly tells whether the code of bb only charges gas.
+func (bb *BasicBlock) chargesGasOnly() bool {
+	for _, ins := range bb.Code {
+		if ins.Op != "add_gas" {
+			return false
+		}
+	}
+	return true
+}
+
+// receivesValue tells whether bb reads the value passed along the jumps to
+// it.
+func (bb *BasicBlock) receivesValue() bool {
+	for _, ins := range bb.Code {
+		if ins.Op == "phi" && len(ins.Immediates) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeBlocks merges the blocks which are only entered by the jump of the
+// block before them into it. The value passed along the jump replaces the
+// value received by the merged block.
+func (g *CFGraph) mergeBlocks() {
+	numPreds := make([]int, len(g.Blocks))
+	for _, succs := range g.successors() {
+		for _, succ := range succs {
+			numPreds[succ]++
+		}
+	}
+
+	renames := make(map[TyValueID]TyValueID)
+	merged := make([]bool, len(g.Blocks))
+	for i := range g.Blocks {
+		if merged[i] {
+			continue
+		}
+		bb := &g.Blocks[i]
+		last := i
+		for bb.JmpKind == JmpUncond && bb.JmpTargets[0] == last+1 && numPreds[last+1] == 1 {
+			next := &g.Blocks[last+1]
+			if len(next.Code) > 0 && next.Code[0].Op == "catch" {
+				break
+			}
+			if next.receivesValue() && bb.YieldValue == 0 {
+				break
+			}
+
+			for _, ins := range next.Code {
+				if ins.Op == "phi" && len(ins.Immediates) == 0 {
+					renames[ins.Target] = bb.YieldValue
+					continue
+				}
+				bb.Code = append(bb.Code, ins)
+			}
+			bb.JmpKind, bb.JmpTargets = next.JmpKind, next.JmpTargets
+			bb.JmpCond, bb.YieldValue, bb.ReturnValues = next.JmpCond, next.YieldValue, next.ReturnValues
+			merged[last+1] = true
+			last++
+		}
+	}
+	g.renameValues(renames)
+
+	// Merged blocks are no longer entered.
+	keep := make([]bool, len(g.Blocks))
+	for i := range keep {
+		keep[i] = !merged[i]
+	}
+	g.removeBlocks(keep)
+}
+
+// removeUnreachableBlocks removes the blocks which are neither reachable from
+// the entry block nor from a catch clause. Unreachable blocks holding the
+// markers of try blocks are kept.
+func (g *CFGraph) removeUnreachableBlocks() {
+	reachable := make([]bool, len(g.Blocks))
+	var work []int
+	for i, bb := range g.Blocks {
+		if i == 0 || len(bb.Code) > 0 && bb.Code[0].Op == "catch" {
+			reachable[i] = true
+			work = append(work, i)
+		}
+	}
+
+	succs := g.successors()
+	for len(work) > 0 {
+		i := work[len(work)-1]
+		work = work[:len(work)-1]
+		for _, succ := range succs[i] {
+			if !reachable[succ] {
+				reachable[succ] = true
+				work = append(work, succ)
+			}
+		}
+	}
+
+	for i, bb := range g.Blocks {
+		for _, ins := range bb.Code {
+			if isHandlerMarker(ins) {
+				reachable[i] = true
+			}
+		}
+	}
+
+	g.removeBlocks(reachable)
+}
+
+// removeBlocks removes the blocks of g which are not kept, none of which may
+// be the target of a kept block.
+func (g *CFGraph) removeBlocks(keep []bool) {
+	relocs := make([]int, len(g.Blocks))
+	blocks := g.Blocks[:0]
+	for i, bb := range g.Blocks {
+		if keep[i] {
+			relocs[i] = len(blocks)
+			blocks = append(blocks, bb)
+		}
+	}
+	for i := range blocks {
+		for j, target := range blocks[i].JmpTargets {
+			blocks[i].JmpTargets[j] = relocs[target]
+		}
+	}
+	g.Blocks = blocks
+}
+
+// renameValues replaces the uses of the values renamed in g, following
+// chains of renames.
+func (g *CFGraph) renameValues(renames map[TyValueID]TyValueID) {
+	if len(renames) == 0 {
+		return
+	}
+
+	rename := func(v TyValueID) TyValueID {
+		for {
+			to, ok := renames[v]
+			if !ok {
+				return v
+			}
+			v = to
+		}
+	}
+
+	for i := range g.Blocks {
+		bb := &g.Blocks[i]
+		for j := range bb.Code {
+			ins := &bb.Code[j]
+
+			// Operands may share their backing arrays with other instructions.
+			if len(ins.Values) > 0 {
+				values := make([]TyValueID, len(ins.Values))
+				for k, v := range ins.Values {
+					values[k] = rename(v)
+				}
+				ins.Values = values
+			}
+		}
+
+		bb.JmpCond = rename(bb.JmpCond)
+		bb.YieldValue = rename(bb.YieldValue)
+		if len(bb.ReturnValues) > 0 {
+			values := make([]TyValueID, len(bb.ReturnValues))
+			for k, v := range bb.ReturnValues {
+				values[k] = rename(v)
+			}
+			bb.ReturnValues = values
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package compiler
+
+import "testing"
+
+func TestMergeBlocksRemovesMergedBlocks(t *testing.T) {
+	c := &SSAFunctionCompiler{Code: []Instr{
+		buildInstr(1, "i32.const", []int64{1}, nil),
+		buildInstr(0, "jmp", []int64{2}, []TyValueID{0}),
+		buildInstr(2, "i32.const", []int64{2}, nil),
+		buildInstr(0, "jmp", []int64{4}, []TyValueID{0}),
+		buildInstr(0, "return", nil, []TyValueID{2}),
+	}}
+	g := c.NewCFGraph()
+	g.mergeBlocks()
+
+	// The three blocks of the chain are merged, the trailing block is left.
+	if len(g.Blocks) != 2 {
+		t.Fatalf("%d blocks after merging", len(g.Blocks))
+	}
+	if len(g.Blocks[0].Code) != 2 || g.Blocks[0].JmpKind != JmpReturn {
+		t.Fatalf("chain not merged: %+v", g.Blocks[0])
+	}
+	for i, bb := range g.Blocks {
+		for _, target := range bb.JmpTargets {
+			if target == i {
+				t.Fatalf("block %d jumps to itself", i)
+			}
+		}
+	}
+}
@@ -0,0 +1,821 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/go-interpreter/wagon/wasm"
+	"github.com/go-interpreter/wagon/wasm/leb128"
+
+	"github.com/perlin-network/life/compiler/opcodes"
+)
+
+const (
+	sectionIDDataCount = 12
+	sectionIDTag       = 13
+)
+
+// ExternalTag is the external kind of tags, as introduced by the exception
+// handling proposal.
+const ExternalTag wasm.External = 4
+
+// NullElement is the value of null function references in element segments.
+const NullElement = math.MaxUint32
+
+// DataSegment is a segment of the data section. Active segments are copied
+// into their memory on instantiation and count as dropped afterwards.
+type DataSegment struct {
+	Passive     bool
+	Data        []byte
+	MemoryIndex uint32 // memory of active segments
+	Offset      []byte // offset expression of active segments, nil otherwise
+}
+
+// MemoryType is the type of a linear memory, as extended by the threads and
+// memory64 proposals. Sizes are in pages.
+type MemoryType struct {
+	Initial    uint64
+	Maximum    uint64 // valid if HasMaximum
+	HasMaximum bool
+	Shared     bool
+	Memory64   bool // indexed by i64 addresses
+}
+
+// ElemSegment is a segment of the element section. Active segments are
+// copied into their table on instantiation, and active and declarative ones
+// count as dropped afterwards.
+type ElemSegment struct {
+	Passive    bool
+	Type       wasm.ValueType // element type
+	Elems      []uint32       // function indices, or NullElement
+	TableIndex uint32         // table of active segments
+	Offset     []byte         // offset expression of active segments, nil otherwise
+}
+
+// Reference types introduced by the reference types proposal.
+const (
+	ValueTypeFuncRef   wasm.ValueType = 0x70
+	ValueTypeExternRef wasm.ValueType = 0x6f
+)
+
+// extendedSections holds the contents of the sections rewriteSections
+// rewrites.
+type extendedSections struct {
+	DataSegments []DataSegment
+	ElemSegments []ElemSegment
+	TableTypes   []wasm.ValueType
+	V128Globals  []V128Global // indices relative to the global section
+	MemoryTypes  []MemoryType
+	Tags         []uint32 // type indices of the declared tags
+	TagImports   []TagImport
+	TagExports   map[string]uint32
+}
+
+// TagImport is a tag imported by a module.
+type TagImport struct {
+	ModuleName string
+	FieldName  string
+	Type       uint32 // type index of the parameters of the tag
+}
+
+// rewriteSections decodes the sections of the module `raw` which may use the
+// encodings of the bulk memory and reference types proposals, and rewrites
+// them into encodings the wasm package is able to read:
+//
+//   - the data and element sections are removed, segments being applied by
+//     the runtime;
+//   - tables are declared as funcref tables, their actual element types
+//     being recorded separately;
+//   - reference constants in global initializers become i64 constants;
+//   - v128 globals become i64 globals holding the low half of their value,
+//     the high half being recorded separately;
+//   - memories are declared with the MVP limits closest to theirs, their
+//     actual types, which may be shared as introduced by the threads
+//     proposal or 64-bit as introduced by the memory64 proposal, being
+//     recorded separately;
+//   - the tag section, and the tag imports and exports of the exception
+//     handling proposal, are removed and recorded separately.
+func rewriteSections(raw []byte) ([]byte, *extendedSections, error) {
+	ext := &extendedSections{}
+	if len(raw) < 8 {
+		return raw, ext, nil // let the wasm package report the error
+	}
+
+	r := bytes.NewReader(raw[8:])
+	out := append([]byte{}, raw[:8]...)
+
+	var importedTables, tables []wasm.ValueType
+	var importedMemories, memories []MemoryType
+
+	for r.Len() > 0 {
+		id, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, err
+		}
+		size, err := leb128.ReadVarUint32(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		if int64(size) > int64(r.Len()) {
+			return nil, nil, io.ErrUnexpectedEOF
+		}
+		payload := make([]byte, int(size))
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return nil, nil, err
+		}
+
+		switch id {
+		case sectionIDDataCount:
+			continue
+		case sectionIDTag:
+			if ext.Tags, err = readTags(payload); err != nil {
+				return nil, nil, err
+			}
+			continue
+		case byte(wasm.SectionIDImport):
+			importedTables, importedMemories, ext.TagImports, payload, err = rewriteImports(payload)
+		case byte(wasm.SectionIDExport):
+			ext.TagExports, payload, err = rewriteExports(payload)
+		case byte(wasm.SectionIDMemory):
+			memories, payload, err = rewriteMemories(payload)
+		case byte(wasm.SectionIDTable):
+			tables, payload, err = rewriteTables(payload)
+		case byte(wasm.SectionIDGlobal):
+			ext.V128Globals, payload, err = rewriteGlobals(payload)
+		case byte(wasm.SectionIDData):
+			if ext.DataSegments, err = readDataSegments(payload); err != nil {
+				return nil, nil, err
+			}
+			continue
+		case byte(wasm.SectionIDElement):
+			if ext.ElemSegments, err = readElemSegments(payload); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		out = append(out, id)
+		out = leb128.AppendUleb128(out, uint64(len(payload)))
+		out = append(out, payload...)
+	}
+
+	ext.TableTypes = append(importedTables, tables...)
+	ext.MemoryTypes = append(importedMemories, memories...)
+	return out, ext, nil
+}
+
+// rewriteImports rewrites the table imports of an import section as funcref
+// tables, returning their element types, and the memory imports with MVP
+// limits, returning their types. Tag imports are removed and returned.
+func rewriteImports(payload []byte) ([]wasm.ValueType, []MemoryType, []TagImport, []byte, error) {
+	r := bytes.NewReader(payload)
+	count, err := leb128.ReadVarUint32(r)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	var out []byte
+	var tables []wasm.ValueType
+	var memories []MemoryType
+	var tags []TagImport
+
+	for i := uint32(0); i < count; i++ {
+		var names [2][]byte // module and field names
+		for j := range names {
+			n, err := leb128.ReadVarUint32(r)
+			if err != nil {
+				return nil, nil, nil, nil, err
+			}
+			if int64(n) > int64(r.Len()) {
+				return nil, nil, nil, nil, io.ErrUnexpectedEOF
+			}
+			names[j] = make([]byte, int(n))
+			if _, err := io.ReadFull(r, names[j]); err != nil {
+				return nil, nil, nil, nil, err
+			}
+		}
+
+		kind, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+
+		if wasm.External(kind) == ExternalTag {
+			typeID, err := readTagType(r)
+			if err != nil {
+				return nil, nil, nil, nil, err
+			}
+			tags = append(tags, TagImport{ModuleName: string(names[0]), FieldName: string(names[1]), Type: typeID})
+			continue
+		}
+
+		for _, name := range names {
+			out = leb128.AppendUleb128(out, uint64(len(name)))
+			out = append(out, name...)
+		}
+		out = append(out, kind)
+
+		switch wasm.External(kind) {
+		case wasm.ExternalFunction:
+			typeID, err := leb128.ReadVarUint32(r)
+			if err != nil {
+				return nil, nil, nil, nil, err
+			}
+			out = leb128.AppendUleb128(out, uint64(typeID))
+		case wasm.ExternalTable:
+			var elemType wasm.ValueType
+			if elemType, out, err = rewriteTableType(r, out); err != nil {
+				return nil, nil, nil, nil, err
+			}
+			tables = append(tables, elemType)
+		case wasm.ExternalMemory:
+			var memType MemoryType
+			if memType, out, err = rewriteMemoryType(r, out); err != nil {
+				return nil, nil, nil, nil, err
+			}
+			memories = append(memories, memType)
+		case wasm.ExternalGlobal:
+			var globalType [2]byte // value type and mutability
+			if _, err := io.ReadFull(r, globalType[:]); err != nil {
+				return nil, nil, nil, nil, err
+			}
+			if wasm.ValueType(globalType[0]) == ValueTypeV128 {
+				return nil, nil, nil, nil, errors.New("v128 global imports are not supported")
+			}
+			out = append(out, globalType[:]...)
+		default:
+			return nil, nil, nil, nil, wasm.InvalidExternalError(kind)
+		}
+	}
+
+	out = append(leb128.AppendUleb128(nil, uint64(int(count)-len(tags))), out...)
+	return tables, memories, tags, out, nil
+}
+
+// rewriteExports removes the tag exports of an export section, returning
+// the indices of the exported tags by name.
+func rewriteExports(payload []byte) (map[string]uint32, []byte, error) {
+	r := bytes.NewReader(payload)
+	count, err := leb128.ReadVarUint32(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var out []byte
+	var tags map[string]uint32
+	numExports := 0
+
+	for i := uint32(0); i < count; i++ {
+		n, err := leb128.ReadVarUint32(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		if int64(n) > int64(r.Len()) {
+			return nil, nil, io.ErrUnexpectedEOF
+		}
+		name := make([]byte, int(n))
+		if _, err := io.ReadFull(r, name); err != nil {
+			return nil, nil, err
+		}
+		kind, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, err
+		}
+		index, err := leb128.ReadVarUint32(r)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if wasm.External(kind) == ExternalTag {
+			if tags == nil {
+				tags = make(map[string]uint32)
+			}
+			tags[string(name)] = index
+			continue
+		}
+
+		out = leb128.AppendUleb128(out, uint64(n))
+		out = append(out, name...)
+		out = append(out, kind)
+		out = leb128.AppendUleb128(out, uint64(index))
+		numExports++
+	}
+
+	return tags, append(leb128.AppendUleb128(nil, uint64(numExports)), out...), nil
+}
+
+// readTags decodes the payload of a tag section, returning the type indices
+// of the tags.
+func readTags(payload []byte) ([]uint32, error) {
+	r := bytes.NewReader(payload)
+	count, err := leb128.ReadVarUint32(r)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]uint32, 0, getInitialCap(count))
+	for i := uint32(0); i < count; i++ {
+		typeID, err := readTagType(r)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, typeID)
+	}
+	return tags, nil
+}
+
+// readTagType reads the type of a tag, made of an attribute which must be
+// 0 for exceptions and of the type index of its parameters.
+func readTagType(r *bytes.Reader) (uint32, error) {
+	attr, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if attr != 0 {
+		return 0, fmt.Errorf("invalid tag attribute %d", attr)
+	}
+	return leb128.ReadVarUint32(r)
+}
+
+// rewriteTables rewrites the tables of a table section as funcref tables,
+// returning their element types.
+func rewriteTables(payload []byte) ([]wasm.ValueType, []byte, error) {
+	r := bytes.NewReader(payload)
+	count, err := leb128.ReadVarUint32(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	out := leb128.AppendUleb128(nil, uint64(count))
+	tables := make([]wasm.ValueType, 0, getInitialCap(count))
+
+	for i := uint32(0); i < count; i++ {
+		var elemType wasm.ValueType
+		if elemType, out, err = rewriteTableType(r, out); err != nil {
+			return nil, nil, err
+		}
+		tables = append(tables, elemType)
+	}
+
+	return tables, out, nil
+}
+
+// rewriteTableType reads a table type and appends it to out as a funcref
+// table type.
+func rewriteTableType(r *bytes.Reader, out []byte) (wasm.ValueType, []byte, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	elemType := wasm.ValueType(b)
+	if elemType != ValueTypeFuncRef && elemType != ValueTypeExternRef {
+		return 0, nil, fmt.Errorf("invalid table element type 0x%x", b)
+	}
+
+	out = append(out, byte(ValueTypeFuncRef))
+	out, err = copyLimits(r, out)
+	return elemType, out, err
+}
+
+// rewriteMemories rewrites the memories of a memory section with MVP limits,
+// returning their types.
+func rewriteMemories(payload []byte) ([]MemoryType, []byte, error) {
+	r := bytes.NewReader(payload)
+	count, err := leb128.ReadVarUint32(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	out := leb128.AppendUleb128(nil, uint64(count))
+	memories := make([]MemoryType, 0, getInitialCap(count))
+
+	for i := uint32(0); i < count; i++ {
+		var memType MemoryType
+		if memType, out, err = rewriteMemoryType(r, out); err != nil {
+			return nil, nil, err
+		}
+		memories = append(memories, memType)
+	}
+
+	return memories, out, nil
+}
+
+// maxMemory64Pages is the number of pages of the largest 64-bit memory.
+const maxMemory64Pages = 1 << 48
+
+// rewriteMemoryType reads a memory type and appends it to out as an unshared
+// 32-bit memory type, its limits being clamped to 65536 pages. Bit 1 of the flags
+// marks shared memories, which must have a maximum size, and bit 2 64-bit
+// memories, whose limits are 64-bit.
+func rewriteMemoryType(r *bytes.Reader, out []byte) (MemoryType, []byte, error) {
+	flags, err := leb128.ReadVarUint32(r)
+	if err != nil {
+		return MemoryType{}, nil, err
+	}
+	if flags > 7 {
+		return MemoryType{}, nil, fmt.Errorf("invalid memory flags %d", flags)
+	}
+
+	memType := MemoryType{
+		HasMaximum: flags&1 != 0,
+		Shared:     flags&2 != 0,
+		Memory64:   flags&4 != 0,
+	}
+	if memType.Shared && !memType.HasMaximum {
+		return MemoryType{}, nil, errors.New("shared memory must have a maximum size")
+	}
+
+	maxPages := uint64(math.MaxUint16 + 1)
+	if memType.Memory64 {
+		maxPages = maxMemory64Pages
+	}
+
+	limits := []*uint64{&memType.Initial}
+	if memType.HasMaximum {
+		limits = append(limits, &memType.Maximum)
+	}
+	out = leb128.AppendUleb128(out, uint64(flags&1))
+	for _, l := range limits {
+		if *l, err = readVarUint64(r); err != nil {
+			return MemoryType{}, nil, err
+		}
+		if *l > maxPages {
+			return MemoryType{}, nil, errors.New("memory size must be at most 65536 pages (4GiB), or 2^48 pages for 64-bit memories")
+		}
+		if *l > math.MaxUint16+1 {
+			out = leb128.AppendUleb128(out, math.MaxUint16+1)
+		} else {
+			out = leb128.AppendUleb128(out, *l)
+		}
+	}
+	if memType.HasMaximum && memType.Maximum < memType.Initial {
+		return MemoryType{}, nil, errors.New("size minimum must not be greater than maximum")
+	}
+	return memType, out, nil
+}
+
+// readVarUint64 reads an unsigned LEB128 integer of at most 64 bits.
+func readVarUint64(r io.Reader) (uint64, error) {
+	var v uint64
+	for shift := uint(0); ; shift += 7 {
+		b, err := wasm.ReadByte(r)
+		if err != nil {
+			return 0, err
+		}
+		if shift == 63 && b > 1 {
+			return 0, errors.New("integer too large")
+		}
+		v |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return v, nil
+		}
+	}
+}
+
+// copyLimits reads resizable limits and appends them to out.
+func copyLimits(r *bytes.Reader, out []byte) ([]byte, error) {
+	flags, err := leb128.ReadVarUint32(r)
+	if err != nil {
+		return nil, err
+	}
+	return copyLimitValues(r, leb128.AppendUleb128(out, uint64(flags)), flags)
+}
+
+// copyLimitValues reads the minimum and, if flags say so, the maximum of
+// resizable limits and appends them to out.
+func copyLimitValues(r *bytes.Reader, out []byte, flags uint32) ([]byte, error) {
+	n := 1
+	if flags&1 != 0 {
+		n = 2
+	}
+	for i := 0; i < n; i++ {
+		v, err := leb128.ReadVarUint32(r)
+		if err != nil {
+			return nil, err
+		}
+		out = leb128.AppendUleb128(out, uint64(v))
+	}
+	return out, nil
+}
+
+// rewriteGlobals rewrites the reference constants initializing the globals
+// of a global section as i64 constants holding the value of the reference,
+// and the v128 globals as i64 globals holding the low half of their value.
+func rewriteGlobals(payload []byte) ([]V128Global, []byte, error) {
+	r := bytes.NewReader(payload)
+	count, err := leb128.ReadVarUint32(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	out := leb128.AppendUleb128(nil, uint64(count))
+	var v128Globals []V128Global
+
+	for i := uint32(0); i < count; i++ {
+		var globalType [2]byte // value type and mutability
+		if _, err := io.ReadFull(r, globalType[:]); err != nil {
+			return nil, nil, err
+		}
+		isV128 := wasm.ValueType(globalType[0]) == ValueTypeV128
+		if isV128 {
+			globalType[0] = byte(wasm.ValueTypeI64)
+		}
+		out = append(out, globalType[:]...)
+
+		expr, err := readConstExpr(r)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if isV128 {
+			// v128.const is the only constant expression of type v128, the
+			// globals it may refer to being imported.
+			lo, hi, err := readV128ConstExpr(expr)
+			if err != nil {
+				return nil, nil, err
+			}
+			out = append(out, 0x42) // i64.const
+			out = leb128.AppendSleb128(out, lo)
+			out = append(out, 0x0b)
+			v128Globals = append(v128Globals, V128Global{Index: int(i), High: hi})
+			continue
+		}
+
+		switch expr[0] {
+		case 0xd0: // ref.null
+			out = append(out, 0x42) // i64.const
+			out = leb128.AppendSleb128(out, NullElement)
+			out = append(out, 0x0b)
+		case 0xd2: // ref.func
+			functionID, err := leb128.ReadVarUint32(bytes.NewReader(expr[1:]))
+			if err != nil {
+				return nil, nil, err
+			}
+			out = append(out, 0x42) // i64.const
+			out = leb128.AppendSleb128(out, int64(functionID))
+			out = append(out, 0x0b)
+		default:
+			out = append(out, expr...)
+		}
+	}
+
+	return v128Globals, out, nil
+}
+
+// readV128ConstExpr returns the low and high halves of the value of a
+// constant expression made of a v128.const instruction.
+func readV128ConstExpr(expr []byte) (int64, int64, error) {
+	r := bytes.NewReader(expr)
+	if op, err := r.ReadByte(); err != nil {
+		return 0, 0, err
+	} else if op != 0xfd {
+		return 0, 0, errors.New("v128 globals must be initialized with v128.const")
+	}
+	if _, err := leb128.ReadVarUint32(r); err != nil {
+		return 0, 0, err
+	}
+
+	var value [16]byte
+	if _, err := io.ReadFull(r, value[:]); err != nil {
+		return 0, 0, err
+	}
+	if end, err := r.ReadByte(); err != nil {
+		return 0, 0, err
+	} else if end != 0x0b {
+		return 0, 0, errors.New("v128 global initializer must have a single instruction")
+	}
+	return int64(binary.LittleEndian.Uint64(value[:8])), int64(binary.LittleEndian.Uint64(value[8:])), nil
+}
+
+// readDataSegments decodes the payload of a data section and re-encodes its
+// active segments.
+func readDataSegments(payload []byte) ([]DataSegment, error) {
+	r := bytes.NewReader(payload)
+	count, err := leb128.ReadVarUint32(r)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]DataSegment, 0, getInitialCap(count))
+
+	for i := uint32(0); i < count; i++ {
+		flags, err := leb128.ReadVarUint32(r)
+		if err != nil {
+			return nil, err
+		}
+
+		var seg DataSegment
+		switch flags {
+		case 0, 2:
+			if flags == 2 {
+				if seg.MemoryIndex, err = leb128.ReadVarUint32(r); err != nil {
+					return nil, err
+				}
+			}
+			if seg.Offset, err = readConstExpr(r); err != nil {
+				return nil, err
+			}
+		case 1:
+			seg.Passive = true
+		default:
+			return nil, fmt.Errorf("data segment %d: invalid flags %d", i, flags)
+		}
+
+		size, err := leb128.ReadVarUint32(r)
+		if err != nil {
+			return nil, err
+		}
+		if int64(size) > int64(r.Len()) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		seg.Data = make([]byte, int(size))
+		if _, err := io.ReadFull(r, seg.Data); err != nil {
+			return nil, err
+		}
+
+		segments = append(segments, seg)
+	}
+
+	return segments, nil
+}
+
+// readElemSegments decodes the payload of an element section.
+func readElemSegments(payload []byte) ([]ElemSegment, error) {
+	r := bytes.NewReader(payload)
+	count, err := leb128.ReadVarUint32(r)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]ElemSegment, 0, getInitialCap(count))
+
+	for i := uint32(0); i < count; i++ {
+		flags, err := leb128.ReadVarUint32(r)
+		if err != nil {
+			return nil, err
+		}
+		if flags > 7 {
+			return nil, fmt.Errorf("element segment %d: invalid flags %d", i, flags)
+		}
+
+		// Bit 0 marks passive and declarative segments, bit 1 explicit table
+		// indices for active ones and declarative ones, and bit 2 segments
+		// holding expressions rather than function indices.
+		var tableIdx uint32
+		var offset []byte
+		if flags&1 == 0 {
+			if flags&2 != 0 {
+				if tableIdx, err = leb128.ReadVarUint32(r); err != nil {
+					return nil, err
+				}
+			}
+			if offset, err = readConstExpr(r); err != nil {
+				return nil, err
+			}
+		}
+
+		elemType := ValueTypeFuncRef
+		if flags&3 != 0 {
+			// element kind or reference type
+			b, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			if flags&4 != 0 {
+				elemType = wasm.ValueType(b)
+			} else if b != 0 {
+				return nil, fmt.Errorf("element segment %d: invalid element kind %d", i, b)
+			}
+			if elemType != ValueTypeFuncRef && elemType != ValueTypeExternRef {
+				return nil, fmt.Errorf("element segment %d: invalid element type 0x%x", i, b)
+			}
+		}
+
+		n, err := leb128.ReadVarUint32(r)
+		if err != nil {
+			return nil, err
+		}
+		elems := make([]uint32, 0, getInitialCap(n))
+		for j := uint32(0); j < n; j++ {
+			var elem uint32
+			if flags&4 != 0 {
+				elem, err = readElemExpr(r)
+			} else {
+				elem, err = leb128.ReadVarUint32(r)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if elemType == ValueTypeExternRef && elem != NullElement {
+				return nil, fmt.Errorf("element segment %d: externref elements must be null", i)
+			}
+			elems = append(elems, elem)
+		}
+
+		segments = append(segments, ElemSegment{
+			Passive:    flags&3 == 1,
+			Type:       elemType,
+			Elems:      elems,
+			TableIndex: tableIdx,
+			Offset:     offset,
+		})
+	}
+
+	return segments, nil
+}
+
+// readConstExpr reads a constant expression, returning its encoding up to
+// and including the final end instruction.
+func readConstExpr(r *bytes.Reader) ([]byte, error) {
+	start := r.Size() - int64(r.Len())
+
+	for {
+		op, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		switch op {
+		case 0x0b: // end
+			end := r.Size() - int64(r.Len())
+			expr := make([]byte, end-start)
+			if _, err := r.ReadAt(expr, start); err != nil {
+				return nil, err
+			}
+			return expr, nil
+		case 0x41: // i32.const
+			_, err = leb128.ReadVarint32(r)
+		case 0x42: // i64.const
+			_, err = leb128.ReadVarint64(r)
+		case 0x43: // f32.const
+			_, err = r.Seek(4, io.SeekCurrent)
+		case 0x44: // f64.const
+			_, err = r.Seek(8, io.SeekCurrent)
+		case 0x23, 0xd2: // global.get, ref.func
+			_, err = leb128.ReadVarUint32(r)
+		case 0xd0: // ref.null
+			_, err = r.ReadByte()
+		case 0xfd: // v128.const
+			var subOp uint32
+			if subOp, err = leb128.ReadVarUint32(r); err == nil {
+				if subOp != uint32(opcodes.V128Const) {
+					return nil, fmt.Errorf("invalid opcode 0xfd 0x%x in constant expression", subOp)
+				}
+				_, err = r.Seek(16, io.SeekCurrent)
+			}
+		default:
+			return nil, fmt.Errorf("invalid opcode 0x%x in constant expression", op)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readElemExpr reads an element expression, which is either a ref.func or a
+// ref.null instruction.
+func readElemExpr(r *bytes.Reader) (uint32, error) {
+	op, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	var elem uint32
+	switch op {
+	case 0xd2: // ref.func
+		if elem, err = leb128.ReadVarUint32(r); err != nil {
+			return 0, err
+		}
+	case 0xd0: // ref.null
+		if _, err := r.ReadByte(); err != nil {
+			return 0, err
+		}
+		elem = NullElement
+	default:
+		return 0, fmt.Errorf("unsupported opcode 0x%x in element expression", op)
+	}
+
+	if end, err := r.ReadByte(); err != nil {
+		return 0, err
+	} else if end != 0x0b {
+		return 0, errors.New("element expression must have a single instruction")
+	}
+	return elem, nil
+}
+
+// getInitialCap bounds the initial capacity of slices allocated for counts
+// read from untrusted modules.
+func getInitialCap(count uint32) uint32 {
+	if count > 1024 {
+		return 1024
+	}
+	return count
+}
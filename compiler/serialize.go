@@ -7,6 +7,25 @@ import (
 	"github.com/perlin-network/life/compiler/opcodes"
 )
 
+// tableOpcodes maps the table instructions to their opcodes.
+var tableOpcodes = map[string]opcodes.Opcode{
+	"table.init": opcodes.TableInit,
+	"table.copy": opcodes.TableCopy,
+	"table.get":  opcodes.TableGet,
+	"table.set":  opcodes.TableSet,
+	"table.size": opcodes.TableSize,
+	"table.grow": opcodes.TableGrow,
+	"table.fill": opcodes.TableFill,
+}
+
+// memoryOpcodes maps the bulk memory instructions taking operands to their
+// opcodes.
+var memoryOpcodes = map[string]opcodes.Opcode{
+	"memory.init": opcodes.MemoryInit,
+	"memory.copy": opcodes.MemoryCopy,
+	"memory.fill": opcodes.MemoryFill,
+}
+
 // Serialize serializes a set of SSA-form instructions into a byte array
 // for execution with an exec.VirtualMachine.
 //
@@ -15,13 +34,32 @@ import (
 //
 // Types are erased in the generated code.
 // Example: float32/float64 are represented as uint32/uint64 respectively.
+//
+// The exception handlers of the function are recorded into c.Handlers.
 func (c *SSAFunctionCompiler) Serialize() []byte {
 	buf := &bytes.Buffer{}
 	insRelocs := make([]int, len(c.Code))
 	reloc32Targets := make([]int, 0)
+	c.Handlers = make([]ExceptionHandler, c.numHandlers)
 
 	for i, ins := range c.Code {
 		insRelocs[i] = buf.Len()
+
+		// The markers of try blocks only delimit the bodies of handlers.
+		switch ins.Op {
+		case "try":
+			c.Handlers[ins.Immediates[0]].Start = buf.Len()
+			c.Handlers[ins.Immediates[0]].Parent = int(ins.Immediates[1])
+			continue
+		case "try_end":
+			c.Handlers[ins.Immediates[0]].End = buf.Len()
+			continue
+		case "delegate":
+			c.Handlers[ins.Immediates[0]].End = buf.Len()
+			c.Handlers[ins.Immediates[0]].Parent = int(ins.Immediates[1])
+			continue
+		}
+
 		_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Target))
 
 		switch ins.Op {
@@ -460,6 +498,58 @@ func (c *SSAFunctionCompiler) Serialize() []byte {
 			_ = binary.Write(buf, binary.LittleEndian, opcodes.I64ExtendSI32)
 			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))
 
+		case "i32.extend8_s":
+			_ = binary.Write(buf, binary.LittleEndian, opcodes.I32Extend8S)
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))
+
+		case "i32.extend16_s":
+			_ = binary.Write(buf, binary.LittleEndian, opcodes.I32Extend16S)
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))
+
+		case "i64.extend8_s":
+			_ = binary.Write(buf, binary.LittleEndian, opcodes.I64Extend8S)
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))
+
+		case "i64.extend16_s":
+			_ = binary.Write(buf, binary.LittleEndian, opcodes.I64Extend16S)
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))
+
+		case "i64.extend32_s":
+			_ = binary.Write(buf, binary.LittleEndian, opcodes.I64Extend32S)
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))
+
+		case "i32.trunc_s:sat/f32":
+			_ = binary.Write(buf, binary.LittleEndian, opcodes.I32TruncSatSF32)
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))
+
+		case "i32.trunc_u:sat/f32":
+			_ = binary.Write(buf, binary.LittleEndian, opcodes.I32TruncSatUF32)
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))
+
+		case "i32.trunc_s:sat/f64":
+			_ = binary.Write(buf, binary.LittleEndian, opcodes.I32TruncSatSF64)
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))
+
+		case "i32.trunc_u:sat/f64":
+			_ = binary.Write(buf, binary.LittleEndian, opcodes.I32TruncSatUF64)
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))
+
+		case "i64.trunc_s:sat/f32":
+			_ = binary.Write(buf, binary.LittleEndian, opcodes.I64TruncSatSF32)
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))
+
+		case "i64.trunc_u:sat/f32":
+			_ = binary.Write(buf, binary.LittleEndian, opcodes.I64TruncSatUF32)
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))
+
+		case "i64.trunc_s:sat/f64":
+			_ = binary.Write(buf, binary.LittleEndian, opcodes.I64TruncSatSF64)
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))
+
+		case "i64.trunc_u:sat/f64":
+			_ = binary.Write(buf, binary.LittleEndian, opcodes.I64TruncSatUF64)
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))
+
 		case "f32.demote/f64":
 			_ = binary.Write(buf, binary.LittleEndian, opcodes.F32DemoteF64)
 			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))
@@ -506,139 +596,139 @@ func (c *SSAFunctionCompiler) Serialize() []byte {
 		case "i32.load", "f32.load":
 			_ = binary.Write(buf, binary.LittleEndian, opcodes.I32Load)
 
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[0])) // Memory alignment flags
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[1])) // Memory offset
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[2])) // Memory index
+			_ = binary.Write(buf, binary.LittleEndian, uint64(ins.Immediates[1])) // Memory offset
 			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))     // Memory base address
 
 		case "i32.load8_s":
 			_ = binary.Write(buf, binary.LittleEndian, opcodes.I32Load8S)
 
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[0])) // Memory alignment flags
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[1])) // Memory offset
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[2])) // Memory index
+			_ = binary.Write(buf, binary.LittleEndian, uint64(ins.Immediates[1])) // Memory offset
 			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))     // Memory base address
 
 		case "i32.load16_s":
 			_ = binary.Write(buf, binary.LittleEndian, opcodes.I32Load16S)
 
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[0])) // Memory alignment flags
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[1])) // Memory offset
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[2])) // Memory index
+			_ = binary.Write(buf, binary.LittleEndian, uint64(ins.Immediates[1])) // Memory offset
 			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))     // Memory base address
 
 		case "i64.load8_s":
 			_ = binary.Write(buf, binary.LittleEndian, opcodes.I64Load8S)
 
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[0])) // Memory alignment flags
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[1])) // Memory offset
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[2])) // Memory index
+			_ = binary.Write(buf, binary.LittleEndian, uint64(ins.Immediates[1])) // Memory offset
 			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))     // Memory base address
 
 		case "i64.load16_s":
 			_ = binary.Write(buf, binary.LittleEndian, opcodes.I64Load16S)
 
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[0])) // Memory alignment flags
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[1])) // Memory offset
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[2])) // Memory index
+			_ = binary.Write(buf, binary.LittleEndian, uint64(ins.Immediates[1])) // Memory offset
 			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))     // Memory base address
 
 		case "i64.load32_s":
 			_ = binary.Write(buf, binary.LittleEndian, opcodes.I64Load32S)
 
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[0])) // Memory alignment flags
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[1])) // Memory offset
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[2])) // Memory index
+			_ = binary.Write(buf, binary.LittleEndian, uint64(ins.Immediates[1])) // Memory offset
 			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))     // Memory base address
 
 		case "i32.load8_u":
 			_ = binary.Write(buf, binary.LittleEndian, opcodes.I32Load8U)
 
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[0])) // Memory alignment flags
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[1])) // Memory offset
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[2])) // Memory index
+			_ = binary.Write(buf, binary.LittleEndian, uint64(ins.Immediates[1])) // Memory offset
 			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))     // Memory base address
 
 		case "i32.load16_u":
 			_ = binary.Write(buf, binary.LittleEndian, opcodes.I32Load16U)
 
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[0])) // Memory alignment flags
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[1])) // Memory offset
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[2])) // Memory index
+			_ = binary.Write(buf, binary.LittleEndian, uint64(ins.Immediates[1])) // Memory offset
 			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))     // Memory base address
 
 		case "i64.load8_u":
 			_ = binary.Write(buf, binary.LittleEndian, opcodes.I64Load8U)
 
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[0])) // Memory alignment flags
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[1])) // Memory offset
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[2])) // Memory index
+			_ = binary.Write(buf, binary.LittleEndian, uint64(ins.Immediates[1])) // Memory offset
 			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))     // Memory base address
 
 		case "i64.load16_u":
 			_ = binary.Write(buf, binary.LittleEndian, opcodes.I64Load16U)
 
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[0])) // Memory alignment flags
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[1])) // Memory offset
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[2])) // Memory index
+			_ = binary.Write(buf, binary.LittleEndian, uint64(ins.Immediates[1])) // Memory offset
 			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))     // Memory base address
 
 		case "i64.load32_u":
 			_ = binary.Write(buf, binary.LittleEndian, opcodes.I64Load32U)
 
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[0])) // Memory alignment flags
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[1])) // Memory offset
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[2])) // Memory index
+			_ = binary.Write(buf, binary.LittleEndian, uint64(ins.Immediates[1])) // Memory offset
 			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))     // Memory base address
 
 		case "i64.load", "f64.load":
 			_ = binary.Write(buf, binary.LittleEndian, opcodes.I64Load)
 
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[0])) // Memory alignment flags
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[1])) // Memory offset
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[2])) // Memory index
+			_ = binary.Write(buf, binary.LittleEndian, uint64(ins.Immediates[1])) // Memory offset
 			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))     // Memory base address
 
 		case "i32.store", "f32.store":
 			_ = binary.Write(buf, binary.LittleEndian, opcodes.I32Store)
 
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[0])) // Memory alignment flags
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[1])) // Memory offset
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[2])) // Memory index
+			_ = binary.Write(buf, binary.LittleEndian, uint64(ins.Immediates[1])) // Memory offset
 			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))     // Memory base address
 			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[1]))     // Address of value to store
 		case "i32.store8":
 			_ = binary.Write(buf, binary.LittleEndian, opcodes.I32Store8)
 
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[0])) // Memory alignment flags
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[1])) // Memory offset
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[2])) // Memory index
+			_ = binary.Write(buf, binary.LittleEndian, uint64(ins.Immediates[1])) // Memory offset
 			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))     // Memory base address
 			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[1]))     // Address of value to store
 
 		case "i32.store16":
 			_ = binary.Write(buf, binary.LittleEndian, opcodes.I32Store16)
 
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[0])) // Memory alignment flags
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[1])) // Memory offset
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[2])) // Memory index
+			_ = binary.Write(buf, binary.LittleEndian, uint64(ins.Immediates[1])) // Memory offset
 			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))     // Memory base address
 			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[1]))     // Address of value to store
 
 		case "i64.store8":
 			_ = binary.Write(buf, binary.LittleEndian, opcodes.I64Store8)
 
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[0])) // Memory alignment flags
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[1])) // Memory offset
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[2])) // Memory index
+			_ = binary.Write(buf, binary.LittleEndian, uint64(ins.Immediates[1])) // Memory offset
 			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))     // Memory base address
 			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[1]))     // Address of value to store
 
 		case "i64.store16":
 			_ = binary.Write(buf, binary.LittleEndian, opcodes.I64Store16)
 
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[0])) // Memory alignment flags
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[1])) // Memory offset
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[2])) // Memory index
+			_ = binary.Write(buf, binary.LittleEndian, uint64(ins.Immediates[1])) // Memory offset
 			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))     // Memory base address
 			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[1]))     // Address of value to store
 
 		case "i64.store32":
 			_ = binary.Write(buf, binary.LittleEndian, opcodes.I64Store32)
 
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[0])) // Memory alignment flags
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[1])) // Memory offset
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[2])) // Memory index
+			_ = binary.Write(buf, binary.LittleEndian, uint64(ins.Immediates[1])) // Memory offset
 			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))     // Memory base address
 			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[1]))     // Address of value to store
 
 		case "i64.store", "f64.store":
 			_ = binary.Write(buf, binary.LittleEndian, opcodes.I64Store)
 
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[0])) // Memory alignment flags
-			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[1])) // Memory offset
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[2])) // Memory index
+			_ = binary.Write(buf, binary.LittleEndian, uint64(ins.Immediates[1])) // Memory offset
 			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))     // Memory base address
 			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[1]))     // Address of value to store
 
@@ -678,10 +768,25 @@ func (c *SSAFunctionCompiler) Serialize() []byte {
 
 			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))
 			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[1]))
+		case "yield":
+			_ = binary.Write(buf, binary.LittleEndian, opcodes.Yield)
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[0]))
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))
 		case "phi":
-			_ = binary.Write(buf, binary.LittleEndian, opcodes.Phi)
+			if len(ins.Immediates) != 0 {
+				_ = binary.Write(buf, binary.LittleEndian, opcodes.PhiIndex)
+				_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[0]))
+			} else {
+				_ = binary.Write(buf, binary.LittleEndian, opcodes.Phi)
+			}
 		case "return":
-			if len(ins.Values) != 0 {
+			if len(ins.Values) > 1 {
+				_ = binary.Write(buf, binary.LittleEndian, opcodes.ReturnValues)
+				_ = binary.Write(buf, binary.LittleEndian, uint32(len(ins.Values)))
+				for _, v := range ins.Values {
+					_ = binary.Write(buf, binary.LittleEndian, uint32(v))
+				}
+			} else if len(ins.Values) != 0 {
 				_ = binary.Write(buf, binary.LittleEndian, opcodes.ReturnValue)
 				_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))
 			} else {
@@ -704,38 +809,141 @@ func (c *SSAFunctionCompiler) Serialize() []byte {
 			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[0]))
 			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))
 
-		case "call":
-			_ = binary.Write(buf, binary.LittleEndian, opcodes.Call)
+		case "call", "return_call":
+			if ins.Op == "call" {
+				_ = binary.Write(buf, binary.LittleEndian, opcodes.Call)
+			} else {
+				_ = binary.Write(buf, binary.LittleEndian, opcodes.ReturnCall)
+			}
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[0]))
+			_ = binary.Write(buf, binary.LittleEndian, uint32(len(ins.Values)))
+			for _, v := range ins.Values {
+				_ = binary.Write(buf, binary.LittleEndian, uint32(v))
+			}
+
+		case "call_indirect", "return_call_indirect":
+			if ins.Op == "call_indirect" {
+				_ = binary.Write(buf, binary.LittleEndian, opcodes.CallIndirect)
+			} else {
+				_ = binary.Write(buf, binary.LittleEndian, opcodes.ReturnCallIndirect)
+			}
 			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[0]))
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[1]))
 			_ = binary.Write(buf, binary.LittleEndian, uint32(len(ins.Values)))
 			for _, v := range ins.Values {
 				_ = binary.Write(buf, binary.LittleEndian, uint32(v))
 			}
 
-		case "call_indirect":
-			_ = binary.Write(buf, binary.LittleEndian, opcodes.CallIndirect)
+		case "catch":
+			h := &c.Handlers[ins.Immediates[0]]
+			h.Catches = append(h.Catches, CatchClause{Tag: int(ins.Immediates[1]), Target: insRelocs[i]})
+			_ = binary.Write(buf, binary.LittleEndian, opcodes.Catch)
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[0]))
+
+		case "throw":
+			_ = binary.Write(buf, binary.LittleEndian, opcodes.Throw)
 			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[0]))
 			_ = binary.Write(buf, binary.LittleEndian, uint32(len(ins.Values)))
 			for _, v := range ins.Values {
 				_ = binary.Write(buf, binary.LittleEndian, uint32(v))
 			}
 
+		case "rethrow":
+			_ = binary.Write(buf, binary.LittleEndian, opcodes.Rethrow)
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[0]))
+
 		case "memory.size":
 			_ = binary.Write(buf, binary.LittleEndian, opcodes.CurrentMemory)
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[0]))
 
 		case "memory.grow":
 			_ = binary.Write(buf, binary.LittleEndian, opcodes.GrowMemory)
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[0]))
 			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))
 
+		case "data.drop":
+			_ = binary.Write(buf, binary.LittleEndian, opcodes.DataDrop)
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[0]))
+		case "memory.init", "memory.copy", "memory.fill":
+			// Segment and memory indices come first, then the operands.
+			_ = binary.Write(buf, binary.LittleEndian, memoryOpcodes[ins.Op])
+			for _, imm := range ins.Immediates {
+				_ = binary.Write(buf, binary.LittleEndian, uint32(imm))
+			}
+			for _, v := range ins.Values {
+				_ = binary.Write(buf, binary.LittleEndian, uint32(v))
+			}
+		case "elem.drop":
+			_ = binary.Write(buf, binary.LittleEndian, opcodes.ElemDrop)
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[0]))
+		case "table.init", "table.copy", "table.get", "table.set", "table.size", "table.grow", "table.fill":
+			// Table and segment indices come first, then the operands.
+			_ = binary.Write(buf, binary.LittleEndian, tableOpcodes[ins.Op])
+			for _, imm := range ins.Immediates {
+				_ = binary.Write(buf, binary.LittleEndian, uint32(imm))
+			}
+			for _, v := range ins.Values {
+				_ = binary.Write(buf, binary.LittleEndian, uint32(v))
+			}
+
 		case "add_gas":
 			_ = binary.Write(buf, binary.LittleEndian, opcodes.AddGas)
 			_ = binary.Write(buf, binary.LittleEndian, uint64(ins.Immediates[0]))
 
+		case "add_gas_scaled":
+			_ = binary.Write(buf, binary.LittleEndian, opcodes.AddGasScaled)
+			_ = binary.Write(buf, binary.LittleEndian, uint64(ins.Immediates[0]))
+			_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Values[0]))
+
 		case "fp_disabled_error":
 			_ = binary.Write(buf, binary.LittleEndian, opcodes.FPDisabledError)
+		case "simd_disabled_error":
+			_ = binary.Write(buf, binary.LittleEndian, opcodes.SIMDDisabledError)
 
 		default:
-			panic(ins.Op)
+			if code, op, ok := atomicOp(ins.Op); ok {
+				// The sub-opcode comes first, then the memory index and the
+				// offset of memory accesses and the operands.
+				_ = binary.Write(buf, binary.LittleEndian, opcodes.Atomic)
+				_ = binary.Write(buf, binary.LittleEndian, code)
+				if op.Kind != AtomicFence {
+					_ = binary.Write(buf, binary.LittleEndian, uint32(ins.Immediates[2]))
+					_ = binary.Write(buf, binary.LittleEndian, uint64(ins.Immediates[1]))
+				}
+				for _, v := range ins.Values {
+					_ = binary.Write(buf, binary.LittleEndian, uint32(v))
+				}
+				break
+			}
+
+			code, op, ok := simdOp(ins.Op)
+			if !ok {
+				panic(ins.Op)
+			}
+			// The sub-opcode comes first, then the immediates and the
+			// operands. Memory accesses have the memory index and the
+			// 64-bit offset, followed by the lane index of lane accesses,
+			// shuffles two 64-bit immediates holding their lane indices,
+			// and other instructions 32-bit ones.
+			_ = binary.Write(buf, binary.LittleEndian, opcodes.SIMD)
+			_ = binary.Write(buf, binary.LittleEndian, code)
+			immediates := ins.Immediates
+			switch op.Kind {
+			case SIMDLoad, SIMDLoadLane, SIMDStore, SIMDStoreLane:
+				_ = binary.Write(buf, binary.LittleEndian, uint32(immediates[2]))
+				_ = binary.Write(buf, binary.LittleEndian, uint64(immediates[1]))
+				immediates = immediates[3:]
+			}
+			for _, imm := range immediates {
+				if op.Kind == SIMDShuffle {
+					_ = binary.Write(buf, binary.LittleEndian, uint64(imm))
+				} else {
+					_ = binary.Write(buf, binary.LittleEndian, uint32(imm))
+				}
+			}
+			for _, v := range ins.Values {
+				_ = binary.Write(buf, binary.LittleEndian, uint32(v))
+			}
 		}
 	}
 
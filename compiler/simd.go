@@ -0,0 +1,472 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/go-interpreter/wagon/disasm"
+	"github.com/go-interpreter/wagon/wasm"
+
+	"github.com/perlin-network/life/compiler/opcodes"
+)
+
+// ValueTypeV128 is the 128-bit vector type introduced by the fixed-width
+// SIMD proposal.
+//
+// v128 values are held in two consecutive 64-bit value slots, the low half
+// first: they take two registers, two locals, two parameters or results of a
+// function and two values on the stack of the SSA compiler. SIMD
+// instructions producing a v128 value assign the low half to their target
+// and yield the high half, which the phi instruction following them
+// retrieves.
+const ValueTypeV128 wasm.ValueType = 0x7b
+
+// SlotTypes returns the types of the value slots holding values of the given
+// types, v128 values taking two i64 slots.
+func SlotTypes(types []wasm.ValueType) []wasm.ValueType {
+	ret := make([]wasm.ValueType, 0, len(types))
+	for _, t := range types {
+		if t == ValueTypeV128 {
+			ret = append(ret, wasm.ValueTypeI64, wasm.ValueTypeI64)
+		} else {
+			ret = append(ret, t)
+		}
+	}
+	return ret
+}
+
+// NumSlots returns the number of value slots holding values of the given
+// types.
+func NumSlots(types []wasm.ValueType) int {
+	n := len(types)
+	for _, t := range types {
+		if t == ValueTypeV128 {
+			n++
+		}
+	}
+	return n
+}
+
+// SIMDKind classifies SIMD instructions by their operands and immediates.
+type SIMDKind int
+
+const (
+	SIMDLoad        SIMDKind = iota // v128 = op(address); align, offset, memory
+	SIMDLoadLane                    // v128 = op(address, v128); align, offset, memory, lane
+	SIMDStore                       // op(address, v128); align, offset, memory
+	SIMDStoreLane                   // op(address, v128); align, offset, memory, lane
+	SIMDConst                       // v128 = op(); lowered to two i64 constants
+	SIMDShuffle                     // v128 = op(v128, v128); 16 lane indices
+	SIMDSplat                       // v128 = op(scalar)
+	SIMDExtractLane                 // scalar = op(v128); lane
+	SIMDReplaceLane                 // v128 = op(v128, scalar); lane
+	SIMDUnary                       // v128 = op(v128)
+	SIMDBinary                      // v128 = op(v128, v128)
+	SIMDTernary                     // v128 = op(v128, v128, v128)
+	SIMDTest                        // i32 = op(v128)
+	SIMDShift                       // v128 = op(v128, i32)
+)
+
+// SIMDOp describes a SIMD instruction. Lanes is the number of lanes the lane
+// index immediate of the instruction may refer to, if any.
+type SIMDOp struct {
+	Name  string
+	Kind  SIMDKind
+	Lanes int
+}
+
+// NumValues returns the number of value slots the instruction takes as
+// operands.
+func (op SIMDOp) NumValues() int {
+	switch op.Kind {
+	case SIMDLoad, SIMDSplat:
+		return 1
+	case SIMDExtractLane, SIMDUnary, SIMDTest:
+		return 2
+	case SIMDLoadLane, SIMDStore, SIMDStoreLane, SIMDReplaceLane, SIMDShift:
+		return 3
+	case SIMDShuffle, SIMDBinary:
+		return 4
+	case SIMDTernary:
+		return 6
+	}
+	return 0
+}
+
+// AccessSize returns the number of bytes accessed by the memory instruction
+// op.
+func (op SIMDOp) AccessSize() int {
+	switch op.Kind {
+	case SIMDLoad:
+		return simdLoadSizes[op.Name]
+	case SIMDLoadLane, SIMDStoreLane:
+		return 16 / op.Lanes
+	}
+	return 16
+}
+
+// simdLoadSizes holds the numbers of bytes read by the loads of the SIMD
+// proposal.
+var simdLoadSizes = map[string]int{
+	"v128.load":         16,
+	"v128.load8x8_s":    8,
+	"v128.load8x8_u":    8,
+	"v128.load16x4_s":   8,
+	"v128.load16x4_u":   8,
+	"v128.load32x2_s":   8,
+	"v128.load32x2_u":   8,
+	"v128.load8_splat":  1,
+	"v128.load16_splat": 2,
+	"v128.load32_splat": 4,
+	"v128.load64_splat": 8,
+	"v128.load32_zero":  4,
+	"v128.load64_zero":  8,
+}
+
+// HasV128Result tells whether the instruction produces a v128 value.
+func (op SIMDOp) HasV128Result() bool {
+	switch op.Kind {
+	case SIMDStore, SIMDStoreLane, SIMDExtractLane, SIMDTest:
+		return false
+	}
+	return true
+}
+
+// SIMDOps are the SIMD instructions, indexed by their sub-opcode.
+var SIMDOps = map[opcodes.SIMDOpcode]SIMDOp{
+	opcodes.V128Load:        {Name: "v128.load", Kind: SIMDLoad},
+	opcodes.V128Load8x8S:    {Name: "v128.load8x8_s", Kind: SIMDLoad},
+	opcodes.V128Load8x8U:    {Name: "v128.load8x8_u", Kind: SIMDLoad},
+	opcodes.V128Load16x4S:   {Name: "v128.load16x4_s", Kind: SIMDLoad},
+	opcodes.V128Load16x4U:   {Name: "v128.load16x4_u", Kind: SIMDLoad},
+	opcodes.V128Load32x2S:   {Name: "v128.load32x2_s", Kind: SIMDLoad},
+	opcodes.V128Load32x2U:   {Name: "v128.load32x2_u", Kind: SIMDLoad},
+	opcodes.V128Load8Splat:  {Name: "v128.load8_splat", Kind: SIMDLoad},
+	opcodes.V128Load16Splat: {Name: "v128.load16_splat", Kind: SIMDLoad},
+	opcodes.V128Load32Splat: {Name: "v128.load32_splat", Kind: SIMDLoad},
+	opcodes.V128Load64Splat: {Name: "v128.load64_splat", Kind: SIMDLoad},
+	opcodes.V128Store:       {Name: "v128.store", Kind: SIMDStore},
+	opcodes.V128Const:       {Name: "v128.const", Kind: SIMDConst},
+	opcodes.I8x16Shuffle:    {Name: "i8x16.shuffle", Kind: SIMDShuffle},
+	opcodes.I8x16Swizzle:    {Name: "i8x16.swizzle", Kind: SIMDBinary},
+	opcodes.I8x16Splat:      {Name: "i8x16.splat", Kind: SIMDSplat},
+	opcodes.I16x8Splat:      {Name: "i16x8.splat", Kind: SIMDSplat},
+	opcodes.I32x4Splat:      {Name: "i32x4.splat", Kind: SIMDSplat},
+	opcodes.I64x2Splat:      {Name: "i64x2.splat", Kind: SIMDSplat},
+	opcodes.F32x4Splat:      {Name: "f32x4.splat", Kind: SIMDSplat},
+	opcodes.F64x2Splat:      {Name: "f64x2.splat", Kind: SIMDSplat},
+
+	opcodes.I8x16ExtractLaneS: {Name: "i8x16.extract_lane_s", Kind: SIMDExtractLane, Lanes: 16},
+	opcodes.I8x16ExtractLaneU: {Name: "i8x16.extract_lane_u", Kind: SIMDExtractLane, Lanes: 16},
+	opcodes.I8x16ReplaceLane:  {Name: "i8x16.replace_lane", Kind: SIMDReplaceLane, Lanes: 16},
+	opcodes.I16x8ExtractLaneS: {Name: "i16x8.extract_lane_s", Kind: SIMDExtractLane, Lanes: 8},
+	opcodes.I16x8ExtractLaneU: {Name: "i16x8.extract_lane_u", Kind: SIMDExtractLane, Lanes: 8},
+	opcodes.I16x8ReplaceLane:  {Name: "i16x8.replace_lane", Kind: SIMDReplaceLane, Lanes: 8},
+	opcodes.I32x4ExtractLane:  {Name: "i32x4.extract_lane", Kind: SIMDExtractLane, Lanes: 4},
+	opcodes.I32x4ReplaceLane:  {Name: "i32x4.replace_lane", Kind: SIMDReplaceLane, Lanes: 4},
+	opcodes.I64x2ExtractLane:  {Name: "i64x2.extract_lane", Kind: SIMDExtractLane, Lanes: 2},
+	opcodes.I64x2ReplaceLane:  {Name: "i64x2.replace_lane", Kind: SIMDReplaceLane, Lanes: 2},
+	opcodes.F32x4ExtractLane:  {Name: "f32x4.extract_lane", Kind: SIMDExtractLane, Lanes: 4},
+	opcodes.F32x4ReplaceLane:  {Name: "f32x4.replace_lane", Kind: SIMDReplaceLane, Lanes: 4},
+	opcodes.F64x2ExtractLane:  {Name: "f64x2.extract_lane", Kind: SIMDExtractLane, Lanes: 2},
+	opcodes.F64x2ReplaceLane:  {Name: "f64x2.replace_lane", Kind: SIMDReplaceLane, Lanes: 2},
+
+	opcodes.I8x16Eq:  {Name: "i8x16.eq", Kind: SIMDBinary},
+	opcodes.I8x16Ne:  {Name: "i8x16.ne", Kind: SIMDBinary},
+	opcodes.I8x16LtS: {Name: "i8x16.lt_s", Kind: SIMDBinary},
+	opcodes.I8x16LtU: {Name: "i8x16.lt_u", Kind: SIMDBinary},
+	opcodes.I8x16GtS: {Name: "i8x16.gt_s", Kind: SIMDBinary},
+	opcodes.I8x16GtU: {Name: "i8x16.gt_u", Kind: SIMDBinary},
+	opcodes.I8x16LeS: {Name: "i8x16.le_s", Kind: SIMDBinary},
+	opcodes.I8x16LeU: {Name: "i8x16.le_u", Kind: SIMDBinary},
+	opcodes.I8x16GeS: {Name: "i8x16.ge_s", Kind: SIMDBinary},
+	opcodes.I8x16GeU: {Name: "i8x16.ge_u", Kind: SIMDBinary},
+	opcodes.I16x8Eq:  {Name: "i16x8.eq", Kind: SIMDBinary},
+	opcodes.I16x8Ne:  {Name: "i16x8.ne", Kind: SIMDBinary},
+	opcodes.I16x8LtS: {Name: "i16x8.lt_s", Kind: SIMDBinary},
+	opcodes.I16x8LtU: {Name: "i16x8.lt_u", Kind: SIMDBinary},
+	opcodes.I16x8GtS: {Name: "i16x8.gt_s", Kind: SIMDBinary},
+	opcodes.I16x8GtU: {Name: "i16x8.gt_u", Kind: SIMDBinary},
+	opcodes.I16x8LeS: {Name: "i16x8.le_s", Kind: SIMDBinary},
+	opcodes.I16x8LeU: {Name: "i16x8.le_u", Kind: SIMDBinary},
+	opcodes.I16x8GeS: {Name: "i16x8.ge_s", Kind: SIMDBinary},
+	opcodes.I16x8GeU: {Name: "i16x8.ge_u", Kind: SIMDBinary},
+	opcodes.I32x4Eq:  {Name: "i32x4.eq", Kind: SIMDBinary},
+	opcodes.I32x4Ne:  {Name: "i32x4.ne", Kind: SIMDBinary},
+	opcodes.I32x4LtS: {Name: "i32x4.lt_s", Kind: SIMDBinary},
+	opcodes.I32x4LtU: {Name: "i32x4.lt_u", Kind: SIMDBinary},
+	opcodes.I32x4GtS: {Name: "i32x4.gt_s", Kind: SIMDBinary},
+	opcodes.I32x4GtU: {Name: "i32x4.gt_u", Kind: SIMDBinary},
+	opcodes.I32x4LeS: {Name: "i32x4.le_s", Kind: SIMDBinary},
+	opcodes.I32x4LeU: {Name: "i32x4.le_u", Kind: SIMDBinary},
+	opcodes.I32x4GeS: {Name: "i32x4.ge_s", Kind: SIMDBinary},
+	opcodes.I32x4GeU: {Name: "i32x4.ge_u", Kind: SIMDBinary},
+	opcodes.F32x4Eq:  {Name: "f32x4.eq", Kind: SIMDBinary},
+	opcodes.F32x4Ne:  {Name: "f32x4.ne", Kind: SIMDBinary},
+	opcodes.F32x4Lt:  {Name: "f32x4.lt", Kind: SIMDBinary},
+	opcodes.F32x4Gt:  {Name: "f32x4.gt", Kind: SIMDBinary},
+	opcodes.F32x4Le:  {Name: "f32x4.le", Kind: SIMDBinary},
+	opcodes.F32x4Ge:  {Name: "f32x4.ge", Kind: SIMDBinary},
+	opcodes.F64x2Eq:  {Name: "f64x2.eq", Kind: SIMDBinary},
+	opcodes.F64x2Ne:  {Name: "f64x2.ne", Kind: SIMDBinary},
+	opcodes.F64x2Lt:  {Name: "f64x2.lt", Kind: SIMDBinary},
+	opcodes.F64x2Gt:  {Name: "f64x2.gt", Kind: SIMDBinary},
+	opcodes.F64x2Le:  {Name: "f64x2.le", Kind: SIMDBinary},
+	opcodes.F64x2Ge:  {Name: "f64x2.ge", Kind: SIMDBinary},
+
+	opcodes.V128Not:       {Name: "v128.not", Kind: SIMDUnary},
+	opcodes.V128And:       {Name: "v128.and", Kind: SIMDBinary},
+	opcodes.V128AndNot:    {Name: "v128.andnot", Kind: SIMDBinary},
+	opcodes.V128Or:        {Name: "v128.or", Kind: SIMDBinary},
+	opcodes.V128Xor:       {Name: "v128.xor", Kind: SIMDBinary},
+	opcodes.V128Bitselect: {Name: "v128.bitselect", Kind: SIMDTernary},
+	opcodes.V128AnyTrue:   {Name: "v128.any_true", Kind: SIMDTest},
+
+	opcodes.V128Load8Lane:   {Name: "v128.load8_lane", Kind: SIMDLoadLane, Lanes: 16},
+	opcodes.V128Load16Lane:  {Name: "v128.load16_lane", Kind: SIMDLoadLane, Lanes: 8},
+	opcodes.V128Load32Lane:  {Name: "v128.load32_lane", Kind: SIMDLoadLane, Lanes: 4},
+	opcodes.V128Load64Lane:  {Name: "v128.load64_lane", Kind: SIMDLoadLane, Lanes: 2},
+	opcodes.V128Store8Lane:  {Name: "v128.store8_lane", Kind: SIMDStoreLane, Lanes: 16},
+	opcodes.V128Store16Lane: {Name: "v128.store16_lane", Kind: SIMDStoreLane, Lanes: 8},
+	opcodes.V128Store32Lane: {Name: "v128.store32_lane", Kind: SIMDStoreLane, Lanes: 4},
+	opcodes.V128Store64Lane: {Name: "v128.store64_lane", Kind: SIMDStoreLane, Lanes: 2},
+	opcodes.V128Load32Zero:  {Name: "v128.load32_zero", Kind: SIMDLoad},
+	opcodes.V128Load64Zero:  {Name: "v128.load64_zero", Kind: SIMDLoad},
+
+	opcodes.F32x4DemoteF64x2Zero: {Name: "f32x4.demote_f64x2_zero", Kind: SIMDUnary},
+	opcodes.F64x2PromoteLowF32x4: {Name: "f64x2.promote_low_f32x4", Kind: SIMDUnary},
+
+	opcodes.I8x16Abs:          {Name: "i8x16.abs", Kind: SIMDUnary},
+	opcodes.I8x16Neg:          {Name: "i8x16.neg", Kind: SIMDUnary},
+	opcodes.I8x16Popcnt:       {Name: "i8x16.popcnt", Kind: SIMDUnary},
+	opcodes.I8x16AllTrue:      {Name: "i8x16.all_true", Kind: SIMDTest},
+	opcodes.I8x16Bitmask:      {Name: "i8x16.bitmask", Kind: SIMDTest},
+	opcodes.I8x16NarrowI16x8S: {Name: "i8x16.narrow_i16x8_s", Kind: SIMDBinary},
+	opcodes.I8x16NarrowI16x8U: {Name: "i8x16.narrow_i16x8_u", Kind: SIMDBinary},
+	opcodes.F32x4Ceil:         {Name: "f32x4.ceil", Kind: SIMDUnary},
+	opcodes.F32x4Floor:        {Name: "f32x4.floor", Kind: SIMDUnary},
+	opcodes.F32x4Trunc:        {Name: "f32x4.trunc", Kind: SIMDUnary},
+	opcodes.F32x4Nearest:      {Name: "f32x4.nearest", Kind: SIMDUnary},
+	opcodes.I8x16Shl:          {Name: "i8x16.shl", Kind: SIMDShift},
+	opcodes.I8x16ShrS:         {Name: "i8x16.shr_s", Kind: SIMDShift},
+	opcodes.I8x16ShrU:         {Name: "i8x16.shr_u", Kind: SIMDShift},
+	opcodes.I8x16Add:          {Name: "i8x16.add", Kind: SIMDBinary},
+	opcodes.I8x16AddSatS:      {Name: "i8x16.add_sat_s", Kind: SIMDBinary},
+	opcodes.I8x16AddSatU:      {Name: "i8x16.add_sat_u", Kind: SIMDBinary},
+	opcodes.I8x16Sub:          {Name: "i8x16.sub", Kind: SIMDBinary},
+	opcodes.I8x16SubSatS:      {Name: "i8x16.sub_sat_s", Kind: SIMDBinary},
+	opcodes.I8x16SubSatU:      {Name: "i8x16.sub_sat_u", Kind: SIMDBinary},
+	opcodes.F64x2Ceil:         {Name: "f64x2.ceil", Kind: SIMDUnary},
+	opcodes.F64x2Floor:        {Name: "f64x2.floor", Kind: SIMDUnary},
+	opcodes.I8x16MinS:         {Name: "i8x16.min_s", Kind: SIMDBinary},
+	opcodes.I8x16MinU:         {Name: "i8x16.min_u", Kind: SIMDBinary},
+	opcodes.I8x16MaxS:         {Name: "i8x16.max_s", Kind: SIMDBinary},
+	opcodes.I8x16MaxU:         {Name: "i8x16.max_u", Kind: SIMDBinary},
+	opcodes.F64x2Trunc:        {Name: "f64x2.trunc", Kind: SIMDUnary},
+	opcodes.I8x16AvgrU:        {Name: "i8x16.avgr_u", Kind: SIMDBinary},
+
+	opcodes.I16x8ExtaddPairwiseI8x16S: {Name: "i16x8.extadd_pairwise_i8x16_s", Kind: SIMDUnary},
+	opcodes.I16x8ExtaddPairwiseI8x16U: {Name: "i16x8.extadd_pairwise_i8x16_u", Kind: SIMDUnary},
+	opcodes.I32x4ExtaddPairwiseI16x8S: {Name: "i32x4.extadd_pairwise_i16x8_s", Kind: SIMDUnary},
+	opcodes.I32x4ExtaddPairwiseI16x8U: {Name: "i32x4.extadd_pairwise_i16x8_u", Kind: SIMDUnary},
+
+	opcodes.I16x8Abs:              {Name: "i16x8.abs", Kind: SIMDUnary},
+	opcodes.I16x8Neg:              {Name: "i16x8.neg", Kind: SIMDUnary},
+	opcodes.I16x8Q15mulrSatS:      {Name: "i16x8.q15mulr_sat_s", Kind: SIMDBinary},
+	opcodes.I16x8AllTrue:          {Name: "i16x8.all_true", Kind: SIMDTest},
+	opcodes.I16x8Bitmask:          {Name: "i16x8.bitmask", Kind: SIMDTest},
+	opcodes.I16x8NarrowI32x4S:     {Name: "i16x8.narrow_i32x4_s", Kind: SIMDBinary},
+	opcodes.I16x8NarrowI32x4U:     {Name: "i16x8.narrow_i32x4_u", Kind: SIMDBinary},
+	opcodes.I16x8ExtendLowI8x16S:  {Name: "i16x8.extend_low_i8x16_s", Kind: SIMDUnary},
+	opcodes.I16x8ExtendHighI8x16S: {Name: "i16x8.extend_high_i8x16_s", Kind: SIMDUnary},
+	opcodes.I16x8ExtendLowI8x16U:  {Name: "i16x8.extend_low_i8x16_u", Kind: SIMDUnary},
+	opcodes.I16x8ExtendHighI8x16U: {Name: "i16x8.extend_high_i8x16_u", Kind: SIMDUnary},
+	opcodes.I16x8Shl:              {Name: "i16x8.shl", Kind: SIMDShift},
+	opcodes.I16x8ShrS:             {Name: "i16x8.shr_s", Kind: SIMDShift},
+	opcodes.I16x8ShrU:             {Name: "i16x8.shr_u", Kind: SIMDShift},
+	opcodes.I16x8Add:              {Name: "i16x8.add", Kind: SIMDBinary},
+	opcodes.I16x8AddSatS:          {Name: "i16x8.add_sat_s", Kind: SIMDBinary},
+	opcodes.I16x8AddSatU:          {Name: "i16x8.add_sat_u", Kind: SIMDBinary},
+	opcodes.I16x8Sub:              {Name: "i16x8.sub", Kind: SIMDBinary},
+	opcodes.I16x8SubSatS:          {Name: "i16x8.sub_sat_s", Kind: SIMDBinary},
+	opcodes.I16x8SubSatU:          {Name: "i16x8.sub_sat_u", Kind: SIMDBinary},
+	opcodes.F64x2Nearest:          {Name: "f64x2.nearest", Kind: SIMDUnary},
+	opcodes.I16x8Mul:              {Name: "i16x8.mul", Kind: SIMDBinary},
+	opcodes.I16x8MinS:             {Name: "i16x8.min_s", Kind: SIMDBinary},
+	opcodes.I16x8MinU:             {Name: "i16x8.min_u", Kind: SIMDBinary},
+	opcodes.I16x8MaxS:             {Name: "i16x8.max_s", Kind: SIMDBinary},
+	opcodes.I16x8MaxU:             {Name: "i16x8.max_u", Kind: SIMDBinary},
+	opcodes.I16x8AvgrU:            {Name: "i16x8.avgr_u", Kind: SIMDBinary},
+	opcodes.I16x8ExtmulLowI8x16S:  {Name: "i16x8.extmul_low_i8x16_s", Kind: SIMDBinary},
+	opcodes.I16x8ExtmulHighI8x16S: {Name: "i16x8.extmul_high_i8x16_s", Kind: SIMDBinary},
+	opcodes.I16x8ExtmulLowI8x16U:  {Name: "i16x8.extmul_low_i8x16_u", Kind: SIMDBinary},
+	opcodes.I16x8ExtmulHighI8x16U: {Name: "i16x8.extmul_high_i8x16_u", Kind: SIMDBinary},
+
+	opcodes.I32x4Abs:              {Name: "i32x4.abs", Kind: SIMDUnary},
+	opcodes.I32x4Neg:              {Name: "i32x4.neg", Kind: SIMDUnary},
+	opcodes.I32x4AllTrue:          {Name: "i32x4.all_true", Kind: SIMDTest},
+	opcodes.I32x4Bitmask:          {Name: "i32x4.bitmask", Kind: SIMDTest},
+	opcodes.I32x4ExtendLowI16x8S:  {Name: "i32x4.extend_low_i16x8_s", Kind: SIMDUnary},
+	opcodes.I32x4ExtendHighI16x8S: {Name: "i32x4.extend_high_i16x8_s", Kind: SIMDUnary},
+	opcodes.I32x4ExtendLowI16x8U:  {Name: "i32x4.extend_low_i16x8_u", Kind: SIMDUnary},
+	opcodes.I32x4ExtendHighI16x8U: {Name: "i32x4.extend_high_i16x8_u", Kind: SIMDUnary},
+	opcodes.I32x4Shl:              {Name: "i32x4.shl", Kind: SIMDShift},
+	opcodes.I32x4ShrS:             {Name: "i32x4.shr_s", Kind: SIMDShift},
+	opcodes.I32x4ShrU:             {Name: "i32x4.shr_u", Kind: SIMDShift},
+	opcodes.I32x4Add:              {Name: "i32x4.add", Kind: SIMDBinary},
+	opcodes.I32x4Sub:              {Name: "i32x4.sub", Kind: SIMDBinary},
+	opcodes.I32x4Mul:              {Name: "i32x4.mul", Kind: SIMDBinary},
+	opcodes.I32x4MinS:             {Name: "i32x4.min_s", Kind: SIMDBinary},
+	opcodes.I32x4MinU:             {Name: "i32x4.min_u", Kind: SIMDBinary},
+	opcodes.I32x4MaxS:             {Name: "i32x4.max_s", Kind: SIMDBinary},
+	opcodes.I32x4MaxU:             {Name: "i32x4.max_u", Kind: SIMDBinary},
+	opcodes.I32x4DotI16x8S:        {Name: "i32x4.dot_i16x8_s", Kind: SIMDBinary},
+	opcodes.I32x4ExtmulLowI16x8S:  {Name: "i32x4.extmul_low_i16x8_s", Kind: SIMDBinary},
+	opcodes.I32x4ExtmulHighI16x8S: {Name: "i32x4.extmul_high_i16x8_s", Kind: SIMDBinary},
+	opcodes.I32x4ExtmulLowI16x8U:  {Name: "i32x4.extmul_low_i16x8_u", Kind: SIMDBinary},
+	opcodes.I32x4ExtmulHighI16x8U: {Name: "i32x4.extmul_high_i16x8_u", Kind: SIMDBinary},
+
+	opcodes.I64x2Abs:              {Name: "i64x2.abs", Kind: SIMDUnary},
+	opcodes.I64x2Neg:              {Name: "i64x2.neg", Kind: SIMDUnary},
+	opcodes.I64x2AllTrue:          {Name: "i64x2.all_true", Kind: SIMDTest},
+	opcodes.I64x2Bitmask:          {Name: "i64x2.bitmask", Kind: SIMDTest},
+	opcodes.I64x2ExtendLowI32x4S:  {Name: "i64x2.extend_low_i32x4_s", Kind: SIMDUnary},
+	opcodes.I64x2ExtendHighI32x4S: {Name: "i64x2.extend_high_i32x4_s", Kind: SIMDUnary},
+	opcodes.I64x2ExtendLowI32x4U:  {Name: "i64x2.extend_low_i32x4_u", Kind: SIMDUnary},
+	opcodes.I64x2ExtendHighI32x4U: {Name: "i64x2.extend_high_i32x4_u", Kind: SIMDUnary},
+	opcodes.I64x2Shl:              {Name: "i64x2.shl", Kind: SIMDShift},
+	opcodes.I64x2ShrS:             {Name: "i64x2.shr_s", Kind: SIMDShift},
+	opcodes.I64x2ShrU:             {Name: "i64x2.shr_u", Kind: SIMDShift},
+	opcodes.I64x2Add:              {Name: "i64x2.add", Kind: SIMDBinary},
+	opcodes.I64x2Sub:              {Name: "i64x2.sub", Kind: SIMDBinary},
+	opcodes.I64x2Mul:              {Name: "i64x2.mul", Kind: SIMDBinary},
+	opcodes.I64x2Eq:               {Name: "i64x2.eq", Kind: SIMDBinary},
+	opcodes.I64x2Ne:               {Name: "i64x2.ne", Kind: SIMDBinary},
+	opcodes.I64x2LtS:              {Name: "i64x2.lt_s", Kind: SIMDBinary},
+	opcodes.I64x2GtS:              {Name: "i64x2.gt_s", Kind: SIMDBinary},
+	opcodes.I64x2LeS:              {Name: "i64x2.le_s", Kind: SIMDBinary},
+	opcodes.I64x2GeS:              {Name: "i64x2.ge_s", Kind: SIMDBinary},
+	opcodes.I64x2ExtmulLowI32x4S:  {Name: "i64x2.extmul_low_i32x4_s", Kind: SIMDBinary},
+	opcodes.I64x2ExtmulHighI32x4S: {Name: "i64x2.extmul_high_i32x4_s", Kind: SIMDBinary},
+	opcodes.I64x2ExtmulLowI32x4U:  {Name: "i64x2.extmul_low_i32x4_u", Kind: SIMDBinary},
+	opcodes.I64x2ExtmulHighI32x4U: {Name: "i64x2.extmul_high_i32x4_u", Kind: SIMDBinary},
+
+	opcodes.F32x4Abs:  {Name: "f32x4.abs", Kind: SIMDUnary},
+	opcodes.F32x4Neg:  {Name: "f32x4.neg", Kind: SIMDUnary},
+	opcodes.F32x4Sqrt: {Name: "f32x4.sqrt", Kind: SIMDUnary},
+	opcodes.F32x4Add:  {Name: "f32x4.add", Kind: SIMDBinary},
+	opcodes.F32x4Sub:  {Name: "f32x4.sub", Kind: SIMDBinary},
+	opcodes.F32x4Mul:  {Name: "f32x4.mul", Kind: SIMDBinary},
+	opcodes.F32x4Div:  {Name: "f32x4.div", Kind: SIMDBinary},
+	opcodes.F32x4Min:  {Name: "f32x4.min", Kind: SIMDBinary},
+	opcodes.F32x4Max:  {Name: "f32x4.max", Kind: SIMDBinary},
+	opcodes.F32x4Pmin: {Name: "f32x4.pmin", Kind: SIMDBinary},
+	opcodes.F32x4Pmax: {Name: "f32x4.pmax", Kind: SIMDBinary},
+	opcodes.F64x2Abs:  {Name: "f64x2.abs", Kind: SIMDUnary},
+	opcodes.F64x2Neg:  {Name: "f64x2.neg", Kind: SIMDUnary},
+	opcodes.F64x2Sqrt: {Name: "f64x2.sqrt", Kind: SIMDUnary},
+	opcodes.F64x2Add:  {Name: "f64x2.add", Kind: SIMDBinary},
+	opcodes.F64x2Sub:  {Name: "f64x2.sub", Kind: SIMDBinary},
+	opcodes.F64x2Mul:  {Name: "f64x2.mul", Kind: SIMDBinary},
+	opcodes.F64x2Div:  {Name: "f64x2.div", Kind: SIMDBinary},
+	opcodes.F64x2Min:  {Name: "f64x2.min", Kind: SIMDBinary},
+	opcodes.F64x2Max:  {Name: "f64x2.max", Kind: SIMDBinary},
+	opcodes.F64x2Pmin: {Name: "f64x2.pmin", Kind: SIMDBinary},
+	opcodes.F64x2Pmax: {Name: "f64x2.pmax", Kind: SIMDBinary},
+
+	opcodes.I32x4TruncSatF32x4S:     {Name: "i32x4.trunc_sat_f32x4_s", Kind: SIMDUnary},
+	opcodes.I32x4TruncSatF32x4U:     {Name: "i32x4.trunc_sat_f32x4_u", Kind: SIMDUnary},
+	opcodes.F32x4ConvertI32x4S:      {Name: "f32x4.convert_i32x4_s", Kind: SIMDUnary},
+	opcodes.F32x4ConvertI32x4U:      {Name: "f32x4.convert_i32x4_u", Kind: SIMDUnary},
+	opcodes.I32x4TruncSatF64x2SZero: {Name: "i32x4.trunc_sat_f64x2_s_zero", Kind: SIMDUnary},
+	opcodes.I32x4TruncSatF64x2UZero: {Name: "i32x4.trunc_sat_f64x2_u_zero", Kind: SIMDUnary},
+	opcodes.F64x2ConvertLowI32x4S:   {Name: "f64x2.convert_low_i32x4_s", Kind: SIMDUnary},
+	opcodes.F64x2ConvertLowI32x4U:   {Name: "f64x2.convert_low_i32x4_u", Kind: SIMDUnary},
+}
+
+// simdOpcodes maps the names of the SIMD instructions to their sub-opcodes.
+var simdOpcodes = make(map[string]opcodes.SIMDOpcode)
+
+func init() {
+	for code, op := range SIMDOps {
+		simdOpcodes[op.Name] = code
+	}
+}
+
+// simdOp returns the SIMD instruction named name, if any.
+func simdOp(name string) (opcodes.SIMDOpcode, SIMDOp, bool) {
+	code, ok := simdOpcodes[name]
+	if !ok {
+		return 0, SIMDOp{}, false
+	}
+	return code, SIMDOps[code], true
+}
+
+// compileSIMD compiles the SIMD instruction ins, returning false if ins is
+// not a SIMD instruction.
+func (c *SSAFunctionCompiler) compileSIMD(ins disasm.Instr) bool {
+	_, op, ok := simdOp(ins.Op.Name)
+	if !ok {
+		return false
+	}
+
+	var immediates []int64
+	switch op.Kind {
+	case SIMDConst:
+		for i := 0; i < 2; i++ {
+			retID := c.NextValueID()
+			c.Code = append(c.Code, buildInstr(retID, "i64.const", []int64{int64(ins.Immediates[i].(uint64))}, nil))
+			c.pushSlot(retID, i == 1)
+		}
+		return true
+	case SIMDShuffle:
+		for i := 0; i < 2; i++ {
+			lanes := ins.Immediates[i].(uint64)
+			for j := 0; j < 64; j += 8 {
+				if lane := byte(lanes >> uint(j)); lane >= 32 {
+					panic(fmt.Errorf("invalid lane index %d", lane))
+				}
+			}
+			immediates = append(immediates, int64(lanes))
+		}
+	case SIMDLoad, SIMDStore:
+		immediates = c.memArg(ins)
+	case SIMDLoadLane, SIMDStoreLane:
+		immediates = append(c.memArg(ins), int64(ins.Immediates[3].(uint8)))
+	case SIMDExtractLane, SIMDReplaceLane:
+		immediates = []int64{int64(ins.Immediates[0].(uint8))}
+	}
+
+	values := c.PopStack(op.NumValues())
+	switch {
+	case op.HasV128Result():
+		lo, hi := c.NextValueID(), c.NextValueID()
+		c.Code = append(c.Code, buildInstr(lo, op.Name, immediates, values))
+		c.Code = append(c.Code, buildInstr(hi, "phi", []int64{1}, nil))
+		c.pushSlot(lo, false)
+		c.pushSlot(hi, true)
+	case op.Kind == SIMDStore || op.Kind == SIMDStoreLane:
+		c.Code = append(c.Code, buildInstr(0, op.Name, immediates, values))
+	default:
+		retID := c.NextValueID()
+		c.Code = append(c.Code, buildInstr(retID, op.Name, immediates, values))
+		c.PushStack(retID)
+	}
+	return true
+}
+
+// isSIMDInstr tells whether ins is a SIMD instruction, v128.const excepted.
+func isSIMDInstr(ins Instr) bool {
+	_, ok := simdOpcodes[ins.Op]
+	return ok
+}
+
+// FilterSIMD replaces the SIMD instructions by instructions raising a
+// TrapSIMDDisabled trap. v128 constants, locals, globals, parameters and
+// results are still allowed as they do not involve any vector arithmetic.
+func (c *SSAFunctionCompiler) FilterSIMD() {
+	for i, ins := range c.Code {
+		if isSIMDInstr(ins) {
+			c.Code[i] = buildInstr(ins.Target, "simd_disabled_error", nil, nil)
+		}
+	}
+}
@@ -22,22 +22,53 @@ type SSAFunctionCompiler struct {
 	Locations []*Location
 
 	CallIndexOffset int
+	ReturnTypes     []wasm.ValueType // result types of the function
+	LocalTypes      []wasm.ValueType // types of the parameters and locals of the function
+	GlobalHighs     map[int]int      // indices of the high halves of the v128 globals
+	NumDataSegments int
+	NumElemSegments int
+	NumTables       int
+	MemoryTypes     []MemoryType
+	Tags            []uint32 // type indices of the parameters of the tags of the module
 
-	StackValueSets map[int][]TyValueID
-	UsedValueIDs   map[TyValueID]struct{}
+	// Handlers holds the exception handlers of the function once serialized.
+	Handlers []ExceptionHandler
+
+	UsedValueIDs map[TyValueID]struct{}
+	HighHalves   map[TyValueID]struct{} // values holding the high half of a v128 value
+
+	localSlots  []int                        // value slot of each local
+	valueTypes  map[TyValueID]wasm.ValueType // types of the values whose type is known; see resultType
+	numHandlers int
 
 	ValueID TyValueID
 }
 
 type Location struct {
-	CodePos         int
-	StackDepth      int
-	BrHead          bool // true for loops
-	PreserveTop     bool
-	LoopPreserveTop bool
-	FixupList       []FixupInfo
+	CodePos     int
+	StackDepth  int  // stack depth below the parameters of the block
+	BrHead      bool // true for loops
+	NumParams   int  // number of value slots of the parameters
+	NumResults  int  // number of value slots of the results
+	ParamTypes  []wasm.ValueType
+	ResultTypes []wasm.ValueType
+	FixupList   []FixupInfo
 
 	IfBlock bool
+	ElsePos int // position of the jump to the else branch of an if block
+
+	TryBlock bool
+	Catching bool // true once the first catch clause of a try block is reached
+	Handler  int  // exception handler of a try block
+}
+
+// BranchArity returns the number of values passed along a branch to the
+// location.
+func (loc *Location) BranchArity() int {
+	if loc.BrHead {
+		return loc.NumParams
+	}
+	return loc.NumResults
 }
 
 type FixupInfo struct {
@@ -58,10 +89,11 @@ type Instr struct {
 // intepreted code into a Static-Single-Assignment-based intermediate representation.
 func NewSSAFunctionCompiler(m *wasm.Module, d *disasm.Disassembly) *SSAFunctionCompiler {
 	return &SSAFunctionCompiler{
-		Module:         m,
-		Source:         d,
-		StackValueSets: make(map[int][]TyValueID),
-		UsedValueIDs:   make(map[TyValueID]struct{}),
+		Module:       m,
+		Source:       d,
+		UsedValueIDs: make(map[TyValueID]struct{}),
+		HighHalves:   make(map[TyValueID]struct{}),
+		valueTypes:   make(map[TyValueID]wasm.ValueType),
 	}
 }
 
@@ -82,30 +114,159 @@ func (c *SSAFunctionCompiler) PopStack(n int) []TyValueID {
 }
 
 func (c *SSAFunctionCompiler) PushStack(values ...TyValueID) {
-	for i, id := range values {
+	for _, id := range values {
 		if _, ok := c.UsedValueIDs[id]; ok {
 			panic("pushing a value ID twice is not supported yet")
 		}
 		c.UsedValueIDs[id] = struct{}{}
-		c.StackValueSets[len(c.Stack)+i] = append(c.StackValueSets[len(c.Stack)+i], id)
 	}
 
 	c.Stack = append(c.Stack, values...)
 }
 
-func (c *SSAFunctionCompiler) FixupLocationRef(loc *Location, wasUnreachable bool) {
-	if loc.PreserveTop || loc.LoopPreserveTop {
-		if wasUnreachable {
-			c.Code = append(
-				c.Code,
-				buildInstr(0, "jmp", []int64{int64(len(c.Code) + 1)}, []TyValueID{0}),
-			)
+// TopStack returns the top n values of the stack without popping them.
+func (c *SSAFunctionCompiler) TopStack(n int) []TyValueID {
+	if len(c.Stack) < n {
+		panic("stack underflow")
+	}
+	return c.Stack[len(c.Stack)-n:]
+}
+
+// YieldValues emits the instructions passing values along the branch which
+// follows them. The first value is passed by the branch itself and is returned.
+func (c *SSAFunctionCompiler) YieldValues(values []TyValueID) TyValueID {
+	if len(values) == 0 {
+		return 0
+	}
+	for i := 1; i < len(values); i++ {
+		c.Code = append(c.Code, buildInstr(0, "yield", []int64{int64(i)}, []TyValueID{values[i]}))
+	}
+	return values[0]
+}
+
+// PushPhis pushes the values of the given types passed along the branches to
+// the current position.
+func (c *SSAFunctionCompiler) PushPhis(types []wasm.ValueType) {
+	for i, high := range highSlots(types) {
+		retID := c.NextValueID()
+		if i == 0 {
+			c.Code = append(c.Code, buildInstr(retID, "phi", nil, nil))
 		} else {
-			c.Code = append(
-				c.Code,
-				buildInstr(0, "jmp", []int64{int64(len(c.Code) + 1)}, c.PopStack(1)),
-			)
+			c.Code = append(c.Code, buildInstr(retID, "phi", []int64{int64(i)}, nil))
+		}
+		c.pushSlot(retID, high)
+	}
+}
+
+// pushSlot pushes a value, which holds the high half of a v128 value if high
+// is set.
+func (c *SSAFunctionCompiler) pushSlot(id TyValueID, high bool) {
+	if high {
+		c.HighHalves[id] = struct{}{}
+	}
+	c.PushStack(id)
+}
+
+// topIsV128 tells whether the value below the top n values of the stack is
+// the high half of a v128 value.
+func (c *SSAFunctionCompiler) topIsV128(n int) bool {
+	if len(c.Stack) <= n {
+		return false
+	}
+	_, ok := c.HighHalves[c.Stack[len(c.Stack)-1-n]]
+	return ok
+}
+
+// highSlots returns, for each value slot holding values of the given types,
+// whether it holds the high half of a v128 value.
+func highSlots(types []wasm.ValueType) []bool {
+	ret := make([]bool, 0, len(types))
+	for _, t := range types {
+		ret = append(ret, false)
+		if t == ValueTypeV128 {
+			ret = append(ret, true)
+		}
+	}
+	return ret
+}
+
+// sameValueTypes tells whether a and b are the same sequence of types.
+func sameValueTypes(a, b []wasm.ValueType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// BlockSignature returns the types of the parameters and results of a block,
+// loop or if instruction.
+func (c *SSAFunctionCompiler) BlockSignature(ins disasm.Instr) ([]wasm.ValueType, []wasm.ValueType) {
+	switch ty := ins.Immediates[0].(type) {
+	case wasm.BlockType:
+		if ty == wasm.BlockTypeEmpty {
+			return nil, nil
+		}
+		return nil, []wasm.ValueType{wasm.ValueType(ty)}
+	case TypeIndex:
+		if c.Module.Types == nil || int(ty) >= len(c.Module.Types.Entries) {
+			panic(fmt.Errorf("invalid block type index %d", ty))
+		}
+		sig := &c.Module.Types.Entries[int(ty)]
+		return sig.ParamTypes, sig.ReturnTypes
+	}
+	panic("invalid block type")
+}
+
+// newBlockLocation returns the location of a block, loop or if instruction.
+func (c *SSAFunctionCompiler) newBlockLocation(ins disasm.Instr) *Location {
+	params, results := c.BlockSignature(ins)
+	return &Location{
+		CodePos:     len(c.Code),
+		NumParams:   NumSlots(params),
+		NumResults:  NumSlots(results),
+		ParamTypes:  params,
+		ResultTypes: results,
+	}
+}
+
+// localSlot returns the value slot of a local, and whether the local is a
+// v128 local taking the slot and the next one.
+func (c *SSAFunctionCompiler) localSlot(index uint32) (int, bool) {
+	if c.LocalTypes == nil {
+		return int(index), false
+	}
+	if c.localSlots == nil {
+		c.localSlots = make([]int, len(c.LocalTypes))
+		slot := 0
+		for i, t := range c.LocalTypes {
+			c.localSlots[i] = slot
+			slot++
+			if t == ValueTypeV128 {
+				slot++
+			}
+		}
+	}
+	if int(index) >= len(c.LocalTypes) {
+		panic(fmt.Errorf("invalid local index %d", index))
+	}
+	return c.localSlots[index], c.LocalTypes[index] == ValueTypeV128
+}
+
+func (c *SSAFunctionCompiler) FixupLocationRef(loc *Location, wasUnreachable bool) {
+	if loc.NumResults > 0 {
+		var yieldValue TyValueID
+		if !wasUnreachable {
+			yieldValue = c.YieldValues(c.PopStack(loc.NumResults))
 		}
+		c.Code = append(
+			c.Code,
+			buildInstr(0, "jmp", []int64{int64(len(c.Code) + 1)}, []TyValueID{yieldValue}),
+		)
 	}
 
 	var innerBrTarget int64
@@ -119,17 +280,22 @@ func (c *SSAFunctionCompiler) FixupLocationRef(loc *Location, wasUnreachable boo
 		c.Code[info.CodePos].Immediates[info.TablePos] = innerBrTarget
 	}
 
-	if loc.PreserveTop || loc.LoopPreserveTop /* why? */ {
-		retID := c.NextValueID()
-		c.Code = append(c.Code, buildInstr(retID, "phi", nil, nil))
-		c.PushStack(retID)
+	c.PushPhis(loc.ResultTypes)
+}
+
+// emitReturn emits a return of the given values.
+func (c *SSAFunctionCompiler) emitReturn(values []TyValueID) {
+	if len(values) == 0 {
+		values = nil
 	}
+	c.Code = append(c.Code, buildInstr(0, "return", nil, values))
 }
 
 func (c *SSAFunctionCompiler) FilterFloatingPoint() {
 	for i, ins := range c.Code {
 		if strings.HasPrefix(ins.Op, "f32.") || strings.HasPrefix(ins.Op, "f64.") ||
-			strings.HasSuffix(ins.Op, "/f32") || strings.HasSuffix(ins.Op, "/f64") {
+			strings.HasSuffix(ins.Op, "/f32") || strings.HasSuffix(ins.Op, "/f64") ||
+			strings.Contains(ins.Op, "f32x4") || strings.Contains(ins.Op, "f64x2") {
 			if strings.Contains(ins.Op, ".reinterpret/") || strings.HasSuffix(ins.Op, ".const") {
 				continue // whitelist
 			}
@@ -142,8 +308,10 @@ func (c *SSAFunctionCompiler) FilterFloatingPoint() {
 // a Static-Single-Assignment-based intermediate representation.
 func (c *SSAFunctionCompiler) Compile(importTypeIDs []int) {
 	c.Locations = append(c.Locations, &Location{
-		CodePos:    0,
-		StackDepth: 0,
+		CodePos:     0,
+		StackDepth:  0,
+		NumResults:  NumSlots(c.ReturnTypes),
+		ResultTypes: c.ReturnTypes,
 	})
 
 	unreachableDepth := 0
@@ -155,12 +323,12 @@ func (c *SSAFunctionCompiler) Compile(importTypeIDs []int) {
 		if unreachableDepth != 0 {
 			wasUnreachable = true
 			switch ins.Op.Name {
-			case "block", "loop", "if":
+			case "block", "loop", "if", "try":
 				unreachableDepth++
-			case "end":
+			case "end", "delegate":
 				unreachableDepth--
 			}
-			if unreachableDepth == 1 && ins.Op.Name == "else" {
+			if unreachableDepth == 1 && (ins.Op.Name == "else" || ins.Op.Name == "catch" || ins.Op.Name == "catch_all") {
 				unreachableDepth--
 			}
 			if unreachableDepth != 0 {
@@ -168,6 +336,8 @@ func (c *SSAFunctionCompiler) Compile(importTypeIDs []int) {
 			}
 		}
 
+		c.checkOperands(ins)
+
 		switch ins.Op.Name {
 		case "nop":
 
@@ -176,6 +346,16 @@ func (c *SSAFunctionCompiler) Compile(importTypeIDs []int) {
 			unreachableDepth = 1
 
 		case "select":
+			if c.topIsV128(1) {
+				// Both halves are selected by the same condition.
+				values := c.PopStack(5)
+				lo, hi := c.NextValueID(), c.NextValueID()
+				c.Code = append(c.Code, buildInstr(lo, ins.Op.Name, nil, []TyValueID{values[0], values[2], values[4]}))
+				c.Code = append(c.Code, buildInstr(hi, ins.Op.Name, nil, []TyValueID{values[1], values[3], values[4]}))
+				c.pushSlot(lo, false)
+				c.pushSlot(hi, true)
+				break
+			}
 			retID := c.NextValueID()
 			c.Code = append(c.Code, buildInstr(retID, ins.Op.Name, nil, c.PopStack(3)))
 			c.PushStack(retID)
@@ -230,8 +410,11 @@ func (c *SSAFunctionCompiler) Compile(importTypeIDs []int) {
 			"f32.sqrt", "f32.ceil", "f32.floor", "f32.trunc", "f32.nearest", "f32.abs", "f32.neg",
 			"f64.sqrt", "f64.ceil", "f64.floor", "f64.trunc", "f64.nearest", "f64.abs", "f64.neg",
 			"i32.wrap/i64", "i64.extend_u/i32", "i64.extend_s/i32",
+			"i32.extend8_s", "i32.extend16_s", "i64.extend8_s", "i64.extend16_s", "i64.extend32_s",
 			"i32.trunc_u/f32", "i32.trunc_u/f64", "i64.trunc_u/f32", "i64.trunc_u/f64",
 			"i32.trunc_s/f32", "i32.trunc_s/f64", "i64.trunc_s/f32", "i64.trunc_s/f64",
+			"i32.trunc_u:sat/f32", "i32.trunc_u:sat/f64", "i64.trunc_u:sat/f32", "i64.trunc_u:sat/f64",
+			"i32.trunc_s:sat/f32", "i32.trunc_s:sat/f64", "i64.trunc_s:sat/f32", "i64.trunc_s:sat/f64",
 			"f32.demote/f64", "f64.promote/f32",
 			"f32.convert_u/i32", "f32.convert_u/i64", "f64.convert_u/i32", "f64.convert_u/i64",
 			"f32.convert_s/i32", "f32.convert_s/i64", "f64.convert_s/i32", "f64.convert_s/i64",
@@ -241,57 +424,75 @@ func (c *SSAFunctionCompiler) Compile(importTypeIDs []int) {
 			c.Code = append(c.Code, buildInstr(retID, ins.Op.Name, nil, c.PopStack(1)))
 			c.PushStack(retID)
 		case "drop":
-			c.PopStack(1)
+			if c.topIsV128(0) {
+				c.PopStack(2)
+			} else {
+				c.PopStack(1)
+			}
 
 		case "i32.load", "i64.load", "i32.load8_s", "i32.load16_s", "i64.load8_s", "i64.load16_s", "i64.load32_s",
 			"i32.load8_u", "i32.load16_u", "i64.load8_u", "i64.load16_u", "i64.load32_u",
 			"f32.load", "f64.load":
 			retID := c.NextValueID()
-			c.Code = append(c.Code, buildInstr(retID, ins.Op.Name, []int64{int64(ins.Immediates[0].(uint32)),
-				int64(ins.Immediates[1].(uint32))}, c.PopStack(1)))
+			c.Code = append(c.Code, buildInstr(retID, ins.Op.Name, c.memArg(ins), c.PopStack(1)))
 			c.PushStack(retID)
 		case "i32.store", "i32.store8", "i32.store16", "i64.store", "i64.store8", "i64.store16", "i64.store32", "f32.store", "f64.store":
-			c.Code = append(c.Code, buildInstr(0, ins.Op.Name, []int64{int64(ins.Immediates[0].(uint32)),
-				int64(ins.Immediates[1].(uint32))}, c.PopStack(2)))
+			c.Code = append(c.Code, buildInstr(0, ins.Op.Name, c.memArg(ins), c.PopStack(2)))
 
 		case "get_local", "get_global":
-			retID := c.NextValueID()
-			c.Code = append(c.Code, buildInstr(retID, ins.Op.Name, []int64{int64(ins.Immediates[0].(uint32))}, nil))
-			c.PushStack(retID)
+			slot, v128 := c.variableSlots(ins)
+			for i, index := range slot[:1+v128] {
+				retID := c.NextValueID()
+				c.Code = append(c.Code, buildInstr(retID, ins.Op.Name, []int64{int64(index)}, nil))
+				c.pushSlot(retID, i == 1)
+			}
 
 		case "set_local", "set_global":
-			c.Code = append(c.Code, buildInstr(0, ins.Op.Name, []int64{int64(ins.Immediates[0].(uint32))}, c.PopStack(1)))
+			slot, v128 := c.variableSlots(ins)
+			values := c.PopStack(1 + v128)
+			for i, index := range slot[:1+v128] {
+				c.Code = append(c.Code, buildInstr(0, ins.Op.Name, []int64{int64(index)}, []TyValueID{values[i]}))
+			}
 
 		case "tee_local":
-			c.Code = append(c.Code, buildInstr(0, "set_local", []int64{int64(ins.Immediates[0].(uint32))}, []TyValueID{c.Stack[len(c.Stack)-1]}))
+			slot, v128 := c.variableSlots(ins)
+			values := c.TopStack(1 + v128)
+			for i, index := range slot[:1+v128] {
+				c.Code = append(c.Code, buildInstr(0, "set_local", []int64{int64(index)}, []TyValueID{values[i]}))
+			}
 
 		case "block":
-			c.Locations = append(c.Locations, &Location{
-				CodePos:     len(c.Code),
-				StackDepth:  len(c.Stack),
-				PreserveTop: ins.Block != nil && ins.Block.Signature != wasm.BlockTypeEmpty,
-			})
+			loc := c.newBlockLocation(ins)
+			loc.StackDepth = len(c.Stack) - loc.NumParams
+			c.Locations = append(c.Locations, loc)
 
 		case "loop":
-			c.Locations = append(c.Locations, &Location{
-				CodePos:         len(c.Code),
-				StackDepth:      len(c.Stack),
-				LoopPreserveTop: ins.Block != nil && ins.Block.Signature != wasm.BlockTypeEmpty,
-				BrHead:          true,
-			})
+			loc := c.newBlockLocation(ins)
+			if loc.NumParams > 0 {
+				yieldValue := c.YieldValues(c.PopStack(loc.NumParams))
+				c.Code = append(c.Code, buildInstr(0, "jmp", []int64{int64(len(c.Code) + 1)}, []TyValueID{yieldValue}))
+			}
+			loc.CodePos = len(c.Code)
+			loc.StackDepth = len(c.Stack)
+			loc.BrHead = true
+			c.Locations = append(c.Locations, loc)
+			c.PushPhis(loc.ParamTypes)
 
 		case "if":
 			cond := c.PopStack(1)[0]
 
-			c.Locations = append(c.Locations, &Location{
-				CodePos:     len(c.Code),
-				StackDepth:  len(c.Stack),
-				PreserveTop: ins.Block != nil && ins.Block.Signature != wasm.BlockTypeEmpty,
-				IfBlock:     true,
-			})
+			loc := c.newBlockLocation(ins)
+			loc.StackDepth = len(c.Stack) - loc.NumParams
+			loc.IfBlock = true
+			c.Locations = append(c.Locations, loc)
 
-			c.Code = append(c.Code, buildInstr(0, "jmp_if", []int64{int64(len(c.Code) + 2)}, []TyValueID{cond, 0}))
-			c.Code = append(c.Code, buildInstr(0, "jmp", []int64{-1}, []TyValueID{0}))
+			// The parameters stay on the stack for the then branch and are
+			// passed along the jump to the else branch.
+			c.Code = append(c.Code, buildInstr(0, "jmp_if", []int64{-1}, []TyValueID{cond, 0}))
+			yieldValue := c.YieldValues(c.TopStack(loc.NumParams))
+			loc.ElsePos = len(c.Code)
+			c.Code = append(c.Code, buildInstr(0, "jmp", []int64{-1}, []TyValueID{yieldValue}))
+			c.Code[loc.CodePos].Immediates[0] = int64(len(c.Code))
 
 		case "else":
 			loc := c.Locations[len(c.Locations)-1]
@@ -299,44 +500,54 @@ func (c *SSAFunctionCompiler) Compile(importTypeIDs []int) {
 				panic("expected if block")
 			}
 
+			var yieldValue TyValueID
+			if !wasUnreachable {
+				if len(c.Stack) != loc.StackDepth+loc.NumResults {
+					panic(fmt.Errorf("inconsistent stack pattern: nr = %d, ls = %d, sd = %d", loc.NumResults, len(c.Stack), loc.StackDepth))
+				}
+				yieldValue = c.YieldValues(c.PopStack(loc.NumResults))
+			}
+
 			loc.FixupList = append(loc.FixupList, FixupInfo{
 				CodePos: len(c.Code),
 			})
+			c.Code = append(c.Code, buildInstr(0, "jmp", []int64{-1}, []TyValueID{yieldValue}))
+			c.Stack = c.Stack[:loc.StackDepth] // unwind stack
 
-			if loc.PreserveTop {
-				if !wasUnreachable {
-					c.Code = append(c.Code, buildInstr(0, "jmp", []int64{-1}, c.PopStack(1)))
-				} else {
-					c.Code = append(c.Code, buildInstr(0, "jmp", []int64{-1}, []TyValueID{0}))
-				}
-			} else {
-				c.Code = append(c.Code, buildInstr(0, "jmp", []int64{-1}, []TyValueID{0}))
-			}
-			if wasUnreachable {
-				c.Stack = c.Stack[:loc.StackDepth] // unwind stack
-			}
-
-			c.Code[loc.CodePos+1].Immediates[0] = int64(len(c.Code))
+			c.Code[loc.ElsePos].Immediates[0] = int64(len(c.Code))
+			c.PushPhis(loc.ParamTypes)
 			loc.IfBlock = false
 
+		case "try":
+			c.compileTry(ins)
+
+		case "catch", "catch_all":
+			c.compileCatch(ins, wasUnreachable)
+
+		case "delegate":
+			c.compileDelegate(ins)
+			fallthrough
+
 		case "end":
 			loc := c.Locations[len(c.Locations)-1]
 			c.Locations = c.Locations[:len(c.Locations)-1]
 
+			if loc.TryBlock && !loc.Catching && ins.Op.Name == "end" {
+				c.Code = append(c.Code, buildInstr(0, "try_end", []int64{int64(loc.Handler)}, nil))
+			}
+
 			if loc.IfBlock {
-				if loc.PreserveTop {
-					panic("if block without an else cannot yield values")
+				if loc.NumParams != loc.NumResults {
+					panic("if block without an else must have as many results as parameters")
 				}
 				loc.FixupList = append(loc.FixupList, FixupInfo{
-					CodePos: loc.CodePos + 1,
+					CodePos: loc.ElsePos,
 				})
 			}
 
 			if !wasUnreachable {
-				if ((loc.PreserveTop || loc.LoopPreserveTop) && len(c.Stack) == loc.StackDepth+1) ||
-					(!(loc.PreserveTop || loc.LoopPreserveTop) && len(c.Stack) == loc.StackDepth) {
-				} else {
-					panic(fmt.Errorf("inconsistent stack pattern: pt = %v, lpt = %v, ls = %d, sd = %d", loc.PreserveTop, loc.LoopPreserveTop, len(c.Stack), loc.StackDepth))
+				if len(c.Stack) != loc.StackDepth+loc.NumResults {
+					panic(fmt.Errorf("inconsistent stack pattern: nr = %d, ls = %d, sd = %d", loc.NumResults, len(c.Stack), loc.StackDepth))
 				}
 			} else {
 				c.Stack = c.Stack[:loc.StackDepth]
@@ -346,46 +557,38 @@ func (c *SSAFunctionCompiler) Compile(importTypeIDs []int) {
 		case "br":
 			label := int(ins.Immediates[0].(uint32))
 			loc := c.Locations[len(c.Locations)-1-label]
-			fixupInfo := FixupInfo{
-				CodePos: len(c.Code),
-			}
 
-			brValues := []TyValueID{0}
-			if loc.PreserveTop {
-				brValues[0] = c.Stack[len(c.Stack)-1]
-			}
-			loc.FixupList = append(loc.FixupList, fixupInfo)
-			c.Code = append(c.Code, buildInstr(0, "jmp", []int64{-1}, brValues))
+			yieldValue := c.YieldValues(c.TopStack(loc.BranchArity()))
+			loc.FixupList = append(loc.FixupList, FixupInfo{
+				CodePos: len(c.Code),
+			})
+			c.Code = append(c.Code, buildInstr(0, "jmp", []int64{-1}, []TyValueID{yieldValue}))
 			unreachableDepth = 1
 
 		case "br_if":
-			brValues := []TyValueID{c.PopStack(1)[0], 0}
+			cond := c.PopStack(1)[0]
 			label := int(ins.Immediates[0].(uint32))
 			loc := c.Locations[len(c.Locations)-1-label]
-			fixupInfo := FixupInfo{
+
+			yieldValue := c.YieldValues(c.TopStack(loc.BranchArity()))
+			loc.FixupList = append(loc.FixupList, FixupInfo{
 				CodePos: len(c.Code),
-			}
-			if loc.PreserveTop {
-				brValues[1] = c.Stack[len(c.Stack)-1]
-			}
-			loc.FixupList = append(loc.FixupList, fixupInfo)
-			c.Code = append(c.Code, buildInstr(0, "jmp_if", []int64{-1}, brValues))
+			})
+			c.Code = append(c.Code, buildInstr(0, "jmp_if", []int64{-1}, []TyValueID{cond, yieldValue}))
 
 		case "br_table":
 			brCount := int(ins.Immediates[0].(uint32)) + 1
 			brTargets := make([]int64, brCount)
-			brValues := []TyValueID{c.PopStack(1)[0], 0}
+			cond := c.PopStack(1)[0]
 
-			preserveTop := false
+			// All targets take the same number of values as the default one.
+			defaultLoc := c.Locations[len(c.Locations)-1-int(ins.Immediates[brCount].(uint32))]
+			yieldValue := c.YieldValues(c.TopStack(defaultLoc.BranchArity()))
 
 			for i := 0; i < brCount; i++ {
 				label := int(ins.Immediates[i+1].(uint32))
 				loc := c.Locations[len(c.Locations)-1-label]
 
-				if loc.PreserveTop {
-					preserveTop = true
-				}
-
 				fixupInfo := FixupInfo{
 					CodePos:  len(c.Code),
 					TablePos: i,
@@ -394,22 +597,22 @@ func (c *SSAFunctionCompiler) Compile(importTypeIDs []int) {
 				brTargets[i] = -1
 			}
 
-			if preserveTop {
-				brValues[1] = c.Stack[len(c.Stack)-1]
-			}
-
-			c.Code = append(c.Code, buildInstr(0, "jmp_table", brTargets, brValues))
+			c.Code = append(c.Code, buildInstr(0, "jmp_table", brTargets, []TyValueID{cond, yieldValue}))
 			unreachableDepth = 1
 
 		case "return":
-			if len(c.Stack) != 0 {
-				c.Code = append(c.Code, buildInstr(0, "return", nil, c.PopStack(1)))
-			} else {
-				c.Code = append(c.Code, buildInstr(0, "return", nil, nil))
-			}
+			c.emitReturn(c.PopStack(NumSlots(c.ReturnTypes)))
+			unreachableDepth = 1
+
+		case "throw":
+			c.compileThrow(ins)
+			unreachableDepth = 1
+
+		case "rethrow":
+			c.compileRethrow(ins)
 			unreachableDepth = 1
 
-		case "call":
+		case "call", "return_call":
 			targetID := int(ins.Immediates[0].(uint32))
 			var targetSig *wasm.FunctionSig
 
@@ -420,50 +623,298 @@ func (c *SSAFunctionCompiler) Compile(importTypeIDs []int) {
 				targetSig = &c.Module.Types.Entries[tyID]
 			}
 
-			params := c.PopStack(len(targetSig.ParamTypes))
+			params := c.PopStack(NumSlots(targetSig.ParamTypes))
+			if ins.Op.Name == "return_call" {
+				c.emitTailCall(ins.Op.Name, targetSig, []int64{int64(targetID)}, params)
+				unreachableDepth = 1
+				break
+			}
+
 			targetValueID := TyValueID(0)
 			if len(targetSig.ReturnTypes) > 0 {
 				targetValueID = c.NextValueID()
 			}
 			c.Code = append(c.Code, buildInstr(targetValueID, "call", []int64{int64(targetID)}, params))
-			if targetValueID != 0 {
-				c.PushStack(targetValueID)
-			}
+			c.pushCallResults(targetValueID, targetSig.ReturnTypes)
 
-		case "call_indirect":
+		case "call_indirect", "return_call_indirect":
 			typeID := int(ins.Immediates[0].(uint32))
 			sig := &c.Module.Types.Entries[typeID]
 
-			targetWithParams := c.PopStack(len(sig.ParamTypes) + 1)
+			targetWithParams := c.PopStack(NumSlots(sig.ParamTypes) + 1)
+			table := c.tableIndex(ins.Immediates[1])
+			if ins.Op.Name == "return_call_indirect" {
+				c.emitTailCall(ins.Op.Name, sig, []int64{int64(typeID), table}, targetWithParams)
+				unreachableDepth = 1
+				break
+			}
+
 			targetValueID := TyValueID(0)
 			if len(sig.ReturnTypes) > 0 {
 				targetValueID = c.NextValueID()
 			}
-			c.Code = append(c.Code, buildInstr(targetValueID, "call_indirect", []int64{int64(typeID)}, targetWithParams))
-			if targetValueID != 0 {
-				c.PushStack(targetValueID)
-			}
+			c.Code = append(c.Code, buildInstr(targetValueID, "call_indirect", []int64{int64(typeID), table}, targetWithParams))
+			c.pushCallResults(targetValueID, sig.ReturnTypes)
 
 		case "memory.size":
 			retID := c.NextValueID()
-			c.Code = append(c.Code, buildInstr(retID, ins.Op.Name, nil, nil))
+			c.Code = append(c.Code, buildInstr(retID, ins.Op.Name, []int64{c.memoryIndex(ins.Immediates[0])}, nil))
 			c.PushStack(retID)
 
 		case "memory.grow":
 			retID := c.NextValueID()
-			c.Code = append(c.Code, buildInstr(retID, ins.Op.Name, nil, c.PopStack(1)))
+			c.Code = append(c.Code, buildInstr(retID, ins.Op.Name, []int64{c.memoryIndex(ins.Immediates[0])}, c.PopStack(1)))
 			c.PushStack(retID)
 
+		case "memory.init", "data.drop":
+			seg := int(ins.Immediates[0].(uint32))
+			if seg >= c.NumDataSegments {
+				panic(fmt.Errorf("invalid data segment index %d", seg))
+			}
+			immediates := []int64{int64(seg)}
+			if ins.Op.Name == "memory.init" {
+				immediates = append(immediates, c.memoryIndex(ins.Immediates[1]))
+			}
+			c.emitBulkOp(ins.Op.Name, immediates)
+
+		case "table.init", "elem.drop":
+			seg := int(ins.Immediates[0].(uint32))
+			if seg >= c.NumElemSegments {
+				panic(fmt.Errorf("invalid element segment index %d", seg))
+			}
+			immediates := []int64{int64(seg)}
+			if ins.Op.Name == "table.init" {
+				immediates = append(immediates, c.tableIndex(ins.Immediates[1]))
+			}
+			c.emitBulkOp(ins.Op.Name, immediates)
+
+		case "table.copy":
+			c.emitBulkOp(ins.Op.Name, []int64{c.tableIndex(ins.Immediates[0]), c.tableIndex(ins.Immediates[1])})
+
+		case "table.fill":
+			c.emitBulkOp(ins.Op.Name, []int64{c.tableIndex(ins.Immediates[0])})
+
+		case "table.get", "table.grow":
+			retID := c.NextValueID()
+			numValues := 1
+			if ins.Op.Name == "table.grow" {
+				numValues = 2
+			}
+			c.Code = append(c.Code, buildInstr(retID, ins.Op.Name, []int64{c.tableIndex(ins.Immediates[0])}, c.PopStack(numValues)))
+			c.PushStack(retID)
+
+		case "table.set":
+			c.Code = append(c.Code, buildInstr(0, ins.Op.Name, []int64{c.tableIndex(ins.Immediates[0])}, c.PopStack(2)))
+
+		case "table.size":
+			retID := c.NextValueID()
+			c.Code = append(c.Code, buildInstr(retID, ins.Op.Name, []int64{c.tableIndex(ins.Immediates[0])}, nil))
+			c.PushStack(retID)
+
+		case "ref.null", "ref.func":
+			// References are held like i32 values: function indices, handles
+			// of host values, or NullElement.
+			ref := int64(NullElement)
+			if ins.Op.Name == "ref.func" {
+				ref = int64(ins.Immediates[0].(uint32))
+			}
+			retID := c.NextValueID()
+			c.Code = append(c.Code, buildInstr(retID, "i32.const", []int64{ref}, nil))
+			c.PushStack(retID)
+
+		case "ref.is_null":
+			nullID := c.NextValueID()
+			c.Code = append(c.Code, buildInstr(nullID, "i32.const", []int64{NullElement}, nil))
+			c.PushStack(nullID)
+			retID := c.NextValueID()
+			c.Code = append(c.Code, buildInstr(retID, "i32.eq", nil, c.PopStack(2)))
+			c.PushStack(retID)
+
+		case "memory.copy":
+			c.emitBulkOp(ins.Op.Name, []int64{c.memoryIndex(ins.Immediates[0]), c.memoryIndex(ins.Immediates[1])})
+
+		case "memory.fill":
+			c.emitBulkOp(ins.Op.Name, []int64{c.memoryIndex(ins.Immediates[0])})
+
 		default:
-			panic(ins.Op.Name)
+			if !c.compileSIMD(ins) && !c.compileAtomic(ins) {
+				panic(ins.Op.Name)
+			}
+		}
+
+		if t, ok := c.resultType(ins); ok {
+			c.valueTypes[c.Stack[len(c.Stack)-1]] = t
 		}
 	}
 
-	c.FixupLocationRef(c.Locations[0], false)
-	if len(c.Stack) != 0 {
-		c.Code = append(c.Code, buildInstr(0, "return", nil, c.PopStack(1)))
-	} else {
-		c.Code = append(c.Code, buildInstr(0, "return", nil, nil))
+	wasUnreachable := unreachableDepth != 0
+	if wasUnreachable {
+		c.Stack = c.Stack[:0]
+	}
+	c.FixupLocationRef(c.Locations[0], wasUnreachable)
+	c.emitReturn(c.PopStack(NumSlots(c.ReturnTypes)))
+}
+
+// variableSlots returns the value slots of the local or global variable
+// accessed by ins, and 1 if it is a v128 variable taking both slots, 0
+// otherwise.
+func (c *SSAFunctionCompiler) variableSlots(ins disasm.Instr) ([2]int, int) {
+	index := ins.Immediates[0].(uint32)
+	if strings.HasSuffix(ins.Op.Name, "_global") {
+		if high, ok := c.GlobalHighs[int(index)]; ok {
+			return [2]int{int(index), high}, 1
+		}
+		return [2]int{int(index)}, 0
+	}
+	slot, v128 := c.localSlot(index)
+	if v128 {
+		return [2]int{slot, slot + 1}, 1
+	}
+	return [2]int{slot}, 0
+}
+
+// tableIndex checks the table index immediate of an instruction.
+func (c *SSAFunctionCompiler) tableIndex(immediate interface{}) int64 {
+	table := immediate.(uint32)
+	if int(table) >= c.NumTables {
+		panic(fmt.Errorf("invalid table index %d", table))
+	}
+	return int64(table)
+}
+
+// memoryIndex checks the memory index immediate of an instruction.
+func (c *SSAFunctionCompiler) memoryIndex(immediate interface{}) int64 {
+	memory := immediate.(uint32)
+	if int(memory) >= len(c.MemoryTypes) {
+		panic(fmt.Errorf("invalid memory index %d", memory))
+	}
+	return int64(memory)
+}
+
+// memArg checks the immediates of the memory access ins, as read by
+// readMemArg, and returns them as the alignment, the offset and the memory
+// index. Offsets into 32-bit memories must fit in 32 bits.
+func (c *SSAFunctionCompiler) memArg(ins disasm.Instr) []int64 {
+	align, offset := ins.Immediates[0].(uint32), ins.Immediates[1].(uint64)
+	memory := c.memoryIndex(ins.Immediates[2])
+	if !c.MemoryTypes[memory].Memory64 && offset > math.MaxUint32 {
+		panic(fmt.Errorf("%s: offset %d out of range for a 32-bit memory", ins.Op.Name, offset))
+	}
+	return []int64{int64(align), int64(offset), memory}
+}
+
+// addressType returns the type of the addresses into the given memory.
+func (c *SSAFunctionCompiler) addressType(immediate interface{}) wasm.ValueType {
+	if c.MemoryTypes[c.memoryIndex(immediate)].Memory64 {
+		return wasm.ValueTypeI64
+	}
+	return wasm.ValueTypeI32
+}
+
+// operandTypes returns the types of the operands of ins, the bottommost
+// first, or nil if they are not checked.
+func (c *SSAFunctionCompiler) operandTypes(ins disasm.Instr) []wasm.ValueType {
+	switch ins.Op.Name {
+	case "i32.load", "i64.load", "i32.load8_s", "i32.load16_s", "i64.load8_s", "i64.load16_s", "i64.load32_s",
+		"i32.load8_u", "i32.load16_u", "i64.load8_u", "i64.load16_u", "i64.load32_u",
+		"f32.load", "f64.load":
+		return []wasm.ValueType{c.addressType(ins.Immediates[2])}
+	case "i32.store", "i32.store8", "i32.store16", "i64.store", "i64.store8", "i64.store16", "i64.store32", "f32.store", "f64.store":
+		// The operators package lists the stored value first.
+		return []wasm.ValueType{c.addressType(ins.Immediates[2]), ins.Op.Args[0]}
+	case "memory.grow":
+		return []wasm.ValueType{c.addressType(ins.Immediates[0])}
+	case "memory.init":
+		return []wasm.ValueType{c.addressType(ins.Immediates[1]), wasm.ValueTypeI32, wasm.ValueTypeI32}
+	case "memory.copy":
+		dst, src := c.addressType(ins.Immediates[0]), c.addressType(ins.Immediates[1])
+		n := dst
+		if src == wasm.ValueTypeI32 {
+			n = src
+		}
+		return []wasm.ValueType{dst, src, n}
+	case "memory.fill":
+		addr := c.addressType(ins.Immediates[0])
+		return []wasm.ValueType{addr, wasm.ValueTypeI32, addr}
+	}
+	if ins.Op.Polymorphic {
+		return nil
+	}
+	// The remaining operators take operands of a single type.
+	return ins.Op.Args
+}
+
+// resultType returns the type of the value pushed by ins, if it is known.
+// Only the types of constants, locals and the results of operators with a
+// fixed signature are tracked.
+func (c *SSAFunctionCompiler) resultType(ins disasm.Instr) (wasm.ValueType, bool) {
+	switch ins.Op.Name {
+	case "memory.size", "memory.grow":
+		return c.addressType(ins.Immediates[0]), true
+	case "get_local":
+		t := c.LocalTypes[ins.Immediates[0].(uint32)]
+		return t, t != ValueTypeV128
+	}
+	if ins.Op.Polymorphic {
+		return 0, false
+	}
+	switch ins.Op.Returns {
+	case wasm.ValueTypeI32, wasm.ValueTypeI64, wasm.ValueTypeF32, wasm.ValueTypeF64, ValueTypeFuncRef:
+		return ins.Op.Returns, true
+	}
+	return 0, false
+}
+
+// checkOperands checks the types of the operands of ins on top of the stack,
+// as far as they are known.
+func (c *SSAFunctionCompiler) checkOperands(ins disasm.Instr) {
+	types := c.operandTypes(ins)
+	if len(types) > len(c.Stack) {
+		return
+	}
+	values := c.Stack[len(c.Stack)-len(types):]
+	for i, t := range types {
+		if actual, ok := c.valueTypes[values[i]]; ok && actual != t {
+			panic(fmt.Errorf("%s: type mismatch: operand %d is %s, expected %s", ins.Op.Name, i, actual, t))
+		}
+	}
+}
+
+// emitBulkOp emits a bulk memory or table instruction. Those taking operands
+// take the destination, the source or value, and the length.
+func (c *SSAFunctionCompiler) emitBulkOp(op string, immediates []int64) {
+	var values []TyValueID
+	if op != "data.drop" && op != "elem.drop" {
+		values = c.PopStack(3)
+	}
+	c.Code = append(c.Code, buildInstr(0, op, immediates, values))
+}
+
+// emitTailCall emits a tail call to a function of signature sig, the
+// results of which are returned by the current function and must thus be of
+// the same types.
+func (c *SSAFunctionCompiler) emitTailCall(op string, sig *wasm.FunctionSig, immediates []int64, values []TyValueID) {
+	if !sameValueTypes(sig.ReturnTypes, c.ReturnTypes) {
+		panic(fmt.Errorf("%s: type mismatch between the results of the callee and the caller", op))
+	}
+	c.Code = append(c.Code, buildInstr(0, op, immediates, values))
+}
+
+// pushCallResults pushes the results of a call, the first value slot of
+// which is held by the call instruction itself and the others are passed like
+// branch values.
+func (c *SSAFunctionCompiler) pushCallResults(targetValueID TyValueID, types []wasm.ValueType) {
+	if targetValueID == 0 {
+		return
+	}
+	c.PushStack(targetValueID)
+	for i, high := range highSlots(types) {
+		if i == 0 {
+			continue
+		}
+		retID := c.NextValueID()
+		c.Code = append(c.Code, buildInstr(retID, "phi", []int64{int64(i)}, nil))
+		c.pushSlot(retID, high)
 	}
 }
 
@@ -0,0 +1,55 @@
+package compiler_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/perlin-network/life/compiler"
+	. "github.com/perlin-network/life/internal/wasmtest"
+)
+
+func TestOperandTypeMismatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  []byte
+		valid bool
+	}{
+		{"i32.extend8_s of an i32", Cat(LocalGet(0), []byte{0xc0, 0x1a}), true},
+		{"i64.extend32_s of an i64", Cat(LocalGet(1), []byte{0xc4, 0x1a}), true},
+		{"i32.extend8_s of an i64", Cat(I64Const(0), []byte{0xc0, 0x1a}), false},
+		{"i64.extend32_s of an i32", Cat(LocalGet(0), []byte{0xc4, 0x1a}), false},
+		{"i32.add of a result of i64.extend8_s", Cat(LocalGet(0), LocalGet(1), []byte{0xc2, 0x6a, 0x1a}), false},
+		{"i32.trunc_sat_f32_s of an f64", Cat([]byte{0x44}, make([]byte, 8), []byte{0xfc, 0x00, 0x1a}), false},
+
+		// Memory 0 is a 32-bit memory, memory 1 a 64-bit one.
+		{"i32.load from a 32-bit memory", Cat(I32Const(0), []byte{0x28, 0x02, 0x00, 0x1a}), true},
+		{"i32.load from a 64-bit memory", Cat(I64Const(0), []byte{0x28, 0x42, 0x01, 0x00, 0x1a}), true},
+		{"i32.load of an i64 address", Cat(I64Const(0), []byte{0x28, 0x02, 0x00, 0x1a}), false},
+		{"i32.load of an i32 address", Cat(I32Const(0), []byte{0x28, 0x42, 0x01, 0x00, 0x1a}), false},
+		{"i64.store to a 64-bit memory", Cat(I64Const(0), I64Const(0), []byte{0x37, 0x43, 0x01, 0x00}), true},
+		{"i64.store of an i32", Cat(I64Const(0), I32Const(0), []byte{0x37, 0x43, 0x01, 0x00}), false},
+		{"memory.size of a 64-bit memory", []byte{0x3f, 0x01, 0x50, 0x1a}, true},            // i64.eqz
+		{"memory.size of a 64-bit memory as an i32", []byte{0x3f, 0x01, 0x45, 0x1a}, false}, // i32.eqz
+		{"memory.fill of a 64-bit memory", Cat(I64Const(0), I32Const(0), I64Const(0), []byte{0xfc, 0x0b, 0x01}), true},
+		{"memory.copy between memories", Cat(I32Const(0), I64Const(0), I32Const(0), []byte{0xfc, 0x0a, 0x00, 0x01}), true},
+		{"memory.copy of an i64 length", Cat(I32Const(0), I64Const(0), I64Const(0), []byte{0xfc, 0x0a, 0x00, 0x01}), false},
+	}
+
+	for _, test := range tests {
+		m := &Module{
+			Types:    [][]byte{FuncType([]byte{I32, I64}, nil)},
+			Funcs:    []Func{{Type: 0, Body: test.body}},
+			Memories: [][]byte{Limits(1, -1), Cat([]byte{4}, U(1))},
+		}
+		mod, err := compiler.LoadModule(m.Bytes())
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		_, err = mod.CompileForInterpreter(nil)
+		if test.valid && err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if !test.valid && (err == nil || !strings.Contains(err.Error(), "type mismatch")) {
+			t.Errorf("%s: expected a type mismatch, got %v", test.name, err)
+		}
+	}
+}
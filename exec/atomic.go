@@ -0,0 +1,218 @@
+package exec
+
+import (
+	"time"
+
+	"github.com/perlin-network/life/compiler"
+	"github.com/perlin-network/life/compiler/opcodes"
+)
+
+// atomicOps are the atomic instructions, indexed by their sub-opcode.
+var atomicOps [256]*compiler.AtomicOp
+
+func init() {
+	for code, op := range compiler.AtomicOps {
+		op := op
+		atomicOps[code] = &op
+	}
+}
+
+// execAtomic executes the atomic instruction at frame.IP, which follows the
+// Atomic opcode, storing its result if any in the register valueID.
+//
+// The atomic accesses to a shared memory are serialized by the lock of the
+// memory, which makes them atomic with respect to each other, and refresh the
+// views of the virtual machine. atomic.fence synchronizes with the first
+// memory.
+func (vm *VirtualMachine) execAtomic(frame *Frame, valueID int) {
+	code := opcodes.AtomicOpcode(frame.Code[frame.IP])
+	op := atomicOps[code]
+	if op == nil {
+		panic("unknown instruction")
+	}
+	frame.IP++
+
+	var memory uint32
+	var offset uint64
+	if op.Kind != compiler.AtomicFence {
+		memory = LE.Uint32(frame.Code[frame.IP : frame.IP+4])
+		offset = LE.Uint64(frame.Code[frame.IP+4 : frame.IP+12])
+		frame.IP += 12
+	}
+
+	var values [3]int64
+	for i := 0; i < op.NumValues(); i++ {
+		values[i] = frame.Regs[int(LE.Uint32(frame.Code[frame.IP:frame.IP+4]))]
+		frame.IP += 4
+	}
+
+	if op.Kind == compiler.AtomicWait {
+		frame.Regs[valueID] = vm.atomicWait(op, memory, values[0], offset, values[1], values[2])
+		return
+	}
+
+	mem := vm.memory
+	if op.Kind != compiler.AtomicFence {
+		mem = vm.memories[memory]
+	}
+	if mem.Shared {
+		mem.mu.Lock()
+		defer mem.mu.Unlock()
+		vm.refreshView(memory)
+	}
+
+	if op.Kind == compiler.AtomicFence {
+		return
+	}
+
+	view, addr := vm.atomicAddress(op, memory, values[0], offset)
+	m := view[addr : addr+op.Size]
+	old := loadAtomic(m)
+
+	switch op.Kind {
+	case compiler.AtomicLoad:
+		frame.Regs[valueID] = int64(old)
+	case compiler.AtomicStore:
+		storeAtomic(m, uint64(values[1]))
+	case compiler.AtomicRmw:
+		operand := uint64(values[1])
+		var v uint64
+		switch (code - opcodes.I32AtomicRmwAdd) / 7 {
+		case 0:
+			v = old + operand
+		case 1:
+			v = old - operand
+		case 2:
+			v = old & operand
+		case 3:
+			v = old | operand
+		case 4:
+			v = old ^ operand
+		default: // xchg
+			v = operand
+		}
+		storeAtomic(m, v)
+		frame.Regs[valueID] = int64(old)
+	case compiler.AtomicCmpxchg:
+		mask := ^uint64(0) >> uint(64-8*op.Size)
+		if old == uint64(values[1])&mask {
+			storeAtomic(m, uint64(values[2]))
+		}
+		frame.Regs[valueID] = int64(old)
+	case compiler.AtomicNotify:
+		n := 0
+		if mem.Shared {
+			n = mem.notify(uint64(addr), uint32(values[1]))
+		}
+		frame.Regs[valueID] = int64(n)
+	}
+}
+
+// refreshView refreshes the view of the shared memory of index i, which is
+// locked.
+func (vm *VirtualMachine) refreshView(i uint32) {
+	if i == 0 {
+		vm.Memory = vm.memory.Bytes
+		vm.memoryView = vm.Memory
+	} else {
+		vm.memoryViews[i] = vm.memories[i].Bytes
+	}
+}
+
+// atomicAddress returns the view of the memory of index i and the effective
+// address of the atomic access op to base+offset, trapping if the access is
+// out of bounds or unaligned.
+func (vm *VirtualMachine) atomicAddress(op *compiler.AtomicOp, i uint32, base int64, offset uint64) ([]byte, int) {
+	view, effective := vm.effectiveAddress(i, base, offset, op.Size)
+	if effective%op.Size != 0 {
+		panic(&Trap{Kind: TrapUnalignedAtomic})
+	}
+	return view, effective
+}
+
+// atomicWait executes memory.atomic.wait32 or memory.atomic.wait64, which
+// return 1 if the value at base+offset is not expected, and otherwise suspend
+// the virtual machine until it is woken up by memory.atomic.notify, returning
+// 0, or the timeout expires, returning 2. Timeouts are in nanoseconds, and
+// negative ones never expire. Waiting traps on unshared memories, and may be
+// interrupted through the context passed to RunContext.
+func (vm *VirtualMachine) atomicWait(op *compiler.AtomicOp, memory uint32, base int64, offset uint64, expected, timeout int64) int64 {
+	mem := vm.memories[memory]
+	var addr int
+
+	w := func() *waiter {
+		if mem.Shared {
+			mem.mu.Lock()
+			defer mem.mu.Unlock()
+			vm.refreshView(memory)
+		}
+
+		view, effective := vm.atomicAddress(op, memory, base, offset)
+		if !mem.Shared {
+			panic(&Trap{Kind: TrapExpectedSharedMemory})
+		}
+		addr = effective
+
+		mask := ^uint64(0) >> uint(64-8*op.Size)
+		if loadAtomic(view[addr:addr+op.Size]) != uint64(expected)&mask {
+			return nil
+		}
+		return mem.addWaiter(uint64(addr))
+	}()
+	if w == nil {
+		return 1
+	}
+
+	var expired <-chan time.Time
+	if timeout >= 0 {
+		timer := time.NewTimer(time.Duration(timeout))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	var done <-chan struct{}
+	if vm.ctx != nil {
+		done = vm.ctx.Done()
+	}
+
+	select {
+	case <-w.woken:
+		return 0
+	case <-expired:
+		if mem.removeWaiter(uint64(addr), w) {
+			return 2
+		}
+	case <-done:
+		if mem.removeWaiter(uint64(addr), w) {
+			panic(&Trap{Kind: TrapInterrupted, Err: vm.ctx.Err()})
+		}
+	}
+	return 0 // woken up in the meantime
+}
+
+// loadAtomic reads the little-endian value of 1, 2, 4 or 8 bytes held by m.
+func loadAtomic(m []byte) uint64 {
+	switch len(m) {
+	case 1:
+		return uint64(m[0])
+	case 2:
+		return uint64(LE.Uint16(m))
+	case 4:
+		return uint64(LE.Uint32(m))
+	}
+	return LE.Uint64(m)
+}
+
+// storeAtomic writes v to m, truncating it to the 1, 2, 4 or 8 bytes of m.
+func storeAtomic(m []byte, v uint64) {
+	switch len(m) {
+	case 1:
+		m[0] = byte(v)
+	case 2:
+		LE.PutUint16(m, uint16(v))
+	case 4:
+		LE.PutUint32(m, uint32(v))
+	default:
+		LE.PutUint64(m, v)
+	}
+}
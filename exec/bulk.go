@@ -0,0 +1,174 @@
+package exec
+
+import (
+	"strings"
+
+	"github.com/perlin-network/life/compiler"
+)
+
+// newDroppedSegments returns the initial dropped state of the data and
+// element segments of m. Only passive segments may be used after
+// instantiation.
+func newDroppedSegments(m *compiler.Module) ([]bool, []bool) {
+	droppedData := make([]bool, len(m.DataSegments))
+	for i, seg := range m.DataSegments {
+		droppedData[i] = !seg.Passive
+	}
+
+	droppedElems := make([]bool, len(m.ElemSegments))
+	for i, seg := range m.ElemSegments {
+		droppedElems[i] = !seg.Passive
+	}
+	return droppedData, droppedElems
+}
+
+// inBounds tells whether the range [start, start+n) fits in a region of
+// `size` units.
+func inBounds(start, n uint32, size int) bool {
+	return uint64(start)+uint64(n) <= uint64(size)
+}
+
+// inBounds64 is like inBounds for the 64-bit ranges of memories.
+func inBounds64(start, n uint64, size int) bool {
+	return start+n >= start && start+n <= uint64(size)
+}
+
+// memoryInit copies n bytes at offset s of the data segment seg to the
+// address d of the memory `memory`.
+func (vm *VirtualMachine) memoryInit(seg int, memory uint32, d uint64, s, n uint32) {
+	var data []byte
+	if !vm.droppedData[seg] {
+		data = vm.Module.DataSegments[seg].Data
+	}
+	mem := vm.memoryAt(memory)
+	if !inBounds(s, n, len(data)) || !inBounds64(d, uint64(n), len(mem)) {
+		panic(&Trap{Kind: TrapMemoryOutOfBounds})
+	}
+	copy(mem[d:], data[s:s+n])
+}
+
+// memoryCopy copies n bytes from the address s of the memory `src` to the
+// address d of the memory `dst`. The regions may overlap.
+func (vm *VirtualMachine) memoryCopy(dst, src uint32, d, s, n uint64) {
+	dstMem, srcMem := vm.memoryAt(dst), vm.memoryAt(src)
+	if !inBounds64(s, n, len(srcMem)) || !inBounds64(d, n, len(dstMem)) {
+		panic(&Trap{Kind: TrapMemoryOutOfBounds})
+	}
+	copy(dstMem[d:], srcMem[s:s+n])
+}
+
+// memoryFill sets n bytes at the address d of the memory `memory` to val.
+func (vm *VirtualMachine) memoryFill(memory uint32, d uint64, val byte, n uint64) {
+	mem := vm.memoryAt(memory)
+	if !inBounds64(d, n, len(mem)) {
+		panic(&Trap{Kind: TrapMemoryOutOfBounds})
+	}
+	region := mem[d : d+n]
+	for i := range region {
+		region[i] = val
+	}
+}
+
+// tableInit copies n elements at offset s of the element segment seg to the
+// slot d of the table `table`.
+func (vm *VirtualMachine) tableInit(seg, table int, d, s, n uint32) {
+	t := vm.TableAt(table)
+
+	var elems []uint32
+	if !vm.droppedElems[seg] {
+		elems = vm.Module.ElemSegments[seg].Elems
+	}
+	if !inBounds(s, n, len(elems)) || !inBounds(d, n, t.Size()) {
+		panic(&Trap{Kind: TrapTableOutOfBounds})
+	}
+
+	for i := uint32(0); i < n; i++ {
+		vm.setRef(t, int(d+i), int64(elems[s+i]))
+	}
+}
+
+// tableCopy copies n elements from the slot s of the table src to the slot d
+// of the table dst. The regions may overlap.
+func (vm *VirtualMachine) tableCopy(dst, src int, d, s, n uint32) {
+	dt, st := vm.TableAt(dst), vm.TableAt(src)
+	if !inBounds(s, n, st.Size()) || !inBounds(d, n, dt.Size()) {
+		panic(&Trap{Kind: TrapTableOutOfBounds})
+	}
+
+	refs := make([]int64, n)
+	for i := range refs {
+		refs[i] = vm.refAt(st, int(s)+i)
+	}
+	for i, ref := range refs {
+		vm.setRef(dt, int(d)+i, ref)
+	}
+}
+
+// generateSegmentsNEnv generates the data and element segments of m and the
+// functions of the bulk memory and table instructions for AOT-compiled code.
+// It must follow the definition of the tables.
+func generateSegmentsNEnv(builder *strings.Builder, m *compiler.Module, droppedData, droppedElems []bool) {
+	bSprintf(builder, "struct DataSegment { const uint8_t *data; uint64_t len; };\n")
+	for i, seg := range m.DataSegments {
+		if droppedData[i] || len(seg.Data) == 0 {
+			continue
+		}
+		bSprintf(builder, "static const uint8_t data_segment_%d[] = {", i)
+		for _, b := range seg.Data {
+			bSprintf(builder, "%d,", b)
+		}
+		bSprintf(builder, "};\n")
+	}
+	bSprintf(builder, "static struct DataSegment data_segments[] = {\n")
+	for i, seg := range m.DataSegments {
+		if droppedData[i] || len(seg.Data) == 0 {
+			bSprintf(builder, "{ .data = 0, .len = 0 },\n")
+		} else {
+			bSprintf(builder, "{ .data = data_segment_%d, .len = %d },\n", i, len(seg.Data))
+		}
+	}
+	bSprintf(builder, "{ .data = 0, .len = 0 },\n") // avoids empty arrays
+	bSprintf(builder, "};\n")
+
+	bSprintf(builder, "struct ElemSegment { const uint32_t *elems; uint64_t len; };\n")
+	for i, seg := range m.ElemSegments {
+		if droppedElems[i] || len(seg.Elems) == 0 {
+			continue
+		}
+		bSprintf(builder, "static const uint32_t elem_segment_%d[] = {", i)
+		for _, elem := range seg.Elems {
+			bSprintf(builder, "%du,", elem)
+		}
+		bSprintf(builder, "};\n")
+	}
+	bSprintf(builder, "static struct ElemSegment elem_segments[] = {\n")
+	for i, seg := range m.ElemSegments {
+		if droppedElems[i] || len(seg.Elems) == 0 {
+			bSprintf(builder, "{ .elems = 0, .len = 0 },\n")
+		} else {
+			bSprintf(builder, "{ .elems = elem_segment_%d, .len = %d },\n", i, len(seg.Elems))
+		}
+	}
+	bSprintf(builder, "{ .elems = 0, .len = 0 },\n")
+	bSprintf(builder, "};\n")
+
+	bSprintf(builder, "static void __attribute__((always_inline)) %smemory_init(struct VirtualMachine *vm, uint64_t seg, uint32_t memory, uint64_t d, uint32_t s, uint32_t n) {\n", compiler.NGEN_ENV_API_PREFIX)
+	bSprintf(builder, "if((uint64_t) s + n > data_segments[seg].len || !mem_in_bounds(vm, memory, d, n)) { vm->throw_s(vm, \"%s\"); }\n", "memory access out of bounds")
+	bSprintf(builder, "if(n != 0) { __builtin_memcpy(&memory_data(vm, memory)[d], &data_segments[seg].data[s], n); }\n")
+	bSprintf(builder, "}\n")
+	bSprintf(builder, "static void __attribute__((always_inline)) %sdata_drop(uint64_t seg) {\n", compiler.NGEN_ENV_API_PREFIX)
+	bSprintf(builder, "data_segments[seg].len = 0;\n")
+	bSprintf(builder, "}\n")
+
+	bSprintf(builder, "static void __attribute__((always_inline)) %stable_init(struct VirtualMachine *vm, uint64_t seg, uint64_t table, uint32_t d, uint32_t s, uint32_t n) {\n", compiler.NGEN_ENV_API_PREFIX)
+	bSprintf(builder, "if((uint64_t) s + n > elem_segments[seg].len || (uint64_t) d + n > tables[table].size) { vm->throw_s(vm, \"%s\"); }\n", "table access out of bounds")
+	bSprintf(builder, "if(n != 0) { __builtin_memcpy(&tables[table].elems[d], &elem_segments[seg].elems[s], n * sizeof(uint32_t)); }\n")
+	bSprintf(builder, "}\n")
+	bSprintf(builder, "static void __attribute__((always_inline)) %selem_drop(uint64_t seg) {\n", compiler.NGEN_ENV_API_PREFIX)
+	bSprintf(builder, "elem_segments[seg].len = 0;\n")
+	bSprintf(builder, "}\n")
+	bSprintf(builder, "static void __attribute__((always_inline)) %stable_copy(struct VirtualMachine *vm, uint64_t dst, uint64_t src, uint32_t d, uint32_t s, uint32_t n) {\n", compiler.NGEN_ENV_API_PREFIX)
+	bSprintf(builder, "if((uint64_t) s + n > tables[src].size || (uint64_t) d + n > tables[dst].size) { vm->throw_s(vm, \"%s\"); }\n", "table access out of bounds")
+	bSprintf(builder, "if(n != 0) { __builtin_memmove(&tables[dst].elems[d], &tables[src].elems[s], n * sizeof(uint32_t)); }\n")
+	bSprintf(builder, "}\n")
+}
@@ -0,0 +1,96 @@
+package exec_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/perlin-network/life/exec"
+	. "github.com/perlin-network/life/internal/wasmtest"
+)
+
+// loopModule exports loop(), which never returns, and sum(n) as in
+// sumModule.
+func loopModule() []byte {
+	m := &Module{
+		Types: [][]byte{FuncType(nil, nil), FuncType([]byte{I32}, []byte{I32})},
+		Funcs: []Func{
+			{Type: 0, Body: []byte{0x03, 0x40, 0x0c, 0x00, 0x0b}}, // loop, br 0, end
+			{Type: 1, Locals: Locals(1, I32), Body: Cat(
+				[]byte{0x02, 0x40, 0x03, 0x40},
+				LocalGet(0), []byte{0x45, 0x0d, 0x01},
+				LocalGet(1), LocalGet(0), []byte{0x6a}, LocalSet(1),
+				LocalGet(0), I32Const(1), []byte{0x6b}, LocalSet(0),
+				[]byte{0x0c, 0x00, 0x0b, 0x0b},
+				LocalGet(1),
+			)},
+		},
+		Exports: [][]byte{Export("loop", KindFunc, 0), Export("sum", KindFunc, 1)},
+	}
+	return m.Bytes()
+}
+
+func TestRunContextDeadline(t *testing.T) {
+	vm, err := exec.NewVirtualMachine(loopModule(), exec.VMConfig{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loop, _ := vm.GetFunctionExport("loop")
+	sum, _ := vm.GetFunctionExport("sum")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err = vm.RunContext(ctx, loop)
+	if trap, ok := err.(*exec.Trap); !ok || trap.Kind != exec.TrapInterrupted {
+		t.Fatalf("expected an interruption, got %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("interruption does not wrap the error of the context: %v", err)
+	}
+
+	// The VM may be run again once interrupted.
+	ret, err := vm.RunContext(context.Background(), sum, 100)
+	if err != nil || ret != 5050 {
+		t.Fatalf("got %d, %v", ret, err)
+	}
+}
+
+func TestRunContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	imports := exec.NewImports()
+	imports.Module("env").HostFunc("cancel", func(vm *exec.VirtualMachine) {
+		if vm.Context() != ctx {
+			t.Error("function import does not see the context of the execution")
+		}
+		cancel()
+	})
+
+	m := &Module{
+		Types:   [][]byte{FuncType(nil, nil)},
+		Imports: []Import{ImportFunc("env", "cancel", 0)},
+		Funcs: []Func{{Type: 0, Body: Cat(
+			Call(0), []byte{0x03, 0x40, 0x0c, 0x00, 0x0b}, // cancel, then loop forever
+		)}},
+		Exports: [][]byte{Export("run", KindFunc, 1)},
+	}
+	vm, err := exec.NewVirtualMachine(m.Bytes(), exec.VMConfig{}, imports, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, _ := vm.GetFunctionExport("run")
+
+	if _, err := vm.RunContext(ctx, entry); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a cancellation, got %v", err)
+	}
+
+	// Done contexts are rejected before running anything.
+	if _, err := vm.RunContext(ctx, entry); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a cancellation, got %v", err)
+	}
+	if vm.Context() != context.Background() {
+		t.Fatal("context kept after the execution")
+	}
+}
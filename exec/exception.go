@@ -0,0 +1,150 @@
+package exec
+
+import (
+	"fmt"
+
+	"github.com/go-interpreter/wagon/wasm"
+	"github.com/perlin-network/life/compiler"
+)
+
+// Tag identifies a kind of exceptions, as introduced by the exception
+// handling proposal. Each instance of a module gets its own tags for those it
+// declares, while imported tags may be shared between modules and with the
+// host. Catch clauses only catch the exceptions thrown with their own tag.
+type Tag struct {
+	Params []wasm.ValueType // types of the payload of the exceptions
+}
+
+// NewTag creates a tag for exceptions whose payload has the given types.
+func NewTag(params ...wasm.ValueType) *Tag {
+	return &Tag{Params: params}
+}
+
+// Exception is a WebAssembly exception. Payload holds the value slots of
+// its arguments, as passed to Run, v128 values taking two slots and
+// references being handles of the virtual machine which threw it.
+//
+// Exceptions which are not caught are returned by Run as a Trap of kind
+// TrapUncaughtException wrapping the exception.
+type Exception struct {
+	Tag     *Tag
+	Payload []int64
+}
+
+func (e *Exception) Error() string {
+	return fmt.Sprintf("exception with payload %v", e.Payload)
+}
+
+// Throw throws an exception of the given tag into the guest. It may only be
+// called from within a function import and does not return; the exception
+// is raised at the call to the function import. Function imports may also
+// throw an exception by returning it as their error.
+func (vm *VirtualMachine) Throw(tag *Tag, payload ...int64) {
+	if len(payload) != compiler.NumSlots(tag.Params) {
+		panic(fmt.Errorf("exception payload has %d values, tag expects %d", len(payload), compiler.NumSlots(tag.Params)))
+	}
+	panic(&Exception{Tag: tag, Payload: payload})
+}
+
+// GetTagExport returns the tag exported with the given name.
+func (vm *VirtualMachine) GetTagExport(key string) (*Tag, bool) {
+	index, ok := vm.getExport(key, compiler.ExternalTag)
+	if !ok {
+		return nil, false
+	}
+	return vm.tags[index], true
+}
+
+// newTags returns the tags of a new instance of m: the imported ones, or new
+// tags for those not imported from a TagResolver, followed by new tags for
+// the declared ones.
+func newTags(m *compiler.Module, imported []*Tag) []*Tag {
+	tags := make([]*Tag, len(m.Tags))
+	for i := range tags {
+		if i < len(imported) && imported[i] != nil {
+			tags[i] = imported[i]
+		} else {
+			tags[i] = NewTag(m.TagParams(i)...)
+		}
+	}
+	return tags
+}
+
+// throw unwinds the call stack to the innermost catch clause catching exc,
+// `ip` being the offset of the throwing instruction in the current frame,
+// and returns the frame of the clause, whose catch instruction receives the
+// exception. Uncaught exceptions trap, leaving the call stack as is.
+func (vm *VirtualMachine) throw(exc *Exception, ip int) *Frame {
+	for i := vm.CurrentFrame; i >= 0; i-- {
+		frame := &vm.CallStack[i]
+
+		// Callers are within their call instruction.
+		frameIP := frame.IP - 1
+		if i == vm.CurrentFrame {
+			frameIP = ip
+		}
+
+		target, ok := vm.findCatch(vm.FunctionCode[frame.FunctionID].Handlers, frameIP, exc.Tag)
+		if !ok {
+			continue
+		}
+
+		for ; vm.CurrentFrame > i; vm.CurrentFrame-- {
+			vm.CallStack[vm.CurrentFrame].Destroy(vm)
+		}
+		frame.IP = target
+		vm.exception = exc
+		return frame
+	}
+
+	panic(&Trap{Kind: TrapUncaughtException, Err: exc})
+}
+
+// findCatch returns the offset of the catch clause catching the exceptions
+// of the given tag thrown at offset `ip` of a function with the given
+// handlers, if any.
+func (vm *VirtualMachine) findCatch(handlers []compiler.ExceptionHandler, ip int, tag *Tag) (int, bool) {
+	h := len(handlers) - 1
+	for ; h >= 0; h-- {
+		if handlers[h].Start <= ip && ip < handlers[h].End {
+			break
+		}
+	}
+
+	for ; h >= 0; h = handlers[h].Parent {
+		for _, clause := range handlers[h].Catches {
+			if clause.Tag < 0 || vm.tags[clause.Tag] == tag {
+				return clause.Target, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// catch stores the exception being delivered to the catch clause of the
+// handler h of frame, for rethrow, and returns it.
+func (vm *VirtualMachine) catch(frame *Frame, h int) *Exception {
+	exc := vm.exception
+	vm.exception = nil
+
+	if frame.Caught == nil {
+		frame.Caught = make([]*Exception, len(vm.FunctionCode[frame.FunctionID].Handlers))
+	}
+	frame.Caught[h] = exc
+	return exc
+}
+
+// invokeCatching calls the function `functionID` of the virtual machine
+// `target` like invoke, returning the exception it throws if any.
+func (vm *VirtualMachine) invokeCatching(target *VirtualMachine, functionID int, args []int64) (ret int64, exc *Exception) {
+	defer func() {
+		if err := recover(); err != nil {
+			var ok bool
+			if exc, ok = err.(*Exception); !ok {
+				panic(err)
+			}
+		}
+	}()
+
+	return target.invoke(vm, functionID, args), nil
+}
@@ -0,0 +1,76 @@
+package exec_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/perlin-network/life/exec"
+	. "github.com/perlin-network/life/internal/wasmtest"
+)
+
+// exitModule exports run(code), which calls the imported env.exit(code)
+// from a nested function and traps if it returns.
+func exitModule() []byte {
+	m := &Module{
+		Types:   [][]byte{FuncType([]byte{I32}, nil)},
+		Imports: []Import{ImportFunc("env", "exit", 0)},
+		Funcs: []Func{
+			{Type: 0, Body: Cat(LocalGet(0), Call(2), []byte{0x00})}, // unreachable
+			{Type: 0, Body: Cat(LocalGet(0), Call(0))},
+		},
+		Exports: [][]byte{Export("run", KindFunc, 1)},
+	}
+	return m.Bytes()
+}
+
+func TestExit(t *testing.T) {
+	imports := exec.NewImports()
+	imports.Module("env").HostFunc("exit", func(vm *exec.VirtualMachine, code uint32) {
+		vm.Exit(code)
+	})
+
+	// An exited virtual machine cannot be run again.
+	run := func(withGasLimit bool, code int64) error {
+		vm, err := exec.NewVirtualMachine(exitModule(), exec.VMConfig{}, imports, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry, _ := vm.GetFunctionExport("run")
+		if withGasLimit {
+			_, err = vm.RunWithGasLimit(entry, 10, code)
+		} else {
+			_, err = vm.Run(entry, code)
+		}
+		return err
+	}
+
+	var exitErr *exec.ExitError
+	if err := run(false, 7); !errors.As(err, &exitErr) || exitErr.Code != 7 {
+		t.Fatalf("expected exit code 7, got %v", err)
+	}
+	if err := run(true, 0); !errors.As(err, &exitErr) || exitErr.Code != 0 {
+		t.Fatalf("expected exit code 0, got %v", err)
+	}
+}
+
+func TestHostFunctionPanicIsNotExit(t *testing.T) {
+	imports := exec.NewImports()
+	imports.Module("env").HostFunc("exit", func(code uint32) {
+		panic("not an exit")
+	})
+
+	vm, err := exec.NewVirtualMachine(exitModule(), exec.VMConfig{}, imports, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, _ := vm.GetFunctionExport("run")
+
+	_, err = vm.Run(entry, 7)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		t.Fatalf("panic reported as %v", err)
+	}
+	if trap, ok := err.(*exec.Trap); !ok || trap.Kind != exec.TrapHostFunction {
+		t.Fatalf("expected a host function trap, got %v", err)
+	}
+}
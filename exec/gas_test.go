@@ -0,0 +1,31 @@
+package exec_test
+
+import (
+	"testing"
+
+	"github.com/perlin-network/life/compiler"
+	"github.com/perlin-network/life/exec"
+)
+
+func TestGasIndependentOfOptimizations(t *testing.T) {
+	var gas []uint64
+	for _, opts := range []compiler.Optimizations{{}, compiler.AllOptimizations} {
+		vm, err := exec.NewVirtualMachine(sumModule(), exec.VMConfig{Optimizations: opts}, nil, &compiler.SimpleGasPolicy{GasPerInstruction: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry, _ := vm.GetFunctionExport("sum")
+
+		ret, err := vm.Run(entry, 100000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int32(ret) != 705082704 {
+			t.Fatalf("%+v: got %d", opts, int32(ret))
+		}
+		gas = append(gas, vm.Gas)
+	}
+	if gas[0] != gas[1] {
+		t.Fatalf("%d gas used without optimizations, %d with", gas[0], gas[1])
+	}
+}
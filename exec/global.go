@@ -0,0 +1,160 @@
+package exec
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/go-interpreter/wagon/wasm"
+)
+
+// ErrImmutableGlobal is returned when writing a global which is not mutable.
+var ErrImmutableGlobal = errors.New("global is immutable")
+
+// Global is a global variable which may be imported and exported by virtual
+// machines, and so be shared between them and the host. Writes to a mutable
+// global are seen by every virtual machine importing or exporting it.
+//
+// The raw value of a global is represented as in interpreter registers: i32
+// values are zero-extended and floating point values are stored as their bits.
+// Globals are not shared with AOT-compiled code, which embeds their values at
+// compile time.
+type Global struct {
+	Type    wasm.ValueType
+	Mutable bool
+
+	value int64
+	owner *VirtualMachine // instance holding the value in its Globals, if any
+	index int
+}
+
+// NewGlobal creates a global of type t holding the raw value `value`.
+func NewGlobal(t wasm.ValueType, mutable bool, value int64) *Global {
+	return &Global{
+		Type:    t,
+		Mutable: mutable,
+		value:   value,
+	}
+}
+
+func (g *Global) ref() *int64 {
+	if g.owner != nil {
+		return &g.owner.Globals[g.index]
+	}
+	return &g.value
+}
+
+// Get returns the raw value of the global.
+func (g *Global) Get() int64 {
+	return *g.ref()
+}
+
+// Set sets the raw value of the global.
+func (g *Global) Set(value int64) error {
+	if !g.Mutable {
+		return ErrImmutableGlobal
+	}
+	*g.ref() = value
+	return nil
+}
+
+// GetI32 returns the value of an i32 global. Panics if the global has
+// another type.
+func (g *Global) GetI32() int32 {
+	g.expect(wasm.ValueTypeI32)
+	return int32(g.Get())
+}
+
+// GetI64 returns the value of an i64 global. Panics if the global has
+// another type.
+func (g *Global) GetI64() int64 {
+	g.expect(wasm.ValueTypeI64)
+	return g.Get()
+}
+
+// GetF32 returns the value of an f32 global. Panics if the global has
+// another type.
+func (g *Global) GetF32() float32 {
+	g.expect(wasm.ValueTypeF32)
+	return math.Float32frombits(uint32(g.Get()))
+}
+
+// GetF64 returns the value of an f64 global. Panics if the global has
+// another type.
+func (g *Global) GetF64() float64 {
+	g.expect(wasm.ValueTypeF64)
+	return math.Float64frombits(uint64(g.Get()))
+}
+
+// SetI32 sets the value of an i32 global. Panics if the global has another
+// type.
+func (g *Global) SetI32(v int32) error {
+	g.expect(wasm.ValueTypeI32)
+	return g.Set(int64(uint32(v)))
+}
+
+// SetI64 sets the value of an i64 global. Panics if the global has another
+// type.
+func (g *Global) SetI64(v int64) error {
+	g.expect(wasm.ValueTypeI64)
+	return g.Set(v)
+}
+
+// SetF32 sets the value of an f32 global. Panics if the global has another
+// type.
+func (g *Global) SetF32(v float32) error {
+	g.expect(wasm.ValueTypeF32)
+	return g.Set(int64(math.Float32bits(v)))
+}
+
+// SetF64 sets the value of an f64 global. Panics if the global has another
+// type.
+func (g *Global) SetF64(v float64) error {
+	g.expect(wasm.ValueTypeF64)
+	return g.Set(int64(math.Float64bits(v)))
+}
+
+func (g *Global) expect(t wasm.ValueType) {
+	if g.Type != t {
+		panic(fmt.Errorf("global is %s, not %s", g.Type, t))
+	}
+}
+
+func (g *Global) globalType() wasm.GlobalVar {
+	return wasm.GlobalVar{Type: g.Type, Mutable: g.Mutable}
+}
+
+// importedGlobal returns the Global object of the imported mutable global
+// `globalID`, or nil if the value of the global is held by vm.Globals.
+func (vm *VirtualMachine) importedGlobal(globalID int) *Global {
+	if globalID < len(vm.importedGlobals) {
+		return vm.importedGlobals[globalID]
+	}
+	return nil
+}
+
+// GlobalVar returns the global `globalID` of the virtual machine. The values
+// of imported mutable globals are held by their Global objects rather than by
+// vm.Globals, and must be accessed through GlobalVar.
+func (vm *VirtualMachine) GlobalVar(globalID int) *Global {
+	if g := vm.importedGlobal(globalID); g != nil {
+		return g
+	}
+
+	t := globalType(vm.Module.Base, globalID)
+	return &Global{
+		Type:    t.Type,
+		Mutable: t.Mutable,
+		owner:   vm,
+		index:   globalID,
+	}
+}
+
+// GetGlobalVarExport returns the global exported with the given name.
+func (vm *VirtualMachine) GetGlobalVarExport(key string) (*Global, bool) {
+	globalID, ok := vm.GetGlobalExport(key)
+	if !ok {
+		return nil, false
+	}
+	return vm.GlobalVar(globalID), true
+}
@@ -0,0 +1,98 @@
+package exec_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-interpreter/wagon/wasm"
+	"github.com/perlin-network/life/exec"
+	. "github.com/perlin-network/life/internal/wasmtest"
+)
+
+// counterModule imports the mutable global env.counter and exports inc()
+// and get() along with its own mutable f64 global "own".
+func counterModule() []byte {
+	m := &Module{
+		Types:   [][]byte{FuncType(nil, nil), FuncType(nil, []byte{I32})},
+		Imports: []Import{{Module: "env", Field: "counter", Kind: KindGlobal, Desc: []byte{I32, 1}}},
+		Funcs: []Func{
+			{Type: 0, Body: Cat([]byte{0x23, 0x00}, I32Const(1), []byte{0x6a, 0x24, 0x00})}, // counter++
+			{Type: 1, Body: []byte{0x23, 0x00}},
+		},
+		Globals: [][]byte{Cat([]byte{F64, 1, 0x44}, make([]byte, 8), []byte{0x0b})},
+		Exports: [][]byte{
+			Export("inc", KindFunc, 0), Export("get", KindFunc, 1),
+			Export("counter", KindGlobal, 0), Export("own", KindGlobal, 1),
+		},
+	}
+	return m.Bytes()
+}
+
+func TestGlobal(t *testing.T) {
+	counter := exec.NewGlobal(wasm.ValueTypeI32, true, 0)
+	imports := exec.NewImports()
+	imports.Module("env").GlobalVar("counter", counter)
+
+	var vms [2]*exec.VirtualMachine
+	for i := range vms {
+		vm, err := exec.NewVirtualMachine(counterModule(), exec.VMConfig{}, imports, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vms[i] = vm
+	}
+
+	run(t, vms[0], "inc")
+	run(t, vms[1], "inc")
+	if v := counter.GetI32(); v != 2 {
+		t.Fatalf("counter is %d", v)
+	}
+	if err := counter.SetI32(-5); err != nil {
+		t.Fatal(err)
+	}
+	if v := int32(run(t, vms[0], "get")); v != -5 {
+		t.Fatalf("counter read as %d", v)
+	}
+	if g, ok := vms[1].GetGlobalVarExport("counter"); !ok || g != counter {
+		t.Fatal("exported global is not the imported one")
+	}
+
+	own, ok := vms[0].GetGlobalVarExport("own")
+	if !ok {
+		t.Fatal("no exported global")
+	}
+	if err := own.SetF64(1.5); err != nil {
+		t.Fatal(err)
+	}
+	if v := own.GetF64(); v != 1.5 {
+		t.Fatalf("global holds %v", v)
+	}
+	if other, _ := vms[1].GetGlobalVarExport("own"); other.GetF64() != 0 {
+		t.Fatal("global defined by a module shared between its instances")
+	}
+}
+
+func TestGlobalErrors(t *testing.T) {
+	g := exec.NewGlobal(wasm.ValueTypeI32, false, 1)
+	if err := g.SetI32(2); !errors.Is(err, exec.ErrImmutableGlobal) || g.GetI32() != 1 {
+		t.Fatalf("immutable global set: %v", err)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("i32 global read as i64")
+			}
+		}()
+		g.GetI64()
+	}()
+
+	// Mutable global imports must be provided with mutable globals.
+	imports := exec.NewImports()
+	imports.Module("env").GlobalVar("counter", g)
+	_, err := exec.NewVirtualMachine(counterModule(), exec.VMConfig{}, imports, nil)
+	var linkErr *exec.LinkError
+	if !errors.As(err, &linkErr) || !errors.Is(linkErr.Imports[0], exec.ErrSignatureMismatch) {
+		t.Fatalf("expected a signature mismatch, got %v", err)
+	}
+}
@@ -1,9 +1,10 @@
 package exec
 
 import (
-	"errors"
-
+	"context"
 	"fmt"
+	"sync/atomic"
+
 	"github.com/perlin-network/life/compiler"
 	"github.com/perlin-network/life/utils"
 )
@@ -23,6 +24,7 @@ func (r *NopResolver) ResolveGlobal(module, field string) int64 {
 
 // RunWithGasLimit runs a WebAssembly modules function denoted by its ID with a specified set
 // of parameters for a specified amount of instructions (also known as gas) denoted by `limit`.
+// The returns of Execute due to Config.InstructionBudget are not counted.
 // Panics on logical errors.
 func (vm *VirtualMachine) RunWithGasLimit(entryID, limit int, params ...int64) (int64, error) {
 	count := 0
@@ -34,9 +36,14 @@ func (vm *VirtualMachine) RunWithGasLimit(entryID, limit int, params ...int64) (
 			vm.Delegate()
 			vm.Delegate = nil
 		}
+		if vm.BudgetExhausted {
+			continue
+		}
 		count++
-		if count == limit {
-			return -1, errors.New("gas limit exceeded")
+		if count == limit && !vm.Exited {
+			t := &Trap{Kind: TrapGasLimitExceeded}
+			vm.locate(t, vm.GetCurrentFrame().IP)
+			return -1, t
 		}
 	}
 
@@ -55,27 +62,42 @@ func (vm *VirtualMachine) Run(entryID int, params ...int64) (retVal int64, retEr
 	if vm.AOTService != nil {
 		recoveryFunc := func() {
 			if err := recover(); err != nil {
-				if err, ok := err.(error); ok {
+				retVal = -1
+				switch err := err.(type) {
+				case *ExitError:
+					retErr = err
+				case *Trap:
 					retErr = err
-				} else {
-					panic(err)
+				case *Exception:
+					retErr = &Trap{Kind: TrapUncaughtException, FunctionID: -1, Err: err}
+				default:
+					// AOT-compiled code only panics through function imports.
+					retErr = &Trap{Kind: TrapHostFunction, FunctionID: -1, Err: unifyTrapCause(err)}
 				}
 			} else {
 				vm.CurrentFrame = -1
 			}
 		}
 		targetName := fmt.Sprintf("%s%d", compiler.NGEN_FUNCTION_PREFIX, entryID)
-		switch len(params) {
-		case 0:
+		if len(params) <= 2 {
 			defer recoveryFunc()
-			return int64(vm.AOTService.UnsafeInvokeFunction_0(vm, targetName)), nil
-		case 1:
-			defer recoveryFunc()
-			return int64(vm.AOTService.UnsafeInvokeFunction_1(vm, targetName, uint64(params[0]))), nil
-		case 2:
-			defer recoveryFunc()
-			return int64(vm.AOTService.UnsafeInvokeFunction_2(vm, targetName, uint64(params[0]), uint64(params[1]))), nil
-		default:
+
+			var ret uint64
+			switch len(params) {
+			case 0:
+				ret = vm.AOTService.UnsafeInvokeFunction_0(vm, targetName)
+			case 1:
+				ret = vm.AOTService.UnsafeInvokeFunction_1(vm, targetName, uint64(params[0]))
+			case 2:
+				ret = vm.AOTService.UnsafeInvokeFunction_2(vm, targetName, uint64(params[0]), uint64(params[1]))
+			}
+
+			if sig := functionSig(vm.Module.Base, entryID); sig != nil && compiler.NumSlots(sig.ReturnTypes) > 1 {
+				numResults := compiler.NumSlots(sig.ReturnTypes)
+				vm.setYieldedValue(numResults-1, 0)
+				vm.AOTService.ReadResults(vm, vm.YieldedValues[:numResults-1])
+			}
+			return int64(ret), nil
 		}
 	}
 
@@ -92,3 +114,124 @@ func (vm *VirtualMachine) Run(entryID int, params ...int64) (retVal int64, retEr
 	}
 	return vm.ReturnValue, nil
 }
+
+// RunValues runs a WebAssembly modules function like Run and returns all of
+// its results.
+func (vm *VirtualMachine) RunValues(entryID int, params ...int64) ([]int64, error) {
+	ret, err := vm.Run(entryID, params...)
+	if err != nil {
+		return nil, err
+	}
+	return vm.collectResults(entryID, ret), nil
+}
+
+// collectResults returns the value slots of the results of the function
+// `functionID` which last returned `first`, the others being held by
+// vm.YieldedValues.
+func (vm *VirtualMachine) collectResults(functionID int, first int64) []int64 {
+	sig := functionSig(vm.Module.Base, functionID)
+	if sig == nil {
+		return []int64{first}
+	}
+
+	results := make([]int64, compiler.NumSlots(sig.ReturnTypes))
+	for i := range results {
+		if i == 0 {
+			results[i] = first
+		} else {
+			results[i] = vm.yieldedValue(i)
+		}
+	}
+	return results
+}
+
+// RunContext runs a WebAssembly modules function like Run, but aborts the
+// execution once ctx is done with a TrapInterrupted trap wrapping ctx.Err().
+// The context is checked on branches and calls, between execution slices and
+// after each call to a function import; function imports may access it through
+// Context. After an interruption the call stack is unwound and the VM may be run
+// again, with any changes made to memory and globals so far preserved.
+func (vm *VirtualMachine) RunContext(ctx context.Context, entryID int, params ...int64) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return -1, &Trap{Kind: TrapInterrupted, FunctionID: -1, Err: err}
+	}
+
+	vm.ctx = ctx
+	vm.setInterrupted(false)
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			vm.setInterrupted(true)
+		case <-stop:
+		}
+	}()
+
+	ret, err := vm.Run(entryID, params...)
+
+	// Make sure the interruption request cannot outlive this call.
+	close(stop)
+	<-stopped
+	vm.setInterrupted(false)
+	vm.ctx = nil
+
+	if t, ok := err.(*Trap); ok && t.Kind == TrapInterrupted {
+		if t.Err == nil {
+			t.Err = ctx.Err()
+		}
+		vm.unwind()
+	}
+	return ret, err
+}
+
+// Context returns the context of the ongoing RunContext call, or
+// context.Background() if the VM was not started through RunContext.
+func (vm *VirtualMachine) Context() context.Context {
+	if vm.ctx != nil {
+		return vm.ctx
+	}
+	return context.Background()
+}
+
+func (vm *VirtualMachine) setInterrupted(interrupted bool) {
+	if interrupted {
+		atomic.StoreUint32(&vm.interrupted, 1)
+	} else {
+		atomic.StoreUint32(&vm.interrupted, 0)
+	}
+
+	if vm.AOTService != nil {
+		vm.AOTService.Interrupt(vm, interrupted)
+	}
+}
+
+// checkInterrupt traps if the execution has been interrupted.
+func (vm *VirtualMachine) checkInterrupt() {
+	if atomic.LoadUint32(&vm.interrupted) != 0 {
+		t := &Trap{Kind: TrapInterrupted}
+		if vm.ctx != nil {
+			t.Err = vm.ctx.Err()
+		}
+		panic(t)
+	}
+}
+
+// Reset leaves a virtual machine whose last execution trapped or exited ready
+// to run functions again. Memories, tables and globals keep their contents.
+func (vm *VirtualMachine) Reset() {
+	vm.unwind()
+}
+
+// unwind discards all call frames along with the error of the last execution.
+func (vm *VirtualMachine) unwind() {
+	for ; vm.CurrentFrame >= 0; vm.CurrentFrame-- {
+		vm.CallStack[vm.CurrentFrame].Destroy(vm)
+	}
+
+	vm.Delegate = nil
+	vm.Exited = true
+	vm.ExitError = nil
+}
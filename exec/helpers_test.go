@@ -0,0 +1,106 @@
+package exec_test
+
+import (
+	"testing"
+
+	"github.com/perlin-network/life/exec"
+	. "github.com/perlin-network/life/internal/wasmtest"
+)
+
+// sumModule exports sum(n), which adds up the integers from 1 to n in a
+// loop.
+func sumModule() []byte {
+	m := &Module{
+		Types: [][]byte{FuncType([]byte{I32}, []byte{I32})},
+		Funcs: []Func{{Type: 0, Locals: Locals(1, I32), Body: Cat(
+			[]byte{0x02, 0x40, 0x03, 0x40},        // block, loop
+			LocalGet(0), []byte{0x45, 0x0d, 0x01}, // br_if 1 (n == 0)
+			LocalGet(1), LocalGet(0), []byte{0x6a}, LocalSet(1), // acc += n
+			LocalGet(0), I32Const(1), []byte{0x6b}, LocalSet(0), // n--
+			[]byte{0x0c, 0x00, 0x0b, 0x0b}, // br 0, end, end
+			LocalGet(1),
+		)}},
+		Exports: [][]byte{Export("sum", KindFunc, 0)},
+	}
+	return m.Bytes()
+}
+
+func TestRunWithGasLimitLongLoop(t *testing.T) {
+	for _, budget := range []int{0, exec.DefaultInstructionBudget} {
+		vm, err := exec.NewVirtualMachine(sumModule(), exec.VMConfig{InstructionBudget: budget}, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry, _ := vm.GetFunctionExport("sum")
+
+		ret, err := vm.RunWithGasLimit(entry, 10, 100000)
+		if err != nil {
+			t.Fatalf("budget %d: %v", budget, err)
+		}
+		if int32(ret) != 705082704 {
+			t.Fatalf("budget %d: got %d", budget, int32(ret))
+		}
+	}
+}
+
+func TestExecuteInstructionBudget(t *testing.T) {
+	vm, err := exec.NewVirtualMachine(sumModule(), exec.VMConfig{InstructionBudget: 100}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, _ := vm.GetFunctionExport("sum")
+
+	vm.Ignite(entry, 1000)
+	slices := 0
+	for !vm.Exited {
+		vm.Execute()
+		if !vm.Exited && !vm.BudgetExhausted {
+			t.Fatal("Execute returned before exhausting its budget")
+		}
+		slices++
+	}
+	if vm.ExitError != nil {
+		t.Fatal(vm.ExitError)
+	}
+	if vm.ReturnValue != 500500 {
+		t.Fatalf("got %d", vm.ReturnValue)
+	}
+	if slices < 10 {
+		t.Fatalf("execution was split into %d slices only", slices)
+	}
+
+	// Without a budget, Execute runs until the end of the execution.
+	vm, err = exec.NewVirtualMachine(sumModule(), exec.VMConfig{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm.Ignite(entry, 1000)
+	vm.Execute()
+	if !vm.Exited || vm.BudgetExhausted {
+		t.Fatal("execution did not complete in a single call to Execute")
+	}
+}
+
+func TestRunWithGasLimitExceeded(t *testing.T) {
+	m := &Module{
+		Types:   [][]byte{FuncType(nil, nil)},
+		Imports: []Import{ImportFunc("env", "ping", 0)},
+		Funcs: []Func{{Type: 0, Body: Cat(
+			[]byte{0x03, 0x40}, Call(0), []byte{0x0c, 0x00, 0x0b}, // loop calling ping forever
+		)}},
+		Exports: [][]byte{Export("run", KindFunc, 1)},
+	}
+	imports := exec.NewImports()
+	imports.Module("env").HostFunc("ping", func() {})
+
+	vm, err := exec.NewVirtualMachine(m.Bytes(), exec.VMConfig{}, imports, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, _ := vm.GetFunctionExport("run")
+	if _, err := vm.RunWithGasLimit(entry, 10); err == nil {
+		t.Fatal("expected the gas limit to be exceeded")
+	} else if trap, ok := err.(*exec.Trap); !ok || trap.Kind != exec.TrapGasLimitExceeded {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
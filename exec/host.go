@@ -0,0 +1,212 @@
+package exec
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/go-interpreter/wagon/wasm"
+)
+
+var (
+	vmType    = reflect.TypeOf((*VirtualMachine)(nil))
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// HostFunction is an ordinary Go function bound as a WebAssembly function import.
+//
+// The function may take a *VirtualMachine as its first parameter, followed by
+// parameters of type int32, uint32, int64, uint64, float32 or float64 which
+// map to the WebAssembly types i32, i64, f32 and f64. It may return any
+// number of values of these types, optionally followed by an error. A non-nil
+// error aborts the execution with a TrapHostFunction trap, unless it is an
+// *Exception, which is thrown into the guest.
+//
+// NewRawHostFunction binds a FunctionImport reading its arguments itself
+// instead, with an explicit signature.
+type HostFunction struct {
+	fn      reflect.Value
+	raw     FunctionImport
+	withVM  bool
+	withErr bool
+
+	params  []wasm.ValueType
+	results []wasm.ValueType
+}
+
+// HostFunctionResolver is implemented by import resolvers providing function
+// imports as HostFunctions. Unless VMConfig.LazyImports is set, their
+// signatures are checked against the module when a virtual machine is
+// created, and mismatches are reported in a LinkError. Imports for which
+// ResolveHostFunction returns nil are resolved through ResolveFunc instead.
+type HostFunctionResolver interface {
+	ImportResolver
+	ResolveHostFunction(module, field string) *HostFunction
+}
+
+// NewRawHostFunction binds f, which reads its arguments from the locals of the
+// current frame, as a function import of the given signature.
+func NewRawHostFunction(sig wasm.FunctionSig, f FunctionImport) *HostFunction {
+	return &HostFunction{raw: f, params: sig.ParamTypes, results: sig.ReturnTypes}
+}
+
+// NewHostFunction binds fn as a function import.
+func NewHostFunction(fn interface{}) (*HostFunction, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return nil, fmt.Errorf("host function must be a non-nil func, got %T", fn)
+	}
+
+	t := v.Type()
+	if t.IsVariadic() {
+		return nil, fmt.Errorf("host function %s must not be variadic", t)
+	}
+
+	h := &HostFunction{fn: v}
+
+	for i := 0; i < t.NumIn(); i++ {
+		in := t.In(i)
+		if i == 0 && in == vmType {
+			h.withVM = true
+			continue
+		}
+
+		vt, ok := valueTypeOf(in)
+		if !ok {
+			return nil, fmt.Errorf("host function %s: unsupported parameter type %s", t, in)
+		}
+		h.params = append(h.params, vt)
+	}
+
+	numOut := t.NumOut()
+	if numOut > 0 && t.Out(numOut-1) == errorType {
+		h.withErr = true
+		numOut--
+	}
+
+	for i := 0; i < numOut; i++ {
+		vt, ok := valueTypeOf(t.Out(i))
+		if !ok {
+			return nil, fmt.Errorf("host function %s: unsupported result type %s", t, t.Out(i))
+		}
+		h.results = append(h.results, vt)
+	}
+
+	return h, nil
+}
+
+// MustHostFunction is like NewHostFunction but panics if fn cannot be bound.
+func MustHostFunction(fn interface{}) *HostFunction {
+	h, err := NewHostFunction(fn)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+// Signature returns the WebAssembly signature of the function.
+func (h *HostFunction) Signature() wasm.FunctionSig {
+	return wasm.FunctionSig{
+		Form:        0x60,
+		ParamTypes:  h.params,
+		ReturnTypes: h.results,
+	}
+}
+
+// FunctionImport returns a FunctionImport which converts the arguments found
+// in the locals of the current frame and calls the bound function.
+func (h *HostFunction) FunctionImport() FunctionImport {
+	if h.raw != nil {
+		return h.raw
+	}
+
+	t := h.fn.Type()
+
+	return func(vm *VirtualMachine) int64 {
+		locals := vm.GetCurrentFrame().Locals
+
+		args := make([]reflect.Value, 0, t.NumIn())
+		if h.withVM {
+			args = append(args, reflect.ValueOf(vm))
+		}
+		for i, vt := range h.params {
+			args = append(args, fromRaw(t.In(len(args)), vt, locals[i]))
+		}
+
+		out := h.fn.Call(args)
+
+		if h.withErr {
+			if err := out[len(out)-1]; !err.IsNil() {
+				panic(err.Interface().(error))
+			}
+		}
+
+		if len(h.results) == 0 {
+			return 0
+		}
+		for i := 1; i < len(h.results); i++ {
+			vm.setYieldedValue(i, toRaw(out[i], h.results[i]))
+		}
+		return toRaw(out[0], h.results[0])
+	}
+}
+
+// valueTypeOf maps a Go type to the WebAssembly value type representing it.
+func valueTypeOf(t reflect.Type) (wasm.ValueType, bool) {
+	switch t.Kind() {
+	case reflect.Int32, reflect.Uint32:
+		return wasm.ValueTypeI32, true
+	case reflect.Int64, reflect.Uint64:
+		return wasm.ValueTypeI64, true
+	case reflect.Float32:
+		return wasm.ValueTypeF32, true
+	case reflect.Float64:
+		return wasm.ValueTypeF64, true
+	}
+	return 0, false
+}
+
+// fromRaw converts a value as stored in interpreter registers into t.
+func fromRaw(t reflect.Type, vt wasm.ValueType, raw int64) reflect.Value {
+	v := reflect.New(t).Elem()
+	switch vt {
+	case wasm.ValueTypeI32:
+		if t.Kind() == reflect.Int32 {
+			v.SetInt(int64(int32(raw)))
+		} else {
+			v.SetUint(uint64(uint32(raw)))
+		}
+	case wasm.ValueTypeI64:
+		if t.Kind() == reflect.Int64 {
+			v.SetInt(raw)
+		} else {
+			v.SetUint(uint64(raw))
+		}
+	case wasm.ValueTypeF32:
+		v.SetFloat(float64(math.Float32frombits(uint32(raw))))
+	case wasm.ValueTypeF64:
+		v.SetFloat(math.Float64frombits(uint64(raw)))
+	}
+	return v
+}
+
+// toRaw converts v into its representation in interpreter registers.
+func toRaw(v reflect.Value, vt wasm.ValueType) int64 {
+	switch vt {
+	case wasm.ValueTypeI32:
+		if v.Kind() == reflect.Int32 {
+			return int64(uint32(int32(v.Int())))
+		}
+		return int64(uint32(v.Uint()))
+	case wasm.ValueTypeI64:
+		if v.Kind() == reflect.Int64 {
+			return v.Int()
+		}
+		return int64(v.Uint())
+	case wasm.ValueTypeF32:
+		return int64(math.Float32bits(float32(v.Float())))
+	case wasm.ValueTypeF64:
+		return int64(math.Float64bits(v.Float()))
+	}
+	return 0
+}
@@ -0,0 +1,124 @@
+package exec_test
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/go-interpreter/wagon/wasm"
+	"github.com/perlin-network/life/exec"
+	. "github.com/perlin-network/life/internal/wasmtest"
+)
+
+// forwardModule exports run, which forwards its parameters to the import
+// env.f of the same type.
+func forwardModule(params, results []byte) []byte {
+	body := []byte{}
+	for i := range params {
+		body = append(body, LocalGet(i)...)
+	}
+	m := &Module{
+		Types:   [][]byte{FuncType(params, results)},
+		Imports: []Import{ImportFunc("env", "f", 0)},
+		Funcs:   []Func{{Type: 0, Body: Cat(body, Call(0))}},
+		Exports: [][]byte{Export("run", KindFunc, 1)},
+	}
+	return m.Bytes()
+}
+
+func TestHostFunction(t *testing.T) {
+	h, err := exec.NewHostFunction(func(vm *exec.VirtualMachine, a int32, b uint32, c float64) int64 {
+		if vm == nil {
+			t.Error("no virtual machine passed")
+		}
+		return int64(a) + int64(b) + int64(c)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := h.Signature()
+	if want := []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32, wasm.ValueTypeF64}; !reflect.DeepEqual(sig.ParamTypes, want) {
+		t.Fatalf("parameters %v", sig.ParamTypes)
+	}
+	if want := []wasm.ValueType{wasm.ValueTypeI64}; !reflect.DeepEqual(sig.ReturnTypes, want) {
+		t.Fatalf("results %v", sig.ReturnTypes)
+	}
+
+	imports := exec.NewImports()
+	imports.Module("env").Func("f", h.FunctionImport())
+
+	vm, err := exec.NewVirtualMachine(forwardModule([]byte{I32, I32, F64}, []byte{I64}), exec.VMConfig{}, imports, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, _ := vm.GetFunctionExport("run")
+
+	// Both i32 parameters are -1, seen as signed and unsigned respectively.
+	ret, err := vm.Run(entry, 0xffffffff, 0xffffffff, int64(math.Float64bits(2.5)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret != math.MaxUint32+1 {
+		t.Fatalf("got %d", ret)
+	}
+}
+
+func TestHostFunctionError(t *testing.T) {
+	errFailed := errors.New("failed")
+	imports := exec.NewImports()
+	imports.Module("env").HostFunc("f", func(x float32) (float32, error) {
+		if x < 0 {
+			return 0, errFailed
+		}
+		return x * 2, nil
+	})
+
+	vm, err := exec.NewVirtualMachine(forwardModule([]byte{F32}, []byte{F32}), exec.VMConfig{}, imports, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, _ := vm.GetFunctionExport("run")
+
+	ret, err := vm.Run(entry, int64(math.Float32bits(1.5)))
+	if err != nil || math.Float32frombits(uint32(ret)) != 3 {
+		t.Fatalf("got %v, %v", math.Float32frombits(uint32(ret)), err)
+	}
+
+	vm, err = exec.NewVirtualMachine(forwardModule([]byte{F32}, []byte{F32}), exec.VMConfig{}, imports, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = vm.Run(entry, int64(math.Float32bits(-1)))
+	if trap, ok := err.(*exec.Trap); !ok || trap.Kind != exec.TrapHostFunction || !errors.Is(err, errFailed) {
+		t.Fatalf("expected a host function trap, got %v", err)
+	}
+}
+
+func TestNewHostFunctionUnsupported(t *testing.T) {
+	for _, fn := range []interface{}{
+		nil,
+		42,
+		(func())(nil),
+		func(...int32) {},
+		func(string) {},
+		func(int32, *exec.VirtualMachine) {},
+		func() struct{} { return struct{}{} },
+		func() (error, int32) { return nil, 0 },
+	} {
+		if _, err := exec.NewHostFunction(fn); err == nil {
+			t.Errorf("%T bound", fn)
+		}
+	}
+}
+
+func TestHostFunctionSignatureMismatch(t *testing.T) {
+	imports := exec.NewImports()
+	imports.Module("env").HostFunc("f", func(x int64) int64 { return x })
+
+	_, err := exec.NewVirtualMachine(forwardModule([]byte{I32}, []byte{I32}), exec.VMConfig{}, imports, nil)
+	var linkErr *exec.LinkError
+	if !errors.As(err, &linkErr) || len(linkErr.Imports) != 1 || !errors.Is(linkErr.Imports[0], exec.ErrSignatureMismatch) {
+		t.Fatalf("expected a signature mismatch, got %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+package exec
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/go-interpreter/wagon/wasm"
+	"github.com/perlin-network/life/compiler"
+)
+
+var _ HostFunctionResolver = (*Imports)(nil)
+var _ ImportProvider = (*Imports)(nil)
+var _ GlobalResolver = (*Imports)(nil)
+var _ MemoryResolver = (*Imports)(nil)
+var _ TableResolver = (*Imports)(nil)
+var _ TagResolver = (*Imports)(nil)
+
+// ErrImportNotFound is the cause of import errors for imports which are not
+// provided by the import resolver.
+var ErrImportNotFound = errors.New("import not found")
+
+// ImportProvider is implemented by import resolvers which can tell whether
+// they provide an import without resolving it. All imports they lack are
+// reported at once in a LinkError when a virtual machine is created.
+type ImportProvider interface {
+	HasImport(module, field string, kind wasm.External) bool
+}
+
+// ImportName identifies an entry of an import registry.
+type ImportName struct {
+	Module string
+	Field  string
+	Kind   wasm.External
+}
+
+type importEntry struct {
+	kind      wasm.External
+	fn        FunctionImport
+	host      *HostFunction
+	global    int64
+	globalVar *Global
+	memory    *Memory
+	table     *Table
+	tag       *Tag
+}
+
+// Imports is a registry of imports, mapping module and field names to
+// functions, globals, memories, tables and tags. It implements ImportResolver and
+// may be used in place of hand-written resolvers:
+//
+//	imports := exec.NewImports()
+//	imports.Module("env").
+//		HostFunc("__life_ping", func(x int64) int64 { return x + 1 }).
+//		Global("__life_magic", 424)
+type Imports struct {
+	modules map[string]map[string]importEntry
+}
+
+// NewImports creates an empty import registry.
+func NewImports() *Imports {
+	return &Imports{
+		modules: make(map[string]map[string]importEntry),
+	}
+}
+
+// ImportModule is a view of an import registry scoped to a single module name.
+type ImportModule struct {
+	imports *Imports
+	name    string
+}
+
+// Module returns a view of the registry for adding the fields of the module
+// `name`.
+func (i *Imports) Module(name string) *ImportModule {
+	return &ImportModule{imports: i, name: name}
+}
+
+// Func registers a function import.
+func (m *ImportModule) Func(field string, f FunctionImport) *ImportModule {
+	m.imports.set(m.name, field, importEntry{kind: wasm.ExternalFunction, fn: f})
+	return m
+}
+
+// HostFunc registers an ordinary Go function as a function import; see
+// HostFunction for the supported signatures. Panics if fn cannot be bound.
+func (m *ImportModule) HostFunc(field string, fn interface{}) *ImportModule {
+	h, ok := fn.(*HostFunction)
+	if !ok {
+		h = MustHostFunction(fn)
+	}
+	m.imports.set(m.name, field, importEntry{kind: wasm.ExternalFunction, host: h})
+	return m
+}
+
+// Global registers a global import.
+func (m *ImportModule) Global(field string, value int64) *ImportModule {
+	m.imports.set(m.name, field, importEntry{kind: wasm.ExternalGlobal, global: value})
+	return m
+}
+
+// GlobalVar registers a global import backed by a Global object, which is
+// shared with the modules importing it.
+func (m *ImportModule) GlobalVar(field string, g *Global) *ImportModule {
+	m.imports.set(m.name, field, importEntry{kind: wasm.ExternalGlobal, globalVar: g})
+	return m
+}
+
+// Memory registers a memory import.
+func (m *ImportModule) Memory(field string, mem *Memory) *ImportModule {
+	m.imports.set(m.name, field, importEntry{kind: wasm.ExternalMemory, memory: mem})
+	return m
+}
+
+// Table registers a table import.
+func (m *ImportModule) Table(field string, t *Table) *ImportModule {
+	m.imports.set(m.name, field, importEntry{kind: wasm.ExternalTable, table: t})
+	return m
+}
+
+// Tag registers a tag import.
+func (m *ImportModule) Tag(field string, t *Tag) *ImportModule {
+	m.imports.set(m.name, field, importEntry{kind: compiler.ExternalTag, tag: t})
+	return m
+}
+
+func (i *Imports) set(module, field string, e importEntry) {
+	fields, ok := i.modules[module]
+	if !ok {
+		fields = make(map[string]importEntry)
+		i.modules[module] = fields
+	}
+	fields[field] = e
+}
+
+func (i *Imports) lookup(module, field string) (importEntry, bool) {
+	e, ok := i.modules[module][field]
+	return e, ok
+}
+
+// Merge copies all entries of other into the registry, replacing existing
+// entries of the same name.
+func (i *Imports) Merge(other *Imports) *Imports {
+	for module, fields := range other.modules {
+		for field, e := range fields {
+			i.set(module, field, e)
+		}
+	}
+	return i
+}
+
+// Namespace returns a new registry holding the entries of the module `from`
+// under the module name `to`.
+func (i *Imports) Namespace(from, to string) *Imports {
+	out := NewImports()
+	for field, e := range i.modules[from] {
+		out.set(to, field, e)
+	}
+	return out
+}
+
+// List returns the names of all entries, sorted by module and field name.
+func (i *Imports) List() []ImportName {
+	var names []ImportName
+	for module, fields := range i.modules {
+		for field, e := range fields {
+			names = append(names, ImportName{Module: module, Field: field, Kind: e.kind})
+		}
+	}
+
+	sort.Slice(names, func(a, b int) bool {
+		if names[a].Module != names[b].Module {
+			return names[a].Module < names[b].Module
+		}
+		return names[a].Field < names[b].Field
+	})
+	return names
+}
+
+// HasImport tells whether the registry holds an entry of the given kind.
+func (i *Imports) HasImport(module, field string, kind wasm.External) bool {
+	e, ok := i.lookup(module, field)
+	return ok && e.kind == kind
+}
+
+func (i *Imports) ResolveFunc(module, field string) FunctionImport {
+	e, ok := i.lookup(module, field)
+	if !ok || e.kind != wasm.ExternalFunction {
+		panic(&ImportError{ModuleName: module, FieldName: field, Err: ErrImportNotFound})
+	}
+	if e.host != nil {
+		return e.host.FunctionImport()
+	}
+	return e.fn
+}
+
+func (i *Imports) ResolveHostFunction(module, field string) *HostFunction {
+	e, _ := i.lookup(module, field)
+	return e.host
+}
+
+func (i *Imports) ResolveGlobal(module, field string) int64 {
+	e, ok := i.lookup(module, field)
+	if !ok || e.kind != wasm.ExternalGlobal {
+		panic(&ImportError{ModuleName: module, FieldName: field, Err: ErrImportNotFound})
+	}
+	if e.globalVar != nil {
+		return e.globalVar.Get()
+	}
+	return e.global
+}
+
+func (i *Imports) ResolveGlobalVar(module, field string) *Global {
+	e, _ := i.lookup(module, field)
+	return e.globalVar
+}
+
+func (i *Imports) ResolveMemory(module, field string) *Memory {
+	e, _ := i.lookup(module, field)
+	return e.memory
+}
+
+func (i *Imports) ResolveTable(module, field string) *Table {
+	e, _ := i.lookup(module, field)
+	return e.table
+}
+
+func (i *Imports) ResolveTag(module, field string) *Tag {
+	e, _ := i.lookup(module, field)
+	return e.tag
+}
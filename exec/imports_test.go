@@ -0,0 +1,111 @@
+package exec_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/go-interpreter/wagon/wasm"
+	"github.com/perlin-network/life/exec"
+	. "github.com/perlin-network/life/internal/wasmtest"
+)
+
+func TestImports(t *testing.T) {
+	imports := exec.NewImports()
+	imports.Module("env").
+		HostFunc("add", func(a, b int32) int32 { return a + b }).
+		Global("base", 40)
+
+	m := &Module{
+		Types: [][]byte{FuncType([]byte{I32, I32}, []byte{I32}), FuncType(nil, []byte{I32})},
+		Imports: []Import{
+			ImportFunc("env", "add", 0),
+			{Module: "env", Field: "base", Kind: KindGlobal, Desc: []byte{I32, 0}},
+		},
+		Funcs:   []Func{{Type: 1, Body: Cat([]byte{0x23, 0x00}, I32Const(2), Call(0))}}, // add(global.get 0, 2)
+		Exports: [][]byte{Export("run", KindFunc, 1)},
+	}
+	vm, err := exec.NewVirtualMachine(m.Bytes(), exec.VMConfig{}, imports, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, _ := vm.GetFunctionExport("run")
+	if ret, err := vm.Run(entry); err != nil || ret != 42 {
+		t.Fatalf("got %d, %v", ret, err)
+	}
+}
+
+func TestImportsRegistry(t *testing.T) {
+	imports := exec.NewImports()
+	imports.Module("b").Global("g", 1)
+	imports.Module("a").
+		Func("f", func(vm *exec.VirtualMachine) int64 { return 0 }).
+		Memory("mem", exec.NewMemory(1, 1))
+
+	want := []exec.ImportName{
+		{Module: "a", Field: "f", Kind: wasm.ExternalFunction},
+		{Module: "a", Field: "mem", Kind: wasm.ExternalMemory},
+		{Module: "b", Field: "g", Kind: wasm.ExternalGlobal},
+	}
+	if got := imports.List(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("listed %v", got)
+	}
+
+	if !imports.HasImport("a", "f", wasm.ExternalFunction) || imports.HasImport("a", "f", wasm.ExternalGlobal) || imports.HasImport("a", "g", wasm.ExternalFunction) {
+		t.Fatal("HasImport does not match the kinds of the entries")
+	}
+
+	renamed := imports.Namespace("a", "c")
+	if names := renamed.List(); len(names) != 2 || names[0].Module != "c" {
+		t.Fatalf("namespaced %v", names)
+	}
+
+	// Merged entries replace existing ones.
+	other := exec.NewImports()
+	other.Module("b").Global("g", 2)
+	imports.Merge(other)
+	if v := imports.ResolveGlobal("b", "g"); v != 2 {
+		t.Fatalf("merged global holds %d", v)
+	}
+}
+
+func TestImportsNotFound(t *testing.T) {
+	imports := exec.NewImports()
+	imports.Module("env").Global("g", 1)
+
+	for _, resolve := range []func(){
+		func() { imports.ResolveFunc("env", "g") },
+		func() { imports.ResolveGlobal("env", "missing") },
+	} {
+		func() {
+			defer func() {
+				err, _ := recover().(error)
+				var importErr *exec.ImportError
+				if !errors.As(err, &importErr) || !errors.Is(err, exec.ErrImportNotFound) {
+					t.Errorf("expected a missing import, got %v", err)
+				}
+			}()
+			resolve()
+		}()
+	}
+
+	// Missing imports are reported when instantiating modules.
+	m := &Module{
+		Types:   [][]byte{FuncType(nil, nil)},
+		Imports: []Import{ImportFunc("env", "f", 0)},
+	}
+	_, err := exec.NewVirtualMachine(m.Bytes(), exec.VMConfig{}, imports, nil)
+	var linkErr *exec.LinkError
+	if !errors.As(err, &linkErr) || len(linkErr.Imports) != 1 || !errors.Is(linkErr.Imports[0], exec.ErrImportNotFound) {
+		t.Fatalf("expected a missing import, got %v", err)
+	}
+}
+
+func TestImportsHostFuncUnsupported(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("unsupported function bound")
+		}
+	}()
+	exec.NewImports().Module("env").HostFunc("f", func(string) {})
+}
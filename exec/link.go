@@ -0,0 +1,436 @@
+package exec
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/go-interpreter/wagon/wasm"
+	"github.com/perlin-network/life/compiler"
+)
+
+// ImportError describes a single import that could not be linked.
+type ImportError struct {
+	ModuleName string
+	FieldName  string
+	Err        error
+}
+
+func (e *ImportError) Error() string {
+	return fmt.Sprintf("import %s.%s: %v", e.ModuleName, e.FieldName, e.Err)
+}
+
+func (e *ImportError) Unwrap() error {
+	return e.Err
+}
+
+// LinkError is returned when creating a module or a virtual machine if some
+// imports could not be linked.
+type LinkError struct {
+	Imports []*ImportError
+}
+
+func (e *LinkError) Error() string {
+	msgs := make([]string, len(e.Imports))
+	for i, imp := range e.Imports {
+		msgs[i] = imp.Error()
+	}
+	return "link error: " + strings.Join(msgs, "; ")
+}
+
+// ErrSignatureMismatch is the cause of import errors for function imports
+// whose signature does not match the module's, for global imports whose type
+// does not match the module's or whose value does not fit in their type, for
+// table imports whose element type does not match the module's, for memory
+// imports which are shared or 64-bit when the module's is not or the reverse,
+// and for tag imports whose parameters do not match the module's.
+var ErrSignatureMismatch = errors.New("signature mismatch")
+
+// ErrLimitsMismatch is the cause of import errors for memory and table imports
+// whose size or maximum size does not satisfy the limits declared by the module.
+var ErrLimitsMismatch = errors.New("limits mismatch")
+
+// typeName returns the name of the value type t, including the reference
+// types the wasm package does not know about.
+func typeName(t wasm.ValueType) string {
+	switch t {
+	case compiler.ValueTypeFuncRef:
+		return "funcref"
+	case compiler.ValueTypeExternRef:
+		return "externref"
+	case compiler.ValueTypeV128:
+		return "v128"
+	}
+	return t.String()
+}
+
+func formatSig(sig *wasm.FunctionSig) string {
+	return formatTypes(sig.ParamTypes) + " -> " + formatTypes(sig.ReturnTypes)
+}
+
+func formatTypes(types []wasm.ValueType) string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = typeName(t)
+	}
+	return "(" + strings.Join(names, ", ") + ")"
+}
+
+func formatGlobalType(t wasm.GlobalVar) string {
+	if t.Mutable {
+		return "mut " + typeName(t.Type)
+	}
+	return typeName(t.Type)
+}
+
+func sameSig(a, b *wasm.FunctionSig) bool {
+	return sameTypes(a.ParamTypes, b.ParamTypes) && sameTypes(a.ReturnTypes, b.ReturnTypes)
+}
+
+func sameTypes(a, b []wasm.ValueType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// GlobalResolver is implemented by import resolvers providing global imports
+// as Global objects. Mutable globals imported from other resolvers hold a
+// private copy of the value returned by ResolveGlobal. Imports for which
+// ResolveGlobalVar returns nil are resolved through ResolveGlobal instead.
+type GlobalResolver interface {
+	ResolveGlobalVar(module, field string) *Global
+}
+
+// MemoryResolver is implemented by import resolvers providing memory imports.
+// Memories imported from other resolvers are allocated anew with
+// VMConfig.DefaultMemoryPages pages.
+type MemoryResolver interface {
+	ResolveMemory(module, field string) *Memory
+}
+
+// TableResolver is implemented by import resolvers providing table imports.
+// Tables imported from other resolvers are allocated anew with
+// VMConfig.DefaultTableSize slots.
+type TableResolver interface {
+	ResolveTable(module, field string) *Table
+}
+
+// TagResolver is implemented by import resolvers providing tag imports. Tags
+// imported from other resolvers are created anew for each instance, and thus
+// only match the exceptions the instance throws itself.
+type TagResolver interface {
+	ResolveTag(module, field string) *Tag
+}
+
+// instanceResolver is implemented by import resolvers linking imports against
+// the exports of other module instances.
+type instanceResolver interface {
+	resolveInstance(module string) *VirtualMachine
+}
+
+// linkedImports holds the imports of a module once linked.
+type linkedImports struct {
+	funcImports []FunctionImportInfo
+	globals     []int64
+	globalVars  []*Global // shared imported mutable globals, nil for the others
+	memories    []*Memory // imported memories, nil unless imported from a MemoryResolver
+	memoryPages []int     // sizes in pages of the imported memories
+	tables      []*Table  // imported tables, nil unless imported from a TableResolver
+	tableSizes  []int     // sizes of the imported tables
+	tags        []*Tag    // imported tags, nil unless imported from a TagResolver
+}
+
+// resolveImports links the imports of m against impResolver. Function
+// imports are left unresolved if config.LazyImports is set; otherwise each
+// one is resolved up front. All imports that could not be linked are
+// reported at once in a LinkError.
+func resolveImports(m *compiler.Module, config VMConfig, impResolver ImportResolver) (*linkedImports, error) {
+	linked := &linkedImports{
+		funcImports: emptyFuncImports,
+		globals:     emptyGlobals,
+	}
+
+	if impResolver == nil || (m.Base.Import == nil && len(m.TagImports) == 0) {
+		return linked, nil
+	}
+
+	var importErrs []*ImportError
+	fail := func(imp wasm.ImportEntry, err error) {
+		importErrs = append(importErrs, &ImportError{ModuleName: imp.ModuleName, FieldName: imp.FieldName, Err: err})
+	}
+
+	provider, _ := impResolver.(ImportProvider)
+
+	var imports []wasm.ImportEntry
+	if m.Base.Import != nil {
+		imports = m.Base.Import.Entries
+	}
+
+	for _, imp := range imports {
+		kind := imp.Type.Kind()
+		if provider != nil && !provider.HasImport(imp.ModuleName, imp.FieldName, kind) {
+			fail(imp, ErrImportNotFound)
+			continue
+		}
+
+		switch kind {
+		case wasm.ExternalFunction:
+			var f FunctionImport
+			if !config.LazyImports {
+				var err error
+				if f, err = resolveFunc(m.Base, imp, impResolver); err != nil {
+					fail(imp, err)
+				}
+			}
+			linked.funcImports = append(linked.funcImports, FunctionImportInfo{
+				ModuleName: imp.ModuleName,
+				FieldName:  imp.FieldName,
+				F:          f, // deferred if nil
+			})
+		case wasm.ExternalGlobal:
+			value, g, err := resolveGlobal(imp, impResolver)
+			if err != nil {
+				fail(imp, err)
+			}
+			if g != nil {
+				linked.globalVars = append(linked.globalVars, make([]*Global, len(linked.globals)-len(linked.globalVars))...)
+				linked.globalVars = append(linked.globalVars, g)
+			}
+			linked.globals = append(linked.globals, value)
+		case wasm.ExternalMemory:
+			memType := m.MemoryTypes[len(linked.memories)]
+			linked.memories = append(linked.memories, nil)
+			linked.memoryPages = append(linked.memoryPages, config.DefaultMemoryPages)
+
+			if mr, ok := impResolver.(MemoryResolver); ok {
+				mem, err := resolveMemory(imp, memType, mr)
+				if err != nil {
+					fail(imp, err)
+					continue
+				}
+				linked.memories[len(linked.memories)-1] = mem
+				linked.memoryPages[len(linked.memoryPages)-1] = mem.Pages()
+			}
+		case wasm.ExternalTable:
+			elemType := m.TableTypes[len(linked.tables)]
+			linked.tables = append(linked.tables, nil)
+			linked.tableSizes = append(linked.tableSizes, config.DefaultTableSize)
+
+			if tr, ok := impResolver.(TableResolver); ok {
+				t, err := resolveTable(imp, elemType, tr)
+				if err != nil {
+					fail(imp, err)
+					continue
+				}
+				linked.tables[len(linked.tables)-1] = t
+				linked.tableSizes[len(linked.tableSizes)-1] = t.Size()
+			}
+		default:
+			panic(fmt.Errorf("import kind not supported: %d", kind))
+		}
+	}
+
+	for _, imp := range m.TagImports {
+		entry := wasm.ImportEntry{ModuleName: imp.ModuleName, FieldName: imp.FieldName}
+		if provider != nil && !provider.HasImport(imp.ModuleName, imp.FieldName, compiler.ExternalTag) {
+			fail(entry, ErrImportNotFound)
+			continue
+		}
+
+		var tag *Tag
+		if tr, ok := impResolver.(TagResolver); ok {
+			var err error
+			if tag, err = resolveTag(imp, m.Base.Types.Entries[imp.Type].ParamTypes, tr); err != nil {
+				fail(entry, err)
+				continue
+			}
+		}
+		linked.tags = append(linked.tags, tag)
+	}
+
+	if len(importErrs) > 0 {
+		return nil, &LinkError{Imports: importErrs}
+	}
+	return linked, nil
+}
+
+// resolveFunc resolves a function import, checking its signature if the
+// resolver provides it as a HostFunction or as the export of an instance.
+func resolveFunc(m *wasm.Module, imp wasm.ImportEntry, r ImportResolver) (f FunctionImport, err error) {
+	typeID := imp.Type.(wasm.FuncImport).Type
+	if m.Types == nil || int(typeID) >= len(m.Types.Entries) {
+		return nil, fmt.Errorf("invalid type index %d", typeID)
+	}
+	want := &m.Types.Entries[typeID]
+
+	if ir, ok := r.(instanceResolver); ok {
+		if vm := ir.resolveInstance(imp.ModuleName); vm != nil {
+			functionID, ok := vm.GetFunctionExport(imp.FieldName)
+			if !ok {
+				return nil, ErrImportNotFound
+			}
+
+			if have := functionSig(vm.Module.Base, functionID); !sameSig(want, have) {
+				return nil, fmt.Errorf("%w: module expects %s, exported function has %s", ErrSignatureMismatch, formatSig(want), formatSig(have))
+			}
+			return vm.exportedFunction(functionID), nil
+		}
+	}
+
+	if hr, ok := r.(HostFunctionResolver); ok {
+		if h := hr.ResolveHostFunction(imp.ModuleName, imp.FieldName); h != nil {
+			have := h.Signature()
+			if !sameSig(want, &have) {
+				return nil, fmt.Errorf("%w: module expects %s, host function has %s", ErrSignatureMismatch, formatSig(want), formatSig(&have))
+			}
+			return h.FunctionImport(), nil
+		}
+	}
+
+	defer catchImportError(&err)
+
+	if f = r.ResolveFunc(imp.ModuleName, imp.FieldName); f == nil {
+		return nil, ErrImportNotFound
+	}
+	return f, nil
+}
+
+// resolveGlobal resolves a global import, checking its type. Imported
+// mutable globals are shared if the resolver provides them as a Global, which
+// is returned along with the current value of the global.
+func resolveGlobal(imp wasm.ImportEntry, r ImportResolver) (value int64, g *Global, err error) {
+	want := imp.Type.(wasm.GlobalVarImport).Type
+
+	if ir, ok := r.(instanceResolver); ok {
+		if vm := ir.resolveInstance(imp.ModuleName); vm != nil {
+			globalID, ok := vm.GetGlobalExport(imp.FieldName)
+			if !ok {
+				return 0, nil, ErrImportNotFound
+			}
+
+			if have := globalType(vm.Module.Base, globalID); have != want {
+				return 0, nil, fmt.Errorf("%w: module expects %s, exported global is %s", ErrSignatureMismatch, formatGlobalType(want), formatGlobalType(have))
+			}
+			return sharedGlobal(vm.GlobalVar(globalID))
+		}
+	}
+
+	defer catchImportError(&err)
+
+	if gr, ok := r.(GlobalResolver); ok {
+		if g := gr.ResolveGlobalVar(imp.ModuleName, imp.FieldName); g != nil {
+			if have := g.globalType(); have != want {
+				return 0, nil, fmt.Errorf("%w: module expects %s, global is %s", ErrSignatureMismatch, formatGlobalType(want), formatGlobalType(have))
+			}
+			return sharedGlobal(g)
+		}
+	}
+
+	value = r.ResolveGlobal(imp.ModuleName, imp.FieldName)
+
+	if t := want.Type; t == wasm.ValueTypeI32 || t == wasm.ValueTypeF32 {
+		if value < math.MinInt32 || value > math.MaxUint32 {
+			return 0, nil, fmt.Errorf("%w: value %d does not fit in %s", ErrSignatureMismatch, value, t)
+		}
+	}
+	return value, nil, nil
+}
+
+// sharedGlobal returns the value of g, and g itself if it is mutable.
+func sharedGlobal(g *Global) (int64, *Global, error) {
+	if !g.Mutable {
+		return g.Get(), nil, nil
+	}
+	return g.Get(), g, nil
+}
+
+// resolveMemory resolves a memory import, checking that the memory matches
+// the sharing, the address width and the limits declared by the module.
+func resolveMemory(imp wasm.ImportEntry, memType compiler.MemoryType, r MemoryResolver) (mem *Memory, err error) {
+	defer catchImportError(&err)
+
+	if mem = r.ResolveMemory(imp.ModuleName, imp.FieldName); mem == nil {
+		return nil, ErrImportNotFound
+	}
+
+	if memType.Shared && !mem.Shared {
+		return nil, fmt.Errorf("%w: module expects a shared memory", ErrSignatureMismatch)
+	} else if !memType.Shared && mem.Shared {
+		return nil, fmt.Errorf("%w: module expects an unshared memory", ErrSignatureMismatch)
+	}
+	if memType.Memory64 && !mem.Is64 {
+		return nil, fmt.Errorf("%w: module expects a 64-bit memory", ErrSignatureMismatch)
+	} else if !memType.Memory64 && mem.Is64 {
+		return nil, fmt.Errorf("%w: module expects a 32-bit memory", ErrSignatureMismatch)
+	}
+
+	if err := checkLimits(memType.Initial, memType.Maximum, memType.HasMaximum, mem.Pages(), mem.MaxPages); err != nil {
+		return nil, err
+	}
+	return mem, nil
+}
+
+// resolveTable resolves a table import, checking that the table matches the
+// element type and the limits declared by the module.
+func resolveTable(imp wasm.ImportEntry, elemType wasm.ValueType, r TableResolver) (t *Table, err error) {
+	defer catchImportError(&err)
+
+	if t = r.ResolveTable(imp.ModuleName, imp.FieldName); t == nil {
+		return nil, ErrImportNotFound
+	}
+
+	if t.isExtern() != (elemType == compiler.ValueTypeExternRef) {
+		return nil, fmt.Errorf("%w: module expects a table of %s, table holds %s", ErrSignatureMismatch, typeName(elemType), typeName(t.elemType()))
+	}
+
+	limits := imp.Type.(wasm.TableImport).Type.Limits
+	if err := checkLimits(uint64(limits.Initial), uint64(limits.Maximum), limits.Flags&1 != 0, t.Size(), t.MaxSize); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// resolveTag resolves a tag import, checking that the tag has the parameters
+// declared by the module.
+func resolveTag(imp compiler.TagImport, params []wasm.ValueType, r TagResolver) (t *Tag, err error) {
+	defer catchImportError(&err)
+
+	if t = r.ResolveTag(imp.ModuleName, imp.FieldName); t == nil {
+		return nil, ErrImportNotFound
+	}
+
+	if !sameTypes(params, t.Params) {
+		return nil, fmt.Errorf("%w: module expects a tag of %s, tag has %s", ErrSignatureMismatch, formatTypes(params), formatTypes(t.Params))
+	}
+	return t, nil
+}
+
+// checkLimits checks that the size and the maximum size, 0 if unbounded, of
+// an imported memory or table satisfy the limits declared by the module.
+func checkLimits(initial, maximum uint64, hasMaximum bool, size, max int) error {
+	if uint64(size) < initial {
+		return fmt.Errorf("%w: size %d is less than the minimum of %d", ErrLimitsMismatch, size, initial)
+	}
+	if hasMaximum && (max == 0 || uint64(max) > maximum) {
+		return fmt.Errorf("%w: maximum exceeds the maximum of %d", ErrLimitsMismatch, maximum)
+	}
+	return nil
+}
+
+// catchImportError turns a panic raised by an import resolver into an error.
+func catchImportError(out *error) {
+	if err := recover(); err != nil {
+		if importErr, ok := err.(*ImportError); ok {
+			*out = importErr.Err
+		} else {
+			*out = unifyTrapCause(err)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package exec_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/perlin-network/life/exec"
+	. "github.com/perlin-network/life/internal/wasmtest"
+)
+
+func TestLinkError(t *testing.T) {
+	imports := exec.NewImports()
+	imports.Module("env").
+		HostFunc("f", func(int64) {}).
+		Global("big", 1<<40).
+		Memory("mem", exec.NewMemory(1, 1))
+
+	m := &Module{
+		Types: [][]byte{FuncType([]byte{I32}, nil)},
+		Imports: []Import{
+			ImportFunc("env", "f", 0),
+			ImportFunc("env", "missing", 0),
+			{Module: "env", Field: "big", Kind: KindGlobal, Desc: []byte{I32, 0}},
+			{Module: "env", Field: "mem", Kind: KindMemory, Desc: Limits(2, -1)},
+		},
+	}
+	_, err := exec.NewVirtualMachine(m.Bytes(), exec.VMConfig{}, imports, nil)
+
+	var linkErr *exec.LinkError
+	if !errors.As(err, &linkErr) {
+		t.Fatalf("expected a link error, got %v", err)
+	}
+	want := []struct {
+		field string
+		err   error
+	}{
+		{"f", exec.ErrSignatureMismatch},
+		{"missing", exec.ErrImportNotFound},
+		{"big", exec.ErrSignatureMismatch},
+		{"mem", exec.ErrLimitsMismatch},
+	}
+	if len(linkErr.Imports) != len(want) {
+		t.Fatalf("%d imports reported: %v", len(linkErr.Imports), err)
+	}
+	for i, w := range want {
+		if imp := linkErr.Imports[i]; imp.ModuleName != "env" || imp.FieldName != w.field || !errors.Is(imp, w.err) {
+			t.Errorf("import %d reported as %v", i, imp)
+		}
+	}
+	if msg := err.Error(); !strings.HasPrefix(msg, "link error: import env.f: signature mismatch: module expects (i32) -> (), host function has (i64) -> ()") {
+		t.Errorf("reported as %q", msg)
+	}
+}
+
+// switchResolver resolves the function imports it knows, and panics for the
+// others like the resolvers predating the Imports registry.
+type switchResolver struct{}
+
+func (switchResolver) ResolveFunc(module, field string) exec.FunctionImport {
+	switch field {
+	case "one":
+		return func(vm *exec.VirtualMachine) int64 { return 1 }
+	}
+	panic(fmt.Errorf("unknown import %s.%s", module, field))
+}
+
+func (switchResolver) ResolveGlobal(module, field string) int64 {
+	panic(fmt.Errorf("unknown import %s.%s", module, field))
+}
+
+func TestLazyImports(t *testing.T) {
+	m := &Module{
+		Types:   [][]byte{FuncType(nil, []byte{I32})},
+		Imports: []Import{ImportFunc("env", "one", 0), ImportFunc("env", "two", 0)},
+		Funcs:   []Func{{Type: 0, Body: Call(0)}, {Type: 0, Body: Call(1)}},
+		Exports: [][]byte{Export("one", KindFunc, 2), Export("two", KindFunc, 3)},
+	}
+
+	// Panics of resolvers are reported as import errors.
+	_, err := exec.NewVirtualMachine(m.Bytes(), exec.VMConfig{}, switchResolver{}, nil)
+	var linkErr *exec.LinkError
+	if !errors.As(err, &linkErr) || len(linkErr.Imports) != 1 || linkErr.Imports[0].FieldName != "two" {
+		t.Fatalf("expected env.two to be reported, got %v", err)
+	}
+
+	vm, err := exec.NewVirtualMachine(m.Bytes(), exec.VMConfig{LazyImports: true}, switchResolver{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	one, _ := vm.GetFunctionExport("one")
+	if ret, err := vm.Run(one); err != nil || ret != 1 {
+		t.Fatalf("got %d, %v", ret, err)
+	}
+	two, _ := vm.GetFunctionExport("two")
+	if _, err := vm.Run(two); err == nil {
+		t.Fatal("unresolved import called")
+	}
+}
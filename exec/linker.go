@@ -0,0 +1,326 @@
+package exec
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-interpreter/wagon/wasm"
+	"github.com/perlin-network/life/compiler"
+	"github.com/perlin-network/life/utils"
+)
+
+var _ HostFunctionResolver = (*Linker)(nil)
+var _ ImportProvider = (*Linker)(nil)
+var _ GlobalResolver = (*Linker)(nil)
+var _ MemoryResolver = (*Linker)(nil)
+var _ TableResolver = (*Linker)(nil)
+var _ TagResolver = (*Linker)(nil)
+
+// errReentrantCall is the cause of traps raised when calling into an
+// AOT-compiled instance which is already running.
+var errReentrantCall = errors.New("re-entrant call into a running instance")
+
+// Linker is a store of named module instances. As an import resolver, it
+// resolves imports from a registered instance against the exports of that
+// instance, and all other imports against its host imports.
+//
+// Calls to functions of other instances, either through function imports or
+// shared tables, run the callee on its own virtual machine until it returns.
+// A call into an instance which is already running, such as a callback into
+// the caller of the current instance, runs on top of its ongoing call. Calls
+// into AOT-compiled instances which are already running trap.
+type Linker struct {
+	host      *Imports
+	instances map[string]*VirtualMachine
+}
+
+// NewLinker creates a linker without any instances or host imports.
+func NewLinker() *Linker {
+	return &Linker{
+		host:      NewImports(),
+		instances: make(map[string]*VirtualMachine),
+	}
+}
+
+// Host returns the registry of host imports of the linker.
+func (l *Linker) Host() *Imports {
+	return l.host
+}
+
+// Register makes the exports of vm available to other modules under the
+// module name `name`, replacing any instance previously registered under it.
+func (l *Linker) Register(name string, vm *VirtualMachine) {
+	l.instances[name] = vm
+}
+
+// Instance returns the instance registered under the given name.
+func (l *Linker) Instance(name string) (*VirtualMachine, bool) {
+	vm, ok := l.instances[name]
+	return vm, ok
+}
+
+// Instantiate creates a virtual machine for a given WebAssembly module with
+// its imports resolved by the linker, and registers it under the module name
+// `name` unless it is empty.
+func (l *Linker) Instantiate(
+	name string,
+	code []byte,
+	config VMConfig,
+	gasPolicy compiler.GasPolicy,
+) (_retVM *VirtualMachine, retErr error) {
+	m, err := NewModule(code, config, l, gasPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	defer utils.CatchPanic(&retErr)
+
+	vm := m.NewVirtualMachine()
+	if name != "" {
+		l.Register(name, vm)
+	}
+	return vm, nil
+}
+
+func (l *Linker) resolveInstance(module string) *VirtualMachine {
+	return l.instances[module]
+}
+
+// HasImport tells whether the linker provides an import of the given kind.
+func (l *Linker) HasImport(module, field string, kind wasm.External) bool {
+	if vm, ok := l.instances[module]; ok {
+		_, ok := vm.getExport(field, kind)
+		return ok
+	}
+	return l.host.HasImport(module, field, kind)
+}
+
+func (l *Linker) ResolveFunc(module, field string) FunctionImport {
+	if vm, ok := l.instances[module]; ok {
+		functionID, ok := vm.GetFunctionExport(field)
+		if !ok {
+			panic(&ImportError{ModuleName: module, FieldName: field, Err: ErrImportNotFound})
+		}
+		return vm.exportedFunction(functionID)
+	}
+	return l.host.ResolveFunc(module, field)
+}
+
+func (l *Linker) ResolveHostFunction(module, field string) *HostFunction {
+	if _, ok := l.instances[module]; ok {
+		return nil
+	}
+	return l.host.ResolveHostFunction(module, field)
+}
+
+func (l *Linker) ResolveGlobal(module, field string) int64 {
+	if vm, ok := l.instances[module]; ok {
+		globalID, ok := vm.GetGlobalExport(field)
+		if !ok {
+			panic(&ImportError{ModuleName: module, FieldName: field, Err: ErrImportNotFound})
+		}
+		return vm.GlobalVar(globalID).Get()
+	}
+	return l.host.ResolveGlobal(module, field)
+}
+
+func (l *Linker) ResolveGlobalVar(module, field string) *Global {
+	if vm, ok := l.instances[module]; ok {
+		g, _ := vm.GetGlobalVarExport(field)
+		return g
+	}
+	return l.host.ResolveGlobalVar(module, field)
+}
+
+func (l *Linker) ResolveMemory(module, field string) *Memory {
+	if vm, ok := l.instances[module]; ok {
+		mem, _ := vm.GetMemoryExport(field)
+		return mem
+	}
+	return l.host.ResolveMemory(module, field)
+}
+
+func (l *Linker) ResolveTable(module, field string) *Table {
+	if vm, ok := l.instances[module]; ok {
+		t, _ := vm.GetTableExport(field)
+		return t
+	}
+	return l.host.ResolveTable(module, field)
+}
+
+func (l *Linker) ResolveTag(module, field string) *Tag {
+	if vm, ok := l.instances[module]; ok {
+		t, _ := vm.GetTagExport(field)
+		return t
+	}
+	return l.host.ResolveTag(module, field)
+}
+
+// functionSig returns the signature of a function of m, or nil if there is
+// no such function.
+func functionSig(m *wasm.Module, functionID int) *wasm.FunctionSig {
+	if functionID < 0 {
+		return nil
+	}
+
+	if m.Import != nil {
+		for _, imp := range m.Import.Entries {
+			if fi, ok := imp.Type.(wasm.FuncImport); ok {
+				if functionID == 0 {
+					return &m.Types.Entries[fi.Type]
+				}
+				functionID--
+			}
+		}
+	}
+
+	if functionID >= len(m.FunctionIndexSpace) {
+		return nil
+	}
+	return m.FunctionIndexSpace[functionID].Sig
+}
+
+// globalType returns the type of a global of m.
+func globalType(m *wasm.Module, globalID int) wasm.GlobalVar {
+	if m.Import != nil {
+		for _, imp := range m.Import.Entries {
+			if gi, ok := imp.Type.(wasm.GlobalVarImport); ok {
+				if globalID == 0 {
+					return gi.Type
+				}
+				globalID--
+			}
+		}
+	}
+	return m.GlobalIndexSpace[globalID].Type
+}
+
+// exportedFunction returns a function import calling the function
+// `functionID` of vm.
+func (vm *VirtualMachine) exportedFunction(functionID int) FunctionImport {
+	numParams := vm.FunctionCode[functionID].NumParams
+
+	return func(caller *VirtualMachine) int64 {
+		return vm.invoke(caller, functionID, caller.GetCurrentFrame().Locals[:numParams])
+	}
+}
+
+// invoke runs the function `functionID` of vm on behalf of another virtual
+// machine, forwarding traps and exits to the caller. Uncaught exceptions are
+// thrown into the caller.
+func (vm *VirtualMachine) invoke(caller *VirtualMachine, functionID int, params []int64) int64 {
+	if vm.CurrentFrame != -1 || vm.InsideExecute {
+		if vm.AOTService != nil {
+			panic(&Trap{Kind: TrapHostFunction, Err: errReentrantCall})
+		}
+		defer vm.resumeCall(vm.suspendCall())
+	}
+
+	// References are translated between the handles of both instances.
+	sig := functionSig(vm.Module.Base, functionID)
+	if sig != nil {
+		params = translateRefs(caller, vm, compiler.SlotTypes(sig.ParamTypes), params)
+	}
+
+	var ret int64
+	var err error
+	if caller.ctx != nil {
+		ret, err = vm.RunContext(caller.ctx, functionID, params...)
+	} else {
+		ret, err = vm.Run(functionID, params...)
+	}
+
+	if err == nil {
+		// Pass the other results of the callee on to the caller.
+		if sig != nil && len(sig.ReturnTypes) > 0 {
+			types := compiler.SlotTypes(sig.ReturnTypes)
+			ret = translateRef(vm, caller, types[0], ret)
+			for i := 1; i < len(types); i++ {
+				caller.setYieldedValue(i, translateRef(vm, caller, types[i], vm.yieldedValue(i)))
+			}
+		}
+		return ret
+	}
+
+	// Leave the callee ready to be called again.
+	vm.unwind()
+
+	if t, ok := err.(*Trap); ok {
+		if exc, ok := t.Err.(*Exception); ok && t.Kind == TrapUncaughtException {
+			panic(&Exception{Tag: exc.Tag, Payload: translateRefs(vm, caller, compiler.SlotTypes(exc.Tag.Params), exc.Payload)})
+		}
+		panic(&Trap{Kind: t.Kind, Err: t.Err, callee: t.Stack})
+	}
+	panic(err)
+}
+
+// callState is the state of the ongoing call of a virtual machine, saved while
+// it runs a nested call.
+type callState struct {
+	callStack        []Frame
+	currentFrame     int
+	insideExecute    bool
+	delegate         func()
+	exited           bool
+	returnValue      int64
+	yieldedValues    []int64
+	budgetExhausted  bool
+	gasLimitExceeded bool
+	ctx              context.Context
+	exception        *Exception
+	thrown           *Exception
+	thrownIP         int
+}
+
+// suspendCall saves the state of the ongoing call of vm, and leaves vm ready
+// to run another call whose frames are pushed on top of those of the ongoing
+// call.
+func (vm *VirtualMachine) suspendCall() *callState {
+	s := &callState{
+		callStack:        vm.CallStack,
+		currentFrame:     vm.CurrentFrame,
+		insideExecute:    vm.InsideExecute,
+		delegate:         vm.Delegate,
+		exited:           vm.Exited,
+		returnValue:      vm.ReturnValue,
+		yieldedValues:    vm.YieldedValues,
+		budgetExhausted:  vm.BudgetExhausted,
+		gasLimitExceeded: vm.GasLimitExceeded,
+		ctx:              vm.ctx,
+		exception:        vm.exception,
+		thrown:           vm.thrown,
+		thrownIP:         vm.thrownIP,
+	}
+
+	vm.CallStack = vm.CallStack[vm.CurrentFrame+1:]
+	vm.callStackBase += vm.CurrentFrame + 1
+	vm.CurrentFrame = -1
+	vm.InsideExecute = false
+	vm.Delegate = nil
+	vm.YieldedValues = append([]int64(nil), vm.YieldedValues...)
+	vm.exception, vm.thrown = nil, nil
+	return s
+}
+
+// resumeCall restores the state of a call saved by suspendCall once the
+// nested call has returned or been unwound.
+func (vm *VirtualMachine) resumeCall(s *callState) {
+	vm.callStackBase -= s.currentFrame + 1
+	vm.CallStack = s.callStack
+	vm.CurrentFrame = s.currentFrame
+	vm.InsideExecute = s.insideExecute
+	vm.Delegate = s.delegate
+	vm.Exited = s.exited
+	vm.ExitError = nil
+	vm.ReturnValue = s.returnValue
+	vm.YieldedValues = s.yieldedValues
+	vm.BudgetExhausted = s.budgetExhausted
+	vm.GasLimitExceeded = s.gasLimitExceeded
+	vm.ctx = s.ctx
+	vm.exception, vm.thrown, vm.thrownIP = s.exception, s.thrown, s.thrownIP
+
+	// The nested call clears interruption requests when it returns.
+	if vm.ctx != nil && vm.ctx.Err() != nil {
+		vm.setInterrupted(true)
+	}
+}
@@ -0,0 +1,170 @@
+package exec_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/perlin-network/life/exec"
+	. "github.com/perlin-network/life/internal/wasmtest"
+)
+
+// libModule exports add(a, b), id(externref) and boom(), which traps.
+func libModule() []byte {
+	m := &Module{
+		Types: [][]byte{
+			FuncType([]byte{I32, I32}, []byte{I32}),
+			FuncType([]byte{ExternRef}, []byte{ExternRef}),
+			FuncType(nil, nil),
+		},
+		Funcs: []Func{
+			{Type: 0, Body: Cat(LocalGet(0), LocalGet(1), []byte{0x6a})},
+			{Type: 1, Body: LocalGet(0)},
+			{Type: 2, Body: []byte{0x00}},
+		},
+		Exports: [][]byte{Export("add", KindFunc, 0), Export("id", KindFunc, 1), Export("boom", KindFunc, 2)},
+	}
+	return m.Bytes()
+}
+
+// appModule imports the functions of libModule from "lib" and exports
+// functions forwarding to them.
+func appModule() []byte {
+	m := &Module{
+		Types: [][]byte{
+			FuncType([]byte{I32, I32}, []byte{I32}),
+			FuncType([]byte{ExternRef}, []byte{ExternRef}),
+			FuncType(nil, nil),
+		},
+		Imports: []Import{ImportFunc("lib", "add", 0), ImportFunc("lib", "id", 1), ImportFunc("lib", "boom", 2)},
+		Funcs: []Func{
+			{Type: 0, Body: Cat(LocalGet(0), LocalGet(1), Call(0))},
+			{Type: 1, Body: Cat(LocalGet(0), Call(1))},
+			{Type: 2, Body: Call(2)},
+		},
+		Exports: [][]byte{Export("add", KindFunc, 3), Export("id", KindFunc, 4), Export("boom", KindFunc, 5)},
+	}
+	return m.Bytes()
+}
+
+func TestLinker(t *testing.T) {
+	l := exec.NewLinker()
+	lib, err := l.Instantiate("lib", libModule(), exec.VMConfig{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, err := l.Instantiate("", appModule(), exec.VMConfig{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vm, ok := l.Instance("lib"); !ok || vm != lib {
+		t.Fatal("instance not registered")
+	}
+	if _, ok := l.Instance(""); ok {
+		t.Fatal("unnamed instance registered")
+	}
+
+	if v := run(t, app, "add", 40, 2); v != 42 {
+		t.Fatalf("got %d", v)
+	}
+
+	// References are translated between the handles of both instances.
+	lib.ExternRef("taken")
+	ref := app.ExternRef("hello")
+	if v := app.Extern(run(t, app, "id", ref)); v != "hello" {
+		t.Fatalf("got %v", v)
+	}
+
+	// Traps in the callee report the stacks of both instances: boom of lib,
+	// then the import of boom and boom of app.
+	entry, _ := app.GetFunctionExport("boom")
+	_, err = app.Run(entry)
+	trap, ok := err.(*exec.Trap)
+	if !ok || trap.Kind != exec.TrapUnreachable {
+		t.Fatalf("expected an unreachable trap, got %v", err)
+	}
+	if len(trap.Stack) != 3 || trap.Stack[0].FunctionID != 2 || trap.Stack[2].FunctionID != 5 {
+		t.Fatalf("trap raised with the stack\n%s", trap.StackTrace())
+	}
+
+	// The callee may be called again.
+	if v := run(t, lib, "add", 1, 2); v != 3 {
+		t.Fatalf("got %d", v)
+	}
+}
+
+func TestLinkerReentrantCall(t *testing.T) {
+	l := exec.NewLinker()
+
+	// core.ping(n) returns pong(n-1) + 1 unless n is zero, pong being the
+	// function in slot 0 of its table. plugin stores its function there,
+	// which calls back into core.ping.
+	core := &Module{
+		Types:  [][]byte{FuncType([]byte{I32}, []byte{I32})},
+		Tables: [][]byte{Cat([]byte{FuncRef}, Limits(1, 1))},
+		Funcs: []Func{{Type: 0, Body: Cat(
+			LocalGet(0), []byte{0x45, 0x04, 0x7f}, // i32.eqz, if (result i32)
+			I32Const(0),
+			// else
+			[]byte{0x05},
+			LocalGet(0), I32Const(1), []byte{0x6b}, I32Const(0), []byte{0x11, 0x00, 0x00}, // call_indirect
+			I32Const(1), []byte{0x6a},
+			[]byte{0x0b},
+		)}},
+		Exports: [][]byte{Export("ping", KindFunc, 0), Export("table", KindTable, 0)},
+	}
+	plugin := &Module{
+		Types: [][]byte{FuncType([]byte{I32}, []byte{I32})},
+		Imports: []Import{
+			ImportFunc("core", "ping", 0),
+			{Module: "core", Field: "table", Kind: KindTable, Desc: Cat([]byte{FuncRef}, Limits(1, 1))},
+		},
+		Funcs: []Func{{Type: 0, Body: Cat(LocalGet(0), Call(0))}},
+		Elems: [][]byte{Cat([]byte{0}, I32Const(0), []byte{0x0b}, Vec(U(1)))},
+	}
+	coreVM, err := l.Instantiate("core", core.Bytes(), exec.VMConfig{MaxCallStackDepth: 4}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Instantiate("plugin", plugin.Bytes(), exec.VMConfig{}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if ret := run(t, coreVM, "ping", 3); ret != 3 {
+		t.Fatalf("got %d", ret)
+	}
+	// Nested calls leave the instance ready to be called again.
+	if ret := run(t, coreVM, "ping", 2); ret != 2 {
+		t.Fatalf("got %d", ret)
+	}
+
+	// The frames of nested calls count towards the call stack depth of the
+	// instance.
+	entry, _ := coreVM.GetFunctionExport("ping")
+	_, err = coreVM.Run(entry, 4)
+	if trap, ok := err.(*exec.Trap); !ok || trap.Kind != exec.TrapCallStackExhausted {
+		t.Fatalf("expected the call stack to be exhausted, got %v", err)
+	}
+}
+
+func TestLinkerErrors(t *testing.T) {
+	l := exec.NewLinker()
+	if _, err := l.Instantiate("lib", libModule(), exec.VMConfig{}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Module{
+		Types:   [][]byte{FuncType([]byte{I64}, nil), FuncType(nil, nil)},
+		Imports: []Import{ImportFunc("lib", "add", 0), ImportFunc("lib", "missing", 1), ImportFunc("other", "f", 1)},
+	}
+	_, err := l.Instantiate("", m.Bytes(), exec.VMConfig{}, nil)
+
+	var linkErr *exec.LinkError
+	if !errors.As(err, &linkErr) || len(linkErr.Imports) != 3 {
+		t.Fatalf("expected 3 import errors, got %v", err)
+	}
+	for i, cause := range []error{exec.ErrSignatureMismatch, exec.ErrImportNotFound, exec.ErrImportNotFound} {
+		if !errors.Is(linkErr.Imports[i], cause) {
+			t.Errorf("import %d reported as %v", i, linkErr.Imports[i])
+		}
+	}
+}
@@ -0,0 +1,619 @@
+package exec
+
+import (
+	"math"
+	"sync"
+
+	"github.com/go-interpreter/wagon/wasm"
+	"github.com/perlin-network/life/compiler"
+)
+
+// MaxMemoryPages is the number of pages of the largest 32-bit linear memory.
+const MaxMemoryPages = 65536
+
+// MaxMemory64Pages is the number of pages of the largest 64-bit linear memory.
+const MaxMemory64Pages = 1 << 48
+
+// NullElement denotes an empty table slot.
+const NullElement = math.MaxUint32
+
+// Memory is a linear memory which may be imported and exported by virtual
+// machines, and so be shared between them and the host.
+//
+// VirtualMachine.Memory is a view of the first memory of a virtual machine,
+// which is refreshed whenever the memory is grown by another virtual machine,
+// and the other memories, as introduced by the multi-memory proposal, are
+// returned by VirtualMachine.MemoryAt. Bytes must not be reassigned while a
+// virtual machine using the memory runs. Memories are not shared with
+// AOT-compiled code, which uses a private copy.
+//
+// Shared memories, as introduced by the threads proposal, may moreover be used
+// by virtual machines running on separate goroutines, which synchronize through
+// atomic instructions. Their bytes never move: growing them extends Bytes
+// within its capacity, and virtual machines observe the growth at their next
+// atomic instruction, memory.size or memory.grow, taking a view of Bytes under
+// the lock of the memory. Bytes itself must not be accessed by the host while
+// virtual machines run. Non-atomic accesses run on these views: as in the
+// threads proposal, those of concurrent virtual machines to the same bytes
+// race unless ordered by atomic instructions, and are reported by the race
+// detector.
+//
+// 64-bit memories, as introduced by the memory64 proposal, are indexed by i64
+// addresses and may grow beyond 4GiB.
+type Memory struct {
+	Bytes    []byte
+	MaxPages int // 0 if unbounded
+	Shared   bool
+	Is64     bool
+
+	mu      sync.Mutex           // serializes atomic accesses and growth of shared memories
+	waiters map[uint64][]*waiter // waiters of memory.atomic.wait by address, oldest first
+}
+
+// waiter is a virtual machine suspended by memory.atomic.wait.
+type waiter struct {
+	woken chan struct{}
+}
+
+// NewMemory allocates a zeroed linear memory of `pages` pages.
+func NewMemory(pages, maxPages int) *Memory {
+	return &Memory{
+		Bytes:    make([]byte, pages*DefaultPageSize),
+		MaxPages: maxPages,
+	}
+}
+
+// NewMemory64 allocates a zeroed 64-bit linear memory of `pages` pages.
+func NewMemory64(pages, maxPages int) *Memory {
+	mem := NewMemory(pages, maxPages)
+	mem.Is64 = true
+	return mem
+}
+
+// NewSharedMemory allocates a zeroed shared memory of `pages` pages, reserving
+// the space of `maxPages` pages, which shared memories must have.
+func NewSharedMemory(pages, maxPages int) *Memory {
+	if maxPages <= 0 || pages > maxPages {
+		panic("invalid maximum size of shared memory")
+	}
+	return &Memory{
+		Bytes:    make([]byte, pages*DefaultPageSize, maxPages*DefaultPageSize),
+		MaxPages: maxPages,
+		Shared:   true,
+	}
+}
+
+// Pages returns the current size of the memory in pages.
+func (m *Memory) Pages() int {
+	return len(m.view()) / DefaultPageSize
+}
+
+// view returns the bytes of the memory, locking shared memories as they may
+// be grown concurrently.
+func (m *Memory) view() []byte {
+	if !m.Shared {
+		return m.Bytes
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.Bytes
+}
+
+// Grow grows the memory by n pages, returning its previous size in pages, or
+// -1 if the memory cannot be grown.
+func (m *Memory) Grow(n int) int {
+	return m.grow(n, 0)
+}
+
+// grow is like Grow but also enforces a limit imposed by the growing virtual
+// machine.
+func (m *Memory) grow(n int, limit int) int {
+	if m.Shared {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+	}
+
+	current := len(m.Bytes) / DefaultPageSize
+	if n < 0 || int64(n) > m.maxPages(limit)-int64(current) {
+		return -1
+	}
+	next := current + n
+
+	if m.Shared {
+		// Virtual machines running concurrently keep using the bytes.
+		if next*DefaultPageSize > cap(m.Bytes) {
+			return -1
+		}
+		m.Bytes = m.Bytes[:next*DefaultPageSize]
+		return current
+	}
+
+	m.Bytes = append(m.Bytes, make([]byte, n*DefaultPageSize)...)
+	return current
+}
+
+// maxPages returns the size in pages the memory may be grown to, under the
+// limit imposed by the growing virtual machine if not 0.
+func (m *Memory) maxPages(limit int) int64 {
+	max := int64(MaxMemoryPages)
+	if m.Is64 {
+		max = MaxMemory64Pages
+	}
+	if m.MaxPages != 0 && int64(m.MaxPages) < max {
+		max = int64(m.MaxPages)
+	}
+	if limit != 0 && int64(limit) < max {
+		max = int64(limit)
+	}
+	return max
+}
+
+// Notify wakes up at most count of the virtual machines waiting on the address
+// addr of a shared memory through memory.atomic.wait, the ones waiting for the
+// longest first, and returns the number of virtual machines woken up.
+func (m *Memory) Notify(addr uint32, count uint32) int {
+	if !m.Shared {
+		return 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.notify(uint64(addr), count)
+}
+
+// notify is like Notify, the memory being locked.
+func (m *Memory) notify(addr uint64, count uint32) int {
+	queue := m.waiters[addr]
+	n := len(queue)
+	if uint64(count) < uint64(n) {
+		n = int(count)
+	}
+
+	for _, w := range queue[:n] {
+		close(w.woken)
+	}
+	if n == len(queue) {
+		delete(m.waiters, addr)
+	} else {
+		m.waiters[addr] = queue[n:]
+	}
+	return n
+}
+
+// addWaiter registers a waiter on the address addr of the memory, which is
+// locked.
+func (m *Memory) addWaiter(addr uint64) *waiter {
+	w := &waiter{woken: make(chan struct{})}
+	if m.waiters == nil {
+		m.waiters = make(map[uint64][]*waiter)
+	}
+	m.waiters[addr] = append(m.waiters[addr], w)
+	return w
+}
+
+// removeWaiter unregisters the waiter w on the address addr, returning false
+// if it has been woken up in the meantime.
+func (m *Memory) removeWaiter(addr uint64, w *waiter) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	queue := m.waiters[addr]
+	for i, other := range queue {
+		if other == w {
+			queue = append(queue[:i:i], queue[i+1:]...)
+			if len(queue) == 0 {
+				delete(m.waiters, addr)
+			} else {
+				m.waiters[addr] = queue
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// Table is a table of references which may be imported and exported by
+// virtual machines, and so be shared between them and the host.
+//
+// Elements of funcref tables are indices into the function index space of
+// the virtual machine owning the table, or NullElement for empty slots.
+// Elements of tables created by the host refer to the functions of the
+// virtual machine calling through them. Functions of other instances are
+// stored with SetFunction; element segments of modules importing a table do
+// so implicitly.
+//
+// Elements of externref tables are held by Externs, nil for empty slots.
+//
+// Tables are not shared with AOT-compiled code, which embeds their contents
+// at compile time.
+type Table struct {
+	Elements []uint32
+	Externs  []interface{} // elements of externref tables
+	ElemType wasm.ValueType
+	MaxSize  int // 0 if unbounded
+
+	owner  *VirtualMachine   // instance the elements refer to, if any
+	owners []*VirtualMachine // instances single elements refer to instead of owner
+}
+
+// NewTable allocates a funcref table of `size` empty slots.
+func NewTable(size, maxSize int) *Table {
+	elems := make([]uint32, size)
+	for i := range elems {
+		elems[i] = NullElement
+	}
+	return &Table{
+		Elements: elems,
+		ElemType: compiler.ValueTypeFuncRef,
+		MaxSize:  maxSize,
+	}
+}
+
+// NewExternTable allocates an externref table of `size` empty slots.
+func NewExternTable(size, maxSize int) *Table {
+	return &Table{
+		Externs:  make([]interface{}, size),
+		ElemType: compiler.ValueTypeExternRef,
+		MaxSize:  maxSize,
+	}
+}
+
+// isExtern tells whether t is an externref table. Tables of other element
+// types are funcref tables.
+func (t *Table) isExtern() bool {
+	return t.ElemType == compiler.ValueTypeExternRef
+}
+
+// elemType returns the element type of t.
+func (t *Table) elemType() wasm.ValueType {
+	if t.isExtern() {
+		return compiler.ValueTypeExternRef
+	}
+	return compiler.ValueTypeFuncRef
+}
+
+// Size returns the number of slots of the table.
+func (t *Table) Size() int {
+	if t.isExtern() {
+		return len(t.Externs)
+	}
+	return len(t.Elements)
+}
+
+// Grow grows the table by n empty slots, returning its previous size, or -1
+// if the table cannot be grown.
+func (t *Table) Grow(n int) int {
+	return t.grow(n, 0)
+}
+
+// grow is like Grow but also enforces a limit imposed by the growing virtual
+// machine.
+func (t *Table) grow(n int, limit int) int {
+	current := t.Size()
+	next := current + n
+
+	if n < 0 || next > math.MaxUint32 ||
+		(t.MaxSize != 0 && next > t.MaxSize) ||
+		(limit != 0 && next > limit) {
+		return -1
+	}
+
+	if t.isExtern() {
+		t.Externs = append(t.Externs, make([]interface{}, n)...)
+		return current
+	}
+
+	elems := make([]uint32, n)
+	for i := range elems {
+		elems[i] = NullElement
+	}
+	t.Elements = append(t.Elements, elems...)
+	return current
+}
+
+// SetFunction stores the function `functionID` of the virtual machine vm in
+// the slot i.
+func (t *Table) SetFunction(i int, vm *VirtualMachine, functionID int) {
+	t.Elements[i] = uint32(functionID)
+	t.setOwner(i, vm)
+}
+
+func (t *Table) setOwner(i int, vm *VirtualMachine) {
+	if vm == t.owner {
+		if i < len(t.owners) {
+			t.owners[i] = nil
+		}
+		return
+	}
+
+	if len(t.owners) < len(t.Elements) {
+		owners := make([]*VirtualMachine, len(t.Elements))
+		copy(owners, t.owners)
+		t.owners = owners
+	}
+	t.owners[i] = vm
+}
+
+// ownerOf returns the virtual machine the element i refers to, or nil for
+// the calling one.
+func (t *Table) ownerOf(i int) *VirtualMachine {
+	if i < len(t.owners) && t.owners[i] != nil {
+		return t.owners[i]
+	}
+	return t.owner
+}
+
+// sameView tells whether a and b view the same bytes.
+func sameView(a, b []byte) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
+func sameElements(a, b []uint32) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
+// syncMemory reconciles vm.Memory with the first memory object of the
+// virtual machine, and refreshes the views of the other memories. Views
+// reassigned by host code, e.g. when restoring a snapshot, replace the
+// contents of the memory object, unless it is shared.
+func (vm *VirtualMachine) syncMemory() {
+	for i := 1; i < len(vm.memories); i++ {
+		vm.memoryViews[i] = vm.memories[i].view()
+	}
+
+	if vm.memory == nil {
+		vm.memory = &Memory{Bytes: vm.Memory}
+	} else if vm.memory.Shared {
+		vm.Memory = vm.memory.view()
+		vm.memoryView = vm.Memory
+		return
+	} else if !sameView(vm.Memory, vm.memoryView) {
+		vm.memory.Bytes = vm.Memory
+	}
+	vm.Memory = vm.memory.Bytes
+	vm.memoryView = vm.Memory
+}
+
+// syncTable reconciles vm.Table with the table object of the virtual machine.
+func (vm *VirtualMachine) syncTable() {
+	if vm.table == nil {
+		vm.table = &Table{Elements: vm.Table}
+	} else if !sameElements(vm.Table, vm.tableView) {
+		vm.table.Elements = vm.Table
+	}
+	vm.Table = vm.table.Elements
+	vm.tableView = vm.Table
+}
+
+// growMemory grows the memory of index i of the virtual machine by n pages.
+func (vm *VirtualMachine) growMemory(i int, n int) int {
+	prev := vm.MemoryAt(i).grow(n, vm.Config.MaxMemoryPages)
+	vm.syncMemory()
+	return prev
+}
+
+// MemoryLimit returns the size in pages the memory of index i may be grown to
+// by the virtual machine.
+func (vm *VirtualMachine) MemoryLimit(i int) int64 {
+	return vm.MemoryAt(i).maxPages(vm.Config.MaxMemoryPages)
+}
+
+// LinearMemory returns the first memory of the virtual machine.
+func (vm *VirtualMachine) LinearMemory() *Memory {
+	vm.syncMemory()
+	return vm.memory
+}
+
+// MemoryAt returns the memory of index i of the virtual machine.
+func (vm *VirtualMachine) MemoryAt(i int) *Memory {
+	if i == 0 {
+		return vm.LinearMemory()
+	}
+	return vm.memories[i]
+}
+
+// memoryAt returns the view of the memory of index i.
+func (vm *VirtualMachine) memoryAt(i uint32) []byte {
+	if i == 0 {
+		return vm.Memory
+	}
+	return vm.memoryViews[i]
+}
+
+// address returns the address of an operand of an instruction accessing the
+// memory of index i, 32-bit memories using the low 32 bits of the operand.
+func (vm *VirtualMachine) address(i uint32, v int64) uint64 {
+	if vm.memories[i].Is64 {
+		return uint64(v)
+	}
+	return uint64(uint32(v))
+}
+
+// effectiveAddress returns the view of the memory of index i and the
+// effective address base+offset of an access of n bytes to it, trapping if
+// the access is out of bounds.
+func (vm *VirtualMachine) effectiveAddress(i uint32, base int64, offset uint64, n int) ([]byte, int) {
+	mem := vm.memoryAt(i)
+	addr := vm.address(i, base)
+	effective := addr + offset
+	if effective < addr || !inBounds64(effective, uint64(n), len(mem)) {
+		panic(&Trap{Kind: TrapMemoryOutOfBounds})
+	}
+	return mem, int(effective)
+}
+
+// memoryAccess decodes the memory index, offset and base address operand of
+// the load or store at frame.IP, and returns the n bytes it accesses.
+func (vm *VirtualMachine) memoryAccess(frame *Frame, n int) []byte {
+	code := frame.Code[frame.IP : frame.IP+16]
+	frame.IP += 16
+
+	mem, effective := vm.effectiveAddress(LE.Uint32(code[0:4]), frame.Regs[int(LE.Uint32(code[12:16]))], LE.Uint64(code[4:12]), n)
+	return mem[effective : effective+n]
+}
+
+// FunctionTable returns the first table of the virtual machine.
+func (vm *VirtualMachine) FunctionTable() *Table {
+	vm.syncTable()
+	return vm.table
+}
+
+// TableAt returns the table of index i of the virtual machine.
+func (vm *VirtualMachine) TableAt(i int) *Table {
+	if i == 0 {
+		return vm.FunctionTable()
+	}
+	return vm.tables[i]
+}
+
+// newMemories creates the memories of a module instance, the imported ones
+// followed by the ones it declares. Imported memories which are not nil are
+// shared, and the others are allocated anew with `importedPages` pages.
+func newMemories(m *compiler.Module, config VMConfig, imported []*Memory, importedPages []int) []*Memory {
+	memories := make([]*Memory, len(m.MemoryTypes))
+	for i, t := range m.MemoryTypes {
+		if i < len(imported) && imported[i] != nil {
+			memories[i] = imported[i]
+			continue
+		}
+
+		pages := int(t.Initial)
+		if i < len(importedPages) {
+			pages = importedPages[i]
+		}
+		if config.MaxMemoryPages != 0 && pages > config.MaxMemoryPages {
+			panic("max memory exceeded")
+		}
+
+		maxPages := 0
+		if t.HasMaximum {
+			maxPages = int(t.Maximum)
+		}
+		if t.Shared {
+			memories[i] = NewSharedMemory(pages, maxPages)
+		} else {
+			memories[i] = NewMemory(pages, maxPages)
+		}
+		memories[i].Is64 = t.Memory64
+	}
+	return memories
+}
+
+// init copies data into the memory at offset, trapping if it does not fit.
+// Shared memories stay locked during the copy, which orders it with respect
+// to the atomic accesses and growth of the virtual machines using them.
+func (m *Memory) init(offset uint64, data []byte) {
+	if m.Shared {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+	}
+	if !inBounds64(offset, uint64(len(data)), len(m.Bytes)) {
+		panic(&Trap{Kind: TrapMemoryOutOfBounds})
+	}
+	copy(m.Bytes[offset:], data)
+}
+
+// initData copies the active data segments of m into their memories.
+func initData(m *compiler.Module, globals []int64, memories []*Memory) {
+	for _, seg := range m.DataSegments {
+		if seg.Offset == nil {
+			continue
+		}
+
+		mem := memories[seg.MemoryIndex]
+		offset := uint64(execInitExpr(seg.Offset, globals))
+		if !mem.Is64 {
+			offset = uint64(uint32(offset))
+		}
+		mem.init(offset, seg.Data)
+	}
+}
+
+// newTables creates the tables of a module instance, the imported ones
+// followed by the ones it declares. Imported tables which are not nil are
+// shared, and the others are allocated anew with `importedSizes` slots.
+func newTables(m *compiler.Module, config VMConfig, imported []*Table, importedSizes []int) []*Table {
+	var limits []wasm.ResizableLimits
+	if m.Base.Import != nil {
+		for _, imp := range m.Base.Import.Entries {
+			if imp.Type.Kind() == wasm.ExternalTable {
+				limits = append(limits, imp.Type.(wasm.TableImport).Type.Limits)
+			}
+		}
+	}
+	if m.Base.Table != nil {
+		for _, t := range m.Base.Table.Entries {
+			limits = append(limits, t.Limits)
+		}
+	}
+
+	tables := make([]*Table, len(limits))
+	for i, l := range limits {
+		if i < len(imported) && imported[i] != nil {
+			tables[i] = imported[i]
+			continue
+		}
+
+		size := int(l.Initial)
+		if i < len(importedSizes) {
+			size = importedSizes[i]
+		}
+		if config.MaxTableSize != 0 && size > config.MaxTableSize {
+			panic("max table size exceeded")
+		}
+
+		maxSize := 0
+		if l.Flags&1 != 0 {
+			maxSize = int(l.Maximum)
+		}
+		if m.TableTypes[i] == compiler.ValueTypeExternRef {
+			tables[i] = NewExternTable(size, maxSize)
+		} else {
+			tables[i] = NewTable(size, maxSize)
+		}
+	}
+	return tables
+}
+
+// initElements copies the active element segments of m into their tables,
+// on behalf of the module instance `instance` if not nil.
+func initElements(m *compiler.Module, globals []int64, tables []*Table, instance *VirtualMachine) {
+	for _, seg := range m.ElemSegments {
+		if seg.Offset == nil {
+			continue
+		}
+
+		t := tables[seg.TableIndex]
+		offset := uint32(execInitExpr(seg.Offset, globals))
+		if !inBounds(offset, uint32(len(seg.Elems)), t.Size()) {
+			panic(&Trap{Kind: TrapTableOutOfBounds})
+		}
+		if t.isExtern() {
+			continue // externref segments only hold null references
+		}
+
+		copy(t.Elements[offset:], seg.Elems)
+		if instance != nil {
+			for i := int(offset); i < int(offset)+len(seg.Elems); i++ {
+				t.setOwner(i, instance)
+			}
+		}
+	}
+}
+
+// GetMemoryExport returns the memory exported with the given name.
+func (vm *VirtualMachine) GetMemoryExport(key string) (*Memory, bool) {
+	index, ok := vm.getExport(key, wasm.ExternalMemory)
+	if !ok {
+		return nil, false
+	}
+	return vm.MemoryAt(index), true
+}
+
+// GetTableExport returns the table exported with the given name.
+func (vm *VirtualMachine) GetTableExport(key string) (*Table, bool) {
+	index, ok := vm.getExport(key, wasm.ExternalTable)
+	if !ok {
+		return nil, false
+	}
+	return vm.TableAt(index), true
+}
@@ -0,0 +1,211 @@
+package exec_test
+
+import (
+	"testing"
+
+	"github.com/perlin-network/life/exec"
+	. "github.com/perlin-network/life/internal/wasmtest"
+)
+
+// memoryModule imports env.mem and exports store(addr, v), load(addr) and
+// grow(n).
+func memoryModule() []byte {
+	m := &Module{
+		Types: [][]byte{
+			FuncType([]byte{I32, I32}, nil),
+			FuncType([]byte{I32}, []byte{I32}),
+		},
+		Imports: []Import{{Module: "env", Field: "mem", Kind: KindMemory, Desc: Limits(1, 3)}},
+		Funcs: []Func{
+			{Type: 0, Body: Cat(LocalGet(0), LocalGet(1), []byte{0x36, 0x02, 0x00})}, // i32.store
+			{Type: 1, Body: Cat(LocalGet(0), []byte{0x28, 0x02, 0x00})},              // i32.load
+			{Type: 1, Body: Cat(LocalGet(0), []byte{0x40, 0x00})},                    // memory.grow
+		},
+		Exports: [][]byte{
+			Export("store", KindFunc, 0), Export("load", KindFunc, 1), Export("grow", KindFunc, 2),
+			Export("memory", KindMemory, 0),
+		},
+	}
+	return m.Bytes()
+}
+
+func run(t *testing.T, vm *exec.VirtualMachine, name string, params ...int64) int64 {
+	t.Helper()
+	entry, ok := vm.GetFunctionExport(name)
+	if !ok {
+		t.Fatalf("no export %s", name)
+	}
+	ret, err := vm.Run(entry, params...)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return ret
+}
+
+func TestSharedMemory(t *testing.T) {
+	mem := exec.NewMemory(1, 3)
+	imports := exec.NewImports()
+	imports.Module("env").Memory("mem", mem)
+
+	var vms [2]*exec.VirtualMachine
+	for i := range vms {
+		vm, err := exec.NewVirtualMachine(memoryModule(), exec.VMConfig{}, imports, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vms[i] = vm
+	}
+
+	run(t, vms[0], "store", 8, 42)
+	if v := run(t, vms[1], "load", 8); v != 42 {
+		t.Fatalf("loaded %d", v)
+	}
+	if v := mem.Bytes[8]; v != 42 {
+		t.Fatalf("host sees %d", v)
+	}
+
+	// Growth by an instance is visible to the others.
+	if prev := run(t, vms[1], "grow", 1); prev != 1 || mem.Pages() != 2 {
+		t.Fatalf("grown from %d to %d pages", prev, mem.Pages())
+	}
+	run(t, vms[0], "store", exec.DefaultPageSize+4, 7)
+	if v := run(t, vms[1], "load", exec.DefaultPageSize+4); v != 7 {
+		t.Fatalf("loaded %d", v)
+	}
+	if exported, ok := vms[0].GetMemoryExport("memory"); !ok || exported != mem {
+		t.Fatal("exported memory is not the imported one")
+	}
+
+	// The maximum size of the memory is enforced.
+	if prev := run(t, vms[0], "grow", 2); prev != -1 || mem.Grow(2) != -1 || mem.Pages() != 2 {
+		t.Fatalf("grown beyond the maximum size to %d pages", mem.Pages())
+	}
+	entry, _ := vms[0].GetFunctionExport("load")
+	if _, err := vms[0].Run(entry, 2*exec.DefaultPageSize); err == nil {
+		t.Fatal("loaded out of bounds")
+	} else if trap, ok := err.(*exec.Trap); !ok || trap.Kind != exec.TrapMemoryOutOfBounds {
+		t.Fatalf("expected an out of bounds access, got %v", err)
+	}
+}
+
+func TestSharedTable(t *testing.T) {
+	table := exec.NewTable(2, 2)
+
+	// The provider stores its function in slot 1 of the table.
+	provider := &Module{
+		Types:   [][]byte{FuncType(nil, []byte{I32})},
+		Imports: []Import{{Module: "env", Field: "table", Kind: KindTable, Desc: Cat([]byte{FuncRef}, Limits(2, 2))}},
+		Funcs:   []Func{{Type: 0, Body: I32Const(42)}},
+		Elems:   [][]byte{Cat([]byte{0}, I32Const(1), []byte{0x0b}, Vec(U(0)))},
+	}
+	caller := &Module{
+		Types:   [][]byte{FuncType(nil, []byte{I32}), FuncType([]byte{I32}, []byte{I32})},
+		Imports: []Import{{Module: "env", Field: "table", Kind: KindTable, Desc: Cat([]byte{FuncRef}, Limits(2, 2))}},
+		Funcs:   []Func{{Type: 1, Body: Cat(LocalGet(0), []byte{0x11, 0x00, 0x00})}}, // call_indirect
+		Exports: [][]byte{Export("call", KindFunc, 0), Export("table", KindTable, 0)},
+	}
+
+	imports := exec.NewImports()
+	imports.Module("env").Table("table", table)
+	if _, err := exec.NewVirtualMachine(provider.Bytes(), exec.VMConfig{}, imports, nil); err != nil {
+		t.Fatal(err)
+	}
+	vm, err := exec.NewVirtualMachine(caller.Bytes(), exec.VMConfig{}, imports, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := run(t, vm, "call", 1); v != 42 {
+		t.Fatalf("called function returned %d", v)
+	}
+	if exported, ok := vm.GetTableExport("table"); !ok || exported != table {
+		t.Fatal("exported table is not the imported one")
+	}
+	if table.Grow(1) != -1 {
+		t.Fatal("table grown beyond its maximum size")
+	}
+
+	entry, _ := vm.GetFunctionExport("call")
+	_, err = vm.Run(entry, 0)
+	if trap, ok := err.(*exec.Trap); !ok || trap.Kind != exec.TrapUndefinedElement {
+		t.Fatalf("expected an undefined element, got %v", err)
+	}
+}
+
+func TestSharedMemoryWaitNotify(t *testing.T) {
+	m := &Module{
+		Types: [][]byte{
+			FuncType(nil, []byte{I32}),
+			FuncType([]byte{I32, I32}, nil),
+			FuncType([]byte{I32}, []byte{I32}),
+		},
+		Imports: []Import{{Module: "env", Field: "mem", Kind: KindMemory, Desc: Cat([]byte{3}, U(1), U(8))}},
+		Funcs: []Func{
+			// Waits on address 0, then returns the value at address 8, or
+			// -1 if the value at address 0 was not 0.
+			{Type: 0, Body: Cat(I32Const(0), I32Const(0), I64Const(-1), []byte{0xfe, 0x01, 0x02, 0x00}, // memory.atomic.wait32
+				[]byte{0x04, I32}, I32Const(-1), []byte{0x05}, I32Const(8), []byte{0x28, 0x02, 0x00, 0x0b})},
+			{Type: 1, Body: Cat(LocalGet(0), LocalGet(1), []byte{0x36, 0x02, 0x00})},       // i32.store
+			{Type: 2, Body: Cat(LocalGet(0), I32Const(1), []byte{0xfe, 0x00, 0x02, 0x00})}, // memory.atomic.notify
+			{Type: 2, Body: Cat(LocalGet(0), []byte{0x40, 0x00})},                          // memory.grow
+		},
+		Exports: [][]byte{
+			Export("wait", KindFunc, 0), Export("store", KindFunc, 1),
+			Export("notify", KindFunc, 2), Export("grow", KindFunc, 3),
+		},
+		Datas: [][]byte{ActiveData(16, "data")},
+	}
+	mem := exec.NewSharedMemory(1, 8)
+	imports := exec.NewImports()
+	imports.Module("env").Memory("mem", mem)
+	newVM := func() *exec.VirtualMachine {
+		vm, err := exec.NewVirtualMachine(m.Bytes(), exec.VMConfig{}, imports, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return vm
+	}
+
+	// Each waiter runs its own instance on its own goroutine, while another
+	// instance is instantiated and grows the memory.
+	const numWaiters = 3
+	results := make(chan int64, numWaiters)
+	for i := 0; i < numWaiters; i++ {
+		vm := newVM()
+		entry, _ := vm.GetFunctionExport("wait")
+		go func() {
+			ret, err := vm.Run(entry)
+			if err != nil {
+				ret = -2
+			}
+			results <- ret
+		}()
+	}
+	grown := make(chan int64)
+	go func() {
+		vm := newVM()
+		entry, _ := vm.GetFunctionExport("grow")
+		total := int64(0)
+		for i := 0; i < 4; i++ {
+			if ret, err := vm.Run(entry, 1); err == nil && ret >= 0 {
+				total++
+			}
+		}
+		grown <- total
+	}()
+
+	// The value stored before notifying is seen by the woken waiters.
+	vm := newVM()
+	run(t, vm, "store", 8, 42)
+	for woken := int64(0); woken < numWaiters; {
+		woken += run(t, vm, "notify", 0)
+	}
+	for i := 0; i < numWaiters; i++ {
+		if ret := <-results; ret != 42 {
+			t.Fatalf("waiter returned %d", ret)
+		}
+	}
+	if n := <-grown; n != 4 || mem.Pages() != 5 {
+		t.Fatalf("grown %d times to %d pages", n, mem.Pages())
+	}
+}
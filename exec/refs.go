@@ -0,0 +1,332 @@
+package exec
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/go-interpreter/wagon/wasm"
+	"github.com/perlin-network/life/compiler"
+)
+
+// foreignFuncRef marks function references to other instances, whose low
+// bits are handles of foreignFunction values. Other function references are
+// function indices.
+const foreignFuncRef = 1 << 32
+
+var errTooManyRefs = errors.New("too many references")
+
+// foreignFunction is a reference to a function of another instance, read from
+// a shared table or passed along a call between instances.
+type foreignFunction struct {
+	vm         *VirtualMachine
+	functionID int
+}
+
+// ExternRef returns the handle by which guest code refers to the host value
+// v as an externref, or the null reference if v is nil. Comparable values
+// get the same handle each time; other values get a new one. Handles are
+// released by the next call into the virtual machine that is not nested in
+// another one, unless held by a global or passed to that call, so the host
+// must not keep them across calls.
+func (vm *VirtualMachine) ExternRef(v interface{}) int64 {
+	if v == nil {
+		return NullElement
+	}
+	return vm.register(v)
+}
+
+// Extern returns the host value the externref handle ref refers to, or nil
+// for the null reference.
+func (vm *VirtualMachine) Extern(ref int64) interface{} {
+	if ref < 0 || ref >= int64(len(vm.refs)) {
+		return nil
+	}
+	if _, ok := vm.refs[ref].(foreignFunction); ok {
+		return nil
+	}
+	return vm.refs[ref]
+}
+
+// register returns the handle of v, registering it if needed.
+func (vm *VirtualMachine) register(v interface{}) int64 {
+	comparable := reflect.TypeOf(v).Comparable()
+	if comparable {
+		if ref, ok := vm.refHandles[v]; ok {
+			return ref
+		}
+	}
+
+	var ref int64
+	if n := len(vm.freeRefs); n > 0 {
+		ref = vm.freeRefs[n-1]
+		vm.freeRefs = vm.freeRefs[:n-1]
+		vm.refs[ref] = v
+	} else {
+		if len(vm.refs) >= NullElement {
+			panic(errTooManyRefs)
+		}
+		ref = int64(len(vm.refs))
+		vm.refs = append(vm.refs, v)
+	}
+	if comparable {
+		if vm.refHandles == nil {
+			vm.refHandles = make(map[interface{}]int64)
+		}
+		vm.refHandles[v] = ref
+	}
+	return ref
+}
+
+// releaseRefs releases the handles held neither by the globals of the virtual
+// machine nor by the arguments args of the function functionID, which are the
+// only values holding handles between calls that are not nested. The handles
+// of AOT-compiled code, which embeds some of them, are never released.
+func (vm *VirtualMachine) releaseRefs(functionID int, args []int64) {
+	if len(vm.refs) == len(vm.freeRefs) || vm.AOTService != nil {
+		return
+	}
+
+	live := make(map[int64]struct{})
+	mark := func(t wasm.ValueType, ref int64) {
+		switch {
+		case ref == NullElement:
+		case t == compiler.ValueTypeExternRef:
+			live[ref] = struct{}{}
+		case t == compiler.ValueTypeFuncRef && ref&foreignFuncRef != 0:
+			live[ref&^foreignFuncRef] = struct{}{}
+		}
+	}
+	for i := 0; i < len(vm.Globals)-len(vm.Module.V128Globals); i++ {
+		if t := globalType(vm.Module.Base, i).Type; t == compiler.ValueTypeExternRef || t == compiler.ValueTypeFuncRef {
+			mark(t, vm.GlobalVar(i).Get())
+		}
+	}
+	if sig := functionSig(vm.Module.Base, functionID); sig != nil {
+		for i, t := range compiler.SlotTypes(sig.ParamTypes) {
+			if i < len(args) {
+				mark(t, args[i])
+			}
+		}
+	}
+
+	for ref, v := range vm.refs {
+		if _, ok := live[int64(ref)]; ok || v == nil {
+			continue
+		}
+		if reflect.TypeOf(v).Comparable() {
+			delete(vm.refHandles, v)
+		}
+		vm.refs[ref] = nil
+		vm.freeRefs = append(vm.freeRefs, int64(ref))
+	}
+}
+
+// translateRef translates the reference ref of type t held by the virtual
+// machine `from` into a reference held by `to`. Values of other types are
+// returned as is.
+func translateRef(from, to *VirtualMachine, t wasm.ValueType, ref int64) int64 {
+	switch t {
+	case compiler.ValueTypeExternRef:
+		return to.ExternRef(from.Extern(ref))
+	case compiler.ValueTypeFuncRef:
+		if ref == NullElement {
+			return ref
+		}
+		f := foreignFunction{vm: from, functionID: int(ref)}
+		if ref&foreignFuncRef != 0 {
+			f = from.refs[ref&^foreignFuncRef].(foreignFunction)
+		}
+		if f.vm == to {
+			return int64(f.functionID)
+		}
+		return foreignFuncRef | to.register(f)
+	}
+	return ref
+}
+
+// translateRefs is like translateRef for a list of values of the given
+// types. values is copied if any of them needs to be translated.
+func translateRefs(from, to *VirtualMachine, types []wasm.ValueType, values []int64) []int64 {
+	out := values
+	for i, t := range types {
+		if t != compiler.ValueTypeExternRef && t != compiler.ValueTypeFuncRef {
+			continue
+		}
+		if &out[0] == &values[0] {
+			out = append([]int64{}, values...)
+		}
+		out[i] = translateRef(from, to, t, values[i])
+	}
+	return out
+}
+
+// refAt returns the reference held by the slot i of the table t.
+func (vm *VirtualMachine) refAt(t *Table, i int) int64 {
+	if t.isExtern() {
+		return vm.ExternRef(t.Externs[i])
+	}
+
+	elem := t.Elements[i]
+	if elem == NullElement {
+		return NullElement
+	}
+	if owner := t.ownerOf(i); owner != nil && owner != vm {
+		return foreignFuncRef | vm.register(foreignFunction{vm: owner, functionID: int(elem)})
+	}
+	return int64(elem)
+}
+
+// setRef stores the reference ref in the slot i of the table t.
+func (vm *VirtualMachine) setRef(t *Table, i int, ref int64) {
+	if t.isExtern() {
+		t.Externs[i] = vm.Extern(ref)
+		return
+	}
+
+	if ref&foreignFuncRef != 0 {
+		f := vm.refs[ref&^foreignFuncRef].(foreignFunction)
+		t.Elements[i] = uint32(f.functionID)
+		t.setOwner(i, f.vm)
+		return
+	}
+	t.Elements[i] = uint32(ref)
+	t.setOwner(i, vm)
+}
+
+// tableGet returns the reference held by the slot i of the table `table`.
+func (vm *VirtualMachine) tableGet(table int, i uint32) int64 {
+	t := vm.TableAt(table)
+	if !inBounds(i, 1, t.Size()) {
+		panic(&Trap{Kind: TrapTableOutOfBounds})
+	}
+	return vm.refAt(t, int(i))
+}
+
+// tableSet stores the reference ref in the slot i of the table `table`.
+func (vm *VirtualMachine) tableSet(table int, i uint32, ref int64) {
+	t := vm.TableAt(table)
+	if !inBounds(i, 1, t.Size()) {
+		panic(&Trap{Kind: TrapTableOutOfBounds})
+	}
+	vm.setRef(t, int(i), ref)
+}
+
+// tableGrow grows the table `table` by n slots holding the reference ref,
+// returning its previous size, or -1 if the table cannot be grown.
+func (vm *VirtualMachine) tableGrow(table int, ref int64, n uint32) int {
+	t := vm.TableAt(table)
+	prev := t.grow(int(n), vm.Config.MaxTableSize)
+	if prev >= 0 {
+		for i := prev; i < prev+int(n); i++ {
+			vm.setRef(t, i, ref)
+		}
+	}
+	if table == 0 {
+		vm.syncTable()
+	}
+	return prev
+}
+
+// tableFill stores the reference ref in n slots of the table `table` from
+// the slot i.
+func (vm *VirtualMachine) tableFill(table int, i uint32, ref int64, n uint32) {
+	t := vm.TableAt(table)
+	if !inBounds(i, n, t.Size()) {
+		panic(&Trap{Kind: TrapTableOutOfBounds})
+	}
+	for j := int(i); j < int(i+n); j++ {
+		vm.setRef(t, j, ref)
+	}
+}
+
+// generateTablesNEnv generates the tables and the functions of the table
+// instructions for AOT-compiled code. Tables may not grow beyond `limit`
+// slots if not zero. Externref tables hold handles of host values registered
+// with vm, and must be empty if vm is nil.
+func generateTablesNEnv(builder *strings.Builder, tables []*Table, limit int, functionCode []compiler.InterpreterCode, vm *VirtualMachine) {
+	bSprintf(builder, "struct Function { uint64_t num_params; void *func; };\n")
+	bSprintf(builder, "static const uint64_t num_functions = %d;\n", len(functionCode))
+	bSprintf(builder, "static const struct Function functions[] = {\n")
+	for i, code := range functionCode {
+		bSprintf(builder, "{ .num_params = %d, .func = %s%d },\n", code.NumParams, compiler.NGEN_FUNCTION_PREFIX, i)
+	}
+	bSprintf(builder, "{ .num_params = 0, .func = 0 },\n") // avoids empty arrays
+	bSprintf(builder, "};\n")
+
+	bSprintf(builder, "struct Table { uint32_t size; uint32_t max; uint32_t *elems; };\n")
+	for i, t := range tables {
+		bSprintf(builder, "static uint32_t table_%d[] = {", i)
+		for j := 0; j < t.Size(); j++ {
+			var ref int64
+			if vm != nil {
+				ref = vm.refAt(t, j)
+			} else if t.isExtern() {
+				ref = NullElement
+			} else {
+				ref = int64(t.Elements[j])
+			}
+			bSprintf(builder, "%du,", uint32(ref))
+		}
+		bSprintf(builder, "0};\n")
+	}
+	bSprintf(builder, "static struct Table tables[] = {\n")
+	for i, t := range tables {
+		max := NullElement
+		if t.MaxSize != 0 {
+			max = t.MaxSize
+		}
+		if limit != 0 && limit < max {
+			max = limit
+		}
+		bSprintf(builder, "{ .size = %d, .max = %du, .elems = table_%d },\n", t.Size(), max, i)
+	}
+	bSprintf(builder, "{ .size = 0, .max = 0, .elems = 0 },\n")
+	bSprintf(builder, "};\n")
+
+	bSprintf(builder, "static void * __attribute__((always_inline)) %sresolve_indirect(struct VirtualMachine *vm, uint64_t table, uint32_t entry_id, uint64_t num_params) {\n", compiler.NGEN_ENV_API_PREFIX)
+	bSprintf(builder, "if(entry_id >= tables[table].size) { vm->throw_s(vm, \"%s\"); }\n", "table entry out of bounds")
+	bSprintf(builder, "uint32_t function_id = tables[table].elems[entry_id];\n")
+	bSprintf(builder, "if(function_id >= num_functions) { vm->throw_s(vm, \"%s\"); }\n", "table entry is null")
+	bSprintf(builder, "if(functions[function_id].num_params != num_params) { vm->throw_s(vm, \"%s\"); }\n", "argument count mismatch")
+	bSprintf(builder, "return functions[function_id].func;\n")
+	bSprintf(builder, "}\n")
+
+	bSprintf(builder, "static uint32_t __attribute__((always_inline)) %stable_get(struct VirtualMachine *vm, uint64_t table, uint32_t i) {\n", compiler.NGEN_ENV_API_PREFIX)
+	bSprintf(builder, "if(i >= tables[table].size) { vm->throw_s(vm, \"%s\"); }\n", "table access out of bounds")
+	bSprintf(builder, "return tables[table].elems[i];\n")
+	bSprintf(builder, "}\n")
+	bSprintf(builder, "static void __attribute__((always_inline)) %stable_set(struct VirtualMachine *vm, uint64_t table, uint32_t i, uint32_t ref) {\n", compiler.NGEN_ENV_API_PREFIX)
+	bSprintf(builder, "if(i >= tables[table].size) { vm->throw_s(vm, \"%s\"); }\n", "table access out of bounds")
+	bSprintf(builder, "tables[table].elems[i] = ref;\n")
+	bSprintf(builder, "}\n")
+	bSprintf(builder, "static uint32_t __attribute__((always_inline)) %stable_size(uint64_t table) {\n", compiler.NGEN_ENV_API_PREFIX)
+	bSprintf(builder, "return tables[table].size;\n")
+	bSprintf(builder, "}\n")
+	bSprintf(builder, "static void __attribute__((always_inline)) %stable_fill(struct VirtualMachine *vm, uint64_t table, uint32_t i, uint32_t ref, uint32_t n) {\n", compiler.NGEN_ENV_API_PREFIX)
+	bSprintf(builder, "if((uint64_t) i + n > tables[table].size) { vm->throw_s(vm, \"%s\"); }\n", "table access out of bounds")
+	bSprintf(builder, "for(uint32_t j = 0; j < n; j++) { tables[table].elems[i + j] = ref; }\n")
+	bSprintf(builder, "}\n")
+
+	// Tables are grown into memory allocated with malloc, and the initial
+	// static arrays are never freed.
+	bSprintf(builder, "static uint32_t * const table_elems_initial[] = {")
+	for i := range tables {
+		bSprintf(builder, "table_%d,", i)
+	}
+	bSprintf(builder, "0};\n")
+	bSprintf(builder, "static uint32_t __attribute__((always_inline)) %stable_grow(struct VirtualMachine *vm, uint64_t table, uint32_t ref, uint32_t n) {\n", compiler.NGEN_ENV_API_PREFIX)
+	bSprintf(builder, "struct Table *t = &tables[table];\n")
+	bSprintf(builder, "uint32_t prev = t->size;\n")
+	bSprintf(builder, "if((uint64_t) prev + n > t->max) { return (uint32_t) -1; }\n")
+	bSprintf(builder, "if(n == 0) { return prev; }\n")
+	bSprintf(builder, "uint32_t *elems = __builtin_malloc(((uint64_t) prev + n) * sizeof(uint32_t));\n")
+	bSprintf(builder, "if(elems == 0) { return (uint32_t) -1; }\n")
+	bSprintf(builder, "__builtin_memcpy(elems, t->elems, (uint64_t) prev * sizeof(uint32_t));\n")
+	bSprintf(builder, "for(uint32_t j = prev; j < prev + n; j++) { elems[j] = ref; }\n")
+	bSprintf(builder, "if(t->elems != table_elems_initial[table]) { __builtin_free(t->elems); }\n")
+	bSprintf(builder, "t->elems = elems;\n")
+	bSprintf(builder, "t->size = prev + n;\n")
+	bSprintf(builder, "return prev;\n")
+	bSprintf(builder, "}\n")
+}
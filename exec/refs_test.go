@@ -0,0 +1,47 @@
+package exec_test
+
+import (
+	"testing"
+
+	"github.com/perlin-network/life/exec"
+	. "github.com/perlin-network/life/internal/wasmtest"
+)
+
+func TestExternRefRelease(t *testing.T) {
+	m := &Module{
+		Types:   [][]byte{FuncType([]byte{ExternRef}, []byte{ExternRef}), FuncType([]byte{ExternRef}, nil)},
+		Globals: [][]byte{Cat([]byte{ExternRef, 1}, []byte{0xd0, ExternRef, 0x0b})}, // ref.null extern
+		Funcs: []Func{
+			{Type: 0, Body: LocalGet(0)},
+			{Type: 1, Body: Cat(LocalGet(0), []byte{0x24, 0x00})}, // global.set
+		},
+		Exports: [][]byte{Export("id", KindFunc, 0), Export("set", KindFunc, 1), Export("g", KindGlobal, 0)},
+	}
+	vm, err := exec.NewVirtualMachine(m.Bytes(), exec.VMConfig{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kept := vm.ExternRef(map[string]int{"kept": 1})
+	run(t, vm, "set", kept)
+
+	// Values which are not comparable get a new handle each time, and the
+	// handles of the previous calls are reused.
+	handles := make(map[int64]struct{})
+	for i := 0; i < 10; i++ {
+		ref := vm.ExternRef([]int{i})
+		if v, ok := vm.Extern(run(t, vm, "id", ref)).([]int); !ok || v[0] != i {
+			t.Fatalf("got %v", vm.Extern(ref))
+		}
+		handles[ref] = struct{}{}
+	}
+	if _, ok := handles[kept]; ok || len(handles) > 2 {
+		t.Fatalf("%d handles used", len(handles))
+	}
+
+	// The handle held by the global is kept.
+	g, _ := vm.GetGlobalVarExport("g")
+	if v, ok := vm.Extern(g.Get()).(map[string]int); !ok || v["kept"] != 1 {
+		t.Fatalf("global holds %v", vm.Extern(g.Get()))
+	}
+}
@@ -0,0 +1,52 @@
+package exec
+
+import "math"
+
+// The saturating truncations of the non-trapping float-to-int conversions
+// proposal. Out of range values are clamped to the nearest representable
+// integer and NaN is converted to 0. Results are represented as in
+// interpreter registers.
+
+func truncSatI32S(x float64) int64 {
+	switch {
+	case x != x:
+		return 0
+	case x <= math.MinInt32:
+		return 0x80000000 // math.MinInt32
+	case x >= math.MaxInt32:
+		return math.MaxInt32
+	}
+	return int64(uint32(int32(x)))
+}
+
+func truncSatI32U(x float64) int64 {
+	switch {
+	case !(x > -1):
+		return 0
+	case x >= math.MaxUint32:
+		return math.MaxUint32
+	}
+	return int64(uint32(x))
+}
+
+func truncSatI64S(x float64) int64 {
+	switch {
+	case x != x:
+		return 0
+	case x <= math.MinInt64:
+		return math.MinInt64
+	case x >= math.MaxInt64:
+		return math.MaxInt64
+	}
+	return int64(x)
+}
+
+func truncSatI64U(x float64) int64 {
+	switch {
+	case !(x > -1):
+		return 0
+	case x >= math.MaxUint64:
+		return -1 // math.MaxUint64
+	}
+	return int64(uint64(x))
+}
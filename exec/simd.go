@@ -0,0 +1,903 @@
+package exec
+
+import (
+	"math"
+	"math/bits"
+
+	"github.com/perlin-network/life/compiler"
+	"github.com/perlin-network/life/compiler/opcodes"
+)
+
+// v128 is a value of the SIMD proposal, holding its lanes in little-endian
+// order.
+type v128 [16]byte
+
+func makeV128(lo, hi int64) (v v128) {
+	LE.PutUint64(v[:8], uint64(lo))
+	LE.PutUint64(v[8:], uint64(hi))
+	return v
+}
+
+func (v *v128) halves() (int64, int64) {
+	return int64(LE.Uint64(v[:8])), int64(LE.Uint64(v[8:]))
+}
+
+func (v *v128) u16(i int) uint16 { return LE.Uint16(v[2*i:]) }
+func (v *v128) u32(i int) uint32 { return LE.Uint32(v[4*i:]) }
+func (v *v128) u64(i int) uint64 { return LE.Uint64(v[8*i:]) }
+func (v *v128) f32(i int) float32 {
+	return math.Float32frombits(v.u32(i))
+}
+func (v *v128) f64(i int) float64 {
+	return math.Float64frombits(v.u64(i))
+}
+
+func (v *v128) setU16(i int, x uint16) { LE.PutUint16(v[2*i:], x) }
+func (v *v128) setU32(i int, x uint32) { LE.PutUint32(v[4*i:], x) }
+func (v *v128) setU64(i int, x uint64) { LE.PutUint64(v[8*i:], x) }
+
+// setF32 and setF64 store floating point results, replacing NaN values by
+// the canonical NaN like the scalar instructions.
+func (v *v128) setF32(i int, x float32) {
+	if x != x {
+		v.setU32(i, 0x7FC00000)
+	} else {
+		v.setU32(i, math.Float32bits(x))
+	}
+}
+
+func (v *v128) setF64(i int, x float64) {
+	if x != x {
+		v.setU64(i, 0x7FF8000000000000)
+	} else {
+		v.setU64(i, math.Float64bits(x))
+	}
+}
+
+// simdOps holds the SIMD instructions by sub-opcode for quick lookups.
+var simdOps [256]*compiler.SIMDOp
+
+func init() {
+	for code, op := range compiler.SIMDOps {
+		op := op
+		simdOps[code] = &op
+	}
+}
+
+// execSIMD executes the SIMD instruction at frame.IP, following its SIMD
+// opcode. Instructions producing a v128 value assign its low half to
+// valueID and yield its high half.
+func (vm *VirtualMachine) execSIMD(frame *Frame, valueID int) {
+	code := opcodes.SIMDOpcode(frame.Code[frame.IP])
+	op := simdOps[code]
+	if op == nil {
+		panic("unknown instruction")
+	}
+	frame.IP++
+
+	var memory uint32
+	var offset uint64
+	var lane int
+	var shuffle v128
+
+	switch op.Kind {
+	case compiler.SIMDLoad, compiler.SIMDStore:
+		memory = LE.Uint32(frame.Code[frame.IP : frame.IP+4])
+		offset = LE.Uint64(frame.Code[frame.IP+4 : frame.IP+12])
+		frame.IP += 12
+	case compiler.SIMDLoadLane, compiler.SIMDStoreLane:
+		memory = LE.Uint32(frame.Code[frame.IP : frame.IP+4])
+		offset = LE.Uint64(frame.Code[frame.IP+4 : frame.IP+12])
+		lane = int(LE.Uint32(frame.Code[frame.IP+12 : frame.IP+16]))
+		frame.IP += 16
+	case compiler.SIMDExtractLane, compiler.SIMDReplaceLane:
+		lane = int(LE.Uint32(frame.Code[frame.IP : frame.IP+4]))
+		frame.IP += 4
+	case compiler.SIMDShuffle:
+		copy(shuffle[:], frame.Code[frame.IP:frame.IP+16])
+		frame.IP += 16
+	}
+
+	var values [6]int64
+	for i := 0; i < op.NumValues(); i++ {
+		values[i] = frame.Regs[int(LE.Uint32(frame.Code[frame.IP:frame.IP+4]))]
+		frame.IP += 4
+	}
+
+	// m holds the bytes accessed by memory instructions.
+	var m []byte
+	switch op.Kind {
+	case compiler.SIMDLoad, compiler.SIMDLoadLane, compiler.SIMDStore, compiler.SIMDStoreLane:
+		n := op.AccessSize()
+		view, effective := vm.effectiveAddress(memory, values[0], offset, n)
+		m = view[effective : effective+n]
+	}
+
+	var r v128
+
+	switch op.Kind {
+	case compiler.SIMDLoad:
+		r = simdLoad(code, m)
+	case compiler.SIMDLoadLane:
+		r = makeV128(values[1], values[2])
+		copy(r[lane*len(m):(lane+1)*len(m)], m)
+	case compiler.SIMDStore:
+		v := makeV128(values[1], values[2])
+		copy(m, v[:])
+		return
+	case compiler.SIMDStoreLane:
+		v := makeV128(values[1], values[2])
+		copy(m, v[lane*len(m):(lane+1)*len(m)])
+		return
+	case compiler.SIMDShuffle:
+		var ab [32]byte
+		a, b := makeV128(values[0], values[1]), makeV128(values[2], values[3])
+		copy(ab[:16], a[:])
+		copy(ab[16:], b[:])
+		for i, j := range shuffle {
+			r[i] = ab[j]
+		}
+	case compiler.SIMDSplat:
+		r = simdSplat(code, values[0])
+	case compiler.SIMDExtractLane:
+		a := makeV128(values[0], values[1])
+		frame.Regs[valueID] = simdExtractLane(code, &a, lane)
+		return
+	case compiler.SIMDReplaceLane:
+		r = makeV128(values[0], values[1])
+		simdReplaceLane(code, &r, lane, values[2])
+	case compiler.SIMDUnary:
+		r = simdUnary(code, makeV128(values[0], values[1]))
+	case compiler.SIMDBinary:
+		r = simdBinary(code, makeV128(values[0], values[1]), makeV128(values[2], values[3]))
+	case compiler.SIMDTernary: // v128.bitselect
+		for i := 0; i < 2; i++ {
+			a, b, c := uint64(values[i]), uint64(values[2+i]), uint64(values[4+i])
+			r.setU64(i, a&c|b&^c)
+		}
+	case compiler.SIMDTest:
+		frame.Regs[valueID] = simdTest(code, makeV128(values[0], values[1]))
+		return
+	case compiler.SIMDShift:
+		r = simdShift(code, makeV128(values[0], values[1]), uint32(values[2]))
+	}
+
+	lo, hi := r.halves()
+	frame.Regs[valueID] = lo
+	vm.setYieldedValue(1, hi)
+}
+
+// simdLoad returns the value loaded by the load `code` from the bytes m.
+func simdLoad(code opcodes.SIMDOpcode, m []byte) (r v128) {
+	switch code {
+	case opcodes.V128Load:
+		copy(r[:], m)
+	case opcodes.V128Load8x8S, opcodes.V128Load8x8U:
+		for i := 0; i < 8; i++ {
+			if code == opcodes.V128Load8x8S {
+				r.setU16(i, uint16(int8(m[i])))
+			} else {
+				r.setU16(i, uint16(m[i]))
+			}
+		}
+	case opcodes.V128Load16x4S, opcodes.V128Load16x4U:
+		for i := 0; i < 4; i++ {
+			x := LE.Uint16(m[2*i:])
+			if code == opcodes.V128Load16x4S {
+				r.setU32(i, uint32(int16(x)))
+			} else {
+				r.setU32(i, uint32(x))
+			}
+		}
+	case opcodes.V128Load32x2S, opcodes.V128Load32x2U:
+		for i := 0; i < 2; i++ {
+			x := LE.Uint32(m[4*i:])
+			if code == opcodes.V128Load32x2S {
+				r.setU64(i, uint64(int32(x)))
+			} else {
+				r.setU64(i, uint64(x))
+			}
+		}
+	case opcodes.V128Load8Splat:
+		r = simdSplat(opcodes.I8x16Splat, int64(m[0]))
+	case opcodes.V128Load16Splat:
+		r = simdSplat(opcodes.I16x8Splat, int64(LE.Uint16(m)))
+	case opcodes.V128Load32Splat:
+		r = simdSplat(opcodes.I32x4Splat, int64(LE.Uint32(m)))
+	case opcodes.V128Load64Splat:
+		r = simdSplat(opcodes.I64x2Splat, int64(LE.Uint64(m)))
+	case opcodes.V128Load32Zero:
+		copy(r[:4], m)
+	case opcodes.V128Load64Zero:
+		copy(r[:8], m)
+	}
+	return r
+}
+
+func simdSplat(code opcodes.SIMDOpcode, x int64) (r v128) {
+	switch code {
+	case opcodes.I8x16Splat:
+		for i := range r {
+			r[i] = byte(x)
+		}
+	case opcodes.I16x8Splat:
+		for i := 0; i < 8; i++ {
+			r.setU16(i, uint16(x))
+		}
+	case opcodes.I32x4Splat, opcodes.F32x4Splat:
+		for i := 0; i < 4; i++ {
+			r.setU32(i, uint32(x))
+		}
+	case opcodes.I64x2Splat, opcodes.F64x2Splat:
+		r.setU64(0, uint64(x))
+		r.setU64(1, uint64(x))
+	}
+	return r
+}
+
+// simdExtractLane returns the lane i of a as represented in interpreter
+// registers.
+func simdExtractLane(code opcodes.SIMDOpcode, a *v128, i int) int64 {
+	switch code {
+	case opcodes.I8x16ExtractLaneS:
+		return int64(uint32(int8(a[i])))
+	case opcodes.I8x16ExtractLaneU:
+		return int64(a[i])
+	case opcodes.I16x8ExtractLaneS:
+		return int64(uint32(int16(a.u16(i))))
+	case opcodes.I16x8ExtractLaneU:
+		return int64(a.u16(i))
+	case opcodes.I32x4ExtractLane, opcodes.F32x4ExtractLane:
+		return int64(a.u32(i))
+	default: // i64x2.extract_lane, f64x2.extract_lane
+		return int64(a.u64(i))
+	}
+}
+
+func simdReplaceLane(code opcodes.SIMDOpcode, r *v128, i int, x int64) {
+	switch code {
+	case opcodes.I8x16ReplaceLane:
+		r[i] = byte(x)
+	case opcodes.I16x8ReplaceLane:
+		r.setU16(i, uint16(x))
+	case opcodes.I32x4ReplaceLane, opcodes.F32x4ReplaceLane:
+		r.setU32(i, uint32(x))
+	default: // i64x2.replace_lane, f64x2.replace_lane
+		r.setU64(i, uint64(x))
+	}
+}
+
+func simdTest(code opcodes.SIMDOpcode, a v128) int64 {
+	var ret int64
+
+	switch code {
+	case opcodes.V128AnyTrue:
+		if a.u64(0)|a.u64(1) != 0 {
+			ret = 1
+		}
+	case opcodes.I8x16AllTrue, opcodes.I16x8AllTrue, opcodes.I32x4AllTrue, opcodes.I64x2AllTrue:
+		n := simdLaneSize(code)
+		ret = 1
+		for i := 0; i < 16; i += n {
+			zero := true
+			for _, b := range a[i : i+n] {
+				zero = zero && b == 0
+			}
+			if zero {
+				ret = 0
+			}
+		}
+	case opcodes.I8x16Bitmask, opcodes.I16x8Bitmask, opcodes.I32x4Bitmask, opcodes.I64x2Bitmask:
+		n := simdLaneSize(code)
+		for i := 0; i < 16; i += n {
+			ret |= int64(a[i+n-1]>>7) << uint(i/n)
+		}
+	}
+	return ret
+}
+
+// simdLaneSize returns the size in bytes of the lanes of the all_true and
+// bitmask instructions.
+func simdLaneSize(code opcodes.SIMDOpcode) int {
+	switch code {
+	case opcodes.I16x8AllTrue, opcodes.I16x8Bitmask:
+		return 2
+	case opcodes.I32x4AllTrue, opcodes.I32x4Bitmask:
+		return 4
+	case opcodes.I64x2AllTrue, opcodes.I64x2Bitmask:
+		return 8
+	}
+	return 1
+}
+
+func simdShift(code opcodes.SIMDOpcode, a v128, n uint32) (r v128) {
+	switch code {
+	case opcodes.I8x16Shl, opcodes.I8x16ShrS, opcodes.I8x16ShrU:
+		n %= 8
+		for i, x := range a {
+			switch code {
+			case opcodes.I8x16Shl:
+				r[i] = x << n
+			case opcodes.I8x16ShrS:
+				r[i] = byte(int8(x) >> n)
+			default:
+				r[i] = x >> n
+			}
+		}
+	case opcodes.I16x8Shl, opcodes.I16x8ShrS, opcodes.I16x8ShrU:
+		n %= 16
+		for i := 0; i < 8; i++ {
+			x := a.u16(i)
+			switch code {
+			case opcodes.I16x8Shl:
+				r.setU16(i, x<<n)
+			case opcodes.I16x8ShrS:
+				r.setU16(i, uint16(int16(x)>>n))
+			default:
+				r.setU16(i, x>>n)
+			}
+		}
+	case opcodes.I32x4Shl, opcodes.I32x4ShrS, opcodes.I32x4ShrU:
+		n %= 32
+		for i := 0; i < 4; i++ {
+			x := a.u32(i)
+			switch code {
+			case opcodes.I32x4Shl:
+				r.setU32(i, x<<n)
+			case opcodes.I32x4ShrS:
+				r.setU32(i, uint32(int32(x)>>n))
+			default:
+				r.setU32(i, x>>n)
+			}
+		}
+	default: // i64x2
+		n %= 64
+		for i := 0; i < 2; i++ {
+			x := a.u64(i)
+			switch code {
+			case opcodes.I64x2Shl:
+				r.setU64(i, x<<n)
+			case opcodes.I64x2ShrS:
+				r.setU64(i, uint64(int64(x)>>n))
+			default:
+				r.setU64(i, x>>n)
+			}
+		}
+	}
+	return r
+}
+
+func simdUnary(code opcodes.SIMDOpcode, a v128) (r v128) {
+	switch code {
+	case opcodes.V128Not:
+		r.setU64(0, ^a.u64(0))
+		r.setU64(1, ^a.u64(1))
+
+	case opcodes.I8x16Abs, opcodes.I8x16Neg, opcodes.I8x16Popcnt:
+		for i, x := range a {
+			switch code {
+			case opcodes.I8x16Abs:
+				if int8(x) < 0 {
+					x = -x
+				}
+				r[i] = x
+			case opcodes.I8x16Neg:
+				r[i] = -x
+			default:
+				r[i] = byte(bits.OnesCount8(x))
+			}
+		}
+	case opcodes.I16x8Abs, opcodes.I16x8Neg:
+		for i := 0; i < 8; i++ {
+			x := a.u16(i)
+			if code == opcodes.I16x8Neg || int16(x) < 0 {
+				x = -x
+			}
+			r.setU16(i, x)
+		}
+	case opcodes.I32x4Abs, opcodes.I32x4Neg:
+		for i := 0; i < 4; i++ {
+			x := a.u32(i)
+			if code == opcodes.I32x4Neg || int32(x) < 0 {
+				x = -x
+			}
+			r.setU32(i, x)
+		}
+	case opcodes.I64x2Abs, opcodes.I64x2Neg:
+		for i := 0; i < 2; i++ {
+			x := a.u64(i)
+			if code == opcodes.I64x2Neg || int64(x) < 0 {
+				x = -x
+			}
+			r.setU64(i, x)
+		}
+
+	case opcodes.I16x8ExtaddPairwiseI8x16S, opcodes.I16x8ExtaddPairwiseI8x16U:
+		for i := 0; i < 8; i++ {
+			if code == opcodes.I16x8ExtaddPairwiseI8x16S {
+				r.setU16(i, uint16(int16(int8(a[2*i]))+int16(int8(a[2*i+1]))))
+			} else {
+				r.setU16(i, uint16(a[2*i])+uint16(a[2*i+1]))
+			}
+		}
+	case opcodes.I32x4ExtaddPairwiseI16x8S, opcodes.I32x4ExtaddPairwiseI16x8U:
+		for i := 0; i < 4; i++ {
+			if code == opcodes.I32x4ExtaddPairwiseI16x8S {
+				r.setU32(i, uint32(int32(int16(a.u16(2*i)))+int32(int16(a.u16(2*i+1)))))
+			} else {
+				r.setU32(i, uint32(a.u16(2*i))+uint32(a.u16(2*i+1)))
+			}
+		}
+
+	case opcodes.I16x8ExtendLowI8x16S, opcodes.I16x8ExtendHighI8x16S, opcodes.I16x8ExtendLowI8x16U, opcodes.I16x8ExtendHighI8x16U:
+		base := 0
+		if code == opcodes.I16x8ExtendHighI8x16S || code == opcodes.I16x8ExtendHighI8x16U {
+			base = 8
+		}
+		for i := 0; i < 8; i++ {
+			x := a[base+i]
+			if code == opcodes.I16x8ExtendLowI8x16S || code == opcodes.I16x8ExtendHighI8x16S {
+				r.setU16(i, uint16(int8(x)))
+			} else {
+				r.setU16(i, uint16(x))
+			}
+		}
+	case opcodes.I32x4ExtendLowI16x8S, opcodes.I32x4ExtendHighI16x8S, opcodes.I32x4ExtendLowI16x8U, opcodes.I32x4ExtendHighI16x8U:
+		base := 0
+		if code == opcodes.I32x4ExtendHighI16x8S || code == opcodes.I32x4ExtendHighI16x8U {
+			base = 4
+		}
+		for i := 0; i < 4; i++ {
+			x := a.u16(base + i)
+			if code == opcodes.I32x4ExtendLowI16x8S || code == opcodes.I32x4ExtendHighI16x8S {
+				r.setU32(i, uint32(int16(x)))
+			} else {
+				r.setU32(i, uint32(x))
+			}
+		}
+	case opcodes.I64x2ExtendLowI32x4S, opcodes.I64x2ExtendHighI32x4S, opcodes.I64x2ExtendLowI32x4U, opcodes.I64x2ExtendHighI32x4U:
+		base := 0
+		if code == opcodes.I64x2ExtendHighI32x4S || code == opcodes.I64x2ExtendHighI32x4U {
+			base = 2
+		}
+		for i := 0; i < 2; i++ {
+			x := a.u32(base + i)
+			if code == opcodes.I64x2ExtendLowI32x4S || code == opcodes.I64x2ExtendHighI32x4S {
+				r.setU64(i, uint64(int32(x)))
+			} else {
+				r.setU64(i, uint64(x))
+			}
+		}
+
+	case opcodes.F32x4Abs, opcodes.F32x4Neg:
+		for i := 0; i < 4; i++ {
+			if code == opcodes.F32x4Abs {
+				r.setU32(i, a.u32(i)&^(1<<31))
+			} else {
+				r.setU32(i, a.u32(i)^(1<<31))
+			}
+		}
+	case opcodes.F64x2Abs, opcodes.F64x2Neg:
+		for i := 0; i < 2; i++ {
+			if code == opcodes.F64x2Abs {
+				r.setU64(i, a.u64(i)&^(1<<63))
+			} else {
+				r.setU64(i, a.u64(i)^(1<<63))
+			}
+		}
+	case opcodes.F32x4Sqrt, opcodes.F32x4Ceil, opcodes.F32x4Floor, opcodes.F32x4Trunc, opcodes.F32x4Nearest:
+		for i := 0; i < 4; i++ {
+			r.setF32(i, float32(simdRound(code, float64(a.f32(i)))))
+		}
+	case opcodes.F64x2Sqrt, opcodes.F64x2Ceil, opcodes.F64x2Floor, opcodes.F64x2Trunc, opcodes.F64x2Nearest:
+		for i := 0; i < 2; i++ {
+			r.setF64(i, simdRound(code, a.f64(i)))
+		}
+
+	case opcodes.I32x4TruncSatF32x4S, opcodes.I32x4TruncSatF32x4U:
+		for i := 0; i < 4; i++ {
+			if code == opcodes.I32x4TruncSatF32x4S {
+				r.setU32(i, uint32(truncSatI32S(float64(a.f32(i)))))
+			} else {
+				r.setU32(i, uint32(truncSatI32U(float64(a.f32(i)))))
+			}
+		}
+	case opcodes.I32x4TruncSatF64x2SZero, opcodes.I32x4TruncSatF64x2UZero:
+		for i := 0; i < 2; i++ {
+			if code == opcodes.I32x4TruncSatF64x2SZero {
+				r.setU32(i, uint32(truncSatI32S(a.f64(i))))
+			} else {
+				r.setU32(i, uint32(truncSatI32U(a.f64(i))))
+			}
+		}
+	case opcodes.F32x4ConvertI32x4S, opcodes.F32x4ConvertI32x4U:
+		for i := 0; i < 4; i++ {
+			if code == opcodes.F32x4ConvertI32x4S {
+				r.setF32(i, float32(int32(a.u32(i))))
+			} else {
+				r.setF32(i, float32(a.u32(i)))
+			}
+		}
+	case opcodes.F64x2ConvertLowI32x4S, opcodes.F64x2ConvertLowI32x4U:
+		for i := 0; i < 2; i++ {
+			if code == opcodes.F64x2ConvertLowI32x4S {
+				r.setF64(i, float64(int32(a.u32(i))))
+			} else {
+				r.setF64(i, float64(a.u32(i)))
+			}
+		}
+	case opcodes.F32x4DemoteF64x2Zero:
+		for i := 0; i < 2; i++ {
+			r.setF32(i, float32(a.f64(i)))
+		}
+	case opcodes.F64x2PromoteLowF32x4:
+		for i := 0; i < 2; i++ {
+			r.setF64(i, float64(a.f32(i)))
+		}
+	}
+	return r
+}
+
+// simdRound applies the square root or rounding instruction `code` to x.
+// f32 lanes are computed in double precision, which rounds to the same
+// single precision results.
+func simdRound(code opcodes.SIMDOpcode, x float64) float64 {
+	switch code {
+	case opcodes.F32x4Sqrt, opcodes.F64x2Sqrt:
+		return math.Sqrt(x)
+	case opcodes.F32x4Ceil, opcodes.F64x2Ceil:
+		return math.Ceil(x)
+	case opcodes.F32x4Floor, opcodes.F64x2Floor:
+		return math.Floor(x)
+	case opcodes.F32x4Trunc, opcodes.F64x2Trunc:
+		return math.Trunc(x)
+	default: // nearest
+		return math.RoundToEven(x)
+	}
+}
+
+func simdBinary(code opcodes.SIMDOpcode, a, b v128) (r v128) {
+	switch code {
+	case opcodes.V128And, opcodes.V128AndNot, opcodes.V128Or, opcodes.V128Xor:
+		for i := 0; i < 2; i++ {
+			x, y := a.u64(i), b.u64(i)
+			switch code {
+			case opcodes.V128And:
+				r.setU64(i, x&y)
+			case opcodes.V128AndNot:
+				r.setU64(i, x&^y)
+			case opcodes.V128Or:
+				r.setU64(i, x|y)
+			default:
+				r.setU64(i, x^y)
+			}
+		}
+
+	case opcodes.I8x16Swizzle:
+		for i, j := range b {
+			if j < 16 {
+				r[i] = a[j]
+			}
+		}
+	case opcodes.I8x16NarrowI16x8S, opcodes.I8x16NarrowI16x8U:
+		for i := 0; i < 16; i++ {
+			var x int16
+			if i < 8 {
+				x = int16(a.u16(i))
+			} else {
+				x = int16(b.u16(i - 8))
+			}
+			if code == opcodes.I8x16NarrowI16x8S {
+				r[i] = byte(saturate(int64(x), math.MinInt8, math.MaxInt8))
+			} else {
+				r[i] = byte(saturate(int64(x), 0, math.MaxUint8))
+			}
+		}
+	case opcodes.I16x8NarrowI32x4S, opcodes.I16x8NarrowI32x4U:
+		for i := 0; i < 8; i++ {
+			var x int32
+			if i < 4 {
+				x = int32(a.u32(i))
+			} else {
+				x = int32(b.u32(i - 4))
+			}
+			if code == opcodes.I16x8NarrowI32x4S {
+				r.setU16(i, uint16(saturate(int64(x), math.MinInt16, math.MaxInt16)))
+			} else {
+				r.setU16(i, uint16(saturate(int64(x), 0, math.MaxUint16)))
+			}
+		}
+
+	case opcodes.I8x16Eq, opcodes.I8x16Ne, opcodes.I8x16LtS, opcodes.I8x16LtU, opcodes.I8x16GtS, opcodes.I8x16GtU,
+		opcodes.I8x16LeS, opcodes.I8x16LeU, opcodes.I8x16GeS, opcodes.I8x16GeU,
+		opcodes.I8x16Add, opcodes.I8x16AddSatS, opcodes.I8x16AddSatU, opcodes.I8x16Sub, opcodes.I8x16SubSatS, opcodes.I8x16SubSatU,
+		opcodes.I8x16MinS, opcodes.I8x16MinU, opcodes.I8x16MaxS, opcodes.I8x16MaxU, opcodes.I8x16AvgrU:
+		for i := range r {
+			r[i] = byte(simdIntOp(code, int64(int8(a[i])), int64(a[i]), int64(int8(b[i])), int64(b[i]), math.MinInt8, math.MaxInt8, math.MaxUint8))
+		}
+	case opcodes.I16x8Eq, opcodes.I16x8Ne, opcodes.I16x8LtS, opcodes.I16x8LtU, opcodes.I16x8GtS, opcodes.I16x8GtU,
+		opcodes.I16x8LeS, opcodes.I16x8LeU, opcodes.I16x8GeS, opcodes.I16x8GeU,
+		opcodes.I16x8Add, opcodes.I16x8AddSatS, opcodes.I16x8AddSatU, opcodes.I16x8Sub, opcodes.I16x8SubSatS, opcodes.I16x8SubSatU,
+		opcodes.I16x8MinS, opcodes.I16x8MinU, opcodes.I16x8MaxS, opcodes.I16x8MaxU, opcodes.I16x8AvgrU,
+		opcodes.I16x8Mul, opcodes.I16x8Q15mulrSatS:
+		for i := 0; i < 8; i++ {
+			x, y := a.u16(i), b.u16(i)
+			r.setU16(i, uint16(simdIntOp(code, int64(int16(x)), int64(x), int64(int16(y)), int64(y), math.MinInt16, math.MaxInt16, math.MaxUint16)))
+		}
+	case opcodes.I32x4Eq, opcodes.I32x4Ne, opcodes.I32x4LtS, opcodes.I32x4LtU, opcodes.I32x4GtS, opcodes.I32x4GtU,
+		opcodes.I32x4LeS, opcodes.I32x4LeU, opcodes.I32x4GeS, opcodes.I32x4GeU,
+		opcodes.I32x4Add, opcodes.I32x4Sub, opcodes.I32x4Mul,
+		opcodes.I32x4MinS, opcodes.I32x4MinU, opcodes.I32x4MaxS, opcodes.I32x4MaxU:
+		for i := 0; i < 4; i++ {
+			x, y := a.u32(i), b.u32(i)
+			r.setU32(i, uint32(simdIntOp(code, int64(int32(x)), int64(x), int64(int32(y)), int64(y), math.MinInt32, math.MaxInt32, math.MaxUint32)))
+		}
+	case opcodes.I64x2Eq, opcodes.I64x2Ne, opcodes.I64x2LtS, opcodes.I64x2GtS, opcodes.I64x2LeS, opcodes.I64x2GeS,
+		opcodes.I64x2Add, opcodes.I64x2Sub, opcodes.I64x2Mul:
+		for i := 0; i < 2; i++ {
+			x, y := int64(a.u64(i)), int64(b.u64(i))
+			var z int64
+			switch code {
+			case opcodes.I64x2Add:
+				z = x + y
+			case opcodes.I64x2Sub:
+				z = x - y
+			case opcodes.I64x2Mul:
+				z = x * y
+			default:
+				z = simdMask(simdCompare(code, x, y))
+			}
+			r.setU64(i, uint64(z))
+		}
+
+	case opcodes.I32x4DotI16x8S:
+		for i := 0; i < 4; i++ {
+			x := int32(int16(a.u16(2*i)))*int32(int16(b.u16(2*i))) + int32(int16(a.u16(2*i+1)))*int32(int16(b.u16(2*i+1)))
+			r.setU32(i, uint32(x))
+		}
+	case opcodes.I16x8ExtmulLowI8x16S, opcodes.I16x8ExtmulHighI8x16S, opcodes.I16x8ExtmulLowI8x16U, opcodes.I16x8ExtmulHighI8x16U:
+		base := 0
+		if code == opcodes.I16x8ExtmulHighI8x16S || code == opcodes.I16x8ExtmulHighI8x16U {
+			base = 8
+		}
+		for i := 0; i < 8; i++ {
+			x, y := a[base+i], b[base+i]
+			if code == opcodes.I16x8ExtmulLowI8x16S || code == opcodes.I16x8ExtmulHighI8x16S {
+				r.setU16(i, uint16(int16(int8(x))*int16(int8(y))))
+			} else {
+				r.setU16(i, uint16(x)*uint16(y))
+			}
+		}
+	case opcodes.I32x4ExtmulLowI16x8S, opcodes.I32x4ExtmulHighI16x8S, opcodes.I32x4ExtmulLowI16x8U, opcodes.I32x4ExtmulHighI16x8U:
+		base := 0
+		if code == opcodes.I32x4ExtmulHighI16x8S || code == opcodes.I32x4ExtmulHighI16x8U {
+			base = 4
+		}
+		for i := 0; i < 4; i++ {
+			x, y := a.u16(base+i), b.u16(base+i)
+			if code == opcodes.I32x4ExtmulLowI16x8S || code == opcodes.I32x4ExtmulHighI16x8S {
+				r.setU32(i, uint32(int32(int16(x))*int32(int16(y))))
+			} else {
+				r.setU32(i, uint32(x)*uint32(y))
+			}
+		}
+	case opcodes.I64x2ExtmulLowI32x4S, opcodes.I64x2ExtmulHighI32x4S, opcodes.I64x2ExtmulLowI32x4U, opcodes.I64x2ExtmulHighI32x4U:
+		base := 0
+		if code == opcodes.I64x2ExtmulHighI32x4S || code == opcodes.I64x2ExtmulHighI32x4U {
+			base = 2
+		}
+		for i := 0; i < 2; i++ {
+			x, y := a.u32(base+i), b.u32(base+i)
+			if code == opcodes.I64x2ExtmulLowI32x4S || code == opcodes.I64x2ExtmulHighI32x4S {
+				r.setU64(i, uint64(int64(int32(x))*int64(int32(y))))
+			} else {
+				r.setU64(i, uint64(x)*uint64(y))
+			}
+		}
+
+	case opcodes.F32x4Eq, opcodes.F32x4Ne, opcodes.F32x4Lt, opcodes.F32x4Gt, opcodes.F32x4Le, opcodes.F32x4Ge:
+		for i := 0; i < 4; i++ {
+			r.setU32(i, uint32(simdMask(simdFloatCompare(code, float64(a.f32(i)), float64(b.f32(i))))))
+		}
+	case opcodes.F64x2Eq, opcodes.F64x2Ne, opcodes.F64x2Lt, opcodes.F64x2Gt, opcodes.F64x2Le, opcodes.F64x2Ge:
+		for i := 0; i < 2; i++ {
+			r.setU64(i, uint64(simdMask(simdFloatCompare(code, a.f64(i), b.f64(i)))))
+		}
+	case opcodes.F32x4Add, opcodes.F32x4Sub, opcodes.F32x4Mul, opcodes.F32x4Div,
+		opcodes.F32x4Min, opcodes.F32x4Max, opcodes.F32x4Pmin, opcodes.F32x4Pmax:
+		for i := 0; i < 4; i++ {
+			x, y := a.f32(i), b.f32(i)
+			switch code {
+			case opcodes.F32x4Add:
+				r.setF32(i, x+y)
+			case opcodes.F32x4Sub:
+				r.setF32(i, x-y)
+			case opcodes.F32x4Mul:
+				r.setF32(i, x*y)
+			case opcodes.F32x4Div:
+				r.setF32(i, x/y)
+			case opcodes.F32x4Min:
+				r.setF32(i, float32(simdMin(float64(x), float64(y))))
+			case opcodes.F32x4Max:
+				r.setF32(i, float32(simdMax(float64(x), float64(y))))
+			case opcodes.F32x4Pmin:
+				if y < x {
+					r.setU32(i, b.u32(i))
+				} else {
+					r.setU32(i, a.u32(i))
+				}
+			default: // pmax
+				if x < y {
+					r.setU32(i, b.u32(i))
+				} else {
+					r.setU32(i, a.u32(i))
+				}
+			}
+		}
+	case opcodes.F64x2Add, opcodes.F64x2Sub, opcodes.F64x2Mul, opcodes.F64x2Div,
+		opcodes.F64x2Min, opcodes.F64x2Max, opcodes.F64x2Pmin, opcodes.F64x2Pmax:
+		for i := 0; i < 2; i++ {
+			x, y := a.f64(i), b.f64(i)
+			switch code {
+			case opcodes.F64x2Add:
+				r.setF64(i, x+y)
+			case opcodes.F64x2Sub:
+				r.setF64(i, x-y)
+			case opcodes.F64x2Mul:
+				r.setF64(i, x*y)
+			case opcodes.F64x2Div:
+				r.setF64(i, x/y)
+			case opcodes.F64x2Min:
+				r.setF64(i, simdMin(x, y))
+			case opcodes.F64x2Max:
+				r.setF64(i, simdMax(x, y))
+			case opcodes.F64x2Pmin:
+				if y < x {
+					r.setU64(i, b.u64(i))
+				} else {
+					r.setU64(i, a.u64(i))
+				}
+			default: // pmax
+				if x < y {
+					r.setU64(i, b.u64(i))
+				} else {
+					r.setU64(i, a.u64(i))
+				}
+			}
+		}
+	}
+	return r
+}
+
+// simdIntOp applies the integer instruction `code` to lanes of at most 32
+// bits, given both as signed (sx, sy) and unsigned (ux, uy) values. min, max
+// and umax are the bounds of the signed and unsigned lane values. The result
+// is truncated to the lane width by the caller.
+func simdIntOp(code opcodes.SIMDOpcode, sx, ux, sy, uy, min, max, umax int64) int64 {
+	switch code {
+	case opcodes.I8x16Add, opcodes.I16x8Add, opcodes.I32x4Add:
+		return ux + uy
+	case opcodes.I8x16Sub, opcodes.I16x8Sub, opcodes.I32x4Sub:
+		return ux - uy
+	case opcodes.I16x8Mul, opcodes.I32x4Mul:
+		return ux * uy
+	case opcodes.I8x16AddSatS, opcodes.I16x8AddSatS:
+		return saturate(sx+sy, min, max)
+	case opcodes.I8x16AddSatU, opcodes.I16x8AddSatU:
+		return saturate(ux+uy, 0, umax)
+	case opcodes.I8x16SubSatS, opcodes.I16x8SubSatS:
+		return saturate(sx-sy, min, max)
+	case opcodes.I8x16SubSatU, opcodes.I16x8SubSatU:
+		return saturate(ux-uy, 0, umax)
+	case opcodes.I8x16MinS, opcodes.I16x8MinS, opcodes.I32x4MinS:
+		if sy < sx {
+			return sy
+		}
+		return sx
+	case opcodes.I8x16MinU, opcodes.I16x8MinU, opcodes.I32x4MinU:
+		if uy < ux {
+			return uy
+		}
+		return ux
+	case opcodes.I8x16MaxS, opcodes.I16x8MaxS, opcodes.I32x4MaxS:
+		if sy > sx {
+			return sy
+		}
+		return sx
+	case opcodes.I8x16MaxU, opcodes.I16x8MaxU, opcodes.I32x4MaxU:
+		if uy > ux {
+			return uy
+		}
+		return ux
+	case opcodes.I8x16AvgrU, opcodes.I16x8AvgrU:
+		return (ux + uy + 1) / 2
+	case opcodes.I16x8Q15mulrSatS:
+		return saturate((sx*sy+0x4000)>>15, min, max)
+	}
+	return simdMask(simdCompare(code, sx, sy) || simdCompareU(code, ux, uy))
+}
+
+// simdCompare evaluates the equality and signed comparison instructions.
+func simdCompare(code opcodes.SIMDOpcode, x, y int64) bool {
+	switch code {
+	case opcodes.I8x16Eq, opcodes.I16x8Eq, opcodes.I32x4Eq, opcodes.I64x2Eq:
+		return x == y
+	case opcodes.I8x16Ne, opcodes.I16x8Ne, opcodes.I32x4Ne, opcodes.I64x2Ne:
+		return x != y
+	case opcodes.I8x16LtS, opcodes.I16x8LtS, opcodes.I32x4LtS, opcodes.I64x2LtS:
+		return x < y
+	case opcodes.I8x16GtS, opcodes.I16x8GtS, opcodes.I32x4GtS, opcodes.I64x2GtS:
+		return x > y
+	case opcodes.I8x16LeS, opcodes.I16x8LeS, opcodes.I32x4LeS, opcodes.I64x2LeS:
+		return x <= y
+	case opcodes.I8x16GeS, opcodes.I16x8GeS, opcodes.I32x4GeS, opcodes.I64x2GeS:
+		return x >= y
+	}
+	return false
+}
+
+// simdCompareU evaluates the unsigned comparison instructions.
+func simdCompareU(code opcodes.SIMDOpcode, x, y int64) bool {
+	switch code {
+	case opcodes.I8x16LtU, opcodes.I16x8LtU, opcodes.I32x4LtU:
+		return x < y
+	case opcodes.I8x16GtU, opcodes.I16x8GtU, opcodes.I32x4GtU:
+		return x > y
+	case opcodes.I8x16LeU, opcodes.I16x8LeU, opcodes.I32x4LeU:
+		return x <= y
+	case opcodes.I8x16GeU, opcodes.I16x8GeU, opcodes.I32x4GeU:
+		return x >= y
+	}
+	return false
+}
+
+func simdFloatCompare(code opcodes.SIMDOpcode, x, y float64) bool {
+	switch code {
+	case opcodes.F32x4Eq, opcodes.F64x2Eq:
+		return x == y
+	case opcodes.F32x4Ne, opcodes.F64x2Ne:
+		return x != y
+	case opcodes.F32x4Lt, opcodes.F64x2Lt:
+		return x < y
+	case opcodes.F32x4Gt, opcodes.F64x2Gt:
+		return x > y
+	case opcodes.F32x4Le, opcodes.F64x2Le:
+		return x <= y
+	default: // ge
+		return x >= y
+	}
+}
+
+// simdMin and simdMax are math.Min and math.Max, except that NaN operands
+// take precedence over infinite ones.
+func simdMin(x, y float64) float64 {
+	if x != x || y != y {
+		return math.NaN()
+	}
+	return math.Min(x, y)
+}
+
+func simdMax(x, y float64) float64 {
+	if x != x || y != y {
+		return math.NaN()
+	}
+	return math.Max(x, y)
+}
+
+// simdMask returns the lane value of comparison results, all ones for true.
+func simdMask(b bool) int64 {
+	if b {
+		return -1
+	}
+	return 0
+}
+
+func saturate(x, min, max int64) int64 {
+	switch {
+	case x < min:
+		return min
+	case x > max:
+		return max
+	}
+	return x
+}
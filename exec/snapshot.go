@@ -1,6 +1,10 @@
 package exec
 
-import "github.com/vmihailenco/msgpack"
+import (
+	"errors"
+
+	"github.com/vmihailenco/msgpack"
+)
 
 func (vm *VirtualMachine) ReadSnapshot() *Snapshot {
 	frames := make([]frameSnapshot, len(vm.CallStack))
@@ -19,6 +23,9 @@ func (vm *VirtualMachine) ReadSnapshot() *Snapshot {
 		NumValueSlots: vm.NumValueSlots,
 		Gas:           vm.Gas,
 		Yielded:       vm.Yielded,
+		YieldedValues: vm.YieldedValues,
+		DroppedData:   vm.droppedData,
+		DroppedElems:  vm.droppedElems,
 	}
 
 	b, err := msgpack.Marshal(ss)
@@ -27,9 +34,15 @@ func (vm *VirtualMachine) ReadSnapshot() *Snapshot {
 		panic(err)
 	}
 
+	var memories [][]byte
+	for i := 1; i < len(vm.memories); i++ {
+		memories = append(memories, vm.memories[i].view())
+	}
+
 	return &Snapshot{
-		State:  b,
-		Memory: vm.Memory,
+		State:    b,
+		Memory:   vm.Memory,
+		Memories: memories,
 	}
 }
 
@@ -39,6 +52,9 @@ func (vm *VirtualMachine) WriteSnapshot(ss *Snapshot) error {
 	if err != nil {
 		return err
 	}
+	if len(ss.Memories) != 0 && len(ss.Memories) != len(vm.memories)-1 {
+		return errors.New("snapshot does not match the memories of the virtual machine")
+	}
 
 	vm.CallStack = make([]Frame, len(state.CallStack))
 	for i, f := range state.CallStack {
@@ -55,8 +71,21 @@ func (vm *VirtualMachine) WriteSnapshot(ss *Snapshot) error {
 	vm.NumValueSlots = state.NumValueSlots
 	vm.Gas = state.Gas
 	vm.Yielded = state.Yielded
+	vm.YieldedValues = state.YieldedValues
+	if state.DroppedData != nil {
+		vm.droppedData = state.DroppedData
+	}
+	if state.DroppedElems != nil {
+		vm.droppedElems = state.DroppedElems
+	}
 
 	vm.Memory = ss.Memory
+	for i, b := range ss.Memories {
+		if mem := vm.memories[i+1]; !mem.Shared {
+			mem.Bytes = b
+		}
+	}
+	vm.syncMemory()
 
 	return nil
 }
@@ -68,6 +97,9 @@ type stateSnapshot struct {
 	NumValueSlots int
 	Gas           uint64
 	Yielded       int64
+	YieldedValues []int64
+	DroppedData   []bool
+	DroppedElems  []bool
 }
 
 type frameSnapshot struct {
@@ -79,7 +111,10 @@ type frameSnapshot struct {
 	Continuation int32
 }
 
+// Snapshot holds the state of a virtual machine. Memory holds the bytes of
+// its first memory, and Memories those of the others.
 type Snapshot struct {
-	State  []byte
-	Memory []byte
+	State    []byte
+	Memory   []byte
+	Memories [][]byte
 }
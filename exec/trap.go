@@ -0,0 +1,225 @@
+package exec
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/perlin-network/life/compiler/opcodes"
+)
+
+// TrapKind denotes the cause of a Trap.
+type TrapKind int
+
+const (
+	// TrapUnknown is the kind of traps that could not be classified.
+	TrapUnknown TrapKind = iota
+	TrapUnreachable
+	TrapIntegerDivideByZero
+	TrapIntegerOverflow
+	TrapMemoryOutOfBounds
+	TrapUndefinedElement
+	TrapIndirectCallTypeMismatch
+	TrapCallStackExhausted
+	TrapGasLimitExceeded
+	TrapFloatingPointDisabled
+
+	// TrapInterrupted is the kind of traps raised when the context passed to
+	// RunContext is done. Err holds the error of the context.
+	TrapInterrupted
+
+	// TrapHostFunction is the kind of traps raised by panics in function imports.
+	TrapHostFunction
+
+	TrapTableOutOfBounds
+
+	// TrapSIMDDisabled is the kind of traps raised by SIMD instructions when
+	// VMConfig.DisableSIMD is set.
+	TrapSIMDDisabled
+
+	// TrapUnalignedAtomic is the kind of traps raised by atomic memory
+	// accesses whose address is not aligned to their size.
+	TrapUnalignedAtomic
+
+	// TrapExpectedSharedMemory is the kind of traps raised by
+	// memory.atomic.wait on unshared memories.
+	TrapExpectedSharedMemory
+
+	// TrapUncaughtException is the kind of traps raised by exceptions no
+	// catch clause catches. Err holds the *Exception.
+	TrapUncaughtException
+)
+
+var trapKindNames = [...]string{
+	TrapUnknown:                  "unknown trap",
+	TrapUnreachable:              "unreachable executed",
+	TrapIntegerDivideByZero:      "integer division by zero",
+	TrapIntegerOverflow:          "integer overflow",
+	TrapMemoryOutOfBounds:        "memory access out of bounds",
+	TrapUndefinedElement:         "undefined table element",
+	TrapIndirectCallTypeMismatch: "indirect call type mismatch",
+	TrapCallStackExhausted:       "call stack exhausted",
+	TrapGasLimitExceeded:         "gas limit exceeded",
+	TrapFloatingPointDisabled:    "floating point disabled",
+	TrapInterrupted:              "execution interrupted",
+	TrapHostFunction:             "host function failed",
+	TrapTableOutOfBounds:         "table access out of bounds",
+	TrapSIMDDisabled:             "simd disabled",
+	TrapUnalignedAtomic:          "unaligned atomic",
+	TrapExpectedSharedMemory:     "expected shared memory",
+	TrapUncaughtException:        "uncaught exception",
+}
+
+func (k TrapKind) String() string {
+	if k < 0 || int(k) >= len(trapKindNames) {
+		return fmt.Sprintf("TrapKind(%d)", int(k))
+	}
+	return trapKindNames[k]
+}
+
+// TrapFrame is a single entry of the wasm call stack captured by a Trap.
+type TrapFrame struct {
+	FunctionID   int
+	FunctionName string
+	IP           int // offset of the current instruction in the compiled function code
+}
+
+// Trap is the error returned when the execution of a WebAssembly module is
+// aborted. FunctionID is -1 when the location is unknown, as is the case for
+// traps raised in AOT-compiled code.
+type Trap struct {
+	Kind         TrapKind
+	FunctionID   int
+	FunctionName string
+	IP           int
+
+	// Stack holds the wasm call stack at the time of the trap, innermost frame first.
+	Stack []TrapFrame
+
+	// Err is the underlying cause, if any.
+	Err error
+
+	// callee holds the call stack of another instance the trap was raised in,
+	// when forwarded through a cross-instance call.
+	callee []TrapFrame
+}
+
+func (t *Trap) Error() string {
+	msg := "wasm: " + t.Kind.String()
+	if t.Err != nil {
+		msg += ": " + t.Err.Error()
+	}
+
+	if t.FunctionID >= 0 {
+		if t.FunctionName != "" {
+			msg += fmt.Sprintf(" in function %d (%s) at ip %d", t.FunctionID, t.FunctionName, t.IP)
+		} else {
+			msg += fmt.Sprintf(" in function %d at ip %d", t.FunctionID, t.IP)
+		}
+	}
+	return msg
+}
+
+func (t *Trap) Unwrap() error {
+	return t.Err
+}
+
+// StackTrace formats the captured call stack, one frame per line.
+func (t *Trap) StackTrace() string {
+	var b strings.Builder
+	for i, f := range t.Stack {
+		fmt.Fprintf(&b, "<%d> [%d]", len(t.Stack)-1-i, f.FunctionID)
+		if f.FunctionName != "" {
+			fmt.Fprintf(&b, " %s", f.FunctionName)
+		}
+		fmt.Fprintf(&b, " at ip %d\n", f.IP)
+	}
+	return b.String()
+}
+
+func (vm *VirtualMachine) functionName(functionID int) string {
+	if functionID >= 0 && functionID < len(vm.Module.FunctionNames) {
+		return vm.Module.FunctionNames[functionID]
+	}
+	return ""
+}
+
+// locate records the call stack of the virtual machine into the trap, with
+// `ip` being the offset of the faulting instruction in the current frame.
+func (vm *VirtualMachine) locate(t *Trap, ip int) {
+	t.FunctionID = -1
+	t.Stack = make([]TrapFrame, 0, len(t.callee)+vm.CurrentFrame+1)
+	t.Stack = append(t.Stack, t.callee...)
+
+	for i := vm.CurrentFrame; i >= 0; i-- {
+		frame := &vm.CallStack[i]
+
+		frameIP := frame.IP
+		if i == vm.CurrentFrame {
+			frameIP = ip
+		}
+
+		t.Stack = append(t.Stack, TrapFrame{
+			FunctionID:   frame.FunctionID,
+			FunctionName: vm.functionName(frame.FunctionID),
+			IP:           frameIP,
+		})
+	}
+
+	if len(t.Stack) != 0 {
+		t.FunctionID = t.Stack[0].FunctionID
+		t.FunctionName = t.Stack[0].FunctionName
+		t.IP = t.Stack[0].IP
+	}
+}
+
+// isMemoryAccess tells whether an instruction accesses linear memory.
+func isMemoryAccess(ins opcodes.Opcode) bool {
+	return ins >= opcodes.I32Load && ins <= opcodes.I64Store32
+}
+
+// recoverTrap converts a value recovered from a panic raised while executing
+// the instruction at offset `ip` of the current frame into a Trap. Exits are
+// passed through unchanged.
+func (vm *VirtualMachine) recoverTrap(err interface{}, ip int) interface{} {
+	if exitErr, ok := err.(*ExitError); ok {
+		return exitErr
+	}
+
+	t, ok := err.(*Trap)
+	if !ok {
+		t = &Trap{Kind: TrapUnknown, Err: unifyTrapCause(err)}
+
+		ins := opcodes.Unknown
+		if vm.CurrentFrame >= 0 && ip+4 < len(vm.CallStack[vm.CurrentFrame].Code) {
+			ins = opcodes.Opcode(vm.CallStack[vm.CurrentFrame].Code[ip+4])
+		}
+
+		// Out of bounds memory and table accesses are caught by the bounds
+		// checks of the Go runtime.
+		_, isRuntimeError := err.(runtime.Error)
+		switch {
+		case ins == opcodes.InvokeImport:
+			t.Kind = TrapHostFunction
+		case isRuntimeError && isMemoryAccess(ins):
+			t.Kind = TrapMemoryOutOfBounds
+			t.Err = nil
+		case isRuntimeError && (ins == opcodes.CallIndirect || ins == opcodes.ReturnCallIndirect):
+			t.Kind = TrapUndefinedElement
+			t.Err = nil
+		}
+	}
+
+	if t.Stack == nil {
+		vm.locate(t, ip)
+	}
+	return t
+}
+
+func unifyTrapCause(err interface{}) error {
+	if err, ok := err.(error); ok {
+		return err
+	}
+	return errors.New(fmt.Sprint(err))
+}
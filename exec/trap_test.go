@@ -0,0 +1,173 @@
+package exec_test
+
+import (
+	"testing"
+
+	"github.com/perlin-network/life/exec"
+	. "github.com/perlin-network/life/internal/wasmtest"
+)
+
+// runTrap runs the export name of a module, expecting a trap of the given
+// kind.
+func runTrap(t *testing.T, vm *exec.VirtualMachine, name string, kind exec.TrapKind) *exec.Trap {
+	t.Helper()
+	entry, ok := vm.GetFunctionExport(name)
+	if !ok {
+		t.Fatalf("no export %s", name)
+	}
+	_, err := vm.Run(entry)
+	trap, ok := err.(*exec.Trap)
+	if !ok || trap.Kind != kind {
+		t.Fatalf("expected a %v trap, got %v", kind, err)
+	}
+	return trap
+}
+
+func TestCallStackDepthExhausted(t *testing.T) {
+	m := &Module{
+		Types:   [][]byte{FuncType(nil, nil)},
+		Funcs:   []Func{{Type: 0, Body: Call(0)}},
+		Exports: [][]byte{Export("recurse", KindFunc, 0)},
+	}
+	vm, err := exec.NewVirtualMachine(m.Bytes(), exec.VMConfig{MaxCallStackDepth: 8}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trap := runTrap(t, vm, "recurse", exec.TrapCallStackExhausted)
+	if len(trap.Stack) != 8 || trap.FunctionID != 0 {
+		t.Fatalf("trap raised in function %d with %d frames", trap.FunctionID, len(trap.Stack))
+	}
+}
+
+func TestValueSlotsExhaustedByCall(t *testing.T) {
+	m := &Module{
+		Types: [][]byte{FuncType(nil, nil)},
+		Funcs: []Func{
+			{Type: 0, Body: Call(1)},
+			{Type: 0, Locals: Locals(100, I64)},
+		},
+		Exports: [][]byte{Export("run", KindFunc, 0)},
+	}
+	vm, err := exec.NewVirtualMachine(m.Bytes(), exec.VMConfig{MaxValueSlots: 50}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The trap is raised by the call, in the caller.
+	trap := runTrap(t, vm, "run", exec.TrapCallStackExhausted)
+	if len(trap.Stack) != 1 || trap.FunctionID != 0 {
+		t.Fatalf("trap raised in function %d with %d frames", trap.FunctionID, len(trap.Stack))
+	}
+	if code := vm.FunctionCode[0]; vm.NumValueSlots != code.NumRegs+code.NumParams+code.NumLocals {
+		t.Fatalf("%d value slots in use", vm.NumValueSlots)
+	}
+}
+
+func TestValueSlotsExhaustedByTailCall(t *testing.T) {
+	m := &Module{
+		Types: [][]byte{FuncType(nil, nil)},
+		Funcs: []Func{
+			{Type: 0, Body: Call(1)},
+			{Type: 0, Body: []byte{0x12, 0x02}}, // return_call 2
+			{Type: 0, Locals: Locals(100, I64)},
+			{Type: 0, Body: Call(4)},
+			{Type: 0, Body: Cat(I32Const(0), []byte{0x13, 0x00, 0x00})}, // return_call_indirect
+		},
+		Tables:  [][]byte{Cat([]byte{FuncRef}, Limits(1, 1))},
+		Elems:   [][]byte{Cat([]byte{0}, I32Const(0), []byte{0x0b}, Vec(U(2)))},
+		Exports: [][]byte{Export("direct", KindFunc, 0), Export("indirect", KindFunc, 3)},
+	}
+
+	for _, name := range []string{"direct", "indirect"} {
+		vm, err := exec.NewVirtualMachine(m.Bytes(), exec.VMConfig{MaxValueSlots: 50}, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The trap is raised by the tail call, in the function making it.
+		trap := runTrap(t, vm, name, exec.TrapCallStackExhausted)
+		entry, _ := vm.GetFunctionExport(name)
+		if len(trap.Stack) != 2 || trap.FunctionID != entry+1 {
+			t.Fatalf("%s: trap raised in function %d with %d frames", name, trap.FunctionID, len(trap.Stack))
+		}
+
+		numValueSlots := 0
+		for _, id := range []int{entry, entry + 1} {
+			code := vm.FunctionCode[id]
+			numValueSlots += code.NumRegs + code.NumParams + code.NumLocals
+		}
+		if vm.NumValueSlots != numValueSlots {
+			t.Fatalf("%s: %d value slots in use, expected %d", name, vm.NumValueSlots, numValueSlots)
+		}
+	}
+}
+
+func TestPostMVPTraps(t *testing.T) {
+	noop := [][]byte{FuncType(nil, nil)}
+	memory := [][]byte{Limits(1, 1)}
+	table := [][]byte{Cat([]byte{FuncRef}, Limits(1, 1))}
+
+	tests := []struct {
+		name string
+		m    *Module
+		kind exec.TrapKind
+	}{
+		{"unaligned atomic", &Module{
+			Types:    noop,
+			Memories: memory,
+			Funcs:    []Func{{Type: 0, Body: Cat(I32Const(1), []byte{0xfe, 0x10, 0x02, 0x00, 0x1a})}}, // i32.atomic.load
+		}, exec.TrapUnalignedAtomic},
+		{"wait on an unshared memory", &Module{
+			Types:    noop,
+			Memories: memory,
+			Funcs:    []Func{{Type: 0, Body: Cat(I32Const(0), I32Const(0), I64Const(-1), []byte{0xfe, 0x01, 0x02, 0x00, 0x1a})}}, // memory.atomic.wait32
+		}, exec.TrapExpectedSharedMemory},
+		{"64-bit address beyond 4GiB", &Module{
+			Types:    noop,
+			Memories: [][]byte{Cat([]byte{4}, U(1))},
+			Funcs:    []Func{{Type: 0, Body: Cat(I64Const(1<<32), []byte{0x28, 0x02, 0x00, 0x1a})}}, // i32.load
+		}, exec.TrapMemoryOutOfBounds},
+		{"memory.fill out of bounds", &Module{
+			Types:    noop,
+			Memories: memory,
+			Funcs:    []Func{{Type: 0, Body: Cat(I32Const(65535), I32Const(0), I32Const(2), []byte{0xfc, 0x0b, 0x00})}},
+		}, exec.TrapMemoryOutOfBounds},
+		{"table.get out of bounds", &Module{
+			Types:  noop,
+			Tables: table,
+			Funcs:  []Func{{Type: 0, Body: Cat(I32Const(1), []byte{0x25, 0x00, 0x1a})}},
+		}, exec.TrapTableOutOfBounds},
+		{"return_call_indirect type mismatch", &Module{
+			Types:  [][]byte{FuncType(nil, nil), FuncType(nil, []byte{I32})},
+			Tables: table,
+			Funcs: []Func{
+				{Type: 0, Body: Cat(I32Const(0), []byte{0x13, 0x00, 0x00})},
+				{Type: 1, Body: I32Const(1)},
+			},
+			Elems: [][]byte{Cat([]byte{0}, I32Const(0), []byte{0x0b}, Vec(U(1)))},
+		}, exec.TrapIndirectCallTypeMismatch},
+		{"uncaught exception", &Module{
+			Types:   noop,
+			Imports: []Import{{Module: "env", Field: "tag", Kind: KindTag, Desc: []byte{0, 0}}},
+			Funcs:   []Func{{Type: 0, Body: []byte{0x08, 0x00}}}, // throw
+		}, exec.TrapUncaughtException},
+	}
+
+	imports := exec.NewImports()
+	imports.Module("env").Tag("tag", exec.NewTag())
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.m.Exports = [][]byte{Export("run", KindFunc, 0)}
+			vm, err := exec.NewVirtualMachine(test.m.Bytes(), exec.VMConfig{}, imports, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			runTrap(t, vm, "run", test.kind)
+
+			// The instance can be run again once reset.
+			vm.Reset()
+			runTrap(t, vm, "run", test.kind)
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package exec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/go-interpreter/wagon/wasm"
+	"github.com/perlin-network/life/compiler"
+)
+
+// ErrExportNotFound is returned by Call and CallContext when the module has
+// no function export of the given name.
+var ErrExportNotFound = errors.New("export not found")
+
+// Value is a typed WebAssembly value.
+type Value struct {
+	Type wasm.ValueType
+	raw  int64
+	high int64 // high half of v128 values
+}
+
+// I32 returns an i32 value.
+func I32(v int32) Value {
+	return Value{Type: wasm.ValueTypeI32, raw: int64(uint32(v))}
+}
+
+// I64 returns an i64 value.
+func I64(v int64) Value {
+	return Value{Type: wasm.ValueTypeI64, raw: v}
+}
+
+// F32 returns an f32 value.
+func F32(v float32) Value {
+	return Value{Type: wasm.ValueTypeF32, raw: int64(math.Float32bits(v))}
+}
+
+// F64 returns an f64 value.
+func F64(v float64) Value {
+	return Value{Type: wasm.ValueTypeF64, raw: int64(math.Float64bits(v))}
+}
+
+// V128 returns a v128 value from its low and high halves, holding its lanes
+// in little-endian order.
+func V128(lo, hi uint64) Value {
+	return Value{Type: compiler.ValueTypeV128, raw: int64(lo), high: int64(hi)}
+}
+
+// NullRef returns the null reference of the reference type t.
+func NullRef(t wasm.ValueType) Value {
+	return Value{Type: t, raw: NullElement}
+}
+
+// ExternRefValue returns an externref value referring to the host value v,
+// or the null reference if v is nil; see ExternRef.
+func (vm *VirtualMachine) ExternRefValue(v interface{}) Value {
+	return Value{Type: compiler.ValueTypeExternRef, raw: vm.ExternRef(v)}
+}
+
+// RawValue returns a value of type t from its representation in interpreter
+// registers.
+func RawValue(t wasm.ValueType, raw int64) Value {
+	if t == wasm.ValueTypeI32 || t == wasm.ValueTypeF32 {
+		raw = int64(uint32(raw))
+	}
+	return Value{Type: t, raw: raw}
+}
+
+// Raw returns the representation of the value in interpreter registers.
+func (v Value) Raw() int64 {
+	return v.raw
+}
+
+// I32 returns the value of an i32 value. Panics if the value has another type.
+func (v Value) I32() int32 {
+	v.expect(wasm.ValueTypeI32)
+	return int32(v.raw)
+}
+
+// I64 returns the value of an i64 value. Panics if the value has another type.
+func (v Value) I64() int64 {
+	v.expect(wasm.ValueTypeI64)
+	return v.raw
+}
+
+// F32 returns the value of an f32 value. Panics if the value has another type.
+func (v Value) F32() float32 {
+	v.expect(wasm.ValueTypeF32)
+	return math.Float32frombits(uint32(v.raw))
+}
+
+// F64 returns the value of an f64 value. Panics if the value has another type.
+func (v Value) F64() float64 {
+	v.expect(wasm.ValueTypeF64)
+	return math.Float64frombits(uint64(v.raw))
+}
+
+// V128 returns the low and high halves of a v128 value. Panics if the value
+// has another type.
+func (v Value) V128() (lo, hi uint64) {
+	v.expect(compiler.ValueTypeV128)
+	return uint64(v.raw), uint64(v.high)
+}
+
+func (v Value) expect(t wasm.ValueType) {
+	if v.Type != t {
+		panic(fmt.Errorf("value is %s, not %s", typeName(v.Type), typeName(t)))
+	}
+}
+
+func (v Value) String() string {
+	switch v.Type {
+	case wasm.ValueTypeI32:
+		return fmt.Sprintf("i32:%d", int32(v.raw))
+	case wasm.ValueTypeI64:
+		return fmt.Sprintf("i64:%d", v.raw)
+	case wasm.ValueTypeF32:
+		return fmt.Sprintf("f32:%v", math.Float32frombits(uint32(v.raw)))
+	case wasm.ValueTypeF64:
+		return fmt.Sprintf("f64:%v", math.Float64frombits(uint64(v.raw)))
+	case compiler.ValueTypeV128:
+		return fmt.Sprintf("v128:0x%016x%016x", uint64(v.high), uint64(v.raw))
+	case compiler.ValueTypeFuncRef, compiler.ValueTypeExternRef:
+		if v.raw == NullElement {
+			return typeName(v.Type) + ":null"
+		}
+	}
+	return fmt.Sprintf("%s:%d", typeName(v.Type), v.raw)
+}
+
+// Call runs the exported function `name` with the given arguments, checking
+// them against the signature of the function, and returns its results.
+func (vm *VirtualMachine) Call(name string, args ...Value) ([]Value, error) {
+	return vm.call(nil, name, args)
+}
+
+// CallContext is like Call, but aborts the execution once ctx is done; see
+// RunContext.
+func (vm *VirtualMachine) CallContext(ctx context.Context, name string, args ...Value) ([]Value, error) {
+	return vm.call(ctx, name, args)
+}
+
+func (vm *VirtualMachine) call(ctx context.Context, name string, args []Value) ([]Value, error) {
+	functionID, ok := vm.GetFunctionExport(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrExportNotFound, name)
+	}
+
+	sig := functionSig(vm.Module.Base, functionID)
+	if sig == nil {
+		return nil, fmt.Errorf("invalid function index %d", functionID)
+	}
+
+	if err := checkArgs(sig, args); err != nil {
+		return nil, fmt.Errorf("call %s: %w", name, err)
+	}
+
+	params := make([]int64, 0, compiler.NumSlots(sig.ParamTypes))
+	for _, arg := range args {
+		params = append(params, arg.raw)
+		if arg.Type == compiler.ValueTypeV128 {
+			params = append(params, arg.high)
+		}
+	}
+
+	var ret int64
+	var err error
+	if ctx != nil {
+		ret, err = vm.RunContext(ctx, functionID, params...)
+	} else {
+		ret, err = vm.Run(functionID, params...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	raw := vm.collectResults(functionID, ret)
+	results := make([]Value, len(sig.ReturnTypes))
+	for i, t := range sig.ReturnTypes {
+		if t == compiler.ValueTypeV128 {
+			results[i] = V128(uint64(raw[0]), uint64(raw[1]))
+			raw = raw[2:]
+			continue
+		}
+		results[i] = RawValue(t, raw[0])
+		raw = raw[1:]
+	}
+	return results, nil
+}
+
+// checkArgs checks that args match the parameters of sig.
+func checkArgs(sig *wasm.FunctionSig, args []Value) error {
+	if len(args) != len(sig.ParamTypes) {
+		return fmt.Errorf("%w: got %d arguments, function expects %s", ErrSignatureMismatch, len(args), formatSig(sig))
+	}
+	for i, arg := range args {
+		if arg.Type != sig.ParamTypes[i] {
+			return fmt.Errorf("%w: argument %d is %s, function expects %s", ErrSignatureMismatch, i, typeName(arg.Type), formatSig(sig))
+		}
+	}
+	return nil
+}
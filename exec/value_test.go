@@ -0,0 +1,84 @@
+package exec_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/perlin-network/life/exec"
+	. "github.com/perlin-network/life/internal/wasmtest"
+)
+
+func TestCall(t *testing.T) {
+	m := &Module{
+		Types: [][]byte{FuncType([]byte{I32, I64}, []byte{I64, I32})},
+		Funcs: []Func{{Type: 0, Body: Cat(
+			LocalGet(1), LocalGet(0), []byte{0xac}, []byte{0x7c}, // i64.extend_i32_s, i64.add
+			LocalGet(0), I32Const(-1), []byte{0x73}, // i32.xor
+		)}},
+		Exports: [][]byte{Export("f", KindFunc, 0)},
+	}
+	vm, err := exec.NewVirtualMachine(m.Bytes(), exec.VMConfig{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := vm.Call("f", exec.I32(-2), exec.I64(1<<40))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].I64() != 1<<40-2 || results[1].I32() != 1 {
+		t.Fatalf("got %v", results)
+	}
+	if s := results[1].String(); s != "i32:1" {
+		t.Fatalf("formatted as %q", s)
+	}
+
+	// Refs are passed as handles of the virtual machine.
+	lib, err := exec.NewVirtualMachine(libModule(), exec.VMConfig{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err = lib.Call("id", lib.ExternRefValue("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := lib.Extern(results[0].Raw()); v != "hello" {
+		t.Fatalf("got %v", v)
+	}
+}
+
+func TestCallErrors(t *testing.T) {
+	vm, err := exec.NewVirtualMachine(libModule(), exec.VMConfig{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := vm.Call("missing"); !errors.Is(err, exec.ErrExportNotFound) {
+		t.Errorf("calling a missing export: %v", err)
+	}
+	for _, args := range [][]exec.Value{
+		{exec.I32(1)},
+		{exec.I32(1), exec.I64(2)},
+		{exec.I32(1), exec.I32(2), exec.I32(3)},
+	} {
+		if _, err := vm.Call("add", args...); !errors.Is(err, exec.ErrSignatureMismatch) {
+			t.Errorf("calling add with %v: %v", args, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := vm.CallContext(ctx, "add", exec.I32(1), exec.I32(2)); !errors.Is(err, context.Canceled) {
+		t.Errorf("calling with a canceled context: %v", err)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("i32 value read as f64")
+			}
+		}()
+		exec.I32(1).F64()
+	}()
+}
@@ -1,7 +1,9 @@
 package exec
 
 import (
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"math"
 	"math/bits"
@@ -26,6 +28,10 @@ const (
 
 	// JITCodeSizeThreshold is the lower-bound code size threshold for the JIT compiler.
 	JITCodeSizeThreshold = 30
+
+	// DefaultInstructionBudget is a reasonable VMConfig.InstructionBudget for
+	// VMs sharing a goroutine.
+	DefaultInstructionBudget = 10000
 )
 
 // LE is a simple alias to `binary.LittleEndian`.
@@ -47,6 +53,14 @@ type AOTService interface {
 	UnsafeInvokeFunction_0(vm *VirtualMachine, name string) uint64
 	UnsafeInvokeFunction_1(vm *VirtualMachine, name string, p0 uint64) uint64
 	UnsafeInvokeFunction_2(vm *VirtualMachine, name string, p0, p1 uint64) uint64
+
+	// Interrupt requests compiled code running on behalf of vm to stop with a
+	// TrapInterrupted trap, or withdraws the request.
+	Interrupt(vm *VirtualMachine, interrupt bool)
+
+	// ReadResults reads the results after the first one of the last function
+	// invoked into results.
+	ReadResults(vm *VirtualMachine, results []int64)
 }
 
 // VirtualMachine is a WebAssembly execution environment.
@@ -62,6 +76,7 @@ type VirtualMachine struct {
 	Memory           []byte
 	NumValueSlots    int
 	Yielded          int64
+	YieldedValues    []int64 // values passed along branches, returns and function imports after the first one
 	InsideExecute    bool
 	Delegate         func()
 	Exited           bool
@@ -69,10 +84,38 @@ type VirtualMachine struct {
 	ReturnValue      int64
 	Gas              uint64
 	GasLimitExceeded bool
+	BudgetExhausted  bool
 	GasPolicy        compiler.GasPolicy
 	ImportResolver   ImportResolver
 	AOTService       AOTService
 	StackTrace       string
+
+	ctx         context.Context
+	interrupted uint32 // accessed atomically
+
+	callStackBase int // depth of the calls suspended by nested calls, whose frames precede CallStack
+
+	memory      *Memory // first memory, also held by memories
+	memoryView  []byte  // value of Memory when last synchronized with memory
+	memories    []*Memory
+	memoryViews [][]byte // views of the memories after the first one
+	table       *Table   // first table, also held by tables
+	tableView   []uint32 // value of Table when last synchronized with table
+	tables      []*Table
+
+	refs       []interface{}         // host values and foreign functions referred to by handles, nil once released
+	refHandles map[interface{}]int64 // handles of the comparable values of refs
+	freeRefs   []int64               // released handles, reused by register
+
+	importedGlobals []*Global // shared imported mutable globals, nil for the others
+
+	droppedData  []bool // dropped state of the data segments
+	droppedElems []bool // dropped state of the element segments
+
+	tags      []*Tag
+	exception *Exception // exception being delivered to a catch clause
+	thrown    *Exception // exception thrown by the last function import
+	thrownIP  int        // offset of the call to the function import
 }
 
 // VMConfig denotes a set of options passed to a single VirtualMachine insta.ce
@@ -87,6 +130,28 @@ type VMConfig struct {
 	GasLimit                 uint64
 	DisableFloatingPoint     bool
 	ReturnOnGasLimitExceeded bool
+
+	// InstructionBudget is the number of instructions the interpreter
+	// executes before Execute returns to let the caller schedule other work.
+	// If zero, Execute runs until the next function import call or the end of
+	// the execution. AOT-compiled code is not preempted.
+	InstructionBudget int
+
+	// LazyImports defers resolving function imports to their first call, as
+	// opposed to resolving and checking all of them when the module or
+	// virtual machine is created. Signatures of host functions are not
+	// checked in this mode.
+	LazyImports bool
+
+	// DisableSIMD makes the SIMD instructions raise a TrapSIMDDisabled trap,
+	// v128 constants, locals, globals, parameters and results being still
+	// allowed. DisableFloatingPoint also applies to the floating point SIMD
+	// instructions.
+	DisableSIMD bool
+
+	// Optimizations selects the optimization passes run over the compiled
+	// code of each function. Gas is charged as for the unoptimized code.
+	Optimizations compiler.Optimizations
 }
 
 // Frame represents a call frame.
@@ -98,6 +163,17 @@ type Frame struct {
 	IP           int
 	ReturnReg    int
 	Continuation int32
+	Caught       []*Exception // exceptions caught by the catch clauses, by handler
+}
+
+// ExitError is returned by Run and RunWithGasLimit when a function import
+// terminated the virtual machine through Exit.
+type ExitError struct {
+	Code uint32
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit with code %d", e.Code)
 }
 
 // ImportResolver is an interface for allowing one to define imports to WebAssembly modules
@@ -116,6 +192,14 @@ type Module struct {
 	Globals         []int64
 	GasPolicy       compiler.GasPolicy
 	ImportResolver  ImportResolver
+
+	importedMemories    []*Memory // imported memories shared by all instances, nil for the others
+	importedMemoryPages []int     // sizes in pages of the imported memories
+	tables              []*Table  // tables of the first instance, as compiled by NCompile
+	importedTables      []*Table  // imported tables shared by all instances, nil for the others
+	importedTableSizes  []int     // sizes of the imported tables
+	importedGlobals     []*Global // imported mutable globals shared by all instances
+	importedTags        []*Tag    // imported tags, nil unless imported from a TagResolver
 }
 
 var (
@@ -144,6 +228,8 @@ func NewModule(
 	}
 
 	m.DisableFloatingPoint = config.DisableFloatingPoint
+	m.DisableSIMD = config.DisableSIMD
+	m.Optimizations = config.Optimizations
 
 	functionCode, err := m.CompileForInterpreter(gasPolicy)
 	if err != nil {
@@ -152,89 +238,46 @@ func NewModule(
 
 	defer utils.CatchPanic(&retErr)
 
-	table := emptyTable
-	globals := emptyGlobals
-	funcImports := emptyFuncImports
-
-	if m.Base.Import != nil && impResolver != nil {
-		for _, imp := range m.Base.Import.Entries {
-			switch imp.Type.Kind() {
-			case wasm.ExternalFunction:
-				funcImports = append(funcImports, FunctionImportInfo{
-					ModuleName: imp.ModuleName,
-					FieldName:  imp.FieldName,
-					F:          nil, // deferred
-				})
-			case wasm.ExternalGlobal:
-				globals = append(globals, impResolver.ResolveGlobal(imp.ModuleName, imp.FieldName))
-			case wasm.ExternalMemory:
-				// TODO: Do we want a real import?
-				if m.Base.Memory != nil && len(m.Base.Memory.Entries) > 0 {
-					panic("cannot import another memory while we already have one")
-				}
-				m.Base.Memory = &wasm.SectionMemories{
-					Entries: []wasm.Memory{
-						{
-							Limits: wasm.ResizableLimits{
-								Initial: uint32(config.DefaultMemoryPages),
-							},
-						},
-					},
-				}
-			case wasm.ExternalTable:
-				// TODO: Do we want a real import?
-				if m.Base.Table != nil && len(m.Base.Table.Entries) > 0 {
-					panic("cannot import another table while we already have one")
-				}
-				m.Base.Table = &wasm.SectionTables{
-					Entries: []wasm.Table{
-						{
-							Limits: wasm.ResizableLimits{
-								Initial: uint32(config.DefaultTableSize),
-							},
-						},
-					},
-				}
-			default:
-				panic(fmt.Errorf("import kind not supported: %d", imp.Type.Kind()))
-			}
-		}
+	linked, err := resolveImports(m, config, impResolver)
+	if err != nil {
+		return nil, err
 	}
 
 	// Load global entries.
+	globals := linked.globals
 	for _, entry := range m.Base.GlobalIndexSpace {
 		globals = append(globals, execInitExpr(entry.Init, globals))
 	}
+	for _, g := range m.V128Globals {
+		globals = append(globals, g.High)
+	}
 
-	// Populate table elements.
-	if m.Base.Table != nil && len(m.Base.Table.Entries) > 0 {
-		t := &m.Base.Table.Entries[0]
-
-		if config.MaxTableSize != 0 && int(t.Limits.Initial) > config.MaxTableSize {
-			panic("max table size exceeded")
-		}
+	// Populate table elements. Tables are populated anew by each instance;
+	// these only check the element segments and serve as templates.
+	tables := newTables(m, config, nil, linked.tableSizes)
+	initElements(m, globals, tables, nil)
 
-		table = make([]uint32, int(t.Limits.Initial))
-		for i := 0; i < int(t.Limits.Initial); i++ {
-			table[i] = 0xffffffff
-		}
-		if m.Base.Elements != nil && len(m.Base.Elements.Entries) > 0 {
-			for _, e := range m.Base.Elements.Entries {
-				offset := int(execInitExpr(e.Offset, globals))
-				copy(table[offset:], e.Elems)
-			}
-		}
+	table := emptyTable
+	if len(tables) > 0 {
+		table = tables[0].Elements
 	}
 
 	return &Module{
-		Module:          m,
-		Config:          config,
-		FunctionCode:    functionCode,
-		FunctionImports: funcImports,
-		Table:           table,
-		Globals:         globals,
-		GasPolicy:       gasPolicy,
-		ImportResolver:  impResolver,
+		Module:              m,
+		Config:              config,
+		FunctionCode:        functionCode,
+		FunctionImports:     linked.funcImports,
+		Table:               table,
+		Globals:             globals,
+		GasPolicy:           gasPolicy,
+		ImportResolver:      impResolver,
+		importedMemories:    linked.memories,
+		importedMemoryPages: linked.memoryPages,
+		tables:              tables,
+		importedTables:      linked.tables,
+		importedTableSizes:  linked.tableSizes,
+		importedGlobals:     linked.globalVars,
+		importedTags:        linked.tags,
 	}, nil
 }
 
@@ -278,12 +321,18 @@ func (m *Module) GenerateNEnv(config NCompileConfig) string {
 	if !m.Config.DisableFloatingPoint {
 		builder.WriteString(compiler.NGEN_FP_HEADER)
 	}
+	if !m.Config.DisableSIMD {
+		builder.WriteString(compiler.NGEN_SIMD_HEADER)
+	}
 
 	bSprintf(builder, "static uint64_t globals[] = {")
 	for _, v := range m.Globals {
 		bSprintf(builder, "%dull,", uint64(v))
 	}
 	bSprintf(builder, "};\n")
+	numYielded := numYieldedValues(m.Module.Base)
+	bSprintf(builder, "uint64_t %syielded[%d];\n", compiler.NGEN_ENV_API_PREFIX, numYielded)
+	bSprintf(builder, "const uint64_t %snum_yielded = %d;\n", compiler.NGEN_ENV_API_PREFIX, numYielded)
 
 	for i, code := range m.FunctionCode {
 		bSprintf(builder, "uint64_t %s%d(struct VirtualMachine *", compiler.NGEN_FUNCTION_PREFIX, i)
@@ -293,27 +342,9 @@ func (m *Module) GenerateNEnv(config NCompileConfig) string {
 		bSprintf(builder, ");\n")
 	}
 
-	// call_indirect dispatcher.
-	bSprintf(builder, "struct TableEntry { uint64_t num_params; void *func; };\n")
-	bSprintf(builder, "static const uint64_t num_table_entries = %d;\n", len(m.Table))
-	bSprintf(builder, "static struct TableEntry table[] = {\n")
-	for _, entry := range m.Table {
-		if entry == math.MaxUint32 {
-			bSprintf(builder, "{ .num_params = 0, .func = 0 },\n")
-		} else {
-			functionID := int(entry)
-			code := m.FunctionCode[functionID]
-
-			bSprintf(builder, "{ .num_params = %d, .func = %s%d },\n", code.NumParams, compiler.NGEN_FUNCTION_PREFIX, functionID)
-		}
-	}
-	bSprintf(builder, "};\n")
-	bSprintf(builder, "static void * __attribute__((always_inline)) %sresolve_indirect(struct VirtualMachine *vm, uint64_t entry_id, uint64_t num_params) {\n", compiler.NGEN_ENV_API_PREFIX)
-	bSprintf(builder, "if(entry_id >= num_table_entries) { vm->throw_s(vm, \"%s\"); }\n", "table entry out of bounds")
-	bSprintf(builder, "if(table[entry_id].func == 0) { vm->throw_s(vm, \"%s\"); }\n", "table entry is null")
-	bSprintf(builder, "if(table[entry_id].num_params != num_params) { vm->throw_s(vm, \"%s\"); }\n", "argument count mismatch")
-	bSprintf(builder, "return table[entry_id].func;\n")
-	bSprintf(builder, "}\n")
+	generateTablesNEnv(builder, m.tables, m.Config.MaxTableSize, m.FunctionCode, nil)
+	droppedData, droppedElems := newDroppedSegments(m.Module)
+	generateSegmentsNEnv(builder, m.Module, droppedData, droppedElems)
 
 	bSprintf(builder, "struct ImportEntry { const char *module_name; const char *field_name; ExternalFunction f; };\n")
 	bSprintf(builder, "static const uint64_t num_import_entries = %d;\n", len(m.FunctionImports))
@@ -371,47 +402,34 @@ func (m *Module) NCompile(config NCompileConfig) string {
 func (m *Module) NewVirtualMachine() *VirtualMachine {
 	globals := make([]int64, len(m.Globals))
 	copy(globals, m.Globals)
-	table := make([]uint32, len(m.Table))
-	copy(table, m.Table)
-
-	// Load linear memory.
-	memory := emptyMemory
-	if m.Module.Base.Memory != nil && len(m.Module.Base.Memory.Entries) > 0 {
-		initialLimit := int(m.Module.Base.Memory.Entries[0].Limits.Initial)
-		if m.Config.MaxMemoryPages != 0 && initialLimit > m.Config.MaxMemoryPages {
-			panic("max memory exceeded")
-		}
+	funcImports := make([]FunctionImportInfo, len(m.FunctionImports))
+	copy(funcImports, m.FunctionImports)
 
-		capacity := initialLimit * DefaultPageSize
+	// Instances share imported tables, and get their own otherwise.
+	tables := newTables(m.Module, m.Config, m.importedTables, m.importedTableSizes)
 
-		// Initialize empty memory.
-		memory = make([]byte, capacity)
-		for i := 0; i < capacity; i++ {
-			memory[i] = 0
-		}
+	memories := newMemories(m.Module, m.Config, m.importedMemories, m.importedMemoryPages)
 
-		if m.Module.Base.Data != nil && len(m.Module.Base.Data.Entries) > 0 {
-			for _, e := range m.Module.Base.Data.Entries {
-				offset := int(execInitExpr(e.Offset, globals))
-				copy(memory[offset:], e.Data)
-			}
-		}
-	}
-
-	return &VirtualMachine{
+	vm := &VirtualMachine{
 		Module:          m.Module,
 		Config:          m.Config,
 		FunctionCode:    m.FunctionCode,
-		FunctionImports: m.FunctionImports,
+		FunctionImports: funcImports,
 		CallStack:       make([]Frame, DefaultCallStackSize),
 		CurrentFrame:    -1,
-		Table:           table,
 		Globals:         globals,
-		Memory:          memory,
 		Exited:          true,
 		GasPolicy:       m.GasPolicy,
 		ImportResolver:  m.ImportResolver,
+		importedGlobals: m.importedGlobals,
+		tags:            newTags(m.Module, m.importedTags),
 	}
+
+	vm.droppedData, vm.droppedElems = newDroppedSegments(m.Module)
+	vm.initTables(tables, m.importedTables, globals)
+	vm.initMemories(memories, globals)
+
+	return vm
 }
 
 // NewVirtualMachine instantiates a virtual machine for a given WebAssembly module, with
@@ -433,6 +451,8 @@ func NewVirtualMachine(
 	}
 
 	m.DisableFloatingPoint = config.DisableFloatingPoint
+	m.DisableSIMD = config.DisableSIMD
+	m.Optimizations = config.Optimizations
 
 	functionCode, err := m.CompileForInterpreter(gasPolicy)
 	if err != nil {
@@ -441,118 +461,78 @@ func NewVirtualMachine(
 
 	defer utils.CatchPanic(&retErr)
 
-	table := emptyTable
-	globals := emptyGlobals
-	funcImports := emptyFuncImports
-
-	if m.Base.Import != nil && impResolver != nil {
-		for _, imp := range m.Base.Import.Entries {
-			switch imp.Type.Kind() {
-			case wasm.ExternalFunction:
-				funcImports = append(funcImports, FunctionImportInfo{
-					ModuleName: imp.ModuleName,
-					FieldName:  imp.FieldName,
-					F:          nil, // deferred
-				})
-			case wasm.ExternalGlobal:
-				globals = append(globals, impResolver.ResolveGlobal(imp.ModuleName, imp.FieldName))
-			case wasm.ExternalMemory:
-				// TODO: Do we want a real import?
-				if m.Base.Memory != nil && len(m.Base.Memory.Entries) > 0 {
-					panic("cannot import another memory while we already have one")
-				}
-				m.Base.Memory = &wasm.SectionMemories{
-					Entries: []wasm.Memory{
-						{
-							Limits: wasm.ResizableLimits{
-								Initial: uint32(config.DefaultMemoryPages),
-							},
-						},
-					},
-				}
-			case wasm.ExternalTable:
-				// TODO: Do we want a real import?
-				if m.Base.Table != nil && len(m.Base.Table.Entries) > 0 {
-					panic("cannot import another table while we already have one")
-				}
-				m.Base.Table = &wasm.SectionTables{
-					Entries: []wasm.Table{
-						{
-							Limits: wasm.ResizableLimits{
-								Initial: uint32(config.DefaultTableSize),
-							},
-						},
-					},
-				}
-			default:
-				panic(fmt.Errorf("import kind not supported: %d", imp.Type.Kind()))
-			}
-		}
+	linked, err := resolveImports(m, config, impResolver)
+	if err != nil {
+		return nil, err
 	}
 
 	// Load global entries.
+	globals := linked.globals
 	for _, entry := range m.Base.GlobalIndexSpace {
 		globals = append(globals, execInitExpr(entry.Init, globals))
 	}
-
-	// Populate table elements.
-	if m.Base.Table != nil && len(m.Base.Table.Entries) > 0 {
-		t := &m.Base.Table.Entries[0]
-
-		if config.MaxTableSize != 0 && int(t.Limits.Initial) > config.MaxTableSize {
-			panic("max table size exceeded")
-		}
-
-		table = make([]uint32, int(t.Limits.Initial))
-		for i := 0; i < int(t.Limits.Initial); i++ {
-			table[i] = 0xffffffff
-		}
-		if m.Base.Elements != nil && len(m.Base.Elements.Entries) > 0 {
-			for _, e := range m.Base.Elements.Entries {
-				offset := int(execInitExpr(e.Offset, globals))
-				copy(table[offset:], e.Elems)
-			}
-		}
+	for _, g := range m.V128Globals {
+		globals = append(globals, g.High)
 	}
 
-	// Load linear memory.
-	memory := emptyMemory
-	if m.Base.Memory != nil && len(m.Base.Memory.Entries) > 0 {
-		initialLimit := int(m.Base.Memory.Entries[0].Limits.Initial)
-		if config.MaxMemoryPages != 0 && initialLimit > config.MaxMemoryPages {
-			panic("max memory exceeded")
-		}
+	tables := newTables(m, config, linked.tables, linked.tableSizes)
 
-		capacity := initialLimit * DefaultPageSize
+	memories := newMemories(m, config, linked.memories, linked.memoryPages)
 
-		// Initialize empty memory.
-		memory = make([]byte, capacity)
-		for i := 0; i < capacity; i++ {
-			memory[i] = 0
-		}
-
-		if m.Base.Data != nil && len(m.Base.Data.Entries) > 0 {
-			for _, e := range m.Base.Data.Entries {
-				offset := int(execInitExpr(e.Offset, globals))
-				copy(memory[offset:], e.Data)
-			}
-		}
-	}
-
-	return &VirtualMachine{
+	vm := &VirtualMachine{
 		Module:          m,
 		Config:          config,
 		FunctionCode:    functionCode,
-		FunctionImports: funcImports,
+		FunctionImports: linked.funcImports,
 		CallStack:       make([]Frame, DefaultCallStackSize),
 		CurrentFrame:    -1,
-		Table:           table,
 		Globals:         globals,
-		Memory:          memory,
 		Exited:          true,
 		GasPolicy:       gasPolicy,
 		ImportResolver:  impResolver,
-	}, nil
+		importedGlobals: linked.globalVars,
+		tags:            newTags(m, linked.tags),
+	}
+
+	vm.droppedData, vm.droppedElems = newDroppedSegments(m)
+	vm.initTables(tables, linked.tables, globals)
+	vm.initMemories(memories, globals)
+
+	return vm, nil
+}
+
+// initTables sets the tables of a new virtual machine, which owns those not
+// imported from a TableResolver, and copies the element segments into them.
+func (vm *VirtualMachine) initTables(tables, imported []*Table, globals []int64) {
+	for i, t := range tables {
+		if i >= len(imported) || imported[i] == nil {
+			t.owner = vm
+		}
+	}
+
+	vm.tables = tables
+	vm.table = &Table{Elements: emptyTable}
+	if len(tables) > 0 {
+		vm.table = tables[0]
+	}
+	vm.Table = vm.table.Elements
+	vm.tableView = vm.Table
+
+	initElements(vm.Module, globals, tables, vm)
+}
+
+// initMemories sets the memories of a new virtual machine and copies the
+// data segments into them.
+func (vm *VirtualMachine) initMemories(memories []*Memory, globals []int64) {
+	vm.memories = memories
+	vm.memoryViews = make([][]byte, len(memories))
+	vm.memory = &Memory{Bytes: emptyMemory}
+	if len(memories) > 0 {
+		vm.memory = memories[0]
+	}
+	vm.syncMemory()
+
+	initData(vm.Module, globals, memories)
 }
 
 func (vm *VirtualMachine) SetAOTService(s AOTService) {
@@ -603,12 +583,18 @@ func (vm *VirtualMachine) GenerateNEnv(config NCompileConfig) string {
 	if !vm.Config.DisableFloatingPoint {
 		builder.WriteString(compiler.NGEN_FP_HEADER)
 	}
+	if !vm.Config.DisableSIMD {
+		builder.WriteString(compiler.NGEN_SIMD_HEADER)
+	}
 
 	bSprintf(builder, "static uint64_t globals[] = {")
 	for _, v := range vm.Globals {
 		bSprintf(builder, "%dull,", uint64(v))
 	}
 	bSprintf(builder, "};\n")
+	numYielded := numYieldedValues(vm.Module.Base)
+	bSprintf(builder, "uint64_t %syielded[%d];\n", compiler.NGEN_ENV_API_PREFIX, numYielded)
+	bSprintf(builder, "const uint64_t %snum_yielded = %d;\n", compiler.NGEN_ENV_API_PREFIX, numYielded)
 
 	for i, code := range vm.FunctionCode {
 		bSprintf(builder, "uint64_t %s%d(struct VirtualMachine *", compiler.NGEN_FUNCTION_PREFIX, i)
@@ -618,27 +604,9 @@ func (vm *VirtualMachine) GenerateNEnv(config NCompileConfig) string {
 		bSprintf(builder, ");\n")
 	}
 
-	// call_indirect dispatcher.
-	bSprintf(builder, "struct TableEntry { uint64_t num_params; void *func; };\n")
-	bSprintf(builder, "static const uint64_t num_table_entries = %d;\n", len(vm.Table))
-	bSprintf(builder, "static struct TableEntry table[] = {\n")
-	for _, entry := range vm.Table {
-		if entry == math.MaxUint32 {
-			bSprintf(builder, "{ .num_params = 0, .func = 0 },\n")
-		} else {
-			functionID := int(entry)
-			code := vm.FunctionCode[functionID]
-
-			bSprintf(builder, "{ .num_params = %d, .func = %s%d },\n", code.NumParams, compiler.NGEN_FUNCTION_PREFIX, functionID)
-		}
-	}
-	bSprintf(builder, "};\n")
-	bSprintf(builder, "static void * __attribute__((always_inline)) %sresolve_indirect(struct VirtualMachine *vm, uint64_t entry_id, uint64_t num_params) {\n", compiler.NGEN_ENV_API_PREFIX)
-	bSprintf(builder, "if(entry_id >= num_table_entries) { vm->throw_s(vm, \"%s\"); }\n", "table entry out of bounds")
-	bSprintf(builder, "if(table[entry_id].func == 0) { vm->throw_s(vm, \"%s\"); }\n", "table entry is null")
-	bSprintf(builder, "if(table[entry_id].num_params != num_params) { vm->throw_s(vm, \"%s\"); }\n", "argument count mismatch")
-	bSprintf(builder, "return table[entry_id].func;\n")
-	bSprintf(builder, "}\n")
+	vm.syncTable()
+	generateTablesNEnv(builder, vm.tables, vm.Config.MaxTableSize, vm.FunctionCode, vm)
+	generateSegmentsNEnv(builder, vm.Module, vm.droppedData, vm.droppedElems)
 
 	bSprintf(builder, "struct ImportEntry { const char *module_name; const char *field_name; ExternalFunction f; };\n")
 	bSprintf(builder, "static const uint64_t num_import_entries = %d;\n", len(vm.FunctionImports))
@@ -696,7 +664,7 @@ func (vm *VirtualMachine) NCompile(config NCompileConfig) string {
 func (f *Frame) Init(vm *VirtualMachine, functionID int, code compiler.InterpreterCode) {
 	numValueSlots := code.NumRegs + code.NumParams + code.NumLocals
 	if vm.Config.MaxValueSlots != 0 && vm.NumValueSlots+numValueSlots > vm.Config.MaxValueSlots {
-		panic("max value slot count exceeded")
+		panic(&Trap{Kind: TrapCallStackExhausted, Err: errors.New("max value slot count exceeded")})
 	}
 	vm.NumValueSlots += numValueSlots
 
@@ -708,10 +676,45 @@ func (f *Frame) Init(vm *VirtualMachine, functionID int, code compiler.Interpret
 	f.Code = code.Bytes
 	f.IP = 0
 	f.Continuation = 0
+	f.Caught = nil
 
 	//fmt.Printf("Enter function %d (%s)\n", functionID, vm.Module.FunctionNames[functionID])
 }
 
+// pushFrame pushes the frame of a call to a function onto the call stack and
+// initializes it. The call stack is left unchanged if the frame cannot be
+// pushed.
+func (vm *VirtualMachine) pushFrame(functionID int, code compiler.InterpreterCode) *Frame {
+	vm.CurrentFrame++
+	pushed := false
+	defer func() {
+		if !pushed {
+			vm.CurrentFrame--
+		}
+	}()
+
+	frame := vm.GetCurrentFrame()
+	frame.Init(vm, functionID, code)
+	pushed = true
+	return frame
+}
+
+// replaceFrame replaces the current frame with the frame of a tail call to a
+// function. The current frame is left unchanged if the new one cannot be
+// initialized.
+func (vm *VirtualMachine) replaceFrame(frame *Frame, functionID int, code compiler.InterpreterCode) {
+	frame.Destroy(vm)
+	replaced := false
+	defer func() {
+		if !replaced {
+			vm.NumValueSlots += len(frame.Regs) + len(frame.Locals)
+		}
+	}()
+
+	frame.Init(vm, functionID, code)
+	replaced = true
+}
+
 // Destroy destroys a frame. Must be called on return.
 func (f *Frame) Destroy(vm *VirtualMachine) {
 	numValueSlots := len(f.Regs) + len(f.Locals)
@@ -720,20 +723,60 @@ func (f *Frame) Destroy(vm *VirtualMachine) {
 	//fmt.Printf("Leave function %d (%s)\n", f.FunctionID, vm.Module.FunctionNames[f.FunctionID])
 }
 
+// numYieldedValues returns the number of values after the first one which
+// may be passed along a branch, return or function import of m.
+func numYieldedValues(m *wasm.Module) int {
+	n := 1
+	if m.Types != nil {
+		for _, ty := range m.Types.Entries {
+			if compiler.NumSlots(ty.ParamTypes)-1 > n {
+				n = compiler.NumSlots(ty.ParamTypes) - 1
+			}
+			if compiler.NumSlots(ty.ReturnTypes)-1 > n {
+				n = compiler.NumSlots(ty.ReturnTypes) - 1
+			}
+		}
+	}
+	return n
+}
+
+// setYieldedValue sets the i-th value (i >= 1) passed along a branch, return
+// or function import.
+func (vm *VirtualMachine) setYieldedValue(i int, v int64) {
+	for len(vm.YieldedValues) < i {
+		vm.YieldedValues = append(vm.YieldedValues, 0)
+	}
+	vm.YieldedValues[i-1] = v
+}
+
+// yieldedValue returns the i-th value (i >= 1) passed along a branch, return
+// or function import.
+func (vm *VirtualMachine) yieldedValue(i int) int64 {
+	if i > len(vm.YieldedValues) {
+		return 0
+	}
+	return vm.YieldedValues[i-1]
+}
+
 // GetCurrentFrame returns the current frame.
 func (vm *VirtualMachine) GetCurrentFrame() *Frame {
-	if vm.Config.MaxCallStackDepth != 0 && vm.CurrentFrame >= vm.Config.MaxCallStackDepth {
-		panic("max call stack depth exceeded")
+	if vm.Config.MaxCallStackDepth != 0 && vm.callStackBase+vm.CurrentFrame >= vm.Config.MaxCallStackDepth {
+		panic(&Trap{Kind: TrapCallStackExhausted, Err: errors.New("max call stack depth exceeded")})
 	}
 
 	if vm.CurrentFrame >= len(vm.CallStack) {
-		panic("call stack overflow")
+		panic(&Trap{Kind: TrapCallStackExhausted})
 		//vm.CallStack = append(vm.CallStack, make([]Frame, DefaultCallStackSize / 2)...)
 	}
 	return &vm.CallStack[vm.CurrentFrame]
 }
 
 func (vm *VirtualMachine) getExport(key string, kind wasm.External) (int, bool) {
+	if kind == compiler.ExternalTag {
+		index, ok := vm.Module.TagExports[key]
+		return int(index), ok
+	}
+
 	if vm.Module.Base.Export == nil {
 		return -1, false
 	}
@@ -785,15 +828,13 @@ func (vm *VirtualMachine) Ignite(functionID int, params ...int64) {
 		panic("param count mismatch")
 	}
 
+	if vm.callStackBase == 0 {
+		vm.releaseRefs(functionID, params)
+	}
+
 	vm.Exited = false
 
-	vm.CurrentFrame++
-	frame := vm.GetCurrentFrame()
-	frame.Init(
-		vm,
-		functionID,
-		code,
-	)
+	frame := vm.pushFrame(functionID, code)
 	copy(frame.Locals, params)
 }
 
@@ -808,7 +849,7 @@ func (vm *VirtualMachine) AddAndCheckGas(delta uint64) bool {
 			return false
 		}
 
-		panic("gas limit exceeded")
+		panic(&Trap{Kind: TrapGasLimitExceeded})
 	}
 
 	vm.Gas = newGas
@@ -816,10 +857,19 @@ func (vm *VirtualMachine) AddAndCheckGas(delta uint64) bool {
 	return true
 }
 
+// Exit terminates the virtual machine with the given exit code. It may only
+// be called from within a function import and does not return; the pending
+// Run or RunWithGasLimit call reports an *ExitError instead.
+func (vm *VirtualMachine) Exit(code uint32) {
+	panic(&ExitError{Code: code})
+}
+
 // Execute starts the virtual machines main instruction processing loop.
-// This function may return at any point and is guaranteed to return
-// at least once every 10000 instructions. Caller is responsible for
-// detecting VM status in a loop.
+// This function may return at any point and, if Config.InstructionBudget is
+// set, is guaranteed to return at least once every Config.InstructionBudget
+// instructions, in which case BudgetExhausted is set and another call to
+// Execute resumes the execution. Caller is responsible for detecting VM
+// status in a loop.
 func (vm *VirtualMachine) Execute() {
 	if vm.Exited {
 		panic("attempting to execute an exited vm")
@@ -834,19 +884,48 @@ func (vm *VirtualMachine) Execute() {
 	}
 	vm.InsideExecute = true
 	vm.GasLimitExceeded = false
+	vm.BudgetExhausted = false
+
+	budget := vm.Config.InstructionBudget
+	limited := budget > 0
+
+	// Offset of the instruction being executed, for locating traps.
+	insIP := 0
 
 	defer func() {
 		vm.InsideExecute = false
 		if err := recover(); err != nil {
 			vm.Exited = true
-			vm.ExitError = err
+			vm.ExitError = vm.recoverTrap(err, insIP)
 			vm.StackTrace = string(debug.Stack())
 		}
 	}()
 
+	// Shared memories may have been grown elsewhere in the meantime.
+	vm.syncMemory()
+	vm.syncTable()
+
 	frame := vm.GetCurrentFrame()
+	insIP = frame.IP
+
+	// Exceptions thrown by function imports are raised at their call.
+	if exc := vm.thrown; exc != nil {
+		vm.thrown = nil
+		insIP = vm.thrownIP
+		frame = vm.throw(exc, insIP)
+	}
+	vm.checkInterrupt()
 
 	for {
+		if limited {
+			if budget == 0 {
+				vm.BudgetExhausted = true
+				return
+			}
+			budget--
+		}
+
+		insIP = frame.IP
 		valueID := int(LE.Uint32(frame.Code[frame.IP : frame.IP+4]))
 		ins := opcodes.Opcode(frame.Code[frame.IP+4])
 		frame.IP += 5
@@ -856,7 +935,7 @@ func (vm *VirtualMachine) Execute() {
 		switch ins {
 		case opcodes.Nop:
 		case opcodes.Unreachable:
-			panic("wasm: unreachable executed")
+			panic(&Trap{Kind: TrapUnreachable})
 		case opcodes.Select:
 			a := frame.Regs[int(LE.Uint32(frame.Code[frame.IP:frame.IP+4]))]
 			b := frame.Regs[int(LE.Uint32(frame.Code[frame.IP+4:frame.IP+8]))]
@@ -891,11 +970,11 @@ func (vm *VirtualMachine) Execute() {
 			b := int32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP+4:frame.IP+8]))])
 
 			if b == 0 {
-				panic("integer division by zero")
+				panic(&Trap{Kind: TrapIntegerDivideByZero})
 			}
 
 			if a == math.MinInt32 && b == -1 {
-				panic("signed integer overflow")
+				panic(&Trap{Kind: TrapIntegerOverflow})
 			}
 
 			frame.IP += 8
@@ -905,7 +984,7 @@ func (vm *VirtualMachine) Execute() {
 			b := uint32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP+4:frame.IP+8]))])
 
 			if b == 0 {
-				panic("integer division by zero")
+				panic(&Trap{Kind: TrapIntegerDivideByZero})
 			}
 
 			frame.IP += 8
@@ -915,7 +994,7 @@ func (vm *VirtualMachine) Execute() {
 			b := int32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP+4:frame.IP+8]))])
 
 			if b == 0 {
-				panic("integer division by zero")
+				panic(&Trap{Kind: TrapIntegerDivideByZero})
 			}
 
 			frame.IP += 8
@@ -925,7 +1004,7 @@ func (vm *VirtualMachine) Execute() {
 			b := uint32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP+4:frame.IP+8]))])
 
 			if b == 0 {
-				panic("integer division by zero")
+				panic(&Trap{Kind: TrapIntegerDivideByZero})
 			}
 
 			frame.IP += 8
@@ -1116,11 +1195,11 @@ func (vm *VirtualMachine) Execute() {
 			b := frame.Regs[int(LE.Uint32(frame.Code[frame.IP+4:frame.IP+8]))]
 
 			if b == 0 {
-				panic("integer division by zero")
+				panic(&Trap{Kind: TrapIntegerDivideByZero})
 			}
 
 			if a == math.MinInt64 && b == -1 {
-				panic("signed integer overflow")
+				panic(&Trap{Kind: TrapIntegerOverflow})
 			}
 
 			frame.IP += 8
@@ -1130,7 +1209,7 @@ func (vm *VirtualMachine) Execute() {
 			b := uint64(frame.Regs[int(LE.Uint32(frame.Code[frame.IP+4:frame.IP+8]))])
 
 			if b == 0 {
-				panic("integer division by zero")
+				panic(&Trap{Kind: TrapIntegerDivideByZero})
 			}
 
 			frame.IP += 8
@@ -1140,7 +1219,7 @@ func (vm *VirtualMachine) Execute() {
 			b := frame.Regs[int(LE.Uint32(frame.Code[frame.IP+4:frame.IP+8]))]
 
 			if b == 0 {
-				panic("integer division by zero")
+				panic(&Trap{Kind: TrapIntegerDivideByZero})
 			}
 
 			frame.IP += 8
@@ -1150,7 +1229,7 @@ func (vm *VirtualMachine) Execute() {
 			b := uint64(frame.Regs[int(LE.Uint32(frame.Code[frame.IP+4:frame.IP+8]))])
 
 			if b == 0 {
-				panic("integer division by zero")
+				panic(&Trap{Kind: TrapIntegerDivideByZero})
 			}
 
 			frame.IP += 8
@@ -1699,6 +1778,38 @@ func (vm *VirtualMachine) Execute() {
 			frame.IP += 4
 			frame.Regs[valueID] = int64(v)
 
+		case opcodes.I32TruncSatSF32:
+			v := math.Float32frombits(uint32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP:frame.IP+4]))]))
+			frame.IP += 4
+			frame.Regs[valueID] = truncSatI32S(float64(v))
+		case opcodes.I32TruncSatSF64:
+			v := math.Float64frombits(uint64(frame.Regs[int(LE.Uint32(frame.Code[frame.IP:frame.IP+4]))]))
+			frame.IP += 4
+			frame.Regs[valueID] = truncSatI32S(v)
+		case opcodes.I32TruncSatUF32:
+			v := math.Float32frombits(uint32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP:frame.IP+4]))]))
+			frame.IP += 4
+			frame.Regs[valueID] = truncSatI32U(float64(v))
+		case opcodes.I32TruncSatUF64:
+			v := math.Float64frombits(uint64(frame.Regs[int(LE.Uint32(frame.Code[frame.IP:frame.IP+4]))]))
+			frame.IP += 4
+			frame.Regs[valueID] = truncSatI32U(v)
+		case opcodes.I64TruncSatSF32:
+			v := math.Float32frombits(uint32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP:frame.IP+4]))]))
+			frame.IP += 4
+			frame.Regs[valueID] = truncSatI64S(float64(v))
+		case opcodes.I64TruncSatSF64:
+			v := math.Float64frombits(uint64(frame.Regs[int(LE.Uint32(frame.Code[frame.IP:frame.IP+4]))]))
+			frame.IP += 4
+			frame.Regs[valueID] = truncSatI64S(v)
+		case opcodes.I64TruncSatUF32:
+			v := math.Float32frombits(uint32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP:frame.IP+4]))]))
+			frame.IP += 4
+			frame.Regs[valueID] = truncSatI64U(float64(v))
+		case opcodes.I64TruncSatUF64:
+			v := math.Float64frombits(uint64(frame.Regs[int(LE.Uint32(frame.Code[frame.IP:frame.IP+4]))]))
+			frame.IP += 4
+			frame.Regs[valueID] = truncSatI64U(v)
 		case opcodes.I32TruncSF32, opcodes.I32TruncUF32:
 			v := math.Float32frombits(uint32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP:frame.IP+4]))]))
 			frame.IP += 4
@@ -1799,108 +1910,80 @@ func (vm *VirtualMachine) Execute() {
 			frame.IP += 4
 			frame.Regs[valueID] = int64(v)
 
-		case opcodes.I32Load, opcodes.I64Load32U:
-			offset := LE.Uint32(frame.Code[frame.IP+4 : frame.IP+8])
-			base := uint32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP+8:frame.IP+12]))])
-
-			frame.IP += 12
+		case opcodes.I32Extend8S:
+			v := int8(frame.Regs[int(LE.Uint32(frame.Code[frame.IP:frame.IP+4]))])
+			frame.IP += 4
+			frame.Regs[valueID] = int64(uint32(v))
 
-			effective := int(uint64(base) + uint64(offset))
-			frame.Regs[valueID] = int64(LE.Uint32(vm.Memory[effective : effective+4]))
-		case opcodes.I64Load32S:
-			offset := LE.Uint32(frame.Code[frame.IP+4 : frame.IP+8])
-			base := uint32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP+8:frame.IP+12]))])
+		case opcodes.I32Extend16S:
+			v := int16(frame.Regs[int(LE.Uint32(frame.Code[frame.IP:frame.IP+4]))])
+			frame.IP += 4
+			frame.Regs[valueID] = int64(uint32(v))
 
-			frame.IP += 12
+		case opcodes.I64Extend8S:
+			v := int8(frame.Regs[int(LE.Uint32(frame.Code[frame.IP:frame.IP+4]))])
+			frame.IP += 4
+			frame.Regs[valueID] = int64(v)
 
-			effective := int(uint64(base) + uint64(offset))
-			frame.Regs[valueID] = int64(int32(LE.Uint32(vm.Memory[effective : effective+4])))
-		case opcodes.I64Load:
-			offset := LE.Uint32(frame.Code[frame.IP+4 : frame.IP+8])
-			base := uint32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP+8:frame.IP+12]))])
+		case opcodes.I64Extend16S:
+			v := int16(frame.Regs[int(LE.Uint32(frame.Code[frame.IP:frame.IP+4]))])
+			frame.IP += 4
+			frame.Regs[valueID] = int64(v)
 
-			frame.IP += 12
+		case opcodes.I64Extend32S:
+			v := int32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP:frame.IP+4]))])
+			frame.IP += 4
+			frame.Regs[valueID] = int64(v)
 
-			effective := int(uint64(base) + uint64(offset))
-			frame.Regs[valueID] = int64(LE.Uint64(vm.Memory[effective : effective+8]))
+		case opcodes.I32Load, opcodes.I64Load32U:
+			m := vm.memoryAccess(frame, 4)
+			frame.Regs[valueID] = int64(LE.Uint32(m))
+		case opcodes.I64Load32S:
+			m := vm.memoryAccess(frame, 4)
+			frame.Regs[valueID] = int64(int32(LE.Uint32(m)))
+		case opcodes.I64Load:
+			m := vm.memoryAccess(frame, 8)
+			frame.Regs[valueID] = int64(LE.Uint64(m))
 		case opcodes.I32Load8S, opcodes.I64Load8S:
-			offset := LE.Uint32(frame.Code[frame.IP+4 : frame.IP+8])
-			base := uint32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP+8:frame.IP+12]))])
-
-			frame.IP += 12
-
-			effective := int(uint64(base) + uint64(offset))
-			frame.Regs[valueID] = int64(int8(vm.Memory[effective]))
+			m := vm.memoryAccess(frame, 1)
+			frame.Regs[valueID] = int64(int8(m[0]))
 		case opcodes.I32Load8U, opcodes.I64Load8U:
-			offset := LE.Uint32(frame.Code[frame.IP+4 : frame.IP+8])
-			base := uint32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP+8:frame.IP+12]))])
-
-			frame.IP += 12
-
-			effective := int(uint64(base) + uint64(offset))
-			frame.Regs[valueID] = int64(vm.Memory[effective])
+			m := vm.memoryAccess(frame, 1)
+			frame.Regs[valueID] = int64(m[0])
 		case opcodes.I32Load16S, opcodes.I64Load16S:
-			offset := LE.Uint32(frame.Code[frame.IP+4 : frame.IP+8])
-			base := uint32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP+8:frame.IP+12]))])
-
-			frame.IP += 12
-
-			effective := int(uint64(base) + uint64(offset))
-			frame.Regs[valueID] = int64(int16(LE.Uint16(vm.Memory[effective : effective+2])))
+			m := vm.memoryAccess(frame, 2)
+			frame.Regs[valueID] = int64(int16(LE.Uint16(m)))
 		case opcodes.I32Load16U, opcodes.I64Load16U:
-			offset := LE.Uint32(frame.Code[frame.IP+4 : frame.IP+8])
-			base := uint32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP+8:frame.IP+12]))])
-
-			frame.IP += 12
-
-			effective := int(uint64(base) + uint64(offset))
-			frame.Regs[valueID] = int64(LE.Uint16(vm.Memory[effective : effective+2]))
+			m := vm.memoryAccess(frame, 2)
+			frame.Regs[valueID] = int64(LE.Uint16(m))
 		case opcodes.I32Store, opcodes.I64Store32:
-			offset := LE.Uint32(frame.Code[frame.IP+4 : frame.IP+8])
-			base := uint32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP+8:frame.IP+12]))])
-
-			value := frame.Regs[int(LE.Uint32(frame.Code[frame.IP+12:frame.IP+16]))]
-
-			frame.IP += 16
-
-			effective := int(uint64(base) + uint64(offset))
-			LE.PutUint32(vm.Memory[effective:effective+4], uint32(value))
+			m := vm.memoryAccess(frame, 4)
+			value := frame.Regs[int(LE.Uint32(frame.Code[frame.IP:frame.IP+4]))]
+			frame.IP += 4
+			LE.PutUint32(m, uint32(value))
 		case opcodes.I64Store:
-			offset := LE.Uint32(frame.Code[frame.IP+4 : frame.IP+8])
-			base := uint32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP+8:frame.IP+12]))])
-
-			value := frame.Regs[int(LE.Uint32(frame.Code[frame.IP+12:frame.IP+16]))]
-
-			frame.IP += 16
-
-			effective := int(uint64(base) + uint64(offset))
-			LE.PutUint64(vm.Memory[effective:effective+8], uint64(value))
+			m := vm.memoryAccess(frame, 8)
+			value := frame.Regs[int(LE.Uint32(frame.Code[frame.IP:frame.IP+4]))]
+			frame.IP += 4
+			LE.PutUint64(m, uint64(value))
 		case opcodes.I32Store8, opcodes.I64Store8:
-			offset := LE.Uint32(frame.Code[frame.IP+4 : frame.IP+8])
-			base := uint32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP+8:frame.IP+12]))])
-
-			value := frame.Regs[int(LE.Uint32(frame.Code[frame.IP+12:frame.IP+16]))]
-
-			frame.IP += 16
-
-			effective := int(uint64(base) + uint64(offset))
-			vm.Memory[effective] = byte(value)
+			m := vm.memoryAccess(frame, 1)
+			value := frame.Regs[int(LE.Uint32(frame.Code[frame.IP:frame.IP+4]))]
+			frame.IP += 4
+			m[0] = byte(value)
 		case opcodes.I32Store16, opcodes.I64Store16:
-			offset := LE.Uint32(frame.Code[frame.IP+4 : frame.IP+8])
-			base := uint32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP+8:frame.IP+12]))])
-
-			value := frame.Regs[int(LE.Uint32(frame.Code[frame.IP+12:frame.IP+16]))]
-
-			frame.IP += 16
-
-			effective := int(uint64(base) + uint64(offset))
-			LE.PutUint16(vm.Memory[effective:effective+2], uint16(value))
+			m := vm.memoryAccess(frame, 2)
+			value := frame.Regs[int(LE.Uint32(frame.Code[frame.IP:frame.IP+4]))]
+			frame.IP += 4
+			LE.PutUint16(m, uint16(value))
 
 		case opcodes.Jmp:
+			vm.checkInterrupt()
 			target := int(LE.Uint32(frame.Code[frame.IP : frame.IP+4]))
 			vm.Yielded = frame.Regs[int(LE.Uint32(frame.Code[frame.IP+4:frame.IP+8]))]
 			frame.IP = target
 		case opcodes.JmpEither:
+			vm.checkInterrupt()
 			targetA := int(LE.Uint32(frame.Code[frame.IP : frame.IP+4]))
 			targetB := int(LE.Uint32(frame.Code[frame.IP+4 : frame.IP+8]))
 			cond := int(LE.Uint32(frame.Code[frame.IP+8 : frame.IP+12]))
@@ -1914,6 +1997,7 @@ func (vm *VirtualMachine) Execute() {
 				frame.IP = targetB
 			}
 		case opcodes.JmpIf:
+			vm.checkInterrupt()
 			target := int(LE.Uint32(frame.Code[frame.IP : frame.IP+4]))
 			cond := int(LE.Uint32(frame.Code[frame.IP+4 : frame.IP+8]))
 			yieldedReg := int(LE.Uint32(frame.Code[frame.IP+8 : frame.IP+12]))
@@ -1923,6 +2007,7 @@ func (vm *VirtualMachine) Execute() {
 				frame.IP = target
 			}
 		case opcodes.JmpTable:
+			vm.checkInterrupt()
 			targetCount := int(LE.Uint32(frame.Code[frame.IP : frame.IP+4]))
 			frame.IP += 4
 
@@ -1944,6 +2029,13 @@ func (vm *VirtualMachine) Execute() {
 			} else {
 				frame.IP = defaultTarget
 			}
+		case opcodes.ReturnValues:
+			count := int(LE.Uint32(frame.Code[frame.IP : frame.IP+4]))
+			frame.IP += 4
+			for i := 1; i < count; i++ {
+				vm.setYieldedValue(i, frame.Regs[int(LE.Uint32(frame.Code[frame.IP+4*i:frame.IP+4*i+4]))])
+			}
+			fallthrough
 		case opcodes.ReturnValue:
 			val := frame.Regs[int(LE.Uint32(frame.Code[frame.IP:frame.IP+4]))]
 			frame.Destroy(vm)
@@ -1980,15 +2072,26 @@ func (vm *VirtualMachine) Execute() {
 			frame.Locals[id] = val
 			//fmt.Printf("SetLocal %d = %d\n", id, val)
 		case opcodes.GetGlobal:
-			frame.Regs[valueID] = vm.Globals[int(LE.Uint32(frame.Code[frame.IP:frame.IP+4]))]
+			id := int(LE.Uint32(frame.Code[frame.IP : frame.IP+4]))
 			frame.IP += 4
+
+			if g := vm.importedGlobal(id); g != nil {
+				frame.Regs[valueID] = *g.ref()
+			} else {
+				frame.Regs[valueID] = vm.Globals[id]
+			}
 		case opcodes.SetGlobal:
 			id := int(LE.Uint32(frame.Code[frame.IP : frame.IP+4]))
 			val := frame.Regs[int(LE.Uint32(frame.Code[frame.IP+4:frame.IP+8]))]
 			frame.IP += 8
 
-			vm.Globals[id] = val
-		case opcodes.Call:
+			if g := vm.importedGlobal(id); g != nil {
+				*g.ref() = val
+			} else {
+				vm.Globals[id] = val
+			}
+		case opcodes.Call, opcodes.ReturnCall:
+			vm.checkInterrupt()
 			functionID := int(LE.Uint32(frame.Code[frame.IP : frame.IP+4]))
 			frame.IP += 4
 			argCount := int(LE.Uint32(frame.Code[frame.IP : frame.IP+4]))
@@ -1997,19 +2100,24 @@ func (vm *VirtualMachine) Execute() {
 			frame.IP += 4 * argCount
 
 			oldRegs := frame.Regs
-			frame.ReturnReg = valueID
-
-			vm.CurrentFrame++
-			frame = vm.GetCurrentFrame()
-			frame.Init(vm, functionID, vm.FunctionCode[functionID])
+			if ins == opcodes.ReturnCall {
+				// The callee takes over the frame of the caller, and thus
+				// returns to the caller of the caller.
+				vm.replaceFrame(frame, functionID, vm.FunctionCode[functionID])
+			} else {
+				frame.ReturnReg = valueID
+				frame = vm.pushFrame(functionID, vm.FunctionCode[functionID])
+			}
 			for i := 0; i < argCount; i++ {
 				frame.Locals[i] = oldRegs[int(LE.Uint32(argsRaw[i*4:i*4+4]))]
 			}
 			//fmt.Println("Call params =", frame.Locals[:argCount])
 
-		case opcodes.CallIndirect:
+		case opcodes.CallIndirect, opcodes.ReturnCallIndirect:
+			vm.checkInterrupt()
 			typeID := int(LE.Uint32(frame.Code[frame.IP : frame.IP+4]))
-			frame.IP += 4
+			table := vm.TableAt(int(LE.Uint32(frame.Code[frame.IP+4 : frame.IP+8])))
+			frame.IP += 8
 			argCount := int(LE.Uint32(frame.Code[frame.IP:frame.IP+4])) - 1
 			frame.IP += 4
 			argsRaw := frame.Code[frame.IP : frame.IP+4*argCount]
@@ -2019,20 +2127,62 @@ func (vm *VirtualMachine) Execute() {
 
 			sig := &vm.Module.Base.Types.Entries[typeID]
 
-			functionID := int(vm.Table[tableItemID])
+			functionID := int(table.Elements[tableItemID])
+
+			// Call functions of other instances stored in shared tables.
+			if target := table.ownerOf(int(tableItemID)); target != nil && target != vm {
+				targetSig := functionSig(target.Module.Base, functionID)
+				if targetSig == nil {
+					panic(&Trap{Kind: TrapUndefinedElement})
+				}
+				if !sameSig(sig, targetSig) {
+					panic(&Trap{Kind: TrapIndirectCallTypeMismatch})
+				}
+
+				args := make([]int64, argCount)
+				for i := 0; i < argCount; i++ {
+					args[i] = frame.Regs[int(LE.Uint32(argsRaw[i*4:i*4+4]))]
+				}
+				ret, exc := vm.invokeCatching(target, functionID, args)
+				vm.syncMemory() // the callee may have grown memories shared with this instance
+				if exc != nil {
+					frame = vm.throw(exc, insIP)
+					break
+				}
+				if ins == opcodes.CallIndirect {
+					frame.Regs[valueID] = ret
+					break
+				}
+
+				// The results of the callee are those of the caller.
+				frame.Destroy(vm)
+				vm.CurrentFrame--
+				if vm.CurrentFrame == -1 {
+					vm.Exited = true
+					vm.ReturnValue = ret
+					return
+				}
+				frame = vm.GetCurrentFrame()
+				if len(sig.ReturnTypes) > 0 {
+					frame.Regs[frame.ReturnReg] = ret
+				}
+				break
+			}
+
 			code := vm.FunctionCode[functionID]
 
 			// TODO: We are only checking CC here; Do we want strict typeck?
-			if code.NumParams != len(sig.ParamTypes) || code.NumReturns != len(sig.ReturnTypes) {
-				panic("type mismatch")
+			if code.NumParams != compiler.NumSlots(sig.ParamTypes) || code.NumReturns != compiler.NumSlots(sig.ReturnTypes) {
+				panic(&Trap{Kind: TrapIndirectCallTypeMismatch})
 			}
 
 			oldRegs := frame.Regs
-			frame.ReturnReg = valueID
-
-			vm.CurrentFrame++
-			frame = vm.GetCurrentFrame()
-			frame.Init(vm, functionID, code)
+			if ins == opcodes.ReturnCallIndirect {
+				vm.replaceFrame(frame, functionID, code)
+			} else {
+				frame.ReturnReg = valueID
+				frame = vm.pushFrame(functionID, code)
+			}
 			for i := 0; i < argCount; i++ {
 				frame.Locals[i] = oldRegs[int(LE.Uint32(argsRaw[i*4:i*4+4]))]
 			}
@@ -2040,39 +2190,147 @@ func (vm *VirtualMachine) Execute() {
 		case opcodes.InvokeImport:
 			importID := int(LE.Uint32(frame.Code[frame.IP : frame.IP+4]))
 			frame.IP += 4
+			importIP := insIP
 			vm.Delegate = func() {
 				defer func() {
 					if err := recover(); err != nil {
+						if exc, ok := err.(*Exception); ok {
+							vm.thrown, vm.thrownIP = exc, importIP
+							return
+						}
 						vm.Exited = true
-						vm.ExitError = err
+						vm.ExitError = vm.recoverTrap(err, importIP)
 					}
 				}()
-				imp := vm.FunctionImports[importID]
+				imp := &vm.FunctionImports[importID]
 				if imp.F == nil {
 					imp.F = vm.ImportResolver.ResolveFunc(imp.ModuleName, imp.FieldName)
 				}
 				frame.Regs[valueID] = imp.F(vm)
+				vm.checkInterrupt()
 			}
 
 			return
 		case opcodes.CurrentMemory:
-			frame.Regs[valueID] = int64(len(vm.Memory) / DefaultPageSize)
+			memory := LE.Uint32(frame.Code[frame.IP : frame.IP+4])
+			frame.IP += 4
+
+			if vm.memories[memory].Shared {
+				vm.syncMemory() // may have been grown by another virtual machine
+			}
+			frame.Regs[valueID] = int64(len(vm.memoryAt(memory)) / DefaultPageSize)
 
 		case opcodes.GrowMemory:
-			n := int(uint32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP:frame.IP+4]))]))
+			memory := LE.Uint32(frame.Code[frame.IP : frame.IP+4])
+			n := int(vm.address(memory, frame.Regs[int(LE.Uint32(frame.Code[frame.IP+4:frame.IP+8]))]))
+			frame.IP += 8
+
+			frame.Regs[valueID] = int64(vm.growMemory(int(memory), n))
+
+		case opcodes.MemoryInit:
+			seg := int(LE.Uint32(frame.Code[frame.IP : frame.IP+4]))
+			memory := LE.Uint32(frame.Code[frame.IP+4 : frame.IP+8])
+			d := vm.address(memory, frame.Regs[int(LE.Uint32(frame.Code[frame.IP+8:frame.IP+12]))])
+			s := uint32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP+12:frame.IP+16]))])
+			n := uint32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP+16:frame.IP+20]))])
+			frame.IP += 20
+			vm.memoryInit(seg, memory, d, s, n)
+
+		case opcodes.DataDrop:
+			vm.droppedData[int(LE.Uint32(frame.Code[frame.IP:frame.IP+4]))] = true
 			frame.IP += 4
 
-			current := len(vm.Memory) / DefaultPageSize
-			if vm.Config.MaxMemoryPages == 0 || (current+n >= current && current+n <= vm.Config.MaxMemoryPages) {
-				frame.Regs[valueID] = int64(current)
-				vm.Memory = append(vm.Memory, make([]byte, n*DefaultPageSize)...)
+		case opcodes.MemoryCopy:
+			dst := LE.Uint32(frame.Code[frame.IP : frame.IP+4])
+			src := LE.Uint32(frame.Code[frame.IP+4 : frame.IP+8])
+			d := vm.address(dst, frame.Regs[int(LE.Uint32(frame.Code[frame.IP+8:frame.IP+12]))])
+			s := vm.address(src, frame.Regs[int(LE.Uint32(frame.Code[frame.IP+12:frame.IP+16]))])
+			n := frame.Regs[int(LE.Uint32(frame.Code[frame.IP+16:frame.IP+20]))]
+			frame.IP += 20
+
+			// The length is an i64 if both memories are 64-bit.
+			if vm.memories[dst].Is64 && vm.memories[src].Is64 {
+				vm.memoryCopy(dst, src, d, s, uint64(n))
 			} else {
-				frame.Regs[valueID] = -1
+				vm.memoryCopy(dst, src, d, s, uint64(uint32(n)))
 			}
 
+		case opcodes.MemoryFill:
+			memory := LE.Uint32(frame.Code[frame.IP : frame.IP+4])
+			d := vm.address(memory, frame.Regs[int(LE.Uint32(frame.Code[frame.IP+4:frame.IP+8]))])
+			val := byte(frame.Regs[int(LE.Uint32(frame.Code[frame.IP+8:frame.IP+12]))])
+			n := vm.address(memory, frame.Regs[int(LE.Uint32(frame.Code[frame.IP+12:frame.IP+16]))])
+			frame.IP += 16
+			vm.memoryFill(memory, d, val, n)
+
+		case opcodes.TableInit:
+			seg := int(LE.Uint32(frame.Code[frame.IP : frame.IP+4]))
+			table := int(LE.Uint32(frame.Code[frame.IP+4 : frame.IP+8]))
+			d := uint32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP+8:frame.IP+12]))])
+			s := uint32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP+12:frame.IP+16]))])
+			n := uint32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP+16:frame.IP+20]))])
+			frame.IP += 20
+			vm.tableInit(seg, table, d, s, n)
+
+		case opcodes.ElemDrop:
+			vm.droppedElems[int(LE.Uint32(frame.Code[frame.IP:frame.IP+4]))] = true
+			frame.IP += 4
+
+		case opcodes.TableCopy:
+			dst := int(LE.Uint32(frame.Code[frame.IP : frame.IP+4]))
+			src := int(LE.Uint32(frame.Code[frame.IP+4 : frame.IP+8]))
+			d := uint32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP+8:frame.IP+12]))])
+			s := uint32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP+12:frame.IP+16]))])
+			n := uint32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP+16:frame.IP+20]))])
+			frame.IP += 20
+			vm.tableCopy(dst, src, d, s, n)
+
+		case opcodes.TableGet:
+			table := int(LE.Uint32(frame.Code[frame.IP : frame.IP+4]))
+			i := uint32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP+4:frame.IP+8]))])
+			frame.IP += 8
+			frame.Regs[valueID] = vm.tableGet(table, i)
+
+		case opcodes.TableSet:
+			table := int(LE.Uint32(frame.Code[frame.IP : frame.IP+4]))
+			i := uint32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP+4:frame.IP+8]))])
+			ref := frame.Regs[int(LE.Uint32(frame.Code[frame.IP+8:frame.IP+12]))]
+			frame.IP += 12
+			vm.tableSet(table, i, ref)
+
+		case opcodes.TableSize:
+			table := int(LE.Uint32(frame.Code[frame.IP : frame.IP+4]))
+			frame.IP += 4
+			frame.Regs[valueID] = int64(vm.TableAt(table).Size())
+
+		case opcodes.TableGrow:
+			table := int(LE.Uint32(frame.Code[frame.IP : frame.IP+4]))
+			ref := frame.Regs[int(LE.Uint32(frame.Code[frame.IP+4:frame.IP+8]))]
+			n := uint32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP+8:frame.IP+12]))])
+			frame.IP += 12
+			frame.Regs[valueID] = int64(uint32(vm.tableGrow(table, ref, n)))
+
+		case opcodes.TableFill:
+			table := int(LE.Uint32(frame.Code[frame.IP : frame.IP+4]))
+			i := uint32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP+4:frame.IP+8]))])
+			ref := frame.Regs[int(LE.Uint32(frame.Code[frame.IP+8:frame.IP+12]))]
+			n := uint32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP+12:frame.IP+16]))])
+			frame.IP += 16
+			vm.tableFill(table, i, ref, n)
+
 		case opcodes.Phi:
 			frame.Regs[valueID] = vm.Yielded
 
+		case opcodes.Yield:
+			i := int(LE.Uint32(frame.Code[frame.IP : frame.IP+4]))
+			vm.setYieldedValue(i, frame.Regs[int(LE.Uint32(frame.Code[frame.IP+4:frame.IP+8]))])
+			frame.IP += 8
+
+		case opcodes.PhiIndex:
+			i := int(LE.Uint32(frame.Code[frame.IP : frame.IP+4]))
+			frame.IP += 4
+			frame.Regs[valueID] = vm.yieldedValue(i)
+
 		case opcodes.AddGas:
 			delta := LE.Uint64(frame.Code[frame.IP : frame.IP+8])
 			frame.IP += 8
@@ -2081,8 +2339,55 @@ func (vm *VirtualMachine) Execute() {
 				return
 			}
 
+		case opcodes.AddGasScaled:
+			cost := LE.Uint64(frame.Code[frame.IP : frame.IP+8])
+			n := uint64(uint32(frame.Regs[int(LE.Uint32(frame.Code[frame.IP+8:frame.IP+12]))]))
+			frame.IP += 12
+			hi, delta := bits.Mul64(cost, n)
+			if hi != 0 {
+				panic("gas overflow")
+			}
+			if !vm.AddAndCheckGas(delta) {
+				vm.GasLimitExceeded = true
+				return
+			}
+
 		case opcodes.FPDisabledError:
-			panic("wasm: floating point disabled")
+			panic(&Trap{Kind: TrapFloatingPointDisabled})
+
+		case opcodes.SIMD:
+			vm.execSIMD(frame, valueID)
+
+		case opcodes.SIMDDisabledError:
+			panic(&Trap{Kind: TrapSIMDDisabled})
+
+		case opcodes.Atomic:
+			vm.execAtomic(frame, valueID)
+
+		case opcodes.Catch:
+			exc := vm.catch(frame, int(LE.Uint32(frame.Code[frame.IP:frame.IP+4])))
+			frame.IP += 4
+			if len(exc.Payload) > 0 {
+				frame.Regs[valueID] = exc.Payload[0]
+			}
+			for i := 1; i < len(exc.Payload); i++ {
+				vm.setYieldedValue(i, exc.Payload[i])
+			}
+
+		case opcodes.Throw:
+			tag := int(LE.Uint32(frame.Code[frame.IP : frame.IP+4]))
+			count := int(LE.Uint32(frame.Code[frame.IP+4 : frame.IP+8]))
+			frame.IP += 8
+			payload := make([]int64, count)
+			for i := range payload {
+				payload[i] = frame.Regs[int(LE.Uint32(frame.Code[frame.IP:frame.IP+4]))]
+				frame.IP += 4
+			}
+			frame = vm.throw(&Exception{Tag: vm.tags[tag], Payload: payload}, insIP)
+
+		case opcodes.Rethrow:
+			h := int(LE.Uint32(frame.Code[frame.IP : frame.IP+4]))
+			frame = vm.throw(frame.Caught[h], insIP)
 
 		default:
 			panic("unknown instruction")
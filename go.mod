@@ -7,4 +7,4 @@ require (
 	google.golang.org/appengine v1.6.0 // indirect
 )
 
-go 1.13
+go 1.16
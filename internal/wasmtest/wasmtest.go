@@ -0,0 +1,206 @@
+// Package wasmtest assembles WebAssembly modules in the binary format for
+// tests.
+package wasmtest
+
+// Value types.
+const (
+	I32       = 0x7f
+	I64       = 0x7e
+	F32       = 0x7d
+	F64       = 0x7c
+	V128      = 0x7b
+	FuncRef   = 0x70
+	ExternRef = 0x6f
+)
+
+// Kinds of imports and exports.
+const (
+	KindFunc   = 0
+	KindTable  = 1
+	KindMemory = 2
+	KindGlobal = 3
+	KindTag    = 4
+)
+
+// Func is a function defined by a module.
+type Func struct {
+	Type   int
+	Locals []byte // local declarations, none if nil
+	Body   []byte // instructions, without the final end
+}
+
+// Import is an import of a module, Desc being the encoded description of
+// the imported external following its kind.
+type Import struct {
+	Module, Field string
+	Kind          byte
+	Desc          []byte
+}
+
+// Module is a module, each section of which holds encoded entries.
+type Module struct {
+	Types    [][]byte
+	Imports  []Import
+	Funcs    []Func
+	Tables   [][]byte
+	Memories [][]byte
+	Globals  [][]byte
+	Exports  [][]byte
+	Start    *int
+	Elems    [][]byte
+	Datas    [][]byte
+}
+
+// U encodes an unsigned LEB128 integer.
+func U(v uint64) []byte {
+	var out []byte
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if v == 0 {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
+
+// S encodes a signed LEB128 integer.
+func S(v int64) []byte {
+	var out []byte
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if (v == 0 && b&0x40 == 0) || (v == -1 && b&0x40 != 0) {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
+
+// Cat concatenates encoded parts.
+func Cat(parts ...[]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+// Vec encodes a vector of encoded items.
+func Vec(items ...[]byte) []byte {
+	return Cat(U(uint64(len(items))), Cat(items...))
+}
+
+// Str encodes a name.
+func Str(s string) []byte {
+	return append(U(uint64(len(s))), s...)
+}
+
+// FuncType encodes a function type.
+func FuncType(params, results []byte) []byte {
+	return Cat([]byte{0x60}, U(uint64(len(params))), params, U(uint64(len(results))), results)
+}
+
+// Locals encodes the declaration of n locals of type t.
+func Locals(n int, t byte) []byte {
+	return Vec(Cat(U(uint64(n)), []byte{t}))
+}
+
+// Limits encodes the limits of a memory or table, without a maximum if max
+// is negative.
+func Limits(min, max int64) []byte {
+	if max < 0 {
+		return Cat([]byte{0}, U(uint64(min)))
+	}
+	return Cat([]byte{1}, U(uint64(min)), U(uint64(max)))
+}
+
+// Export encodes an export.
+func Export(name string, kind byte, index int) []byte {
+	return Cat(Str(name), []byte{kind}, U(uint64(index)))
+}
+
+// ImportFunc returns an import of a function of the given type.
+func ImportFunc(module, field string, typ int) Import {
+	return Import{Module: module, Field: field, Kind: KindFunc, Desc: U(uint64(typ))}
+}
+
+// ActiveData encodes a data segment initializing the first memory at offset.
+func ActiveData(offset int32, data string) []byte {
+	return Cat([]byte{0}, I32Const(offset), []byte{0x0b}, Str(data))
+}
+
+// I32Const encodes an i32.const instruction.
+func I32Const(v int32) []byte { return Cat([]byte{0x41}, S(int64(v))) }
+
+// I64Const encodes an i64.const instruction.
+func I64Const(v int64) []byte { return Cat([]byte{0x42}, S(v)) }
+
+// LocalGet encodes a local.get instruction.
+func LocalGet(i int) []byte { return Cat([]byte{0x20}, U(uint64(i))) }
+
+// LocalSet encodes a local.set instruction.
+func LocalSet(i int) []byte { return Cat([]byte{0x21}, U(uint64(i))) }
+
+// Call encodes a call instruction.
+func Call(i int) []byte { return Cat([]byte{0x10}, U(uint64(i))) }
+
+func section(id byte, content []byte) []byte {
+	return Cat([]byte{id}, U(uint64(len(content))), content)
+}
+
+// Bytes encodes the module.
+func (m *Module) Bytes() []byte {
+	out := []byte{0, 'a', 's', 'm', 1, 0, 0, 0}
+	if len(m.Types) > 0 {
+		out = append(out, section(1, Vec(m.Types...))...)
+	}
+	if len(m.Imports) > 0 {
+		var items [][]byte
+		for _, im := range m.Imports {
+			items = append(items, Cat(Str(im.Module), Str(im.Field), []byte{im.Kind}, im.Desc))
+		}
+		out = append(out, section(2, Vec(items...))...)
+	}
+	if len(m.Funcs) > 0 {
+		var items [][]byte
+		for _, f := range m.Funcs {
+			items = append(items, U(uint64(f.Type)))
+		}
+		out = append(out, section(3, Vec(items...))...)
+	}
+	if len(m.Tables) > 0 {
+		out = append(out, section(4, Vec(m.Tables...))...)
+	}
+	if len(m.Memories) > 0 {
+		out = append(out, section(5, Vec(m.Memories...))...)
+	}
+	if len(m.Globals) > 0 {
+		out = append(out, section(6, Vec(m.Globals...))...)
+	}
+	if len(m.Exports) > 0 {
+		out = append(out, section(7, Vec(m.Exports...))...)
+	}
+	if m.Start != nil {
+		out = append(out, section(8, U(uint64(*m.Start)))...)
+	}
+	if len(m.Elems) > 0 {
+		out = append(out, section(9, Vec(m.Elems...))...)
+	}
+	if len(m.Funcs) > 0 {
+		var items [][]byte
+		for _, f := range m.Funcs {
+			locals := f.Locals
+			if locals == nil {
+				locals = []byte{0}
+			}
+			body := Cat(locals, f.Body, []byte{0x0b})
+			items = append(items, Cat(U(uint64(len(body))), body))
+		}
+		out = append(out, section(10, Vec(items...))...)
+	}
+	if len(m.Datas) > 0 {
+		out = append(out, section(11, Vec(m.Datas...))...)
+	}
+	return out
+}
@@ -1,73 +1,68 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"github.com/perlin-network/life/compiler"
 	"github.com/perlin-network/life/exec"
 	"github.com/perlin-network/life/platform"
+	"github.com/perlin-network/life/wasi"
+	"github.com/perlin-network/life/wasi/vfs"
 	wasm_validation "github.com/perlin-network/life/wasm-validation"
 	"io/ioutil"
+	"os"
 	"strconv"
 	"time"
 )
 
-// Resolver defines imports for WebAssembly modules ran in Life.
-type Resolver struct{}
-
-// ResolveFunc defines a set of import functions that may be called within a WebAssembly module.
-func (r *Resolver) ResolveFunc(module, field string) exec.FunctionImport {
-	fmt.Printf("Resolve func: %s %s\n", module, field)
-	switch module {
-	case "env":
-		switch field {
-		case "__life_ping":
-			return func(vm *exec.VirtualMachine) int64 {
-				return vm.GetCurrentFrame().Locals[0] + 1
-			}
-		case "__life_log":
-			return func(vm *exec.VirtualMachine) int64 {
-				ptr := int(uint32(vm.GetCurrentFrame().Locals[0]))
-				msgLen := int(uint32(vm.GetCurrentFrame().Locals[1]))
-				msg := vm.Memory[ptr : ptr+msgLen]
-				fmt.Printf("[app] %s\n", string(msg))
-				return 0
-			}
-		case "print_i64":
-			return func(vm *exec.VirtualMachine) int64 {
-				fmt.Printf("[app] print_i64: %d\n", vm.GetCurrentFrame().Locals[0])
-				return 0
-			}
-
-		default:
-			panic(fmt.Errorf("unknown field: %s", field))
-		}
-	default:
-		panic(fmt.Errorf("unknown module: %s", module))
-	}
+// newImports defines a set of import functions and global variables for use
+// within WebAssembly modules ran in Life.
+func newImports() *exec.Imports {
+	imports := exec.NewImports()
+	imports.Module("env").
+		Func("__life_ping", func(vm *exec.VirtualMachine) int64 {
+			return vm.GetCurrentFrame().Locals[0] + 1
+		}).
+		HostFunc("__life_log", func(vm *exec.VirtualMachine, ptr, msgLen uint32) {
+			msg := vm.Memory[ptr : ptr+msgLen]
+			fmt.Printf("[app] %s\n", string(msg))
+		}).
+		HostFunc("print_i64", func(v int64) {
+			fmt.Printf("[app] print_i64: %d\n", v)
+		}).
+		Global("__life_magic", 424)
+	return imports
 }
 
-// ResolveGlobal defines a set of global variables for use within a WebAssembly module.
-func (r *Resolver) ResolveGlobal(module, field string) int64 {
-	fmt.Printf("Resolve global: %s %s\n", module, field)
-	switch module {
-	case "env":
-		switch field {
-		case "__life_magic":
-			return 424
-		default:
-			panic(fmt.Errorf("unknown field: %s", field))
-		}
-	default:
-		panic(fmt.Errorf("unknown module: %s", module))
-	}
+func main() {
+	os.Exit(run())
 }
 
-func main() {
+// run runs the module given on the command line and returns the exit code of
+// the process, once deferred cleanups such as closing WASI files have run.
+func run() int {
 	entryFunctionFlag := flag.String("entry", "app_main", "entry function name")
 	pmFlag := flag.Bool("polymerase", false, "enable the Polymerase engine")
 	noFloatingPointFlag := flag.Bool("no-fp", false, "disable floating point")
+	optFlag := flag.Bool("opt", false, "run the optimization passes over the compiled code")
+	wasiFlag := flag.Bool("wasi", false, "provide the WASI (wasi_snapshot_preview1) host interface")
+	wasiDirFlag := flag.String("wasi-dir", "", "host directory to mount read-only as / for WASI modules")
 	flag.Parse()
 
+	// WASI commands are started through `_start` unless told otherwise.
+	if *wasiFlag {
+		entrySet := false
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "entry" {
+				entrySet = true
+			}
+		})
+		if !entrySet {
+			*entryFunctionFlag = "_start"
+		}
+	}
+
 	// Read WebAssembly *.wasm file.
 	input, err := ioutil.ReadFile(flag.Arg(0))
 	if err != nil {
@@ -78,12 +73,46 @@ func main() {
 		panic(err)
 	}
 
+	var resolver exec.ImportResolver = newImports()
+
+	if *wasiFlag {
+		var mounts []vfs.Mount
+		if *wasiDirFlag != "" {
+			hostFS, err := vfs.NewHostFS(*wasiDirFlag)
+			if err != nil {
+				panic(err)
+			}
+			mounts = append(mounts, vfs.Mount{Path: "/", FS: hostFS})
+		}
+
+		w, err := wasi.New(wasi.Config{
+			Args:     flag.Args(),
+			Stdin:    os.Stdin,
+			Stdout:   os.Stdout,
+			Stderr:   os.Stderr,
+			Mounts:   mounts,
+			Fallback: resolver,
+		})
+		if err != nil {
+			panic(err)
+		}
+		defer w.Close()
+
+		resolver = w
+	}
+
+	var optimizations compiler.Optimizations
+	if *optFlag {
+		optimizations = compiler.AllOptimizations
+	}
+
 	// Instantiate a new WebAssembly VM with a few resolved imports.
 	vm, err := exec.NewVirtualMachine(input, exec.VMConfig{
 		DefaultMemoryPages:   128,
 		DefaultTableSize:     65536,
 		DisableFloatingPoint: *noFloatingPointFlag,
-	}, new(Resolver), nil)
+		Optimizations:        optimizations,
+	}, resolver, nil)
 
 	if err != nil {
 		panic(err)
@@ -117,27 +146,47 @@ func main() {
 		startID := int(vm.Module.Base.Start.Index)
 		_, err := vm.Run(startID)
 		if err != nil {
+			if code, ok := exitCode(err); ok {
+				return code
+			}
 			vm.PrintStackTrace()
 			panic(err)
 		}
 	}
+	// Arguments of WASI modules are passed through args_get instead.
 	var args []int64
-	for _, arg := range flag.Args()[1:] {
-		fmt.Println(arg)
-		if ia, err := strconv.Atoi(arg); err != nil {
-			panic(err)
-		} else {
-			args = append(args, int64(ia))
+	if !*wasiFlag {
+		for _, arg := range flag.Args()[1:] {
+			fmt.Println(arg)
+			if ia, err := strconv.Atoi(arg); err != nil {
+				panic(err)
+			} else {
+				args = append(args, int64(ia))
+			}
 		}
 	}
 
 	// Run the WebAssembly module's entry function.
 	ret, err := vm.Run(entryID, args...)
 	if err != nil {
+		if code, ok := exitCode(err); ok {
+			return code
+		}
 		vm.PrintStackTrace()
 		panic(err)
 	}
 	end := time.Now()
 
 	fmt.Printf("return value = %d, duration = %v\n", ret, end.Sub(start))
+	return 0
+}
+
+// exitCode returns the exit code of the module if err was caused by the
+// module exiting through a function import.
+func exitCode(err error) (int, bool) {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return int(exitErr.Code), true
+	}
+	return 0, false
 }
@@ -19,6 +19,12 @@ func (c *AOTContext) UnsafeInvokeFunction_2(vm *exec.VirtualMachine, name string
 	return 0
 }
 
+func (c *AOTContext) Interrupt(vm *exec.VirtualMachine, interrupt bool) {
+}
+
+func (c *AOTContext) ReadResults(vm *exec.VirtualMachine, results []int64) {
+}
+
 func FullAOTCompile(vm *exec.VirtualMachine) *AOTContext {
 	return nil
 }
@@ -81,6 +81,7 @@ static uint64_t unsafe_invoke_function_2(struct VirtualMachine *vm, void *sym, u
 import "C"
 
 import (
+	"errors"
 	"io/ioutil"
 	"log"
 	os_exec "os/exec"
@@ -89,23 +90,62 @@ import (
 	"runtime"
 	"unsafe"
 
+	"github.com/perlin-network/life/compiler"
 	"github.com/perlin-network/life/exec"
 )
 
+// aotTrapKinds maps the messages passed to throw_s by the runtime and the
+// generated code to trap kinds. Failures of the runtime itself are left
+// unclassified.
+var aotTrapKinds = map[string]exec.TrapKind{
+	"unreachable executed":        exec.TrapUnreachable,
+	"divide by zero":              exec.TrapIntegerDivideByZero,
+	"memory access out of bounds": exec.TrapMemoryOutOfBounds,
+	"access violation":            exec.TrapMemoryOutOfBounds,
+	"floating point disabled":     exec.TrapFloatingPointDisabled,
+	"execution interrupted":       exec.TrapInterrupted,
+	"table access out of bounds":  exec.TrapTableOutOfBounds,
+	"table entry out of bounds":   exec.TrapUndefinedElement,
+	"table entry is null":         exec.TrapUndefinedElement,
+	"argument count mismatch":     exec.TrapIndirectCallTypeMismatch,
+	"simd disabled":               exec.TrapSIMDDisabled,
+	"unaligned atomic":            exec.TrapUnalignedAtomic,
+	"expected shared memory":      exec.TrapExpectedSharedMemory,
+	"import entry out of bounds":  exec.TrapHostFunction,
+	"cannot resolve import":       exec.TrapHostFunction,
+	"host function failed":        exec.TrapHostFunction,
+
+	"cannot setup memory mapping":        exec.TrapUnknown,
+	"cannot setup userfaultfd":           exec.TrapUnknown,
+	"cannot initialize userfaultfd":      exec.TrapUnknown,
+	"cannot register userfaultfd":        exec.TrapUnknown,
+	"cannot start monitor thread":        exec.TrapUnknown,
+	"cannot create thread for execution": exec.TrapUnknown,
+}
+
 //export go_vm_throw_s
 func go_vm_throw_s(vm *C.struct_VirtualMachine, s *C.const_char) {
+	if c := contextOf(vm); c != nil && c.importPanic != nil {
+		err := c.importPanic
+		c.importPanic = nil
+		panic(err)
+	}
+
 	gs := C.GoString(s)
-	panic(gs)
+	if kind := aotTrapKinds[gs]; kind != exec.TrapUnknown {
+		panic(&exec.Trap{Kind: kind, FunctionID: -1})
+	}
+	panic(&exec.Trap{Kind: exec.TrapUnknown, FunctionID: -1, Err: errors.New(gs)})
 }
 
 //export go_vm_resolve_import
 func go_vm_resolve_import(vm *C.struct_VirtualMachine, moduleName *C.const_char, fieldName *C.const_char) C.ExternalFunction {
-	return C.ExternalFunction(C.go_vm_dispatch_import_invocation)
+	return C.vm_import_dispatcher()
 }
 
 //export go_vm_dispatch_import_invocation
-func go_vm_dispatch_import_invocation(vm *C.struct_VirtualMachine, importID C.uint64_t, numParams C.uint64_t, params *C.uint64_t) C.uint64_t {
-	managedVM := (*exec.VirtualMachine)(unsafe.Pointer(uintptr(C.vm_get_managed(vm))))
+func go_vm_dispatch_import_invocation(vm *C.struct_VirtualMachine, importID C.uint64_t, numParams C.uint64_t, params *C.uint64_t) (ret C.uint64_t) {
+	managedVM := managedVMOf(vm)
 
 	imp := &managedVM.FunctionImports[importID]
 	if imp.F == nil {
@@ -120,12 +160,53 @@ func go_vm_dispatch_import_invocation(vm *C.struct_VirtualMachine, importID C.ui
 		Cap:  int(numParams),
 	}
 	managedVM.GetCurrentFrame().Locals = *(*[]int64)(unsafe.Pointer(&localsSlice)) // very unsafe - should we just allocate a new slice?
-	return C.uint64_t(imp.F(managedVM))
+
+	// Panics must not unwind the execution thread of the runtime. They are
+	// raised again by go_vm_throw_s once the runtime has left compiled code.
+	defer func() {
+		if err := recover(); err != nil {
+			if c := contextOf(vm); c != nil {
+				c.importPanic = err
+			} else {
+				panic(err)
+			}
+			ret = 0
+		}
+	}()
+	ret = C.uint64_t(imp.F(managedVM))
+	if c := contextOf(vm); c != nil {
+		copy(c.yielded, managedVM.YieldedValues)
+	}
+	return ret
 }
 
-//export go_vm_pre_notify_grow_memory
-func go_vm_pre_notify_grow_memory(vm *C.struct_VirtualMachine, incSize C.uint64_t) {
+//export go_vm_import_failed
+func go_vm_import_failed(vm *C.struct_VirtualMachine) C.int {
+	if c := contextOf(vm); c != nil && c.importPanic != nil {
+		return 1
+	}
+	return 0
+}
 
+// contextOf returns the AOT context of the managed virtual machine of vm.
+func contextOf(vm *C.struct_VirtualMachine) *AOTContext {
+	c, _ := managedVMOf(vm).AOTService.(*AOTContext)
+	return c
+}
+
+// managedVMOf returns the managed virtual machine of vm.
+func managedVMOf(vm *C.struct_VirtualMachine) *exec.VirtualMachine {
+	return (*exec.VirtualMachine)(unsafe.Pointer(uintptr(C.vm_get_managed(vm))))
+}
+
+//export go_vm_pre_notify_grow_memory
+func go_vm_pre_notify_grow_memory(vm *C.struct_VirtualMachine, index, incSize C.uint64_t) C.int {
+	managedVM := managedVMOf(vm)
+	pages := (uint64(len(managedVM.MemoryAt(int(index)).Bytes)) + uint64(incSize)) / exec.DefaultPageSize
+	if pages > uint64(managedVM.MemoryLimit(int(index))) {
+		return 0
+	}
+	return 1
 }
 
 //export go_vm_post_notify_grow_memory
@@ -134,18 +215,37 @@ func go_vm_post_notify_grow_memory(vm *C.struct_VirtualMachine) {
 }
 
 func updateMemory(vm *C.struct_VirtualMachine) {
-	managedVM := (*exec.VirtualMachine)(unsafe.Pointer(uintptr(C.vm_get_managed(vm))))
+	managedVM := managedVMOf(vm)
+	managedVM.Memory = nativeBytes(vm.mem, vm.mem_size)
+	for i := 1; i < int(vm.num_memories); i++ {
+		m := C.vm_memory_at(vm, C.uint64_t(i))
+		managedVM.MemoryAt(i).Bytes = nativeBytes(m.data, m.size)
+	}
+}
+
+// nativeBytes returns a slice of the size bytes of native memory at data.
+func nativeBytes(data *C.uint8_t, size C.uint64_t) []byte {
 	memorySlice := reflect.SliceHeader{
-		Data: uintptr(unsafe.Pointer(vm.mem)),
-		Len:  int(vm.mem_size),
-		Cap:  int(vm.mem_size),
+		Data: uintptr(unsafe.Pointer(data)),
+		Len:  int(size),
+		Cap:  int(size),
 	}
-	managedVM.Memory = *(*[]byte)(unsafe.Pointer(&memorySlice))
+	return *(*[]byte)(unsafe.Pointer(&memorySlice))
 }
 
 type AOTContext struct {
 	dlHandle unsafe.Pointer
 	vmHandle *C.struct_VirtualMachine
+
+	importPanic interface{} // panic raised by a function import, pending to be raised again
+	yielded     []int64     // values after the first one passed along branches and returns
+}
+
+// loadYielded looks up the storage of the values after the first one passed
+// along branches and returns of the compiled code.
+func (c *AOTContext) loadYielded() {
+	numYielded := *(*C.uint64_t)(c.resolveNameForInvocation(compiler.NGEN_ENV_API_PREFIX + "num_yielded"))
+	c.yielded = (*[1 << 28]int64)(c.resolveNameForInvocation(compiler.NGEN_ENV_API_PREFIX + "yielded"))[:numYielded:numYielded]
 }
 
 func (c *AOTContext) resolveNameForInvocation(name string) unsafe.Pointer {
@@ -167,6 +267,15 @@ func (c *AOTContext) Initialize(vm *exec.VirtualMachine) {
 		C.memcpy(unsafe.Pointer(nativeVM.mem), unsafe.Pointer(&vm.Memory[0]), C.ulong(len(vm.Memory)))
 	}
 
+	C.vm_build_memories(nativeVM, C.uint64_t(len(vm.Module.MemoryTypes)))
+	for i := 1; i < len(vm.Module.MemoryTypes); i++ {
+		bytes := vm.MemoryAt(i).Bytes
+		C.vm_build_memory(nativeVM, C.uint64_t(i), C.uint64_t(len(bytes)))
+		if len(bytes) > 0 {
+			C.memcpy(unsafe.Pointer(C.vm_memory_at(nativeVM, C.uint64_t(i)).data), unsafe.Pointer(&bytes[0]), C.ulong(len(bytes)))
+		}
+	}
+
 	updateMemory(nativeVM)
 
 	c.vmHandle = nativeVM
@@ -196,7 +305,32 @@ func (c *AOTContext) UnsafeInvokeFunction_2(vm *exec.VirtualMachine, name string
 	))
 }
 
+func (c *AOTContext) ReadResults(vm *exec.VirtualMachine, results []int64) {
+	copy(results, c.yielded)
+}
+
+func (c *AOTContext) Interrupt(vm *exec.VirtualMachine, interrupt bool) {
+	if c.vmHandle == nil {
+		return
+	}
+
+	if interrupt {
+		C.vm_interrupt(c.vmHandle, 1)
+	} else {
+		C.vm_interrupt(c.vmHandle, 0)
+	}
+}
+
 func FullAOTCompile(vm *exec.VirtualMachine) *AOTContext {
+	if vm.Module.UsesSharedMemory() {
+		log.Println("shared memories are not supported by AOT-compiled code")
+		return nil
+	}
+	if vm.Module.UsesExceptionHandling() {
+		log.Println("exception handling is not supported by AOT-compiled code")
+		return nil
+	}
+
 	code := vm.NCompile(exec.NCompileConfig{
 		AliasDef:             false,
 		DisableMemBoundCheck: C.need_mem_bound_check() == 0,
@@ -216,7 +350,7 @@ func FullAOTCompile(vm *exec.VirtualMachine) *AOTContext {
 		return nil
 	}
 
-	cmd := os_exec.Command("clang", "-fPIC", "-O2", "-lm", "-o", outPath, "-shared", inPath)
+	cmd := os_exec.Command("clang", "-fPIC", "-O2", "-o", outPath, "-shared", inPath, "-lm")
 	out, err := cmd.CombinedOutput()
 
 	if len(out) > 0 {
@@ -239,6 +373,7 @@ func FullAOTCompile(vm *exec.VirtualMachine) *AOTContext {
 	ctx := &AOTContext{
 		dlHandle: handle,
 	}
+	ctx.loadYielded()
 
 	runtime.SetFinalizer(ctx, func(ctx *AOTContext) {
 		C.dlclose(ctx.dlHandle)
@@ -252,6 +387,15 @@ func FullAOTCompile(vm *exec.VirtualMachine) *AOTContext {
 }
 
 func FullAOTCompileModule(m *exec.Module) *AOTContext {
+	if m.Module.UsesSharedMemory() {
+		log.Println("shared memories are not supported by AOT-compiled code")
+		return nil
+	}
+	if m.Module.UsesExceptionHandling() {
+		log.Println("exception handling is not supported by AOT-compiled code")
+		return nil
+	}
+
 	code := m.NCompile(exec.NCompileConfig{
 		AliasDef:             false,
 		DisableMemBoundCheck: C.need_mem_bound_check() == 0,
@@ -271,7 +415,7 @@ func FullAOTCompileModule(m *exec.Module) *AOTContext {
 		return nil
 	}
 
-	cmd := os_exec.Command("clang", "-fPIC", "-O2", "-lm", "-o", outPath, "-shared", inPath)
+	cmd := os_exec.Command("clang", "-fPIC", "-O2", "-o", outPath, "-shared", inPath, "-lm")
 	out, err := cmd.CombinedOutput()
 
 	if len(out) > 0 {
@@ -294,6 +438,7 @@ func FullAOTCompileModule(m *exec.Module) *AOTContext {
 	ctx := &AOTContext{
 		dlHandle: handle,
 	}
+	ctx.loadYielded()
 
 	runtime.SetFinalizer(ctx, func(ctx *AOTContext) {
 		C.dlclose(ctx.dlHandle)
@@ -0,0 +1,148 @@
+// +build !android
+
+package platform
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	os_exec "os/exec"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/perlin-network/life/exec"
+	. "github.com/perlin-network/life/internal/wasmtest"
+)
+
+// newAOTVM instantiates a module and compiles it ahead of time, skipping the
+// test if no C compiler is available.
+func newAOTVM(t *testing.T, code []byte) *exec.VirtualMachine {
+	t.Helper()
+	if _, err := os_exec.LookPath("clang"); err != nil {
+		t.Skip("clang not found")
+	}
+
+	vm, err := exec.NewVirtualMachine(code, exec.VMConfig{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aot := FullAOTCompile(vm)
+	if aot == nil {
+		t.Fatal("AOT compilation failed")
+	}
+	vm.SetAOTService(aot)
+	return vm
+}
+
+func TestRunContextAOT(t *testing.T) {
+	m := &Module{
+		Types: [][]byte{FuncType(nil, nil), FuncType([]byte{I32}, []byte{I32})},
+		Funcs: []Func{
+			{Type: 0, Body: []byte{0x03, 0x40, 0x0c, 0x00, 0x0b}}, // loop, br 0, end
+			{Type: 1, Body: Cat(LocalGet(0), I32Const(1), []byte{0x6a})},
+		},
+		Exports: [][]byte{Export("loop", KindFunc, 0), Export("inc", KindFunc, 1)},
+	}
+	vm := newAOTVM(t, m.Bytes())
+	loop, _ := vm.GetFunctionExport("loop")
+	inc, _ := vm.GetFunctionExport("inc")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err := vm.RunContext(ctx, loop)
+	if trap, ok := err.(*exec.Trap); !ok || trap.Kind != exec.TrapInterrupted {
+		t.Fatalf("expected an interruption, got %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("interruption does not wrap the error of the context: %v", err)
+	}
+
+	// The VM may be run again once interrupted.
+	if ret, err := vm.RunContext(context.Background(), inc, 41); err != nil || ret != 42 {
+		t.Fatalf("got %d, %v", ret, err)
+	}
+}
+
+func TestRunContextAOTGrowMemory(t *testing.T) {
+	m := &Module{
+		Types: [][]byte{FuncType(nil, nil)},
+		Funcs: []Func{
+			// loop, memory.grow 0, drop, br 0, end
+			{Type: 0, Body: Cat([]byte{0x03, 0x40}, I32Const(0), []byte{0x40, 0x00, 0x1a, 0x0c, 0x00, 0x0b})},
+		},
+		Memories: [][]byte{Limits(1, -1)},
+		Exports:  [][]byte{Export("grow", KindFunc, 0)},
+	}
+	vm := newAOTVM(t, m.Bytes())
+	grow, _ := vm.GetFunctionExport("grow")
+
+	// Interruptions arriving while memory grows are deferred until compiled
+	// code runs again.
+	for i := 0; i < 20; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		_, err := vm.RunContext(ctx, grow)
+		cancel()
+		if trap, ok := err.(*exec.Trap); !ok || trap.Kind != exec.TrapInterrupted {
+			t.Fatalf("expected an interruption, got %v", err)
+		}
+	}
+}
+
+// throwPatterns match the messages passed to throw_s by the runtimes, and by
+// the code generated by the compiler and the virtual machine.
+var throwPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`throw_s\([^,()]+, "([^"%]+)"\)`),
+	regexp.MustCompile(`throw_s\(vm, \\"([^"%\\]+)\\"\)`),
+	regexp.MustCompile(`throw_s\(vm, \\"%s\\"\);[^"]*", "([^"]+)"`),
+}
+
+func TestAOTTrapKinds(t *testing.T) {
+	var files []string
+	for _, pattern := range []string{"*.h", "../compiler/*.go", "../exec/*.go"} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, matches...)
+	}
+
+	messages := make(map[string]string)
+	for _, file := range files {
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, re := range throwPatterns {
+			for _, m := range re.FindAllSubmatch(src, -1) {
+				messages[string(m[1])] = file
+			}
+		}
+	}
+	if len(messages) == 0 {
+		t.Fatal("no messages found")
+	}
+	for msg, file := range messages {
+		if _, ok := aotTrapKinds[msg]; !ok {
+			t.Errorf("%s: no trap kind for %q", file, msg)
+		}
+	}
+
+	// Traps are classified as by the interpreter.
+	for msg, kind := range map[string]exec.TrapKind{
+		"table entry out of bounds":   exec.TrapUndefinedElement,
+		"table entry is null":         exec.TrapUndefinedElement,
+		"argument count mismatch":     exec.TrapIndirectCallTypeMismatch,
+		"memory access out of bounds": exec.TrapMemoryOutOfBounds,
+		"cannot resolve import":       exec.TrapHostFunction,
+	} {
+		if _, ok := messages[msg]; !ok {
+			t.Errorf("%q is not passed to throw_s", msg)
+		}
+		if aotTrapKinds[msg] != kind {
+			t.Errorf("%q is classified as %v, expected %v", msg, aotTrapKinds[msg], kind)
+		}
+	}
+}
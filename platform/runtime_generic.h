@@ -3,18 +3,31 @@
 #include <stdlib.h>
 #include "vm_def.h"
 
+struct GenericRuntimeInfo {
+    uintptr_t managed_vm;
+    int interrupted;
+};
+
 static int need_mem_bound_check() {
     return 1;
 }
 
-static void __x_grow_memory(struct VirtualMachine *vm, uint64_t inc_size) {
-    if(vm->mem_size + inc_size < vm->mem_size) {
-        vm->throw_s(vm, "memory size overflow");
+static int __x_grow_memory(struct VirtualMachine *vm, uint64_t index, uint64_t inc_size) {
+    if(index != 0) {
+        return vm_grow_heap_memory(vm, index, inc_size);
+    }
+    if(vm->mem_size + inc_size < vm->mem_size || !go_vm_pre_notify_grow_memory(vm, index, inc_size)) {
+        return 0;
     }
-    go_vm_pre_notify_grow_memory(vm, inc_size);
+    uint8_t *mem = realloc(vm->mem, vm->mem_size + inc_size);
+    if(!mem && vm->mem_size + inc_size != 0) {
+        return 0;
+    }
+    __builtin_memset(mem + vm->mem_size, 0, inc_size);
+    vm->mem = mem;
     vm->mem_size += inc_size;
-    vm->mem = realloc(vm->mem, vm->mem_size);
     go_vm_post_notify_grow_memory(vm);
+    return 1;
 }
 
 static void vm_build(struct VirtualMachine *vm, uintptr_t managed_vm, uint64_t mem_size) {
@@ -23,17 +36,51 @@ static void vm_build(struct VirtualMachine *vm, uintptr_t managed_vm, uint64_t m
     vm->mem_size = mem_size;
     vm->mem = malloc(mem_size);
     vm->grow_memory = __x_grow_memory;
-    vm->userdata = (void *) managed_vm;
+
+    struct GenericRuntimeInfo *rt_info = malloc(sizeof(struct GenericRuntimeInfo));
+    rt_info->managed_vm = managed_vm;
+    rt_info->interrupted = 0;
+    vm->userdata = rt_info;
 }
 
 static void vm_destroy(struct VirtualMachine *vm) {
     if(vm->mem) free(vm->mem);
+    vm_destroy_memories(vm);
+    free(vm->userdata);
 }
 
 static uintptr_t vm_get_managed(struct VirtualMachine *vm) {
-    return (uintptr_t) vm->userdata;
+    return ((struct GenericRuntimeInfo *) vm->userdata)->managed_vm;
+}
+
+// Compiled code cannot be preempted by this runtime; interruptions only take
+// effect when entering the VM and when returning from an import.
+static void vm_interrupt(struct VirtualMachine *vm, int interrupt) {
+    struct GenericRuntimeInfo *rt_info = vm->userdata;
+    __atomic_store_n(&rt_info->interrupted, interrupt, __ATOMIC_SEQ_CST);
+}
+
+static void __x_check_interrupt(struct VirtualMachine *vm) {
+    struct GenericRuntimeInfo *rt_info = vm->userdata;
+    if(__atomic_load_n(&rt_info->interrupted, __ATOMIC_SEQ_CST)) {
+        vm->throw_s(vm, "execution interrupted");
+    }
+}
+
+static uint64_t __x_dispatch_import_invocation(struct VirtualMachine *vm, uint64_t import_id, uint64_t num_params, uint64_t *params) {
+    uint64_t ret = go_vm_dispatch_import_invocation(vm, import_id, num_params, params);
+    if(go_vm_import_failed(vm)) {
+        vm->throw_s(vm, "host function failed");
+    }
+    __x_check_interrupt(vm);
+    return ret;
+}
+
+static ExternalFunction vm_import_dispatcher() {
+    return __x_dispatch_import_invocation;
 }
 
 static uint64_t vm_execute(struct VirtualMachine *vm, uint64_t (*f)(struct VirtualMachine *, void *), void *userdata) {
+    __x_check_interrupt(vm);
     return f(vm, userdata);
 }
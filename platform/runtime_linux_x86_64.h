@@ -18,13 +18,19 @@ static const unsigned long MMAP_SIZE = 1024ul * 1024 * 1024 * 9;
 static const unsigned long STACK_SIZE = 65536;
 static const unsigned long SIG42_SPECIAL_STACK_SIZE = 8192;
 
+// Sent to the execution thread to interrupt compiled code.
+#define SIG_INTERRUPT 43
+
 struct LinuxRuntimeInfo {
     struct VirtualMachine *vm;
     uintptr_t managed_vm;
     int uffd;
     pthread_t mon_thread;
     pthread_t exec_thread;
+    pthread_mutex_t exec_lock; // guards exec_thread and in_exec
     int in_exec;
+    volatile sig_atomic_t interruptible; // whether compiled code may be interrupted right now
+    volatile sig_atomic_t interrupt_pending;
     jmp_buf recovery_env;
     const char *pending_error;
     unsigned long current_stack_size;
@@ -42,15 +48,51 @@ static int need_mem_bound_check() {
     return 0;
 }
 
-static void __x_grow_memory(struct VirtualMachine *vm, uint64_t inc_size) {
+static int __x_grow_memory_unchecked(struct VirtualMachine *vm, uint64_t index, uint64_t inc_size) {
+    if(index != 0) {
+        return vm_grow_heap_memory(vm, index, inc_size);
+    }
     // No concurrent call of __x_grow_memory is allowed.
     // Otherwise there will be a race condition (TOCTOU).
-    if(vm->mem_size + inc_size < vm->mem_size) {
-        vm->throw_s(vm, "memory size overflow");
+    // The first memory must also not reach the stack at the end of its region.
+    if(vm->mem_size + inc_size < vm->mem_size
+        || vm->mem_size + inc_size > MMAP_SIZE - STACK_SIZE - SIG42_SPECIAL_STACK_SIZE
+        || !go_vm_pre_notify_grow_memory(vm, index, inc_size)) {
+        return 0;
     }
-    go_vm_pre_notify_grow_memory(vm, inc_size);
     __atomic_fetch_add(&vm->mem_size, inc_size, __ATOMIC_RELAXED);
     go_vm_post_notify_grow_memory(vm);
+    return 1;
+}
+
+// Calls out of compiled code, into Go or into the allocator, must not be
+// unwound by longjmp. Interruptions arriving meanwhile take effect once they
+// return.
+static void __x_leave_compiled_code(struct VirtualMachine *vm) {
+    struct LinuxRuntimeInfo *rt_info = vm->userdata;
+    rt_info->interruptible = 0;
+}
+
+static void __x_enter_compiled_code(struct VirtualMachine *vm) {
+    struct LinuxRuntimeInfo *rt_info = vm->userdata;
+    rt_info->interruptible = 1;
+    if(rt_info->interrupt_pending) {
+        vm->throw_s(vm, "execution interrupted");
+    }
+}
+
+static int __x_grow_memory(struct VirtualMachine *vm, uint64_t index, uint64_t inc_size) {
+    __x_leave_compiled_code(vm);
+    int ret = __x_grow_memory_unchecked(vm, index, inc_size);
+    __x_enter_compiled_code(vm);
+    return ret;
+}
+
+static ExternalFunction __x_resolve_import(struct VirtualMachine *vm, const char *module_name, const char *field_name) {
+    __x_leave_compiled_code(vm);
+    ExternalFunction ret = go_vm_resolve_import(vm, module_name, field_name);
+    __x_enter_compiled_code(vm);
+    return ret;
 }
 
 static void * __x_mon_thread(void *__arg) {
@@ -163,7 +205,7 @@ static uint8_t * __x_setup_memory(struct VirtualMachine *vm) {
 
 static void vm_build(struct VirtualMachine *vm, uintptr_t managed_vm, uint64_t mem_size) {
     vm->throw_s = go_vm_throw_s;
-    vm->resolve_import = go_vm_resolve_import;
+    vm->resolve_import = __x_resolve_import;
     vm->mem_size = mem_size;
     vm->grow_memory = __x_grow_memory;
 
@@ -172,6 +214,9 @@ static void vm_build(struct VirtualMachine *vm, uintptr_t managed_vm, uint64_t m
     rt_info->managed_vm = managed_vm;
     rt_info->page_size = sysconf(_SC_PAGE_SIZE);
     rt_info->in_exec = 0;
+    rt_info->interruptible = 0;
+    rt_info->interrupt_pending = 0;
+    pthread_mutex_init(&rt_info->exec_lock, NULL);
     rt_info->current_stack_size = STACK_SIZE;
     rt_info->pending_error = NULL;
     vm->userdata = rt_info;
@@ -184,7 +229,9 @@ static void vm_destroy(struct VirtualMachine *vm) {
     pthread_cancel(rt_info->mon_thread);
     pthread_join(rt_info->mon_thread, NULL);
     close(rt_info->uffd);
+    pthread_mutex_destroy(&rt_info->exec_lock);
     munmap(vm->mem, MMAP_SIZE);
+    vm_destroy_memories(vm);
 }
 
 static __thread struct VirtualMachine *current_vm = NULL;
@@ -200,6 +247,48 @@ static void __x_throw_s(struct VirtualMachine *vm, const char *s) {
     longjmp(rt_info->recovery_env, 1);
 }
 
+// Interruptions arriving while an import is running are deferred until the
+// import returns, as Go code must not be unwound by longjmp.
+static void __x_handle_interrupt(int signum) {
+    if(!current_vm) return;
+
+    struct LinuxRuntimeInfo *rt_info = current_vm->userdata;
+    if(rt_info->interruptible) {
+        current_vm->throw_s(current_vm, "execution interrupted");
+    }
+}
+
+static void vm_interrupt(struct VirtualMachine *vm, int interrupt) {
+    struct LinuxRuntimeInfo *rt_info = vm->userdata;
+
+    pthread_mutex_lock(&rt_info->exec_lock);
+    rt_info->interrupt_pending = interrupt;
+    if(interrupt && rt_info->in_exec) {
+        pthread_kill(rt_info->exec_thread, SIG_INTERRUPT);
+    }
+    pthread_mutex_unlock(&rt_info->exec_lock);
+}
+
+static uint64_t __x_dispatch_import_invocation(struct VirtualMachine *vm, uint64_t import_id, uint64_t num_params, uint64_t *params) {
+    struct LinuxRuntimeInfo *rt_info = vm->userdata;
+
+    rt_info->interruptible = 0;
+    uint64_t ret = go_vm_dispatch_import_invocation(vm, import_id, num_params, params);
+    rt_info->interruptible = 1;
+
+    if(go_vm_import_failed(vm)) {
+        vm->throw_s(vm, "host function failed");
+    }
+    if(rt_info->interrupt_pending) {
+        vm->throw_s(vm, "execution interrupted");
+    }
+    return ret;
+}
+
+static ExternalFunction vm_import_dispatcher() {
+    return __x_dispatch_import_invocation;
+}
+
 #ifdef __x86_64__
 asm(
     "__x_switch_stack:\n"
@@ -227,18 +316,29 @@ static void * __x_execute_delegate(void *__arg) {
     struct LinuxRuntimeInfo *rt_info = ctx->vm->userdata;
 
     signal(42, __x_handle_sig42);
+    signal(SIG_INTERRUPT, __x_handle_interrupt);
     current_vm = ctx->vm;
 
     ctx->vm->throw_s = __x_throw_s;
     rt_info->pending_error = NULL;
 
     if(setjmp(rt_info->recovery_env) == 0) {
+        rt_info->interruptible = 1;
+        if(rt_info->interrupt_pending) {
+            ctx->vm->throw_s(ctx->vm, "execution interrupted");
+        }
         ctx->result = __x_switch_stack((void *) ((unsigned long) ctx->vm->mem + MMAP_SIZE), perform_delegate_execution, ctx);
     } else {
         ctx->result = 0;
     }
+    rt_info->interruptible = 0;
     ctx->vm->throw_s = go_vm_throw_s;
 
+    // The thread must not be signaled any more once it is about to exit.
+    pthread_mutex_lock(&rt_info->exec_lock);
+    rt_info->in_exec = 0;
+    pthread_mutex_unlock(&rt_info->exec_lock);
+
     current_vm = NULL;
     return NULL;
 }
@@ -250,25 +350,26 @@ static uint64_t vm_execute(struct VirtualMachine *vm, uint64_t (*f)(struct Virtu
     ctx->f = f;
     ctx->userdata = userdata;
 
-    rt_info->in_exec = 1;
-
+    pthread_mutex_lock(&rt_info->exec_lock);
     if(pthread_create(&rt_info->exec_thread, NULL, __x_execute_delegate, ctx)) {
-        rt_info->in_exec = 0;
+        pthread_mutex_unlock(&rt_info->exec_lock);
         free(ctx);
 
         vm->throw_s(vm, "cannot create thread for execution");
     }
+    rt_info->in_exec = 1;
+    pthread_mutex_unlock(&rt_info->exec_lock);
 
     pthread_join(rt_info->exec_thread, NULL);
 
-    rt_info->in_exec = 0;
+    uint64_t result = ctx->result;
     free(ctx);
 
     if(rt_info->pending_error) {
         vm->throw_s(vm, rt_info->pending_error);
     }
 
-    return ctx->result;
+    return result;
 }
 
 static uintptr_t vm_get_managed(struct VirtualMachine *vm) {
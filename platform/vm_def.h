@@ -5,21 +5,67 @@
 
 struct VirtualMachine;
 typedef uint64_t (*ExternalFunction)(struct VirtualMachine *vm, uint64_t import_id, uint64_t num_params, uint64_t *params);
+struct Memory {
+	uint64_t size;
+	uint8_t *data;
+};
 struct VirtualMachine {
 	void (*throw_s)(struct VirtualMachine *vm, const char *s);
 	ExternalFunction (*resolve_import)(struct VirtualMachine *vm, const char *module_name, const char *field_name);
 	uint64_t mem_size;
 	uint8_t *mem;
-	void (*grow_memory)(struct VirtualMachine *vm, uint64_t inc_size);
+	int (*grow_memory)(struct VirtualMachine *vm, uint64_t index, uint64_t inc_size); // 0 if the memory cannot grow
 	void *userdata;
+	struct Memory *memories; // memories after the first one, from index 1
+	uint64_t num_memories;
 };
 
 void go_vm_throw_s(struct VirtualMachine *vm, const char *s);
 ExternalFunction go_vm_resolve_import(struct VirtualMachine *vm, const char *module_name, const char *field_name);
-void go_vm_pre_notify_grow_memory(struct VirtualMachine *vm, uint64_t inc_size);
+int go_vm_pre_notify_grow_memory(struct VirtualMachine *vm, uint64_t index, uint64_t inc_size);
 void go_vm_post_notify_grow_memory(struct VirtualMachine *vm);
 uint64_t go_vm_dispatch_import_invocation(struct VirtualMachine *vm, uint64_t import_id, uint64_t num_params, uint64_t *params);
+int go_vm_import_failed(struct VirtualMachine *vm);
 
 static struct VirtualMachine * vm_alloc() {
-    return (struct VirtualMachine *) malloc(sizeof(struct VirtualMachine));
+    return (struct VirtualMachine *) calloc(1, sizeof(struct VirtualMachine));
+}
+
+// The first memory is managed by the runtimes, while the other ones are
+// allocated on the heap by all of them.
+static void vm_build_memories(struct VirtualMachine *vm, uint64_t num_memories) {
+    vm->num_memories = num_memories;
+    vm->memories = (struct Memory *) calloc(num_memories, sizeof(struct Memory));
+}
+
+static void vm_build_memory(struct VirtualMachine *vm, uint64_t index, uint64_t size) {
+    vm->memories[index].size = size;
+    vm->memories[index].data = (uint8_t *) calloc(size, 1);
+}
+
+static struct Memory * vm_memory_at(struct VirtualMachine *vm, uint64_t index) {
+    return &vm->memories[index];
+}
+
+static void vm_destroy_memories(struct VirtualMachine *vm) {
+    for(uint64_t i = 1; i < vm->num_memories; i++) {
+        free(vm->memories[i].data);
+    }
+    free(vm->memories);
+}
+
+static int vm_grow_heap_memory(struct VirtualMachine *vm, uint64_t index, uint64_t inc_size) {
+    struct Memory *m = &vm->memories[index];
+    if(m->size + inc_size < m->size || !go_vm_pre_notify_grow_memory(vm, index, inc_size)) {
+        return 0;
+    }
+    uint8_t *data = (uint8_t *) realloc(m->data, m->size + inc_size);
+    if(!data && m->size + inc_size != 0) {
+        return 0;
+    }
+    __builtin_memset(data + m->size, 0, inc_size);
+    m->data = data;
+    m->size += inc_size;
+    go_vm_post_notify_grow_memory(vm);
+    return 1;
 }
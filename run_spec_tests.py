@@ -12,13 +12,22 @@ def collect_wast(dir):
 
     return ret
 
+# Options passed to wast2json to enable the proposals used by each test file.
+features = {
+    "atomics.wast": ["--enable-threads"],
+    "tail_call.wast": ["--enable-tail-call"],
+    "exceptions.wast": ["--enable-exceptions"],
+    "memory64.wast": ["--enable-memory64"],
+    "multi_memory.wast": ["--enable-multi-memory"],
+}
+
 wast_files = collect_wast(sys.argv[1])
 success_list = []
 failure_list = []
 for name in wast_files:
     try:
         json_name = name + ".json"
-        ret = subprocess.call(["wast2json", name, "-o", json_name ])
+        ret = subprocess.call(["wast2json", name, "-o", json_name] + features.get(os.path.basename(name), []))
         if ret != 0:
             raise Exception("wast2json")
         ret = subprocess.call(["./test_runner", json_name])
@@ -6,35 +6,48 @@ import (
 	"github.com/perlin-network/life/compiler"
 	"github.com/perlin-network/life/exec"
 	"io/ioutil"
+	"math"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 )
 
-type Resolver struct{}
+var spectest = exec.NewImports()
 
-func (r *Resolver) ResolveFunc(module, field string) exec.FunctionImport {
-	if module != "spectest" {
-		panic("module != spectest")
-	}
-	switch field {
-	case "print_i32":
-		return func(vm *exec.VirtualMachine) int64 { return 0 }
-	default:
-		panic(fmt.Errorf("func %s not found", field))
-	}
+func init() {
+	print := func(vm *exec.VirtualMachine) int64 { return 0 }
+
+	spectest.Module("spectest").
+		Func("print", print).
+		Func("print_i32", print).
+		Func("print_i64", print).
+		Func("print_f32", print).
+		Func("print_f64", print).
+		Func("print_i32_f32", print).
+		Func("print_f64_f64", print).
+		Global("global_i32", 0).
+		Global("global_i64", 0).
+		Global("global_f32", 0).
+		Global("global_f64", 0).
+		Memory("memory", exec.NewMemory(1, 2)).
+		Table("table", exec.NewTable(10, 20))
 }
 
-func (r *Resolver) ResolveGlobal(module, field string) int64 {
-	if module != "spectest" {
-		panic("module != spectest")
+// hostRef is the host value of the externref values of the spec tests.
+type hostRef uint64
+
+// refArg returns the representation of a reference argument.
+func refArg(vm *exec.VirtualMachine, arg ValueInfo) int64 {
+	if arg.Value == "null" {
+		return exec.NullElement
 	}
-	switch field {
-	case "global_i32":
-		return 0
-	default:
-		panic(fmt.Errorf("global %s not found", field))
+	var val uint64
+	fmt.Sscanf(arg.Value, "%d", &val)
+	if arg.Type == "externref" {
+		return vm.ExternRef(hostRef(val))
 	}
+	return int64(val)
 }
 
 type Config struct {
@@ -47,6 +60,7 @@ type Command struct {
 	Line       int         `json:"line"`
 	Filename   string      `json:"filename"`
 	Name       string      `json:"name"`
+	As         string      `json:"as"`
 	Action     CmdAction   `json:"action"`
 	Text       string      `json:"text"`
 	ModuleType string      `json:"module_type"`
@@ -62,8 +76,82 @@ type CmdAction struct {
 }
 
 type ValueInfo struct {
-	Type  string `json:"type"`
-	Value string `json:"value"`
+	Type     string   `json:"type"`
+	Value    string   `json:"value"`
+	LaneType string   `json:"lane_type"`
+	Lanes    []string `json:"-"`
+}
+
+// UnmarshalJSON accepts both the scalar values and the v128 values, the
+// latter having one value per lane.
+func (v *ValueInfo) UnmarshalJSON(raw []byte) error {
+	var info struct {
+		Type     string          `json:"type"`
+		Value    json.RawMessage `json:"value"`
+		LaneType string          `json:"lane_type"`
+	}
+	if err := json.Unmarshal(raw, &info); err != nil {
+		return err
+	}
+	*v = ValueInfo{Type: info.Type, LaneType: info.LaneType}
+	if len(info.Value) == 0 {
+		return nil
+	}
+	if info.Value[0] == '[' {
+		return json.Unmarshal(info.Value, &v.Lanes)
+	}
+	return json.Unmarshal(info.Value, &v.Value)
+}
+
+// laneBits returns the width in bits of the lanes of a v128 value.
+func (v ValueInfo) laneBits() uint {
+	switch v.LaneType {
+	case "i8":
+		return 8
+	case "i16":
+		return 16
+	case "i32", "f32":
+		return 32
+	default:
+		return 64
+	}
+}
+
+// v128Arg returns the low and high halves of a v128 value.
+func v128Arg(v ValueInfo) (lo, hi int64) {
+	bits := v.laneBits()
+	var halves [2]uint64
+	for i, lane := range v.Lanes {
+		var val uint64
+		fmt.Sscanf(lane, "%d", &val)
+		if bits < 64 {
+			val &= 1<<bits - 1
+		}
+		pos := uint(i) * bits
+		halves[pos/64] |= val << (pos % 64)
+	}
+	return int64(halves[0]), int64(halves[1])
+}
+
+// checkV128 checks the lanes of a v128 result, skipping the NaN lanes.
+func checkV128(e ValueInfo, lo, hi int64) {
+	bits := e.laneBits()
+	halves := [2]uint64{uint64(lo), uint64(hi)}
+	for i, lane := range e.Lanes {
+		var exp uint64
+		if n, _ := fmt.Sscanf(lane, "%d", &exp); n != 1 {
+			continue // e.g. nan:canonical
+		}
+		pos := uint(i) * bits
+		ret := halves[pos/64] >> (pos % 64)
+		if bits < 64 {
+			ret &= 1<<bits - 1
+			exp &= 1<<bits - 1
+		}
+		if ret != exp {
+			panic(fmt.Errorf("ret mismatch: lane %d got %d, expected %d\n", i, ret, exp))
+		}
+	}
 }
 
 func LoadConfigFromFile(filename string) *Config {
@@ -79,31 +167,113 @@ func LoadConfigFromFile(filename string) *Config {
 	return &cfg
 }
 
+// trapKinds maps the messages of the spec tests to the kinds of traps they
+// denote. Some messages denote several kinds as the distinction between
+// missing and null table elements is not kept by every instruction.
+var trapKinds = map[string][]exec.TrapKind{
+	"unreachable":                 {exec.TrapUnreachable},
+	"integer divide by zero":      {exec.TrapIntegerDivideByZero},
+	"integer overflow":            {exec.TrapIntegerOverflow},
+	"out of bounds memory access": {exec.TrapMemoryOutOfBounds},
+	"out of bounds table access":  {exec.TrapTableOutOfBounds},
+	"undefined element":           {exec.TrapUndefinedElement, exec.TrapTableOutOfBounds},
+	"uninitialized element":       {exec.TrapUndefinedElement},
+	"indirect call type mismatch": {exec.TrapIndirectCallTypeMismatch},
+	"call stack exhausted":        {exec.TrapCallStackExhausted},
+	"unaligned atomic":            {exec.TrapUnalignedAtomic},
+	"expected shared memory":      {exec.TrapExpectedSharedMemory},
+	"uncaught exception":          {exec.TrapUncaughtException},
+}
+
+// checkTrap checks that err is a trap matching the message of the spec test.
+func checkTrap(err error, text string) {
+	trap, ok := err.(*exec.Trap)
+	if !ok {
+		panic(fmt.Errorf("expected trap %q, got %v\n", text, err))
+	}
+	kinds, ok := trapKinds[text]
+	if !ok {
+		if !strings.Contains(trap.Error(), text) {
+			panic(fmt.Errorf("trap mismatch: got %v, expected %q\n", trap, text))
+		}
+		return
+	}
+	for _, kind := range kinds {
+		if trap.Kind == kind {
+			return
+		}
+	}
+	panic(fmt.Errorf("trap mismatch: got %v, expected %q\n", trap, text))
+}
+
 func (c *Config) Run(cfgPath string) {
 	var vm *exec.VirtualMachine
 	namedVMs := make(map[string]*exec.VirtualMachine)
 
+	linker := exec.NewLinker()
+	linker.Host().Merge(spectest)
+
 	dir, _ := filepath.Split(cfgPath)
 
+	instantiate := func(filename string) (*exec.VirtualMachine, error) {
+		input, err := ioutil.ReadFile(path.Join(dir, filename))
+		if err != nil {
+			panic(err)
+		}
+		localVM, err := linker.Instantiate("", input, exec.VMConfig{
+			//EnableJIT:      true,
+			MaxMemoryPages:       1024, // for memory trap tests
+			GasLimit:             0,    // unlimited
+			DisableFloatingPoint: false,
+		}, &compiler.SimpleGasPolicy{
+			GasPerInstruction: 1,
+		})
+		/*aotSvc := platform.FullAOTCompile(localVM)
+		if aotSvc != nil {
+			localVM.SetAOTService(aotSvc)
+		}*/
+		return localVM, err
+	}
+
+	targetVM := func(cmd Command) *exec.VirtualMachine {
+		if cmd.Action.Module == "" {
+			return vm
+		}
+		target, ok := namedVMs[cmd.Action.Module]
+		if !ok {
+			panic("named module not found")
+		}
+		return target
+	}
+
+	invoke := func(localVM *exec.VirtualMachine, cmd Command) ([]int64, error) {
+		entryID, ok := localVM.GetFunctionExport(cmd.Action.Field)
+		if !ok {
+			panic("export not found (func)")
+		}
+		args := make([]int64, 0)
+		for _, arg := range cmd.Action.Args {
+			if arg.Type == "externref" || arg.Type == "funcref" {
+				args = append(args, refArg(localVM, arg))
+				continue
+			}
+			if arg.Type == "v128" {
+				lo, hi := v128Arg(arg)
+				args = append(args, lo, hi)
+				continue
+			}
+			var val uint64
+			fmt.Sscanf(arg.Value, "%d", &val)
+			args = append(args, int64(val))
+		}
+		fmt.Printf("Entry = %d, len(args) = %d\n", entryID, len(args))
+		return localVM.RunValues(entryID, args...)
+	}
+
 	for _, cmd := range c.Commands {
 		switch cmd.Type {
 		case "module":
-			input, err := ioutil.ReadFile(path.Join(dir, cmd.Filename))
-			if err != nil {
-				panic(err)
-			}
-			localVM, err := exec.NewVirtualMachine(input, exec.VMConfig{
-				//EnableJIT:      true,
-				MaxMemoryPages:       1024, // for memory trap tests
-				GasLimit:             0,    // unlimited
-				DisableFloatingPoint: false,
-			}, &Resolver{}, &compiler.SimpleGasPolicy{
-				GasPerInstruction: 1,
-			})
-			/*aotSvc := platform.FullAOTCompile(localVM)
-			if aotSvc != nil {
-				localVM.SetAOTService(aotSvc)
-			}*/
+			localVM, err := instantiate(cmd.Filename)
 			if err != nil {
 				panic(err)
 			}
@@ -111,38 +281,63 @@ func (c *Config) Run(cfgPath string) {
 			if cmd.Name != "" {
 				namedVMs[cmd.Name] = localVM
 			}
-		case "assert_return", "action":
+		case "register":
 			localVM := vm
-			if cmd.Action.Module != "" {
-				if target, ok := namedVMs[cmd.Action.Module]; ok {
+			if cmd.Name != "" {
+				if target, ok := namedVMs[cmd.Name]; ok {
 					localVM = target
 				} else {
 					panic("named module not found")
 				}
 			}
+			linker.Register(cmd.As, localVM)
+		case "assert_return", "action":
+			localVM := targetVM(cmd)
 
 			switch cmd.Action.Type {
 			case "invoke":
-				entryID, ok := localVM.GetFunctionExport(cmd.Action.Field)
-				if !ok {
-					panic("export not found (func)")
-				}
-				args := make([]int64, 0)
-				for _, arg := range cmd.Action.Args {
-					var val uint64
-					fmt.Sscanf(arg.Value, "%d", &val)
-					args = append(args, int64(val))
-				}
-				fmt.Printf("Entry = %d, len(args) = %d\n", entryID, len(args))
-				ret, err := localVM.Run(entryID, args...)
+				rets, err := invoke(localVM, cmd)
 				if err != nil {
 					panic(err)
 				}
-				if len(cmd.Action.Expected) != 0 {
+				expected := cmd.Expected
+				if len(expected) == 0 {
+					expected = cmd.Action.Expected
+				}
+				numSlots := 0
+				for _, e := range expected {
+					numSlots++
+					if e.Type == "v128" {
+						numSlots++
+					}
+				}
+				if len(expected) != 0 && len(rets) != numSlots {
+					panic(fmt.Errorf("ret count mismatch: got %d, expected %d\n", len(rets), numSlots))
+				}
+				i := 0
+				for _, e := range expected {
+					if e.Type == "v128" {
+						checkV128(e, rets[i], rets[i+1])
+						i += 2
+						continue
+					}
+					ret := rets[i]
+					i++
+					if e.Type == "externref" || e.Type == "funcref" {
+						if e.Value == "null" && ret != exec.NullElement {
+							panic(fmt.Errorf("ret mismatch: got %d, expected null\n", ret))
+						}
+						if e.Type == "externref" && e.Value != "null" && localVM.Extern(ret) != localVM.Extern(refArg(localVM, e)) {
+							panic(fmt.Errorf("ret mismatch: got %v, expected %s\n", localVM.Extern(ret), e.Value))
+						}
+						continue
+					}
 					var _exp uint64
-					fmt.Sscanf(cmd.Action.Expected[0].Value, "%d", &_exp)
+					if n, _ := fmt.Sscanf(e.Value, "%d", &_exp); n != 1 {
+						continue // e.g. nan:canonical
+					}
 					exp := int64(_exp)
-					if cmd.Action.Expected[0].Type == "i32" || cmd.Action.Expected[0].Type == "f32" {
+					if e.Type == "i32" || e.Type == "f32" {
 						ret = int64(uint32(ret))
 						exp = int64(uint32(exp))
 					}
@@ -151,17 +346,24 @@ func (c *Config) Run(cfgPath string) {
 					}
 				}
 			case "get":
-				globalID, ok := localVM.GetGlobalExport(cmd.Action.Field)
+				g, ok := localVM.GetGlobalVarExport(cmd.Action.Field)
 				if !ok {
 					panic("export not found (global)")
 				}
-				val := localVM.Globals[globalID]
 				var _exp uint64
 				fmt.Sscanf(cmd.Expected[0].Value, "%d", &_exp)
-				exp := int64(_exp)
-				if cmd.Expected[0].Type == "i32" || cmd.Expected[0].Type == "f32" {
-					val = int64(uint32(val))
-					exp = int64(uint32(exp))
+				var val, exp uint64
+				switch cmd.Expected[0].Type {
+				case "i32":
+					val, exp = uint64(uint32(g.GetI32())), uint64(uint32(_exp))
+				case "i64":
+					val, exp = uint64(g.GetI64()), _exp
+				case "f32":
+					val, exp = uint64(math.Float32bits(g.GetF32())), uint64(uint32(_exp))
+				case "f64":
+					val, exp = math.Float64bits(g.GetF64()), _exp
+				default:
+					panic(cmd.Expected[0].Type)
 				}
 				if val != exp {
 					panic(fmt.Errorf("val mismatch: got %d, expected %d\n", val, exp))
@@ -169,8 +371,22 @@ func (c *Config) Run(cfgPath string) {
 			default:
 				panic(cmd.Action.Type)
 			}
-		case "assert_trap", "assert_malformed", "assert_invalid", "assert_exhaustion", "assert_unlinkable",
-			"assert_return_canonical_nan", "assert_return_arithmetic_nan":
+		case "assert_trap", "assert_exhaustion":
+			localVM := targetVM(cmd)
+			_, err := invoke(localVM, cmd)
+			checkTrap(err, cmd.Text)
+			// Leave the instance usable by the next commands.
+			localVM.Reset()
+		case "assert_malformed", "assert_invalid", "assert_unlinkable", "assert_uninstantiable":
+			if cmd.ModuleType == "text" {
+				// Malformed text modules are rejected by wast2json itself.
+				fmt.Printf("skipping %s (text module)\n", cmd.Type)
+				break
+			}
+			if _, err := instantiate(cmd.Filename); err == nil {
+				panic(fmt.Errorf("module instantiated, expected %q\n", cmd.Text))
+			}
+		case "assert_return_canonical_nan", "assert_return_arithmetic_nan":
 			fmt.Printf("skipping %s\n", cmd.Type)
 		default:
 			panic(cmd.Type)
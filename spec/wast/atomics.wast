@@ -0,0 +1,102 @@
+;; Threads proposal: shared memories and atomic memory accesses
+
+(module
+  (memory 1 1 shared)
+
+  (func (export "init") (param i64)
+    (i64.store (i32.const 0) (local.get 0)))
+
+  (func (export "i32.atomic.load") (param i32) (result i32)
+    (i32.atomic.load (local.get 0)))
+  (func (export "i64.atomic.load") (param i32) (result i64)
+    (i64.atomic.load (local.get 0)))
+  (func (export "i32.atomic.load8_u") (param i32) (result i32)
+    (i32.atomic.load8_u (local.get 0)))
+  (func (export "i64.atomic.load32_u") (param i32) (result i64)
+    (i64.atomic.load32_u (local.get 0)))
+
+  (func (export "i32.atomic.store") (param i32 i32)
+    (i32.atomic.store (local.get 0) (local.get 1)))
+  (func (export "i64.atomic.store16") (param i32 i64)
+    (i64.atomic.store16 (local.get 0) (local.get 1)))
+
+  (func (export "i32.atomic.rmw.add") (param i32 i32) (result i32)
+    (i32.atomic.rmw.add (local.get 0) (local.get 1)))
+  (func (export "i64.atomic.rmw.sub") (param i32 i64) (result i64)
+    (i64.atomic.rmw.sub (local.get 0) (local.get 1)))
+  (func (export "i32.atomic.rmw8.and_u") (param i32 i32) (result i32)
+    (i32.atomic.rmw8.and_u (local.get 0) (local.get 1)))
+  (func (export "i64.atomic.rmw16.or_u") (param i32 i64) (result i64)
+    (i64.atomic.rmw16.or_u (local.get 0) (local.get 1)))
+  (func (export "i32.atomic.rmw16.xor_u") (param i32 i32) (result i32)
+    (i32.atomic.rmw16.xor_u (local.get 0) (local.get 1)))
+  (func (export "i64.atomic.rmw32.xchg_u") (param i32 i64) (result i64)
+    (i64.atomic.rmw32.xchg_u (local.get 0) (local.get 1)))
+
+  (func (export "i32.atomic.rmw.cmpxchg") (param i32 i32 i32) (result i32)
+    (i32.atomic.rmw.cmpxchg (local.get 0) (local.get 1) (local.get 2)))
+  (func (export "i32.atomic.rmw8.cmpxchg_u") (param i32 i32 i32) (result i32)
+    (i32.atomic.rmw8.cmpxchg_u (local.get 0) (local.get 1) (local.get 2)))
+
+  (func (export "memory.atomic.notify") (param i32 i32) (result i32)
+    (memory.atomic.notify (local.get 0) (local.get 1)))
+  (func (export "memory.atomic.wait32") (param i32 i32 i64) (result i32)
+    (memory.atomic.wait32 (local.get 0) (local.get 1) (local.get 2)))
+  (func (export "fence") (atomic.fence))
+)
+
+(invoke "init" (i64.const 0x0706050403020100))
+(assert_return (invoke "i32.atomic.load" (i32.const 0)) (i32.const 0x03020100))
+(assert_return (invoke "i64.atomic.load" (i32.const 0)) (i64.const 0x0706050403020100))
+(assert_return (invoke "i32.atomic.load8_u" (i32.const 5)) (i32.const 5))
+(assert_return (invoke "i64.atomic.load32_u" (i32.const 4)) (i64.const 0x07060504))
+
+(assert_return (invoke "i32.atomic.store" (i32.const 0) (i32.const 0xffffffff)))
+(assert_return (invoke "i64.atomic.load" (i32.const 0)) (i64.const 0x07060504ffffffff))
+(assert_return (invoke "i64.atomic.store16" (i32.const 6) (i64.const 0x12345678)))
+(assert_return (invoke "i64.atomic.load" (i32.const 0)) (i64.const 0x56780504ffffffff))
+
+(invoke "init" (i64.const 10))
+(assert_return (invoke "i32.atomic.rmw.add" (i32.const 0) (i32.const 5)) (i32.const 10))
+(assert_return (invoke "i64.atomic.rmw.sub" (i32.const 0) (i64.const 20)) (i64.const 15))
+(assert_return (invoke "i64.atomic.load" (i32.const 0)) (i64.const -5))
+(assert_return (invoke "i32.atomic.rmw8.and_u" (i32.const 0) (i32.const 0x0f)) (i32.const 0xfb))
+(assert_return (invoke "i64.atomic.rmw16.or_u" (i32.const 0) (i64.const 0xf0)) (i64.const 0xff0b))
+(assert_return (invoke "i32.atomic.rmw16.xor_u" (i32.const 0) (i32.const 0xffff)) (i32.const 0xfffb))
+(assert_return (invoke "i64.atomic.rmw32.xchg_u" (i32.const 0) (i64.const 0x1122334455)) (i64.const 0xffff0004))
+(assert_return (invoke "i64.atomic.load" (i32.const 0)) (i64.const 0xffffffff22334455))
+
+(invoke "init" (i64.const 0x0101))
+(assert_return (invoke "i32.atomic.rmw.cmpxchg" (i32.const 0) (i32.const 0) (i32.const 7)) (i32.const 0x0101))
+(assert_return (invoke "i32.atomic.rmw.cmpxchg" (i32.const 0) (i32.const 0x0101) (i32.const 7)) (i32.const 0x0101))
+(assert_return (invoke "i32.atomic.load" (i32.const 0)) (i32.const 7))
+(assert_return (invoke "i32.atomic.rmw8.cmpxchg_u" (i32.const 0) (i32.const 0x107) (i32.const 0x1ff)) (i32.const 7))
+(assert_return (invoke "i32.atomic.load" (i32.const 0)) (i32.const 0xff))
+
+(assert_return (invoke "memory.atomic.notify" (i32.const 0) (i32.const 1)) (i32.const 0))
+(assert_return (invoke "memory.atomic.wait32" (i32.const 0) (i32.const 0) (i64.const 0)) (i32.const 1))
+(assert_return (invoke "memory.atomic.wait32" (i32.const 0) (i32.const 0xff) (i64.const 0)) (i32.const 2))
+(assert_return (invoke "fence"))
+
+(assert_trap (invoke "i32.atomic.load" (i32.const 1)) "unaligned atomic")
+(assert_trap (invoke "i32.atomic.rmw.add" (i32.const 2) (i32.const 0)) "unaligned atomic")
+(assert_trap (invoke "i32.atomic.load" (i32.const 65536)) "out of bounds memory access")
+(assert_trap (invoke "memory.atomic.notify" (i32.const 1) (i32.const 0)) "unaligned atomic")
+
+(module
+  (memory 1)
+  (func (export "wait") (param i32 i32 i64) (result i32)
+    (memory.atomic.wait32 (local.get 0) (local.get 1) (local.get 2)))
+  (func (export "notify") (param i32 i32) (result i32)
+    (memory.atomic.notify (local.get 0) (local.get 1)))
+)
+
+(assert_return (invoke "notify" (i32.const 0) (i32.const 1)) (i32.const 0))
+(assert_trap (invoke "wait" (i32.const 0) (i32.const 0) (i64.const 0)) "expected shared memory")
+
+(assert_invalid
+  (module (memory 1) (func (drop (i32.atomic.load align=1 (i32.const 0)))))
+  "alignment must be exactly natural")
+(assert_malformed
+  (module quote "(memory 1 shared)")
+  "shared memory must have maximum")
@@ -0,0 +1,113 @@
+;; Bulk memory and table operations
+
+(module
+  (type $t (func (result i32)))
+  (table 4 funcref)
+  (memory 1)
+
+  (elem func $f10 $f11)
+  (elem (i32.const 0) $f12)
+  (data "\01\02\03\04")
+  (data (i32.const 16) "\aa\bb")
+
+  (func $f10 (result i32) (i32.const 10))
+  (func $f11 (result i32) (i32.const 11))
+  (func $f12 (result i32) (i32.const 12))
+
+  (func (export "load8_u") (param i32) (result i32)
+    (i32.load8_u (local.get 0)))
+  (func (export "init") (param i32 i32 i32)
+    (memory.init 0 (local.get 0) (local.get 1) (local.get 2)))
+  (func (export "init_active") (param i32 i32 i32)
+    (memory.init 1 (local.get 0) (local.get 1) (local.get 2)))
+  (func (export "data.drop") (data.drop 0))
+  (func (export "copy") (param i32 i32 i32)
+    (memory.copy (local.get 0) (local.get 1) (local.get 2)))
+  (func (export "fill") (param i32 i32 i32)
+    (memory.fill (local.get 0) (local.get 1) (local.get 2)))
+
+  (func (export "call") (param i32) (result i32)
+    (call_indirect (type $t) (local.get 0)))
+  (func (export "table.init") (param i32 i32 i32)
+    (table.init 0 (local.get 0) (local.get 1) (local.get 2)))
+  (func (export "elem.drop") (elem.drop 0))
+  (func (export "table.copy") (param i32 i32 i32)
+    (table.copy (local.get 0) (local.get 1) (local.get 2)))
+)
+
+;; Active segments are applied on instantiation and dropped afterwards.
+(assert_return (invoke "load8_u" (i32.const 16)) (i32.const 0xaa))
+(assert_return (invoke "load8_u" (i32.const 17)) (i32.const 0xbb))
+(assert_return (invoke "init_active" (i32.const 0) (i32.const 0) (i32.const 0)))
+(assert_trap (invoke "init_active" (i32.const 0) (i32.const 0) (i32.const 1)) "out of bounds memory access")
+
+;; memory.init
+(assert_return (invoke "init" (i32.const 100) (i32.const 0) (i32.const 4)))
+(assert_return (invoke "load8_u" (i32.const 100)) (i32.const 1))
+(assert_return (invoke "load8_u" (i32.const 103)) (i32.const 4))
+(assert_return (invoke "load8_u" (i32.const 104)) (i32.const 0))
+(assert_return (invoke "init" (i32.const 200) (i32.const 1) (i32.const 2)))
+(assert_return (invoke "load8_u" (i32.const 199)) (i32.const 0))
+(assert_return (invoke "load8_u" (i32.const 200)) (i32.const 2))
+(assert_return (invoke "load8_u" (i32.const 201)) (i32.const 3))
+(assert_return (invoke "load8_u" (i32.const 202)) (i32.const 0))
+(assert_return (invoke "init" (i32.const 65536) (i32.const 4) (i32.const 0)))
+(assert_trap (invoke "init" (i32.const 65535) (i32.const 0) (i32.const 2)) "out of bounds memory access")
+(assert_trap (invoke "init" (i32.const 0) (i32.const 3) (i32.const 2)) "out of bounds memory access")
+(assert_trap (invoke "init" (i32.const 0) (i32.const 5) (i32.const 0)) "out of bounds memory access")
+
+;; memory.copy, with overlapping regions in both directions
+(assert_return (invoke "copy" (i32.const 101) (i32.const 100) (i32.const 3)))
+(assert_return (invoke "load8_u" (i32.const 100)) (i32.const 1))
+(assert_return (invoke "load8_u" (i32.const 101)) (i32.const 1))
+(assert_return (invoke "load8_u" (i32.const 102)) (i32.const 2))
+(assert_return (invoke "load8_u" (i32.const 103)) (i32.const 3))
+(assert_return (invoke "copy" (i32.const 100) (i32.const 101) (i32.const 3)))
+(assert_return (invoke "load8_u" (i32.const 100)) (i32.const 1))
+(assert_return (invoke "load8_u" (i32.const 101)) (i32.const 2))
+(assert_return (invoke "load8_u" (i32.const 102)) (i32.const 3))
+(assert_return (invoke "load8_u" (i32.const 103)) (i32.const 3))
+(assert_return (invoke "copy" (i32.const 65536) (i32.const 0) (i32.const 0)))
+(assert_trap (invoke "copy" (i32.const 65535) (i32.const 0) (i32.const 2)) "out of bounds memory access")
+(assert_trap (invoke "copy" (i32.const 0) (i32.const 65535) (i32.const 2)) "out of bounds memory access")
+
+;; memory.fill
+(assert_return (invoke "fill" (i32.const 400) (i32.const 0x1ff) (i32.const 3)))
+(assert_return (invoke "load8_u" (i32.const 399)) (i32.const 0))
+(assert_return (invoke "load8_u" (i32.const 400)) (i32.const 0xff))
+(assert_return (invoke "load8_u" (i32.const 402)) (i32.const 0xff))
+(assert_return (invoke "load8_u" (i32.const 403)) (i32.const 0))
+(assert_return (invoke "fill" (i32.const 65536) (i32.const 0) (i32.const 0)))
+(assert_trap (invoke "fill" (i32.const 65535) (i32.const 0) (i32.const 2)) "out of bounds memory access")
+
+;; data.drop
+(assert_return (invoke "data.drop"))
+(assert_return (invoke "init" (i32.const 0) (i32.const 0) (i32.const 0)))
+(assert_trap (invoke "init" (i32.const 0) (i32.const 0) (i32.const 1)) "out of bounds memory access")
+
+;; table.init, table.copy and elem.drop
+(assert_return (invoke "call" (i32.const 0)) (i32.const 12))
+(assert_trap (invoke "call" (i32.const 1)) "uninitialized element")
+(assert_return (invoke "table.init" (i32.const 1) (i32.const 0) (i32.const 2)))
+(assert_return (invoke "call" (i32.const 1)) (i32.const 10))
+(assert_return (invoke "call" (i32.const 2)) (i32.const 11))
+(assert_return (invoke "table.copy" (i32.const 3) (i32.const 0) (i32.const 1)))
+(assert_return (invoke "call" (i32.const 3)) (i32.const 12))
+(assert_return (invoke "table.copy" (i32.const 0) (i32.const 1) (i32.const 3)))
+(assert_return (invoke "call" (i32.const 0)) (i32.const 10))
+(assert_return (invoke "call" (i32.const 1)) (i32.const 11))
+(assert_return (invoke "call" (i32.const 2)) (i32.const 12))
+(assert_trap (invoke "table.init" (i32.const 3) (i32.const 0) (i32.const 2)) "out of bounds table access")
+(assert_trap (invoke "table.copy" (i32.const 0) (i32.const 3) (i32.const 2)) "out of bounds table access")
+(assert_return (invoke "elem.drop"))
+(assert_return (invoke "table.init" (i32.const 0) (i32.const 0) (i32.const 0)))
+(assert_trap (invoke "table.init" (i32.const 0) (i32.const 0) (i32.const 1)) "out of bounds table access")
+
+(assert_invalid
+  (module (func (data.drop 0)))
+  "unknown data segment"
+)
+(assert_invalid
+  (module (table 1 funcref) (func (elem.drop 0)))
+  "unknown elem segment"
+)
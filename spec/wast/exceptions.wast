@@ -0,0 +1,80 @@
+;; Exception handling: tags, try/catch/catch_all/delegate, throw and rethrow
+
+(module
+  (tag $e (param i32))
+  (tag $pair (param i32 i64))
+  (tag $empty)
+  (tag $other (param i32))
+  (export "e" (tag $e))
+
+  (func $throw (param i32) (throw $e (local.get 0)))
+
+  (func (export "simple") (param i32) (result i32)
+    (try (result i32)
+      (do (throw $e (local.get 0)))
+      (catch $e (i32.add (i32.const 1)))))
+
+  (func (export "through-call") (param i32) (result i32)
+    (try (result i32)
+      (do (call $throw (local.get 0)) (i32.const 0))
+      (catch $e (i32.add (i32.const 100)))))
+
+  (func (export "pair") (param i32) (result i32)
+    (try (result i32)
+      (do (throw $pair (local.get 0) (i64.extend_i32_u (local.get 0))))
+      (catch $pair (i32.wrap_i64) (i32.add))))
+
+  (func (export "catch-all") (result i32)
+    (try (result i32)
+      (do (throw $other (i32.const 1)))
+      (catch $e)
+      (catch_all (i32.const 7))))
+
+  (func (export "rethrow") (param i32) (result i32)
+    (try (result i32)
+      (do
+        (try (result i32)
+          (do (throw $e (local.get 0)))
+          (catch $e (drop) (rethrow 0))))
+      (catch $e (i32.add (i32.const 1000)))))
+
+  (func (export "delegate") (param i32) (result i32)
+    (try (result i32)
+      (do
+        (try (result i32)
+          (do
+            (try (result i32)
+              (do (throw $e (local.get 0)))
+              (delegate 1)))
+          (catch $e (i32.add (i32.const 10)))))
+      (catch $e (i32.add (i32.const 20)))))
+
+  (func (export "empty") (result i32)
+    (try (result i32)
+      (do (throw $empty))
+      (catch $empty (i32.const 42))))
+
+  (func (export "stack") (param i32) (result i32)
+    (i32.add
+      (i32.const 5)
+      (try (result i32)
+        (do (call $throw (local.get 0)) (i32.const 0))
+        (catch $e))))
+
+  (func (export "uncaught") (throw $other (i32.const 1)))
+)
+
+(assert_return (invoke "simple" (i32.const 41)) (i32.const 42))
+(assert_return (invoke "through-call" (i32.const 1)) (i32.const 101))
+(assert_return (invoke "pair" (i32.const 21)) (i32.const 42))
+(assert_return (invoke "catch-all") (i32.const 7))
+(assert_return (invoke "rethrow" (i32.const 1)) (i32.const 1001))
+(assert_return (invoke "delegate" (i32.const 1)) (i32.const 21))
+(assert_return (invoke "empty") (i32.const 42))
+(assert_return (invoke "stack" (i32.const 3)) (i32.const 8))
+(assert_trap (invoke "uncaught") "uncaught exception")
+
+(assert_invalid
+  (module
+    (func (rethrow 0)))
+  "invalid rethrow label")
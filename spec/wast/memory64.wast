@@ -0,0 +1,48 @@
+;; 64-bit memories: i64 addresses, offsets and sizes
+
+(module
+  (memory i64 1 4)
+  (data (i64.const 16) "hello")
+
+  (func (export "load") (param i64) (result i64)
+    (i64.load (local.get 0)))
+  (func (export "load_offset") (param i64) (result i64)
+    (i64.load offset=4294967296 (local.get 0)))
+  (func (export "store") (param i64 i64)
+    (i64.store (local.get 0) (local.get 1)))
+  (func (export "size") (result i64)
+    (memory.size))
+  (func (export "grow") (param i64) (result i64)
+    (memory.grow (local.get 0)))
+  (func (export "fill") (param i64 i32 i64)
+    (memory.fill (local.get 0) (local.get 1) (local.get 2)))
+  (func (export "copy") (param i64 i64 i64)
+    (memory.copy (local.get 0) (local.get 1) (local.get 2)))
+)
+
+(assert_return (invoke "load" (i64.const 16)) (i64.const 0x6f6c6c6568))
+(assert_trap (invoke "load_offset" (i64.const 16)) "out of bounds memory access")
+(assert_trap (invoke "load" (i64.const 0x100000010)) "out of bounds memory access")
+(assert_trap (invoke "load" (i64.const -8)) "out of bounds memory access")
+(assert_return (invoke "store" (i64.const 65528) (i64.const -2)))
+(assert_return (invoke "load" (i64.const 65528)) (i64.const -2))
+(assert_trap (invoke "load" (i64.const 65529)) "out of bounds memory access")
+(assert_return (invoke "size") (i64.const 1))
+(assert_return (invoke "grow" (i64.const 0x10000000000)) (i64.const -1))
+(assert_return (invoke "grow" (i64.const 3)) (i64.const 1))
+(assert_return (invoke "grow" (i64.const 1)) (i64.const -1))
+(assert_return (invoke "size") (i64.const 4))
+(assert_return (invoke "fill" (i64.const 100) (i32.const 7) (i64.const 3)))
+(assert_return (invoke "copy" (i64.const 200) (i64.const 96) (i64.const 8)))
+(assert_return (invoke "load" (i64.const 200)) (i64.const 0x07070700000000))
+(assert_trap (invoke "fill" (i64.const 262143) (i32.const 0) (i64.const 2)) "out of bounds memory access")
+
+(assert_invalid
+  (module (memory i64 1) (func (drop (i32.load (i32.const 0)))))
+  "type mismatch")
+(assert_invalid
+  (module (memory 1) (func (drop (i32.load (i64.const 0)))))
+  "type mismatch")
+(assert_invalid
+  (module (memory i64 2 1))
+  "size minimum must not be greater than maximum")
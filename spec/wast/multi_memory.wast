@@ -0,0 +1,55 @@
+;; Multiple memories: memory indices of loads, stores and bulk instructions
+
+(module
+  (memory $a 1)
+  (memory $b i64 1 2)
+  (memory $c 1)
+  (data (memory $b) (i64.const 16) "hello")
+  (data $p "passive")
+
+  (func (export "load_a") (param i32) (result i32)
+    (i32.load8_u $a (local.get 0)))
+  (func (export "load_b") (param i64) (result i32)
+    (i32.load8_u $b (local.get 0)))
+  (func (export "load_c") (param i32) (result i32)
+    (i32.load8_u $c (local.get 0)))
+  (func (export "store_c") (param i32 i32)
+    (i32.store8 $c (local.get 0) (local.get 1)))
+  (func (export "size_b") (result i64)
+    (memory.size $b))
+  (func (export "grow_b") (param i64) (result i64)
+    (memory.grow $b (local.get 0)))
+  (func (export "grow_c") (param i32) (result i32)
+    (memory.grow $c (local.get 0)))
+  (func (export "copy_b_to_c") (param i32 i64 i32)
+    (memory.copy $c $b (local.get 0) (local.get 1) (local.get 2)))
+  (func (export "init_c") (param i32 i32 i32)
+    (memory.init $c $p (local.get 0) (local.get 1) (local.get 2)))
+  (func (export "fill_c") (param i32 i32 i32)
+    (memory.fill $c (local.get 0) (local.get 1) (local.get 2)))
+)
+
+(assert_return (invoke "load_b" (i64.const 16)) (i32.const 104))
+(assert_return (invoke "load_a" (i32.const 16)) (i32.const 0))
+(assert_return (invoke "store_c" (i32.const 5) (i32.const 42)))
+(assert_return (invoke "load_c" (i32.const 5)) (i32.const 42))
+(assert_return (invoke "load_a" (i32.const 5)) (i32.const 0))
+(assert_return (invoke "copy_b_to_c" (i32.const 8) (i64.const 16) (i32.const 5)))
+(assert_return (invoke "load_c" (i32.const 12)) (i32.const 111))
+(assert_return (invoke "init_c" (i32.const 0) (i32.const 1) (i32.const 3)))
+(assert_return (invoke "load_c" (i32.const 0)) (i32.const 97))
+(assert_return (invoke "fill_c" (i32.const 65535) (i32.const 1) (i32.const 1)))
+(assert_trap (invoke "fill_c" (i32.const 65535) (i32.const 1) (i32.const 2)) "out of bounds memory access")
+(assert_return (invoke "size_b") (i64.const 1))
+(assert_return (invoke "grow_b" (i64.const 2)) (i64.const -1))
+(assert_return (invoke "grow_b" (i64.const 1)) (i64.const 1))
+(assert_return (invoke "grow_c" (i32.const 1)) (i32.const 1))
+(assert_return (invoke "load_c" (i32.const 65536)) (i32.const 0))
+(assert_trap (invoke "load_b" (i64.const 131072)) "out of bounds memory access")
+
+(assert_invalid
+  (module (memory 1) (func (drop (i32.load 1 (i32.const 0)))))
+  "unknown memory")
+(assert_invalid
+  (module (memory 1) (data (memory 1) (i32.const 0) ""))
+  "unknown memory")
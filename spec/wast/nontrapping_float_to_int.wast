@@ -0,0 +1,102 @@
+;; Non-trapping float-to-int conversions
+
+(module
+  (func (export "i32.trunc_sat_f32_s") (param $x f32) (result i32) (i32.trunc_sat_f32_s (local.get $x)))
+  (func (export "i32.trunc_sat_f32_u") (param $x f32) (result i32) (i32.trunc_sat_f32_u (local.get $x)))
+  (func (export "i32.trunc_sat_f64_s") (param $x f64) (result i32) (i32.trunc_sat_f64_s (local.get $x)))
+  (func (export "i32.trunc_sat_f64_u") (param $x f64) (result i32) (i32.trunc_sat_f64_u (local.get $x)))
+  (func (export "i64.trunc_sat_f32_s") (param $x f32) (result i64) (i64.trunc_sat_f32_s (local.get $x)))
+  (func (export "i64.trunc_sat_f32_u") (param $x f32) (result i64) (i64.trunc_sat_f32_u (local.get $x)))
+  (func (export "i64.trunc_sat_f64_s") (param $x f64) (result i64) (i64.trunc_sat_f64_s (local.get $x)))
+  (func (export "i64.trunc_sat_f64_u") (param $x f64) (result i64) (i64.trunc_sat_f64_u (local.get $x)))
+)
+
+(assert_return (invoke "i32.trunc_sat_f32_s" (f32.const 0.0)) (i32.const 0))
+(assert_return (invoke "i32.trunc_sat_f32_s" (f32.const -0.0)) (i32.const 0))
+(assert_return (invoke "i32.trunc_sat_f32_s" (f32.const 1.5)) (i32.const 1))
+(assert_return (invoke "i32.trunc_sat_f32_s" (f32.const -1.5)) (i32.const -1))
+(assert_return (invoke "i32.trunc_sat_f32_s" (f32.const 0x1.fffffep+30)) (i32.const 2147483520))
+(assert_return (invoke "i32.trunc_sat_f32_s" (f32.const -0x1p+31)) (i32.const -2147483648))
+(assert_return (invoke "i32.trunc_sat_f32_s" (f32.const 0x1p+31)) (i32.const 0x7fffffff))
+(assert_return (invoke "i32.trunc_sat_f32_s" (f32.const -0x1.000002p+31)) (i32.const 0x80000000))
+(assert_return (invoke "i32.trunc_sat_f32_s" (f32.const inf)) (i32.const 0x7fffffff))
+(assert_return (invoke "i32.trunc_sat_f32_s" (f32.const -inf)) (i32.const 0x80000000))
+(assert_return (invoke "i32.trunc_sat_f32_s" (f32.const nan)) (i32.const 0))
+(assert_return (invoke "i32.trunc_sat_f32_s" (f32.const -nan)) (i32.const 0))
+
+(assert_return (invoke "i32.trunc_sat_f32_u" (f32.const 0.0)) (i32.const 0))
+(assert_return (invoke "i32.trunc_sat_f32_u" (f32.const 1.5)) (i32.const 1))
+(assert_return (invoke "i32.trunc_sat_f32_u" (f32.const -0x1.ccccccp-1)) (i32.const 0))
+(assert_return (invoke "i32.trunc_sat_f32_u" (f32.const 0x1p+31)) (i32.const -2147483648))
+(assert_return (invoke "i32.trunc_sat_f32_u" (f32.const 0x1.fffffep+31)) (i32.const -256))
+(assert_return (invoke "i32.trunc_sat_f32_u" (f32.const 0x1p+32)) (i32.const 0xffffffff))
+(assert_return (invoke "i32.trunc_sat_f32_u" (f32.const -1.0)) (i32.const 0x00000000))
+(assert_return (invoke "i32.trunc_sat_f32_u" (f32.const inf)) (i32.const 0xffffffff))
+(assert_return (invoke "i32.trunc_sat_f32_u" (f32.const -inf)) (i32.const 0x00000000))
+(assert_return (invoke "i32.trunc_sat_f32_u" (f32.const nan)) (i32.const 0))
+
+(assert_return (invoke "i32.trunc_sat_f64_s" (f64.const 0.0)) (i32.const 0))
+(assert_return (invoke "i32.trunc_sat_f64_s" (f64.const -1.5)) (i32.const -1))
+(assert_return (invoke "i32.trunc_sat_f64_s" (f64.const 2147483647.0)) (i32.const 2147483647))
+(assert_return (invoke "i32.trunc_sat_f64_s" (f64.const -2147483648.0)) (i32.const -2147483648))
+(assert_return (invoke "i32.trunc_sat_f64_s" (f64.const -2147483648.9)) (i32.const -2147483648))
+(assert_return (invoke "i32.trunc_sat_f64_s" (f64.const 2147483647.9)) (i32.const 2147483647))
+(assert_return (invoke "i32.trunc_sat_f64_s" (f64.const 2147483648.0)) (i32.const 0x7fffffff))
+(assert_return (invoke "i32.trunc_sat_f64_s" (f64.const -2147483649.0)) (i32.const 0x80000000))
+(assert_return (invoke "i32.trunc_sat_f64_s" (f64.const inf)) (i32.const 0x7fffffff))
+(assert_return (invoke "i32.trunc_sat_f64_s" (f64.const -inf)) (i32.const 0x80000000))
+(assert_return (invoke "i32.trunc_sat_f64_s" (f64.const nan)) (i32.const 0))
+
+(assert_return (invoke "i32.trunc_sat_f64_u" (f64.const 0.0)) (i32.const 0))
+(assert_return (invoke "i32.trunc_sat_f64_u" (f64.const -0.9)) (i32.const 0))
+(assert_return (invoke "i32.trunc_sat_f64_u" (f64.const 4294967295.0)) (i32.const -1))
+(assert_return (invoke "i32.trunc_sat_f64_u" (f64.const 4294967295.9)) (i32.const -1))
+(assert_return (invoke "i32.trunc_sat_f64_u" (f64.const 4294967296.0)) (i32.const 0xffffffff))
+(assert_return (invoke "i32.trunc_sat_f64_u" (f64.const 1e16)) (i32.const 0xffffffff))
+(assert_return (invoke "i32.trunc_sat_f64_u" (f64.const -1.0)) (i32.const 0x00000000))
+(assert_return (invoke "i32.trunc_sat_f64_u" (f64.const inf)) (i32.const 0xffffffff))
+(assert_return (invoke "i32.trunc_sat_f64_u" (f64.const -inf)) (i32.const 0x00000000))
+(assert_return (invoke "i32.trunc_sat_f64_u" (f64.const nan)) (i32.const 0))
+
+(assert_return (invoke "i64.trunc_sat_f32_s" (f32.const 0.0)) (i64.const 0))
+(assert_return (invoke "i64.trunc_sat_f32_s" (f32.const -1.5)) (i64.const -1))
+(assert_return (invoke "i64.trunc_sat_f32_s" (f32.const 4294967296)) (i64.const 4294967296))
+(assert_return (invoke "i64.trunc_sat_f32_s" (f32.const 0x1.fffffep+62)) (i64.const 9223371487098961920))
+(assert_return (invoke "i64.trunc_sat_f32_s" (f32.const -0x1p+63)) (i64.const -9223372036854775808))
+(assert_return (invoke "i64.trunc_sat_f32_s" (f32.const 0x1p+63)) (i64.const 0x7fffffffffffffff))
+(assert_return (invoke "i64.trunc_sat_f32_s" (f32.const -0x1.000002p+63)) (i64.const 0x8000000000000000))
+(assert_return (invoke "i64.trunc_sat_f32_s" (f32.const inf)) (i64.const 0x7fffffffffffffff))
+(assert_return (invoke "i64.trunc_sat_f32_s" (f32.const -inf)) (i64.const 0x8000000000000000))
+(assert_return (invoke "i64.trunc_sat_f32_s" (f32.const nan)) (i64.const 0))
+
+(assert_return (invoke "i64.trunc_sat_f32_u" (f32.const 0.0)) (i64.const 0))
+(assert_return (invoke "i64.trunc_sat_f32_u" (f32.const 1.5)) (i64.const 1))
+(assert_return (invoke "i64.trunc_sat_f32_u" (f32.const 4294967296)) (i64.const 4294967296))
+(assert_return (invoke "i64.trunc_sat_f32_u" (f32.const 0x1.fffffep+63)) (i64.const -1099511627776))
+(assert_return (invoke "i64.trunc_sat_f32_u" (f32.const 0x1p+64)) (i64.const 0xffffffffffffffff))
+(assert_return (invoke "i64.trunc_sat_f32_u" (f32.const -1.0)) (i64.const 0x0000000000000000))
+(assert_return (invoke "i64.trunc_sat_f32_u" (f32.const inf)) (i64.const 0xffffffffffffffff))
+(assert_return (invoke "i64.trunc_sat_f32_u" (f32.const -inf)) (i64.const 0x0000000000000000))
+(assert_return (invoke "i64.trunc_sat_f32_u" (f32.const nan)) (i64.const 0))
+
+(assert_return (invoke "i64.trunc_sat_f64_s" (f64.const 0.0)) (i64.const 0))
+(assert_return (invoke "i64.trunc_sat_f64_s" (f64.const -1.5)) (i64.const -1))
+(assert_return (invoke "i64.trunc_sat_f64_s" (f64.const 4294967296)) (i64.const 4294967296))
+(assert_return (invoke "i64.trunc_sat_f64_s" (f64.const 0x1.fffffffffffffp+62)) (i64.const 9223372036854774784))
+(assert_return (invoke "i64.trunc_sat_f64_s" (f64.const -0x1p+63)) (i64.const -9223372036854775808))
+(assert_return (invoke "i64.trunc_sat_f64_s" (f64.const 0x1p+63)) (i64.const 0x7fffffffffffffff))
+(assert_return (invoke "i64.trunc_sat_f64_s" (f64.const -0x1.0000000000001p+63)) (i64.const 0x8000000000000000))
+(assert_return (invoke "i64.trunc_sat_f64_s" (f64.const inf)) (i64.const 0x7fffffffffffffff))
+(assert_return (invoke "i64.trunc_sat_f64_s" (f64.const -inf)) (i64.const 0x8000000000000000))
+(assert_return (invoke "i64.trunc_sat_f64_s" (f64.const nan)) (i64.const 0))
+
+(assert_return (invoke "i64.trunc_sat_f64_u" (f64.const 0.0)) (i64.const 0))
+(assert_return (invoke "i64.trunc_sat_f64_u" (f64.const -0.9)) (i64.const 0))
+(assert_return (invoke "i64.trunc_sat_f64_u" (f64.const 4294967295)) (i64.const 0xffffffff))
+(assert_return (invoke "i64.trunc_sat_f64_u" (f64.const 1e16)) (i64.const 10000000000000000))
+(assert_return (invoke "i64.trunc_sat_f64_u" (f64.const 0x1.fffffffffffffp+63)) (i64.const -2048))
+(assert_return (invoke "i64.trunc_sat_f64_u" (f64.const 0x1p+64)) (i64.const 0xffffffffffffffff))
+(assert_return (invoke "i64.trunc_sat_f64_u" (f64.const -1.0)) (i64.const 0x0000000000000000))
+(assert_return (invoke "i64.trunc_sat_f64_u" (f64.const inf)) (i64.const 0xffffffffffffffff))
+(assert_return (invoke "i64.trunc_sat_f64_u" (f64.const -inf)) (i64.const 0x0000000000000000))
+(assert_return (invoke "i64.trunc_sat_f64_u" (f64.const nan)) (i64.const 0))
@@ -0,0 +1,92 @@
+;; Reference types, multiple tables and table instructions
+
+(module
+  (type $t (func (result i32)))
+  (table $funcs 2 funcref)
+  (table $externs 0 4 externref)
+  (global $g (mut externref) (ref.null extern))
+  (global $f funcref (ref.func $f42))
+
+  (elem (i32.const 1) funcref (ref.func $f42))
+  (elem (table $externs) (i32.const 0) externref)
+  (elem declare func $f42)
+
+  (func $f42 (result i32) (i32.const 42))
+
+  (func (export "id") (param externref) (result externref) (local.get 0))
+  (func (export "is_null") (param externref) (result i32)
+    (ref.is_null (local.get 0)))
+
+  (func (export "get") (param i32) (result externref)
+    (table.get $externs (local.get 0)))
+  (func (export "set") (param i32 externref)
+    (table.set $externs (local.get 0) (local.get 1)))
+  (func (export "size") (result i32) (table.size $externs))
+  (func (export "grow") (param externref i32) (result i32)
+    (table.grow $externs (local.get 0) (local.get 1)))
+  (func (export "fill") (param i32 externref)
+    (table.fill $externs (local.get 0) (local.get 1) (i32.const 2)))
+
+  (func (export "call") (param i32) (result i32)
+    (call_indirect $funcs (type $t) (local.get 0)))
+  (func (export "set_func") (param i32)
+    (table.set $funcs (local.get 0) (ref.func $f42)))
+  (func (export "set_null") (param i32)
+    (table.set $funcs (local.get 0) (ref.null func)))
+  (func (export "func_is_null") (param i32) (result i32)
+    (ref.is_null (table.get $funcs (local.get 0))))
+  (func (export "func_size") (result i32) (table.size $funcs))
+  (func (export "func_grow") (param i32) (result i32)
+    (table.grow $funcs (global.get $f) (local.get 0)))
+
+  (func (export "global_set") (param externref) (global.set $g (local.get 0)))
+  (func (export "global_get") (result externref) (global.get $g))
+  (func (export "select") (param i32) (result externref)
+    (select (result externref) (ref.null extern) (global.get $g) (local.get 0)))
+)
+
+(assert_return (invoke "id" (ref.extern 1)) (ref.extern 1))
+(assert_return (invoke "is_null" (ref.null extern)) (i32.const 1))
+(assert_return (invoke "is_null" (ref.extern 1)) (i32.const 0))
+
+;; externref tables
+(assert_return (invoke "size") (i32.const 0))
+(assert_return (invoke "grow" (ref.extern 1) (i32.const 3)) (i32.const 0))
+(assert_return (invoke "size") (i32.const 3))
+(assert_return (invoke "get" (i32.const 2)) (ref.extern 1))
+(assert_return (invoke "set" (i32.const 1) (ref.extern 2)))
+(assert_return (invoke "get" (i32.const 1)) (ref.extern 2))
+(assert_return (invoke "grow" (ref.null extern) (i32.const 2)) (i32.const -1))
+(assert_return (invoke "grow" (ref.null extern) (i32.const 1)) (i32.const 3))
+(assert_return (invoke "fill" (i32.const 0) (ref.null extern)))
+(assert_return (invoke "get" (i32.const 0)) (ref.null extern))
+(assert_return (invoke "get" (i32.const 1)) (ref.null extern))
+(assert_return (invoke "get" (i32.const 2)) (ref.extern 1))
+(assert_trap (invoke "get" (i32.const 4)) "out of bounds table access")
+(assert_trap (invoke "fill" (i32.const 3) (ref.null extern)) "out of bounds table access")
+
+;; funcref tables
+(assert_return (invoke "call" (i32.const 1)) (i32.const 42))
+(assert_trap (invoke "call" (i32.const 0)) "uninitialized element")
+(assert_return (invoke "set_func" (i32.const 0)))
+(assert_return (invoke "call" (i32.const 0)) (i32.const 42))
+(assert_return (invoke "func_is_null" (i32.const 0)) (i32.const 0))
+(assert_return (invoke "set_null" (i32.const 0)))
+(assert_trap (invoke "call" (i32.const 0)) "uninitialized element")
+(assert_return (invoke "func_is_null" (i32.const 0)) (i32.const 1))
+(assert_return (invoke "func_size") (i32.const 2))
+(assert_return (invoke "func_grow" (i32.const 3)) (i32.const 2))
+(assert_return (invoke "func_size") (i32.const 5))
+(assert_return (invoke "call" (i32.const 4)) (i32.const 42))
+
+;; reference globals and typed select
+(assert_return (invoke "global_get") (ref.null extern))
+(assert_return (invoke "global_set" (ref.extern 1)))
+(assert_return (invoke "global_get") (ref.extern 1))
+(assert_return (invoke "select" (i32.const 1)) (ref.null extern))
+(assert_return (invoke "select" (i32.const 0)) (ref.extern 1))
+
+(assert_invalid
+  (module (func (drop (table.size 0))))
+  "unknown table"
+)
@@ -0,0 +1,84 @@
+;; Fixed-width SIMD instructions and v128 values
+
+(module
+  (memory 1)
+  (data (i32.const 0) "\00\01\02\03\04\05\06\07\08\09\0a\0b\0c\0d\0e\0f")
+  (global $g (mut v128) (v128.const i32x4 1 2 3 4))
+
+  (func (export "i32x4.add") (param v128 v128) (result v128)
+    (i32x4.add (local.get 0) (local.get 1)))
+  (func (export "i8x16.sub_sat_u") (param v128 v128) (result v128)
+    (i8x16.sub_sat_u (local.get 0) (local.get 1)))
+  (func (export "i16x8.mul") (param v128 v128) (result v128)
+    (i16x8.mul (local.get 0) (local.get 1)))
+  (func (export "i64x2.shl") (param v128 i32) (result v128)
+    (i64x2.shl (local.get 0) (local.get 1)))
+  (func (export "f32x4.mul") (param v128 v128) (result v128)
+    (f32x4.mul (local.get 0) (local.get 1)))
+  (func (export "f64x2.min") (param v128 v128) (result v128)
+    (f64x2.min (local.get 0) (local.get 1)))
+
+  (func (export "splat") (param i32) (result v128)
+    (i32x4.splat (local.get 0)))
+  (func (export "extract") (param v128) (result i32)
+    (i8x16.extract_lane_s 15 (local.get 0)))
+  (func (export "replace") (param v128 i64) (result v128)
+    (i64x2.replace_lane 1 (local.get 0) (local.get 1)))
+  (func (export "shuffle") (param v128 v128) (result v128)
+    (i8x16.shuffle 0 16 1 17 2 18 3 19 4 20 5 21 6 22 7 23 (local.get 0) (local.get 1)))
+  (func (export "all_true") (param v128) (result i32)
+    (i32x4.all_true (local.get 0)))
+  (func (export "bitmask") (param v128) (result i32)
+    (i8x16.bitmask (local.get 0)))
+  (func (export "select") (param v128 v128 i32) (result v128)
+    (select (local.get 0) (local.get 1) (local.get 2)))
+
+  (func (export "load") (param i32) (result v128)
+    (v128.load (local.get 0)))
+  (func (export "load8x8_u") (param i32) (result v128)
+    (v128.load8x8_u (local.get 0)))
+  (func (export "store") (param i32 v128) (result v128)
+    (v128.store (local.get 0) (local.get 1))
+    (v128.load (local.get 0)))
+
+  (func (export "get_global") (result v128) (global.get $g))
+  (func (export "add_global") (param v128) (result v128)
+    (global.set $g (i32x4.add (global.get $g) (local.get 0)))
+    (global.get $g))
+  (func (export "swap") (param v128 i32 v128) (result v128 i32 v128)
+    (local.get 2) (local.get 1) (local.get 0))
+)
+
+(assert_return (invoke "i32x4.add" (v128.const i32x4 1 2 3 4) (v128.const i32x4 -1 10 0x7fffffff 0))
+  (v128.const i32x4 0 12 0x80000002 4))
+(assert_return (invoke "i8x16.sub_sat_u" (v128.const i8x16 0 1 2 3 4 5 6 7 8 9 10 11 12 13 14 255) (v128.const i8x16 1 1 1 1 1 1 1 1 1 1 1 1 1 1 1 1))
+  (v128.const i8x16 0 0 1 2 3 4 5 6 7 8 9 10 11 12 13 254))
+(assert_return (invoke "i16x8.mul" (v128.const i16x8 1 2 3 4 5 6 7 0x4000) (v128.const i16x8 2 2 2 2 2 2 2 4))
+  (v128.const i16x8 2 4 6 8 10 12 14 0))
+(assert_return (invoke "i64x2.shl" (v128.const i64x2 1 3) (i32.const 65))
+  (v128.const i64x2 2 6))
+(assert_return (invoke "f32x4.mul" (v128.const f32x4 1.5 -2 0.5 3) (v128.const f32x4 2 2 2 -1))
+  (v128.const f32x4 3 -4 1 -3))
+(assert_return (invoke "f64x2.min" (v128.const f64x2 -0 1) (v128.const f64x2 0 -inf))
+  (v128.const f64x2 -0 -inf))
+
+(assert_return (invoke "splat" (i32.const 7)) (v128.const i32x4 7 7 7 7))
+(assert_return (invoke "extract" (v128.const i8x16 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 -2)) (i32.const -2))
+(assert_return (invoke "replace" (v128.const i64x2 1 2) (i64.const 9)) (v128.const i64x2 1 9))
+(assert_return (invoke "shuffle" (v128.const i8x16 0 1 2 3 4 5 6 7 8 9 10 11 12 13 14 15) (v128.const i8x16 16 17 18 19 20 21 22 23 24 25 26 27 28 29 30 31))
+  (v128.const i8x16 0 16 1 17 2 18 3 19 4 20 5 21 6 22 7 23))
+(assert_return (invoke "all_true" (v128.const i32x4 1 2 3 4)) (i32.const 1))
+(assert_return (invoke "all_true" (v128.const i32x4 1 0 3 4)) (i32.const 0))
+(assert_return (invoke "bitmask" (v128.const i8x16 -1 0 -1 0 0 0 0 0 0 0 0 0 0 0 0 -1)) (i32.const 0x8005))
+(assert_return (invoke "select" (v128.const i64x2 1 2) (v128.const i64x2 3 4) (i32.const 0)) (v128.const i64x2 3 4))
+
+(assert_return (invoke "load" (i32.const 0)) (v128.const i8x16 0 1 2 3 4 5 6 7 8 9 10 11 12 13 14 15))
+(assert_return (invoke "load8x8_u" (i32.const 8)) (v128.const i16x8 8 9 10 11 12 13 14 15))
+(assert_return (invoke "store" (i32.const 32) (v128.const i32x4 5 6 7 8)) (v128.const i32x4 5 6 7 8))
+
+(assert_return (invoke "get_global") (v128.const i32x4 1 2 3 4))
+(assert_return (invoke "add_global" (v128.const i32x4 1 1 1 1)) (v128.const i32x4 2 3 4 5))
+(assert_return (invoke "swap" (v128.const i64x2 1 2) (i32.const 3) (v128.const i64x2 4 5))
+  (v128.const i64x2 4 5) (i32.const 3) (v128.const i64x2 1 2))
+
+(assert_trap (invoke "load" (i32.const 65530)) "out of bounds memory access")
@@ -0,0 +1,50 @@
+;; Tail calls: return_call and return_call_indirect
+
+(module
+  (type $i32-i32 (func (param i32) (result i32)))
+  (table funcref (elem $even $odd))
+
+  (func $count (export "count") (param i32 i32) (result i32)
+    (if (i32.eqz (local.get 0)) (then (return (local.get 1))))
+    (return_call $count
+      (i32.sub (local.get 0) (i32.const 1))
+      (i32.add (local.get 1) (i32.const 1))))
+
+  (func (export "start") (param i32) (result i32)
+    (return_call $count (local.get 0) (i32.const 0)))
+
+  (func $even (export "even") (param i32) (result i32)
+    (if (i32.eqz (local.get 0)) (then (return (i32.const 1))))
+    (return_call_indirect (type $i32-i32)
+      (i32.sub (local.get 0) (i32.const 1)) (i32.const 1)))
+  (func $odd (export "odd") (param i32) (result i32)
+    (if (i32.eqz (local.get 0)) (then (return (i32.const 0))))
+    (return_call_indirect (type $i32-i32)
+      (i32.sub (local.get 0) (i32.const 1)) (i32.const 0)))
+
+  (func $pair (param i32) (result i32 i64)
+    (local.get 0) (i64.extend_i32_u (local.get 0)))
+  (func (export "pair") (param i32) (result i32 i64)
+    (return_call $pair (local.get 0)))
+
+  (func (export "mismatch") (result i32)
+    (return_call_indirect (param i32 i32) (result i32)
+      (i32.const 0) (i32.const 0) (i32.const 0)))
+  (func (export "undefined") (result i32)
+    (return_call_indirect (type $i32-i32) (i32.const 0) (i32.const 2)))
+)
+
+(assert_return (invoke "count" (i32.const 1000000) (i32.const 0)) (i32.const 1000000))
+(assert_return (invoke "start" (i32.const 1000000)) (i32.const 1000000))
+(assert_return (invoke "even" (i32.const 100000)) (i32.const 1))
+(assert_return (invoke "odd" (i32.const 100001)) (i32.const 1))
+(assert_return (invoke "even" (i32.const 77777)) (i32.const 0))
+(assert_return (invoke "pair" (i32.const 7)) (i32.const 7) (i64.const 7))
+(assert_trap (invoke "mismatch") "indirect call type mismatch")
+(assert_trap (invoke "undefined") "undefined element")
+
+(assert_invalid
+  (module
+    (func $f (result i64) (i64.const 0))
+    (func (result i32) (return_call $f)))
+  "type mismatch")
@@ -0,0 +1,219 @@
+package wasi
+
+import "fmt"
+
+// ModuleName is the import module name used by WASI preview1 binaries.
+const ModuleName = "wasi_snapshot_preview1"
+
+// Errno is a WASI error number as returned to the guest.
+type Errno uint16
+
+// Error numbers defined by wasi_snapshot_preview1.
+const (
+	ErrnoSuccess Errno = iota
+	Errno2big
+	ErrnoAcces
+	ErrnoAddrinuse
+	ErrnoAddrnotavail
+	ErrnoAfnosupport
+	ErrnoAgain
+	ErrnoAlready
+	ErrnoBadf
+	ErrnoBadmsg
+	ErrnoBusy
+	ErrnoCanceled
+	ErrnoChild
+	ErrnoConnaborted
+	ErrnoConnrefused
+	ErrnoConnreset
+	ErrnoDeadlk
+	ErrnoDestaddrreq
+	ErrnoDom
+	ErrnoDquot
+	ErrnoExist
+	ErrnoFault
+	ErrnoFbig
+	ErrnoHostunreach
+	ErrnoIdrm
+	ErrnoIlseq
+	ErrnoInprogress
+	ErrnoIntr
+	ErrnoInval
+	ErrnoIo
+	ErrnoIsconn
+	ErrnoIsdir
+	ErrnoLoop
+	ErrnoMfile
+	ErrnoMlink
+	ErrnoMsgsize
+	ErrnoMultihop
+	ErrnoNametoolong
+	ErrnoNetdown
+	ErrnoNetreset
+	ErrnoNetunreach
+	ErrnoNfile
+	ErrnoNobufs
+	ErrnoNodev
+	ErrnoNoent
+	ErrnoNoexec
+	ErrnoNolck
+	ErrnoNolink
+	ErrnoNomem
+	ErrnoNomsg
+	ErrnoNoprotoopt
+	ErrnoNospc
+	ErrnoNosys
+	ErrnoNotconn
+	ErrnoNotdir
+	ErrnoNotempty
+	ErrnoNotrecoverable
+	ErrnoNotsock
+	ErrnoNotsup
+	ErrnoNotty
+	ErrnoNxio
+	ErrnoOverflow
+	ErrnoOwnerdead
+	ErrnoPerm
+	ErrnoPipe
+	ErrnoProto
+	ErrnoProtonosupport
+	ErrnoPrototype
+	ErrnoRange
+	ErrnoRofs
+	ErrnoSpipe
+	ErrnoSrch
+	ErrnoStale
+	ErrnoTimedout
+	ErrnoTxtbsy
+	ErrnoXdev
+	ErrnoNotcapable
+)
+
+func (e Errno) Error() string {
+	return fmt.Sprintf("wasi: errno %d", uint16(e))
+}
+
+// File types.
+const (
+	filetypeUnknown uint8 = iota
+	filetypeBlockDevice
+	filetypeCharacterDevice
+	filetypeDirectory
+	filetypeRegularFile
+	filetypeSocketDgram
+	filetypeSocketStream
+	filetypeSymbolicLink
+)
+
+// File descriptor flags.
+const (
+	fdflagAppend   uint16 = 1 << 0
+	fdflagDsync    uint16 = 1 << 1
+	fdflagNonblock uint16 = 1 << 2
+	fdflagRsync    uint16 = 1 << 3
+	fdflagSync     uint16 = 1 << 4
+)
+
+// Open flags used by path_open.
+const (
+	oflagCreat     uint16 = 1 << 0
+	oflagDirectory uint16 = 1 << 1
+	oflagExcl      uint16 = 1 << 2
+	oflagTrunc     uint16 = 1 << 3
+)
+
+// Lookup flags.
+const lookupSymlinkFollow uint32 = 1 << 0
+
+// Flags for *_set_times.
+const (
+	fstflagAtim    uint16 = 1 << 0
+	fstflagAtimNow uint16 = 1 << 1
+	fstflagMtim    uint16 = 1 << 2
+	fstflagMtimNow uint16 = 1 << 3
+)
+
+// Whence values for fd_seek.
+const (
+	whenceSet uint8 = iota
+	whenceCur
+	whenceEnd
+)
+
+// Clock IDs.
+const (
+	clockRealtime uint32 = iota
+	clockMonotonic
+	clockProcessCputime
+	clockThreadCputime
+)
+
+// Event types for poll_oneoff.
+const (
+	eventtypeClock uint8 = iota
+	eventtypeFdRead
+	eventtypeFdWrite
+)
+
+const subclockflagAbstime uint16 = 1 << 0
+
+const preopentypeDir uint8 = 0
+
+// Rights.
+const (
+	rightFdDatasync uint64 = 1 << iota
+	rightFdRead
+	rightFdSeek
+	rightFdFdstatSetFlags
+	rightFdSync
+	rightFdTell
+	rightFdWrite
+	rightFdAdvise
+	rightFdAllocate
+	rightPathCreateDirectory
+	rightPathCreateFile
+	rightPathLinkSource
+	rightPathLinkTarget
+	rightPathOpen
+	rightFdReaddir
+	rightPathReadlink
+	rightPathRenameSource
+	rightPathRenameTarget
+	rightPathFilestatGet
+	rightPathFilestatSetSize
+	rightPathFilestatSetTimes
+	rightFdFilestatGet
+	rightFdFilestatSetSize
+	rightFdFilestatSetTimes
+	rightPathSymlink
+	rightPathRemoveDirectory
+	rightPathUnlinkFile
+	rightPollFdReadwrite
+	rightSockShutdown
+	rightSockAccept
+)
+
+const (
+	rightsFile = rightFdDatasync | rightFdRead | rightFdSeek | rightFdFdstatSetFlags | rightFdSync |
+		rightFdTell | rightFdWrite | rightFdAdvise | rightFdAllocate | rightFdFilestatGet |
+		rightFdFilestatSetSize | rightFdFilestatSetTimes | rightPollFdReadwrite
+
+	rightsDirectory = rightFdFdstatSetFlags | rightFdSync | rightFdAdvise | rightPathCreateDirectory |
+		rightPathCreateFile | rightPathLinkSource | rightPathLinkTarget | rightPathOpen | rightFdReaddir |
+		rightPathReadlink | rightPathRenameSource | rightPathRenameTarget | rightPathFilestatGet |
+		rightPathFilestatSetSize | rightPathFilestatSetTimes | rightFdFilestatGet | rightFdFilestatSetTimes |
+		rightPathSymlink | rightPathRemoveDirectory | rightPathUnlinkFile
+
+	rightsStdio = rightFdRead | rightFdWrite | rightFdFdstatSetFlags | rightFdFilestatGet | rightPollFdReadwrite
+)
+
+// Sizes of structures laid out in guest memory.
+const (
+	sizeFdstat       = 24
+	sizeFilestat     = 64
+	sizePrestat      = 8
+	sizeDirent       = 24
+	sizeIovec        = 8
+	sizeSubscription = 48
+	sizeEvent        = 32
+)
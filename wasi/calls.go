@@ -0,0 +1,926 @@
+package wasi
+
+import (
+	"io"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/perlin-network/life/exec"
+	"github.com/perlin-network/life/wasi/vfs"
+)
+
+func u32(v int64) uint32 {
+	return uint32(v)
+}
+
+// writeStrings lays out a list of strings as expected by args_get and
+// environ_get: an array of pointers at `ptrs` into NUL-terminated strings
+// stored contiguously at `buf`.
+func writeStrings(mem memory, list []string, ptrs, buf uint32) {
+	for i, s := range list {
+		mem.putUint32(ptrs+uint32(i)*4, buf)
+		copy(mem.slice(buf, uint32(len(s))), s)
+		mem.putUint8(buf+uint32(len(s)), 0)
+		buf += uint32(len(s)) + 1
+	}
+}
+
+func writeSizes(mem memory, list []string, countPtr, sizePtr uint32) {
+	size := 0
+	for _, s := range list {
+		size += len(s) + 1
+	}
+	mem.putUint32(countPtr, uint32(len(list)))
+	mem.putUint32(sizePtr, uint32(size))
+}
+
+func (w *WASI) argsGet(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	writeStrings(mem, w.config.Args, u32(params[0]), u32(params[1]))
+	return ErrnoSuccess
+}
+
+func (w *WASI) argsSizesGet(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	writeSizes(mem, w.config.Args, u32(params[0]), u32(params[1]))
+	return ErrnoSuccess
+}
+
+func (w *WASI) environGet(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	writeStrings(mem, w.config.Env, u32(params[0]), u32(params[1]))
+	return ErrnoSuccess
+}
+
+func (w *WASI) environSizesGet(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	writeSizes(mem, w.config.Env, u32(params[0]), u32(params[1]))
+	return ErrnoSuccess
+}
+
+// now returns the current time of the given clock in nanoseconds.
+func (w *WASI) now(clockID uint32) (uint64, Errno) {
+	switch clockID {
+	case clockRealtime:
+		return uint64(w.config.Now().UnixNano()), ErrnoSuccess
+	case clockMonotonic, clockProcessCputime, clockThreadCputime:
+		return uint64(time.Since(w.start).Nanoseconds()), ErrnoSuccess
+	default:
+		return 0, ErrnoInval
+	}
+}
+
+func (w *WASI) clockResGet(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	if _, errno := w.now(u32(params[0])); errno != ErrnoSuccess {
+		return errno
+	}
+	mem.putUint64(u32(params[1]), 1)
+	return ErrnoSuccess
+}
+
+func (w *WASI) clockTimeGet(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	t, errno := w.now(u32(params[0]))
+	if errno != ErrnoSuccess {
+		return errno
+	}
+	mem.putUint64(u32(params[2]), t)
+	return ErrnoSuccess
+}
+
+func (w *WASI) fdAdvise(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	_, errno := w.fds.getWithRights(u32(params[0]), rightFdAdvise)
+	return errno
+}
+
+func (w *WASI) fdAllocate(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	e, errno := w.fds.getWithRights(u32(params[0]), rightFdAllocate)
+	if errno != ErrnoSuccess {
+		return errno
+	}
+
+	f, ok := e.file.(vfs.File)
+	if !ok {
+		return ErrnoBadf
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return errnoOf(err)
+	}
+
+	end := params[1] + params[2]
+	if end < params[1] {
+		return ErrnoFbig
+	}
+
+	if end > info.Size() {
+		return errnoOf(f.Truncate(end))
+	}
+	return ErrnoSuccess
+}
+
+func (w *WASI) fdClose(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	return w.fds.close(u32(params[0]))
+}
+
+func (w *WASI) fdDatasync(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	return w.sync(u32(params[0]), rightFdDatasync)
+}
+
+func (w *WASI) fdSync(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	return w.sync(u32(params[0]), rightFdSync)
+}
+
+// sync flushes the file opened at fd, which must hold the given rights.
+func (w *WASI) sync(fd uint32, rights uint64) Errno {
+	e, errno := w.fds.getWithRights(fd, rights)
+	if errno != ErrnoSuccess {
+		return errno
+	}
+
+	if f, ok := e.file.(vfs.File); ok {
+		return errnoOf(f.Sync())
+	}
+	return ErrnoSuccess
+}
+
+func (w *WASI) fdFdstatGet(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	e, errno := w.fds.get(u32(params[0]))
+	if errno != ErrnoSuccess {
+		return errno
+	}
+
+	buf := u32(params[1])
+	mem.slice(buf, sizeFdstat)
+	mem.putUint8(buf, e.fileType)
+	mem.putUint8(buf+1, 0)
+	mem.putUint16(buf+2, e.fdFlags)
+	mem.putUint32(buf+4, 0)
+	mem.putUint64(buf+8, e.rightsBase)
+	mem.putUint64(buf+16, e.rightsInheriting)
+	return ErrnoSuccess
+}
+
+func (w *WASI) fdFdstatSetFlags(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	e, errno := w.fds.getWithRights(u32(params[0]), rightFdFdstatSetFlags)
+	if errno != ErrnoSuccess {
+		return errno
+	}
+
+	flags := uint16(params[1])
+	if flags&^(fdflagAppend|fdflagNonblock) != 0 {
+		return ErrnoNotsup
+	}
+	e.fdFlags = flags
+	return ErrnoSuccess
+}
+
+func (w *WASI) fdFdstatSetRights(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	e, errno := w.fds.get(u32(params[0]))
+	if errno != ErrnoSuccess {
+		return errno
+	}
+
+	base, inheriting := uint64(params[1]), uint64(params[2])
+	if base&^e.rightsBase != 0 || inheriting&^e.rightsInheriting != 0 {
+		return ErrnoNotcapable // rights may only be dropped
+	}
+	e.rightsBase = base
+	e.rightsInheriting = inheriting
+	return ErrnoSuccess
+}
+
+// writeFilestat stores a filestat structure describing `info` at `buf`.
+// A nil info describes a character device such as the standard streams.
+func writeFilestat(mem memory, buf uint32, info os.FileInfo) {
+	mem.slice(buf, sizeFilestat)
+	for i := uint32(0); i < sizeFilestat; i += 8 {
+		mem.putUint64(buf+i, 0)
+	}
+
+	if info == nil {
+		mem.putUint8(buf+16, filetypeCharacterDevice)
+		mem.putUint64(buf+24, 1)
+		return
+	}
+
+	mtime := uint64(info.ModTime().UnixNano())
+	mem.putUint8(buf+16, fileTypeOf(info.Mode()))
+	mem.putUint64(buf+24, 1)
+	mem.putUint64(buf+32, uint64(info.Size()))
+	mem.putUint64(buf+40, mtime)
+	mem.putUint64(buf+48, mtime)
+	mem.putUint64(buf+56, mtime)
+}
+
+func (e *fileEntry) stat() (os.FileInfo, error) {
+	if f, ok := e.file.(vfs.File); ok {
+		return f.Stat()
+	}
+	if e.mount != nil {
+		return e.mount.FS.Stat(e.path)
+	}
+	return nil, nil
+}
+
+func (w *WASI) fdFilestatGet(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	e, errno := w.fds.getWithRights(u32(params[0]), rightFdFilestatGet)
+	if errno != ErrnoSuccess {
+		return errno
+	}
+
+	info, err := e.stat()
+	if err != nil {
+		return errnoOf(err)
+	}
+
+	writeFilestat(mem, u32(params[1]), info)
+	return ErrnoSuccess
+}
+
+func (w *WASI) fdFilestatSetSize(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	e, errno := w.fds.getWithRights(u32(params[0]), rightFdFilestatSetSize)
+	if errno != ErrnoSuccess {
+		return errno
+	}
+
+	f, ok := e.file.(vfs.File)
+	if !ok {
+		return ErrnoBadf
+	}
+	return errnoOf(f.Truncate(params[1]))
+}
+
+// setTimes applies the atim/mtim/fst_flags arguments of *_set_times to a file.
+func (w *WASI) setTimes(mount *vfs.Mount, name string, atim, mtim int64, flags uint16) Errno {
+	if (flags&fstflagAtim != 0 && flags&fstflagAtimNow != 0) ||
+		(flags&fstflagMtim != 0 && flags&fstflagMtimNow != 0) {
+		return ErrnoInval
+	}
+
+	info, err := mount.FS.Stat(name)
+	if err != nil {
+		return errnoOf(err)
+	}
+
+	now := w.config.Now()
+	atime, mtime := info.ModTime(), info.ModTime()
+
+	switch {
+	case flags&fstflagAtim != 0:
+		atime = time.Unix(0, atim)
+	case flags&fstflagAtimNow != 0:
+		atime = now
+	}
+
+	switch {
+	case flags&fstflagMtim != 0:
+		mtime = time.Unix(0, mtim)
+	case flags&fstflagMtimNow != 0:
+		mtime = now
+	}
+
+	return errnoOf(mount.FS.Chtimes(name, atime, mtime))
+}
+
+func (w *WASI) fdFilestatSetTimes(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	e, errno := w.fds.getWithRights(u32(params[0]), rightFdFilestatSetTimes)
+	if errno != ErrnoSuccess {
+		return errno
+	}
+
+	if e.mount == nil {
+		return ErrnoBadf
+	}
+	return w.setTimes(e.mount, e.path, params[1], params[2], uint16(params[3]))
+}
+
+func (w *WASI) fdPread(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	e, errno := w.fds.getWithRights(u32(params[0]), rightFdRead|rightFdSeek)
+	if errno != ErrnoSuccess {
+		return errno
+	}
+
+	f, ok := e.file.(io.ReaderAt)
+	if !ok {
+		if e.isDir() {
+			return ErrnoIsdir
+		}
+		return ErrnoSpipe
+	}
+
+	offset := params[3]
+	total := uint32(0)
+	for _, buf := range mem.iovecs(u32(params[1]), u32(params[2])) {
+		n, err := f.ReadAt(buf, offset)
+		total += uint32(n)
+		offset += int64(n)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return errnoOf(err)
+		}
+	}
+
+	mem.putUint32(u32(params[4]), total)
+	return ErrnoSuccess
+}
+
+func (w *WASI) fdPrestatGet(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	e, errno := w.fds.get(u32(params[0]))
+	if errno != ErrnoSuccess {
+		return errno
+	}
+
+	if e.preopenPath == "" {
+		return ErrnoBadf
+	}
+
+	buf := u32(params[1])
+	mem.putUint32(buf, uint32(preopentypeDir))
+	mem.putUint32(buf+4, uint32(len(e.preopenPath)))
+	return ErrnoSuccess
+}
+
+func (w *WASI) fdPrestatDirName(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	e, errno := w.fds.get(u32(params[0]))
+	if errno != ErrnoSuccess {
+		return errno
+	}
+
+	if e.preopenPath == "" {
+		return ErrnoBadf
+	}
+
+	if u32(params[2]) < uint32(len(e.preopenPath)) {
+		return ErrnoNametoolong
+	}
+
+	copy(mem.slice(u32(params[1]), uint32(len(e.preopenPath))), e.preopenPath)
+	return ErrnoSuccess
+}
+
+func (w *WASI) fdPwrite(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	e, errno := w.fds.getWithRights(u32(params[0]), rightFdWrite|rightFdSeek)
+	if errno != ErrnoSuccess {
+		return errno
+	}
+
+	f, ok := e.file.(io.WriterAt)
+	if !ok {
+		if e.isDir() {
+			return ErrnoIsdir
+		}
+		return ErrnoSpipe
+	}
+
+	offset := params[3]
+	total := uint32(0)
+	for _, buf := range mem.iovecs(u32(params[1]), u32(params[2])) {
+		n, err := f.WriteAt(buf, offset)
+		total += uint32(n)
+		offset += int64(n)
+		if err != nil {
+			return errnoOf(err)
+		}
+	}
+
+	mem.putUint32(u32(params[4]), total)
+	return ErrnoSuccess
+}
+
+func (w *WASI) fdRead(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	e, errno := w.fds.getWithRights(u32(params[0]), rightFdRead)
+	if errno != ErrnoSuccess {
+		return errno
+	}
+
+	if e.file == nil {
+		return ErrnoIsdir
+	}
+
+	total := uint32(0)
+	for _, buf := range mem.iovecs(u32(params[1]), u32(params[2])) {
+		n, err := e.file.Read(buf)
+		total += uint32(n)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return errnoOf(err)
+		}
+
+		// Stop on short reads so that interactive streams do not block for
+		// more data than is available.
+		if n < len(buf) {
+			break
+		}
+	}
+
+	mem.putUint32(u32(params[3]), total)
+	return ErrnoSuccess
+}
+
+func (w *WASI) fdReaddir(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	e, errno := w.fds.getWithRights(u32(params[0]), rightFdReaddir)
+	if errno != ErrnoSuccess {
+		return errno
+	}
+
+	if !e.isDir() {
+		return ErrnoNotdir
+	}
+
+	infos, err := e.mount.FS.ReadDir(e.path)
+	if err != nil {
+		return errnoOf(err)
+	}
+
+	buf, bufLen, cookie := u32(params[1]), u32(params[2]), uint64(params[3])
+	out := mem.slice(buf, bufLen)
+	used := uint32(0)
+
+	for i := cookie; i < uint64(len(infos)) && used < bufLen; i++ {
+		name := infos[i].Name()
+
+		// The last entry may be truncated; the guest detects this by seeing
+		// a completely filled buffer and calls again with a larger one.
+		dirent := make([]byte, sizeDirent+len(name))
+		le.PutUint64(dirent[0:], i+1)
+		le.PutUint64(dirent[8:], 0)
+		le.PutUint32(dirent[16:], uint32(len(name)))
+		dirent[20] = fileTypeOf(infos[i].Mode())
+		copy(dirent[sizeDirent:], name)
+
+		used += uint32(copy(out[used:], dirent))
+	}
+
+	mem.putUint32(u32(params[4]), used)
+	return ErrnoSuccess
+}
+
+func (w *WASI) fdRenumber(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	from, to := u32(params[0]), u32(params[1])
+
+	e, errno := w.fds.get(from)
+	if errno != ErrnoSuccess {
+		return errno
+	}
+
+	if _, errno := w.fds.get(to); errno != ErrnoSuccess {
+		return errno
+	}
+
+	if from == to {
+		return ErrnoSuccess
+	}
+
+	w.fds.close(to)
+	delete(w.fds.entries, from)
+	w.fds.entries[to] = e
+	return ErrnoSuccess
+}
+
+func (w *WASI) fdSeek(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	e, errno := w.fds.getWithRights(u32(params[0]), rightFdSeek)
+	if errno != ErrnoSuccess {
+		return errno
+	}
+
+	if e.file == nil {
+		return ErrnoIsdir
+	}
+
+	var whence int
+	switch uint8(params[2]) {
+	case whenceSet:
+		whence = io.SeekStart
+	case whenceCur:
+		whence = io.SeekCurrent
+	case whenceEnd:
+		whence = io.SeekEnd
+	default:
+		return ErrnoInval
+	}
+
+	pos, err := e.file.Seek(params[1], whence)
+	if err != nil {
+		return errnoOf(err)
+	}
+
+	mem.putUint64(u32(params[3]), uint64(pos))
+	return ErrnoSuccess
+}
+
+func (w *WASI) fdTell(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	e, errno := w.fds.getWithRights(u32(params[0]), rightFdTell)
+	if errno != ErrnoSuccess {
+		return errno
+	}
+
+	if e.file == nil {
+		return ErrnoIsdir
+	}
+
+	pos, err := e.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return errnoOf(err)
+	}
+
+	mem.putUint64(u32(params[1]), uint64(pos))
+	return ErrnoSuccess
+}
+
+func (w *WASI) fdWrite(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	e, errno := w.fds.getWithRights(u32(params[0]), rightFdWrite)
+	if errno != ErrnoSuccess {
+		return errno
+	}
+
+	if e.file == nil {
+		return ErrnoIsdir
+	}
+
+	if e.fdFlags&fdflagAppend != 0 {
+		if _, err := e.file.Seek(0, io.SeekEnd); err != nil && err != ErrnoSpipe {
+			return errnoOf(err)
+		}
+	}
+
+	total := uint32(0)
+	for _, buf := range mem.iovecs(u32(params[1]), u32(params[2])) {
+		n, err := e.file.Write(buf)
+		total += uint32(n)
+		if err != nil {
+			return errnoOf(err)
+		}
+	}
+
+	mem.putUint32(u32(params[3]), total)
+	return ErrnoSuccess
+}
+
+func (w *WASI) pathCreateDirectory(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	mount, name, errno := w.resolvePath(u32(params[0]), rightPathCreateDirectory, mem.string(u32(params[1]), u32(params[2])))
+	if errno != ErrnoSuccess {
+		return errno
+	}
+	return errnoOf(mount.FS.Mkdir(name, 0755))
+}
+
+func (w *WASI) pathFilestatGet(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	mount, name, errno := w.resolvePath(u32(params[0]), rightPathFilestatGet, mem.string(u32(params[2]), u32(params[3])))
+	if errno != ErrnoSuccess {
+		return errno
+	}
+
+	var info os.FileInfo
+	var err error
+
+	if u32(params[1])&lookupSymlinkFollow != 0 {
+		info, err = mount.FS.Stat(name)
+	} else {
+		info, err = mount.FS.Lstat(name)
+	}
+
+	if err != nil {
+		return errnoOf(err)
+	}
+
+	writeFilestat(mem, u32(params[4]), info)
+	return ErrnoSuccess
+}
+
+func (w *WASI) pathFilestatSetTimes(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	mount, name, errno := w.resolvePath(u32(params[0]), rightPathFilestatSetTimes, mem.string(u32(params[2]), u32(params[3])))
+	if errno != ErrnoSuccess {
+		return errno
+	}
+	return w.setTimes(mount, name, params[4], params[5], uint16(params[6]))
+}
+
+func (w *WASI) pathLink(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	oldMount, oldName, errno := w.resolvePath(u32(params[0]), rightPathLinkSource, mem.string(u32(params[2]), u32(params[3])))
+	if errno != ErrnoSuccess {
+		return errno
+	}
+
+	newMount, newName, errno := w.resolvePath(u32(params[4]), rightPathLinkTarget, mem.string(u32(params[5]), u32(params[6])))
+	if errno != ErrnoSuccess {
+		return errno
+	}
+
+	if oldMount != newMount {
+		return ErrnoXdev
+	}
+	return errnoOf(oldMount.FS.Link(oldName, newName))
+}
+
+func (w *WASI) pathOpen(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	dirFD := u32(params[0])
+	oflags := uint16(params[4])
+	rightsBase, rightsInheriting := uint64(params[5]), uint64(params[6])
+	fdFlags := uint16(params[7])
+
+	required := rightPathOpen
+	if oflags&oflagCreat != 0 {
+		required |= rightPathCreateFile
+	}
+	if oflags&oflagTrunc != 0 {
+		required |= rightPathFilestatSetSize
+	}
+
+	mount, name, errno := w.resolvePath(dirFD, required, mem.string(u32(params[2]), u32(params[3])))
+	if errno != ErrnoSuccess {
+		return errno
+	}
+
+	// The opened file gets the requested rights the directory passes on.
+	dir, _ := w.fds.get(dirFD)
+	rightsBase &= dir.rightsInheriting
+	rightsInheriting &= dir.rightsInheriting
+
+	flag := 0
+	switch {
+	case rightsBase&rightFdRead != 0 && rightsBase&rightFdWrite != 0:
+		flag = os.O_RDWR
+	case rightsBase&rightFdWrite != 0:
+		flag = os.O_WRONLY
+	default:
+		flag = os.O_RDONLY
+	}
+
+	if oflags&oflagCreat != 0 {
+		flag |= os.O_CREATE
+	}
+	if oflags&oflagExcl != 0 {
+		flag |= os.O_EXCL
+	}
+	if oflags&oflagTrunc != 0 {
+		flag |= os.O_TRUNC
+	}
+
+	info, err := mount.FS.Stat(name)
+	if err == nil && info.IsDir() {
+		if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC) != 0 && flag&os.O_EXCL == 0 {
+			return ErrnoIsdir
+		}
+		if flag&os.O_EXCL != 0 {
+			return ErrnoExist
+		}
+
+		fd := w.fds.insert(&fileEntry{
+			mount:            mount,
+			path:             name,
+			fileType:         filetypeDirectory,
+			fdFlags:          fdFlags,
+			rightsBase:       rightsBase & rightsDirectory,
+			rightsInheriting: rightsInheriting,
+		})
+		mem.putUint32(u32(params[8]), fd)
+		return ErrnoSuccess
+	}
+
+	if oflags&oflagDirectory != 0 {
+		if err != nil {
+			return errnoOf(err)
+		}
+		return ErrnoNotdir
+	}
+
+	f, err := mount.FS.OpenFile(name, flag, 0644)
+	if err != nil {
+		return errnoOf(err)
+	}
+
+	fd := w.fds.insert(&fileEntry{
+		file:             f,
+		mount:            mount,
+		path:             name,
+		fileType:         filetypeRegularFile,
+		fdFlags:          fdFlags,
+		rightsBase:       rightsBase & rightsFile,
+		rightsInheriting: rightsInheriting,
+	})
+	mem.putUint32(u32(params[8]), fd)
+	return ErrnoSuccess
+}
+
+func (w *WASI) pathReadlink(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	mount, name, errno := w.resolvePath(u32(params[0]), rightPathReadlink, mem.string(u32(params[1]), u32(params[2])))
+	if errno != ErrnoSuccess {
+		return errno
+	}
+
+	target, err := mount.FS.Readlink(name)
+	if err != nil {
+		return errnoOf(err)
+	}
+
+	buf, bufLen := u32(params[3]), u32(params[4])
+	n := copy(mem.slice(buf, bufLen), target)
+	mem.putUint32(u32(params[5]), uint32(n))
+	return ErrnoSuccess
+}
+
+func (w *WASI) pathRemoveDirectory(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	mount, name, errno := w.resolvePath(u32(params[0]), rightPathRemoveDirectory, mem.string(u32(params[1]), u32(params[2])))
+	if errno != ErrnoSuccess {
+		return errno
+	}
+
+	info, err := mount.FS.Lstat(name)
+	if err != nil {
+		return errnoOf(err)
+	}
+
+	if !info.IsDir() {
+		return ErrnoNotdir
+	}
+	return errnoOf(mount.FS.Remove(name))
+}
+
+func (w *WASI) pathRename(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	oldMount, oldName, errno := w.resolvePath(u32(params[0]), rightPathRenameSource, mem.string(u32(params[1]), u32(params[2])))
+	if errno != ErrnoSuccess {
+		return errno
+	}
+
+	newMount, newName, errno := w.resolvePath(u32(params[3]), rightPathRenameTarget, mem.string(u32(params[4]), u32(params[5])))
+	if errno != ErrnoSuccess {
+		return errno
+	}
+
+	if oldMount != newMount {
+		return ErrnoXdev
+	}
+	return errnoOf(oldMount.FS.Rename(oldName, newName))
+}
+
+func (w *WASI) pathSymlink(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	target := mem.string(u32(params[0]), u32(params[1]))
+
+	mount, name, errno := w.resolvePath(u32(params[2]), rightPathSymlink, mem.string(u32(params[3]), u32(params[4])))
+	if errno != ErrnoSuccess {
+		return errno
+	}
+
+	return errnoOf(mount.FS.Symlink(target, name))
+}
+
+func (w *WASI) pathUnlinkFile(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	mount, name, errno := w.resolvePath(u32(params[0]), rightPathUnlinkFile, mem.string(u32(params[1]), u32(params[2])))
+	if errno != ErrnoSuccess {
+		return errno
+	}
+
+	info, err := mount.FS.Lstat(name)
+	if err != nil {
+		return errnoOf(err)
+	}
+
+	if info.IsDir() {
+		return ErrnoIsdir
+	}
+	return errnoOf(mount.FS.Remove(name))
+}
+
+func (w *WASI) pollOneoff(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	in, out, n := u32(params[0]), u32(params[1]), u32(params[2])
+	if n == 0 {
+		return ErrnoInval
+	}
+
+	mem.array(in, n, sizeSubscription)
+	mem.array(out, n, sizeEvent)
+
+	type clockSub struct {
+		index    uint32
+		deadline uint64
+	}
+
+	var clocks []clockSub
+	var minDeadline uint64
+	numEvents := uint32(0)
+
+	writeEvent := func(userdata uint64, errno Errno, ty uint8) {
+		ev := out + numEvents*sizeEvent
+		mem.putUint64(ev, userdata)
+		mem.putUint16(ev+8, uint16(errno))
+		mem.putUint8(ev+10, ty)
+		for i := uint32(11); i < sizeEvent; i++ {
+			mem.putUint8(ev+i, 0)
+		}
+		numEvents++
+	}
+
+	for i := uint32(0); i < n; i++ {
+		sub := in + i*sizeSubscription
+		userdata := mem.uint64(sub)
+		ty := mem.uint8(sub + 8)
+
+		switch ty {
+		case eventtypeClock:
+			clockID := mem.uint32(sub + 16)
+			timeout := mem.uint64(sub + 24)
+			flags := mem.uint16(sub + 40)
+
+			now, errno := w.now(clockID)
+			if errno != ErrnoSuccess {
+				writeEvent(userdata, errno, ty)
+				continue
+			}
+
+			deadline := now + timeout
+			if flags&subclockflagAbstime != 0 {
+				deadline = timeout
+			}
+
+			// Convert all deadlines to the monotonic clock.
+			mono, _ := w.now(clockMonotonic)
+			if deadline > now {
+				deadline = mono + (deadline - now)
+			} else {
+				deadline = mono
+			}
+
+			if len(clocks) == 0 || deadline < minDeadline {
+				minDeadline = deadline
+			}
+			clocks = append(clocks, clockSub{index: i, deadline: deadline})
+		case eventtypeFdRead, eventtypeFdWrite:
+			// All file descriptors are always ready.
+			if _, errno := w.fds.getWithRights(mem.uint32(sub+16), rightPollFdReadwrite); errno != ErrnoSuccess {
+				writeEvent(userdata, errno, ty)
+			} else {
+				writeEvent(userdata, ErrnoSuccess, ty)
+			}
+		default:
+			writeEvent(userdata, ErrnoInval, ty)
+		}
+	}
+
+	// Only sleep when no other event is ready.
+	if numEvents == 0 && len(clocks) > 0 {
+		if mono, _ := w.now(clockMonotonic); minDeadline > mono {
+			timer := time.NewTimer(time.Duration(minDeadline - mono))
+			select {
+			case <-timer.C:
+			case <-vm.Context().Done():
+				timer.Stop()
+				return ErrnoIntr
+			}
+		}
+
+		for _, c := range clocks {
+			if c.deadline <= minDeadline {
+				writeEvent(mem.uint64(in+c.index*sizeSubscription), ErrnoSuccess, eventtypeClock)
+			}
+		}
+	}
+
+	mem.putUint32(u32(params[3]), numEvents)
+	return ErrnoSuccess
+}
+
+func (w *WASI) procExit(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	vm.Exit(u32(params[0]))
+	return ErrnoSuccess
+}
+
+func (w *WASI) procRaise(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	return ErrnoNosys
+}
+
+func (w *WASI) schedYield(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	runtime.Gosched()
+	return ErrnoSuccess
+}
+
+func (w *WASI) randomGet(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	if _, err := io.ReadFull(w.config.Random, mem.slice(u32(params[0]), u32(params[1]))); err != nil {
+		return ErrnoIo
+	}
+	return ErrnoSuccess
+}
+
+// Sockets cannot be created through WASI preview1, so there is never a
+// socket to operate on.
+func (w *WASI) sockCall(fd uint32) Errno {
+	if _, errno := w.fds.get(fd); errno != ErrnoSuccess {
+		return errno
+	}
+	return ErrnoNotsock
+}
+
+func (w *WASI) sockAccept(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	return w.sockCall(u32(params[0]))
+}
+
+func (w *WASI) sockRecv(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	return w.sockCall(u32(params[0]))
+}
+
+func (w *WASI) sockSend(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	return w.sockCall(u32(params[0]))
+}
+
+func (w *WASI) sockShutdown(vm *exec.VirtualMachine, mem memory, params []int64) Errno {
+	return w.sockCall(u32(params[0]))
+}
@@ -0,0 +1,116 @@
+package wasi
+
+import (
+	"testing"
+
+	"github.com/perlin-network/life/wasi/vfs"
+)
+
+// newTestWASI returns a WASI environment with an in-memory file system
+// holding the file "in.txt" preopened at fd 3, and a guest memory.
+func newTestWASI(t *testing.T) (*WASI, memory) {
+	t.Helper()
+	fs := vfs.NewMemFS()
+	if err := vfs.WriteFile(fs, "in.txt", []byte("input data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := New(Config{Mounts: []vfs.Mount{{Path: "/sandbox", FS: fs}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w, make(memory, 4096)
+}
+
+// Layout of the guest memory used by the tests.
+const (
+	testPath  = 0    // path passed to path_* calls
+	testIovec = 512  // single iovec
+	testBuf   = 1024 // buffer the iovec points to
+	testOut   = 2048 // result pointer
+)
+
+// testPathOpen opens name relative to dirFD with the given rights.
+func (w *WASI) testPathOpen(mem memory, dirFD uint32, name string, oflags uint16, base, inheriting uint64) (uint32, Errno) {
+	copy(mem[testPath:], name)
+	errno := w.pathOpen(nil, mem, []int64{int64(dirFD), 0, testPath, int64(len(name)), int64(oflags), int64(base), int64(inheriting), 0, testOut})
+	return mem.uint32(testOut), errno
+}
+
+// testIO calls fd_read or fd_write on fd with a single iovec of n bytes.
+func testIO(call syscallFunc, mem memory, fd uint32, n uint32) Errno {
+	mem.putUint32(testIovec, testBuf)
+	mem.putUint32(testIovec+4, n)
+	return call(nil, mem, []int64{int64(fd), testIovec, 1, testOut})
+}
+
+func TestFdRights(t *testing.T) {
+	w, mem := newTestWASI(t)
+
+	fd, errno := w.testPathOpen(mem, 3, "in.txt", 0, rightFdRead, 0)
+	if errno != ErrnoSuccess {
+		t.Fatalf("path_open: %v", errno)
+	}
+	if errno := testIO(w.fdRead, mem, fd, 5); errno != ErrnoSuccess {
+		t.Fatalf("fd_read: %v", errno)
+	}
+	if got := mem.string(testBuf, mem.uint32(testOut)); got != "input" {
+		t.Fatalf("read %q", got)
+	}
+
+	if errno := testIO(w.fdWrite, mem, fd, 5); errno != ErrnoNotcapable {
+		t.Fatalf("fd_write without the right: %v", errno)
+	}
+	if errno := w.fdSeek(nil, mem, []int64{int64(fd), 0, int64(whenceSet), testOut}); errno != ErrnoNotcapable {
+		t.Fatalf("fd_seek without the right: %v", errno)
+	}
+
+	// Rights may only be dropped.
+	if errno := w.fdFdstatSetRights(nil, mem, []int64{int64(fd), int64(rightFdRead | rightFdWrite), 0}); errno != ErrnoNotcapable {
+		t.Fatalf("fd_fdstat_set_rights: %v", errno)
+	}
+	if errno := w.fdFdstatSetRights(nil, mem, []int64{int64(fd), 0, 0}); errno != ErrnoSuccess {
+		t.Fatalf("fd_fdstat_set_rights: %v", errno)
+	}
+	if errno := testIO(w.fdRead, mem, fd, 5); errno != ErrnoNotcapable {
+		t.Fatalf("fd_read after dropping the right: %v", errno)
+	}
+}
+
+func TestPathRights(t *testing.T) {
+	w, mem := newTestWASI(t)
+
+	if errno := w.fdFdstatSetRights(nil, mem, []int64{3, int64(rightsDirectory &^ (rightPathOpen | rightPathCreateDirectory)), int64(rightFdRead)}); errno != ErrnoSuccess {
+		t.Fatalf("fd_fdstat_set_rights: %v", errno)
+	}
+
+	if _, errno := w.testPathOpen(mem, 3, "in.txt", 0, rightFdRead, 0); errno != ErrnoNotcapable {
+		t.Fatalf("path_open without the right: %v", errno)
+	}
+
+	copy(mem[testPath:], "dir")
+	if errno := w.pathCreateDirectory(nil, mem, []int64{3, testPath, 3}); errno != ErrnoNotcapable {
+		t.Fatalf("path_create_directory without the right: %v", errno)
+	}
+
+	// The rights of opened files are limited to the inheriting rights of
+	// their directory.
+	w, mem = newTestWASI(t)
+	if errno := w.fdFdstatSetRights(nil, mem, []int64{3, int64(rightPathOpen), int64(rightFdRead)}); errno != ErrnoSuccess {
+		t.Fatalf("fd_fdstat_set_rights: %v", errno)
+	}
+	fd, errno := w.testPathOpen(mem, 3, "in.txt", 0, rightFdRead|rightFdWrite, rightFdRead|rightFdWrite)
+	if errno != ErrnoSuccess {
+		t.Fatalf("path_open: %v", errno)
+	}
+	if e := w.fds.entries[fd]; e.rightsBase != rightFdRead || e.rightsInheriting != rightFdRead {
+		t.Fatalf("opened with rights %#x, inheriting %#x", e.rightsBase, e.rightsInheriting)
+	}
+	if errno := testIO(w.fdWrite, mem, fd, 1); errno != ErrnoNotcapable {
+		t.Fatalf("fd_write without the right: %v", errno)
+	}
+
+	if _, errno := w.testPathOpen(mem, 3, "new.txt", oflagCreat, rightFdRead, 0); errno != ErrnoNotcapable {
+		t.Fatalf("path_open creating a file without the right: %v", errno)
+	}
+}
@@ -0,0 +1,174 @@
+package wasi
+
+import (
+	"io"
+	"os"
+	"sort"
+
+	"github.com/perlin-network/life/wasi/vfs"
+)
+
+// file is an open file description backing a WASI file descriptor.
+type file interface {
+	io.Reader
+	io.Writer
+	io.Seeker
+	io.Closer
+}
+
+// fileEntry is a single slot in the file descriptor table.
+type fileEntry struct {
+	file     file       // nil for directories
+	mount    *vfs.Mount // file system of files and directories opened via path_open
+	path     string     // name of the file or directory within the mount
+	fileType uint8
+	fdFlags  uint16
+
+	rightsBase       uint64
+	rightsInheriting uint64
+
+	// Set for preopened directories only.
+	preopenPath string
+}
+
+func (e *fileEntry) isDir() bool {
+	return e.fileType == filetypeDirectory
+}
+
+// fdTable maps WASI file descriptors to open files.
+type fdTable struct {
+	entries map[uint32]*fileEntry
+}
+
+func newFDTable() *fdTable {
+	return &fdTable{
+		entries: make(map[uint32]*fileEntry),
+	}
+}
+
+// insert places the entry at the lowest unused file descriptor.
+func (t *fdTable) insert(e *fileEntry) uint32 {
+	fd := uint32(0)
+	for {
+		if _, ok := t.entries[fd]; !ok {
+			t.entries[fd] = e
+			return fd
+		}
+		fd++
+	}
+}
+
+func (t *fdTable) get(fd uint32) (*fileEntry, Errno) {
+	e, ok := t.entries[fd]
+	if !ok {
+		return nil, ErrnoBadf
+	}
+	return e, ErrnoSuccess
+}
+
+// getWithRights is like get, but fails with ErrnoNotcapable unless the file
+// descriptor holds all the given rights.
+func (t *fdTable) getWithRights(fd uint32, rights uint64) (*fileEntry, Errno) {
+	e, errno := t.get(fd)
+	if errno != ErrnoSuccess {
+		return nil, errno
+	}
+	if e.rightsBase&rights != rights {
+		return nil, ErrnoNotcapable
+	}
+	return e, ErrnoSuccess
+}
+
+func (t *fdTable) close(fd uint32) Errno {
+	e, ok := t.entries[fd]
+	if !ok {
+		return ErrnoBadf
+	}
+	delete(t.entries, fd)
+	if e.file != nil {
+		if err := e.file.Close(); err != nil {
+			return errnoOf(err)
+		}
+	}
+	return ErrnoSuccess
+}
+
+func (t *fdTable) closeAll() {
+	fds := make([]int, 0, len(t.entries))
+	for fd := range t.entries {
+		fds = append(fds, int(fd))
+	}
+	sort.Ints(fds)
+
+	for _, fd := range fds {
+		t.close(uint32(fd))
+	}
+}
+
+// readerFile adapts an io.Reader into a non-seekable, read-only file.
+type readerFile struct {
+	r io.Reader
+}
+
+func (f *readerFile) Read(p []byte) (int, error) {
+	if f.r == nil {
+		return 0, io.EOF
+	}
+	return f.r.Read(p)
+}
+
+func (f *readerFile) Write(p []byte) (int, error) {
+	return 0, ErrnoBadf
+}
+
+func (f *readerFile) Seek(offset int64, whence int) (int64, error) {
+	return 0, ErrnoSpipe
+}
+
+func (f *readerFile) Close() error {
+	return nil
+}
+
+// writerFile adapts an io.Writer into a non-seekable, write-only file.
+type writerFile struct {
+	w io.Writer
+}
+
+func (f *writerFile) Read(p []byte) (int, error) {
+	return 0, ErrnoBadf
+}
+
+func (f *writerFile) Write(p []byte) (int, error) {
+	if f.w == nil {
+		return len(p), nil
+	}
+	return f.w.Write(p)
+}
+
+func (f *writerFile) Seek(offset int64, whence int) (int64, error) {
+	return 0, ErrnoSpipe
+}
+
+func (f *writerFile) Close() error {
+	return nil
+}
+
+// fileTypeOf converts a file mode into a WASI file type.
+func fileTypeOf(mode os.FileMode) uint8 {
+	switch {
+	case mode.IsRegular():
+		return filetypeRegularFile
+	case mode.IsDir():
+		return filetypeDirectory
+	case mode&os.ModeSymlink != 0:
+		return filetypeSymbolicLink
+	case mode&os.ModeCharDevice != 0:
+		return filetypeCharacterDevice
+	case mode&os.ModeDevice != 0:
+		return filetypeBlockDevice
+	case mode&os.ModeSocket != 0:
+		return filetypeSocketStream
+	default:
+		return filetypeUnknown
+	}
+}
@@ -0,0 +1,80 @@
+package wasi
+
+import "encoding/binary"
+
+var le = binary.LittleEndian
+
+type faultError struct{}
+
+// errFault is panicked by memory accessors when the guest passes a pointer
+// outside of its linear memory. It is turned into ErrnoFault by the syscall
+// wrapper.
+var errFault = faultError{}
+
+// memory provides bounds-checked little-endian access to a linear memory.
+type memory []byte
+
+func (m memory) slice(ptr, n uint32) []byte {
+	end := uint64(ptr) + uint64(n)
+	if end > uint64(len(m)) {
+		panic(errFault)
+	}
+	return m[ptr:end]
+}
+
+func (m memory) uint32(ptr uint32) uint32 {
+	return le.Uint32(m.slice(ptr, 4))
+}
+
+func (m memory) uint64(ptr uint32) uint64 {
+	return le.Uint64(m.slice(ptr, 8))
+}
+
+func (m memory) uint16(ptr uint32) uint16 {
+	return le.Uint16(m.slice(ptr, 2))
+}
+
+func (m memory) uint8(ptr uint32) uint8 {
+	return m.slice(ptr, 1)[0]
+}
+
+func (m memory) putUint64(ptr uint32, v uint64) {
+	le.PutUint64(m.slice(ptr, 8), v)
+}
+
+func (m memory) putUint32(ptr uint32, v uint32) {
+	le.PutUint32(m.slice(ptr, 4), v)
+}
+
+func (m memory) putUint16(ptr uint32, v uint16) {
+	le.PutUint16(m.slice(ptr, 2), v)
+}
+
+func (m memory) putUint8(ptr uint32, v uint8) {
+	m.slice(ptr, 1)[0] = v
+}
+
+func (m memory) string(ptr, n uint32) string {
+	return string(m.slice(ptr, n))
+}
+
+// array bounds checks an array of `n` elements of `size` bytes each.
+func (m memory) array(ptr, n, size uint32) {
+	if uint64(ptr)+uint64(n)*uint64(size) > uint64(len(m)) {
+		panic(errFault)
+	}
+}
+
+// iovecs returns the buffers described by an array of `n` iovec/ciovec
+// structures located at `ptr`.
+func (m memory) iovecs(ptr, n uint32) [][]byte {
+	m.array(ptr, n, sizeIovec)
+
+	bufs := make([][]byte, n)
+	for i := uint32(0); i < n; i++ {
+		base := m.uint32(ptr + i*sizeIovec)
+		length := m.uint32(ptr + i*sizeIovec + 4)
+		bufs[i] = m.slice(base, length)
+	}
+	return bufs
+}
@@ -0,0 +1,147 @@
+package vfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var _ FS = (*HostFS)(nil)
+
+// HostFS is a read-only view of a directory on the host. Symbolic links may
+// not lead outside of the directory.
+type HostFS struct {
+	root string
+}
+
+// NewHostFS exposes the host directory `root` as a read-only file system.
+func NewHostFS(root string) (*HostFS, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err = filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return nil, pathError("open", root, ErrNotDir)
+	}
+
+	return &HostFS{root: root}, nil
+}
+
+// resolve converts a name into a host path. Unless `follow` is set, a final
+// symbolic link is not resolved and may point anywhere.
+func (h *HostFS) resolve(name string, follow bool) (string, error) {
+	elems, err := split(name)
+	if err != nil {
+		return "", err
+	}
+
+	if len(elems) == 0 {
+		return h.root, nil
+	}
+
+	hostPath := filepath.Join(h.root, filepath.FromSlash(strings.Join(elems, "/")))
+
+	check := hostPath
+	if !follow {
+		check = filepath.Dir(hostPath)
+	}
+
+	resolved, err := filepath.EvalSymlinks(check)
+	if err != nil {
+		return hostPath, nil // let the caller report the lookup failure
+	}
+
+	if resolved != h.root && !strings.HasPrefix(resolved, h.root+string(filepath.Separator)) {
+		return "", os.ErrPermission
+	}
+
+	return hostPath, nil
+}
+
+// OpenFile opens the named file for reading. Any flag that could modify the
+// file results in ErrReadOnly.
+func (h *HostFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if isWrite(flag) {
+		return nil, pathError("open", name, ErrReadOnly)
+	}
+
+	hostPath, err := h.resolve(name, true)
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+
+	f, err := os.Open(hostPath)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (h *HostFS) Stat(name string) (os.FileInfo, error) {
+	hostPath, err := h.resolve(name, true)
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+	return os.Stat(hostPath)
+}
+
+func (h *HostFS) Lstat(name string) (os.FileInfo, error) {
+	hostPath, err := h.resolve(name, false)
+	if err != nil {
+		return nil, pathError("lstat", name, err)
+	}
+	return os.Lstat(hostPath)
+}
+
+func (h *HostFS) ReadDir(name string) ([]os.FileInfo, error) {
+	hostPath, err := h.resolve(name, true)
+	if err != nil {
+		return nil, pathError("readdir", name, err)
+	}
+	return ioutil.ReadDir(hostPath)
+}
+
+func (h *HostFS) Readlink(name string) (string, error) {
+	hostPath, err := h.resolve(name, false)
+	if err != nil {
+		return "", pathError("readlink", name, err)
+	}
+	return os.Readlink(hostPath)
+}
+
+func (h *HostFS) Mkdir(name string, perm os.FileMode) error {
+	return pathError("mkdir", name, ErrReadOnly)
+}
+
+func (h *HostFS) Remove(name string) error {
+	return pathError("remove", name, ErrReadOnly)
+}
+
+func (h *HostFS) Rename(oldname, newname string) error {
+	return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: ErrReadOnly}
+}
+
+func (h *HostFS) Chtimes(name string, atime, mtime time.Time) error {
+	return pathError("chtimes", name, ErrReadOnly)
+}
+
+func (h *HostFS) Symlink(oldname, newname string) error {
+	return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: ErrReadOnly}
+}
+
+func (h *HostFS) Link(oldname, newname string) error {
+	return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: ErrReadOnly}
+}
@@ -0,0 +1,60 @@
+package vfs
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHostFS(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	if err := os.MkdirAll(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "sub", "f.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "secret"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("sub/f.txt", filepath.Join(root, "inside")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../secret", filepath.Join(root, "outside")); err != nil {
+		t.Fatal(err)
+	}
+
+	fs, err := NewHostFS(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data, err := ReadFile(fs, "inside"); err != nil || string(data) != "hello" {
+		t.Fatalf("read %q, %v", data, err)
+	}
+	if infos, err := fs.ReadDir("sub"); err != nil || len(infos) != 1 || infos[0].Name() != "f.txt" {
+		t.Fatalf("listed %v, %v", infos, err)
+	}
+
+	// Symbolic links may not lead outside of the root, but may be read.
+	if _, err := ReadFile(fs, "outside"); !os.IsPermission(err) {
+		t.Errorf("reading through an escaping symbolic link: %v", err)
+	}
+	if target, err := fs.Readlink("outside"); err != nil || target != "../secret" {
+		t.Errorf("readlink %q, %v", target, err)
+	}
+	if _, err := ReadFile(fs, "../secret"); !os.IsNotExist(err) {
+		t.Errorf("reading above the root: %v", err)
+	}
+
+	if err := WriteFile(fs, "new.txt", nil, 0644); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("writing a file: %v", err)
+	}
+
+	if _, err := NewHostFS(filepath.Join(dir, "secret")); !errors.Is(err, ErrNotDir) {
+		t.Errorf("rooting at a file: %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package vfs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+)
+
+// ioFS adapts an fs.FS into a read-only FS.
+type ioFS struct {
+	fsys fs.FS
+}
+
+// FromFS exposes an fs.FS, such as an embed.FS or an archive, as a read-only
+// file system. Files that do not implement io.Seeker or io.ReaderAt report
+// ErrNotSupported for the corresponding operations.
+func FromFS(fsys fs.FS) FS {
+	return &ioFS{fsys: fsys}
+}
+
+// ioName converts a name into the form expected by fs.FS.
+func ioName(name string) (string, error) {
+	elems, err := split(name)
+	if err != nil {
+		return "", err
+	}
+
+	if len(elems) == 0 {
+		return ".", nil
+	}
+	return strings.Join(elems, "/"), nil
+}
+
+func (i *ioFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if isWrite(flag) {
+		return nil, pathError("open", name, ErrReadOnly)
+	}
+
+	ioPath, err := ioName(name)
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+
+	f, err := i.fsys.Open(ioPath)
+	if err != nil {
+		return nil, err
+	}
+	return &ioFile{File: f, name: name}, nil
+}
+
+func (i *ioFS) Stat(name string) (os.FileInfo, error) {
+	ioPath, err := ioName(name)
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+	return fs.Stat(i.fsys, ioPath)
+}
+
+// Lstat is the same as Stat as fs.FS does not expose symbolic links.
+func (i *ioFS) Lstat(name string) (os.FileInfo, error) {
+	return i.Stat(name)
+}
+
+func (i *ioFS) ReadDir(name string) ([]os.FileInfo, error) {
+	ioPath, err := ioName(name)
+	if err != nil {
+		return nil, pathError("readdir", name, err)
+	}
+
+	entries, err := fs.ReadDir(i.fsys, ioPath)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]os.FileInfo, len(entries))
+	for j, entry := range entries {
+		if infos[j], err = entry.Info(); err != nil {
+			return nil, err
+		}
+	}
+	return infos, nil
+}
+
+func (i *ioFS) Readlink(name string) (string, error) {
+	return "", pathError("readlink", name, os.ErrInvalid)
+}
+
+func (i *ioFS) Mkdir(name string, perm os.FileMode) error {
+	return pathError("mkdir", name, ErrReadOnly)
+}
+
+func (i *ioFS) Remove(name string) error {
+	return pathError("remove", name, ErrReadOnly)
+}
+
+func (i *ioFS) Rename(oldname, newname string) error {
+	return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: ErrReadOnly}
+}
+
+func (i *ioFS) Chtimes(name string, atime, mtime time.Time) error {
+	return pathError("chtimes", name, ErrReadOnly)
+}
+
+func (i *ioFS) Symlink(oldname, newname string) error {
+	return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: ErrReadOnly}
+}
+
+func (i *ioFS) Link(oldname, newname string) error {
+	return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: ErrReadOnly}
+}
+
+// ioFile adapts an fs.File into a read-only File.
+type ioFile struct {
+	fs.File
+	name string
+}
+
+func (f *ioFile) Write(p []byte) (int, error) {
+	return 0, pathError("write", f.name, ErrReadOnly)
+}
+
+func (f *ioFile) WriteAt(p []byte, off int64) (int, error) {
+	return 0, pathError("write", f.name, ErrReadOnly)
+}
+
+func (f *ioFile) Truncate(size int64) error {
+	return pathError("truncate", f.name, ErrReadOnly)
+}
+
+func (f *ioFile) Seek(offset int64, whence int) (int64, error) {
+	if s, ok := f.File.(io.Seeker); ok {
+		return s.Seek(offset, whence)
+	}
+	return 0, pathError("seek", f.name, ErrNotSupported)
+}
+
+func (f *ioFile) ReadAt(p []byte, off int64) (int, error) {
+	if r, ok := f.File.(io.ReaderAt); ok {
+		return r.ReadAt(p, off)
+	}
+	return 0, pathError("read", f.name, ErrNotSupported)
+}
+
+func (f *ioFile) Sync() error {
+	return nil
+}
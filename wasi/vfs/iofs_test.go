@@ -0,0 +1,48 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFromFS(t *testing.T) {
+	fs := FromFS(fstest.MapFS{
+		"dir/f.txt": {Data: []byte("hello")},
+	})
+
+	f, err := fs.OpenFile("/dir/../dir/f.txt", os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	buf := make([]byte, 3)
+	if _, err := f.ReadAt(buf, 2); err != nil || string(buf) != "llo" {
+		t.Fatalf("read %q, %v", buf, err)
+	}
+	if pos, err := f.Seek(1, io.SeekStart); err != nil || pos != 1 {
+		t.Fatalf("seeked to %d, %v", pos, err)
+	}
+	if info, err := fs.Stat("dir"); err != nil || !info.IsDir() {
+		t.Fatalf("stat %v, %v", info, err)
+	}
+	if infos, err := fs.ReadDir("."); err != nil || len(infos) != 1 || infos[0].Name() != "dir" {
+		t.Fatalf("listed %v, %v", infos, err)
+	}
+
+	if _, err := f.Write([]byte("x")); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("writing: %v", err)
+	}
+	if _, err := fs.OpenFile("dir/f.txt", os.O_RDWR, 0); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("opening for writing: %v", err)
+	}
+	if err := fs.Mkdir("new", 0755); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("creating a directory: %v", err)
+	}
+	if _, err := fs.OpenFile("missing", os.O_RDONLY, 0); !os.IsNotExist(err) {
+		t.Errorf("opening a missing file: %v", err)
+	}
+}
@@ -0,0 +1,627 @@
+package vfs
+
+import (
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxSymlinks bounds the number of symbolic links followed by a single lookup.
+const maxSymlinks = 40
+
+var _ FS = (*MemFS)(nil)
+
+// memNode is a file, directory or symbolic link of a MemFS. Hard links share
+// the same node.
+type memNode struct {
+	mode     os.FileMode
+	modTime  time.Time
+	data     []byte              // regular files only
+	children map[string]*memNode // directories only
+	target   string              // symbolic links only
+}
+
+func (n *memNode) isDir() bool {
+	return n.mode.IsDir()
+}
+
+func (n *memNode) isSymlink() bool {
+	return n.mode&os.ModeSymlink != 0
+}
+
+func (n *memNode) info(name string) os.FileInfo {
+	size := int64(len(n.data))
+	if n.isSymlink() {
+		size = int64(len(n.target))
+	}
+
+	return &fileInfo{
+		name:    name,
+		size:    size,
+		mode:    n.mode,
+		modTime: n.modTime,
+	}
+}
+
+// MemFS is a writable file system held entirely in memory. Symbolic links are
+// resolved within the file system, with absolute targets interpreted relative
+// to its root. A MemFS is safe for concurrent use.
+type MemFS struct {
+	mu   sync.Mutex
+	root *memNode
+}
+
+// NewMemFS creates an empty in-memory file system.
+func NewMemFS() *MemFS {
+	return &MemFS{
+		root: &memNode{
+			mode:     os.ModeDir | 0755,
+			modTime:  time.Now(),
+			children: make(map[string]*memNode),
+		},
+	}
+}
+
+// walk resolves path elements into a node. Symbolic links are followed in all
+// elements but the last one, which is only followed if `follow` is set.
+func (m *MemFS) walk(elems []string, follow bool) (*memNode, error) {
+	node := m.root
+	links := 0
+
+	for i := 0; i < len(elems); i++ {
+		if !node.isDir() {
+			return nil, ErrNotDir
+		}
+
+		child, ok := node.children[elems[i]]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+
+		if child.isSymlink() && (follow || i < len(elems)-1) {
+			links++
+			if links > maxSymlinks {
+				return nil, ErrLoop
+			}
+
+			// Restart from the root with the link substituted. Cleaning
+			// the new path keeps ".." from climbing above the root.
+			target := child.target
+			if !path.IsAbs(target) {
+				target = path.Join(strings.Join(elems[:i], "/"), target)
+			}
+			elems, _ = split(path.Join(target, strings.Join(elems[i+1:], "/")))
+			node = m.root
+			i = -1
+			continue
+		}
+
+		node = child
+	}
+
+	return node, nil
+}
+
+func (m *MemFS) lookup(name string, follow bool) (*memNode, error) {
+	elems, err := split(name)
+	if err != nil {
+		return nil, err
+	}
+	return m.walk(elems, follow)
+}
+
+// parent resolves the directory containing the named entry, returning it along
+// with the base name of the entry. The root has no parent.
+func (m *MemFS) parent(name string) (*memNode, string, error) {
+	elems, err := split(name)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(elems) == 0 {
+		return nil, "", os.ErrInvalid
+	}
+
+	dir, err := m.walk(elems[:len(elems)-1], true)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !dir.isDir() {
+		return nil, "", ErrNotDir
+	}
+
+	return dir, elems[len(elems)-1], nil
+}
+
+// OpenFile opens the named file, creating it with mode `perm` if O_CREATE is set.
+func (m *MemFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, err := m.lookup(name, true)
+	switch {
+	case err == os.ErrNotExist && flag&os.O_CREATE != 0:
+		dir, base, err := m.parent(name)
+		if err != nil {
+			return nil, pathError("open", name, err)
+		}
+
+		if _, ok := dir.children[base]; ok {
+			return nil, pathError("open", name, os.ErrNotExist) // dangling symbolic link
+		}
+
+		now := time.Now()
+		node = &memNode{mode: perm.Perm(), modTime: now}
+		dir.children[base] = node
+		dir.modTime = now
+	case err != nil:
+		return nil, pathError("open", name, err)
+	case flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, pathError("open", name, os.ErrExist)
+	case node.isDir() && isWrite(flag):
+		return nil, pathError("open", name, ErrIsDir)
+	case flag&os.O_TRUNC != 0:
+		node.data = nil
+		node.modTime = time.Now()
+	}
+
+	return &memFile{fs: m, node: node, name: name, flag: flag}, nil
+}
+
+// Stat returns information about the named file, following symbolic links.
+func (m *MemFS) Stat(name string) (os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, err := m.lookup(name, true)
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+	return node.info(path.Base(name)), nil
+}
+
+// Lstat returns information about the named file without following a final
+// symbolic link.
+func (m *MemFS) Lstat(name string) (os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, err := m.lookup(name, false)
+	if err != nil {
+		return nil, pathError("lstat", name, err)
+	}
+	return node.info(path.Base(name)), nil
+}
+
+// ReadDir lists the named directory sorted by file name.
+func (m *MemFS) ReadDir(name string) ([]os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, err := m.lookup(name, true)
+	if err != nil {
+		return nil, pathError("readdir", name, err)
+	}
+
+	if !node.isDir() {
+		return nil, pathError("readdir", name, ErrNotDir)
+	}
+
+	infos := make([]os.FileInfo, 0, len(node.children))
+	for childName, child := range node.children {
+		infos = append(infos, child.info(childName))
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+
+	return infos, nil
+}
+
+// Mkdir creates the named directory.
+func (m *MemFS) Mkdir(name string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dir, base, err := m.parent(name)
+	if err == os.ErrInvalid {
+		err = os.ErrExist // the root always exists
+	}
+	if err != nil {
+		return pathError("mkdir", name, err)
+	}
+
+	if _, ok := dir.children[base]; ok {
+		return pathError("mkdir", name, os.ErrExist)
+	}
+
+	now := time.Now()
+	dir.children[base] = &memNode{
+		mode:     os.ModeDir | perm.Perm(),
+		modTime:  now,
+		children: make(map[string]*memNode),
+	}
+	dir.modTime = now
+	return nil
+}
+
+// Remove removes the named file or empty directory.
+func (m *MemFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dir, base, err := m.parent(name)
+	if err != nil {
+		return pathError("remove", name, err)
+	}
+
+	node, ok := dir.children[base]
+	if !ok {
+		return pathError("remove", name, os.ErrNotExist)
+	}
+
+	if node.isDir() && len(node.children) != 0 {
+		return pathError("remove", name, ErrNotEmpty)
+	}
+
+	delete(dir.children, base)
+	dir.modTime = time.Now()
+	return nil
+}
+
+// contains tells whether `target` is `dir` or one of its descendants.
+func contains(dir, target *memNode) bool {
+	if dir == target {
+		return true
+	}
+	for _, child := range dir.children {
+		if child.isDir() && contains(child, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Rename moves a file or directory, replacing an existing entry at the
+// destination if their types are compatible.
+func (m *MemFS) Rename(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	oldDir, oldBase, err := m.parent(oldname)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+
+	newDir, newBase, err := m.parent(newname)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+
+	node, ok := oldDir.children[oldBase]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrNotExist}
+	}
+
+	if existing, ok := newDir.children[newBase]; ok {
+		if existing == node {
+			return nil
+		}
+
+		switch {
+		case node.isDir() && !existing.isDir():
+			err = ErrNotDir
+		case !node.isDir() && existing.isDir():
+			err = ErrIsDir
+		case existing.isDir() && len(existing.children) != 0:
+			err = ErrNotEmpty
+		}
+	}
+
+	if err == nil && node.isDir() && contains(node, newDir) {
+		err = os.ErrInvalid // a directory cannot be moved into itself
+	}
+
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+
+	now := time.Now()
+	delete(oldDir.children, oldBase)
+	newDir.children[newBase] = node
+	oldDir.modTime = now
+	newDir.modTime = now
+	return nil
+}
+
+// Chtimes changes the modification time of the named file. Access times are
+// not tracked.
+func (m *MemFS) Chtimes(name string, atime, mtime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, err := m.lookup(name, true)
+	if err != nil {
+		return pathError("chtimes", name, err)
+	}
+
+	node.modTime = mtime
+	return nil
+}
+
+// Symlink creates `newname` as a symbolic link to `oldname`.
+func (m *MemFS) Symlink(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dir, base, err := m.parent(newname)
+	if err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+	}
+
+	if _, ok := dir.children[base]; ok {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: os.ErrExist}
+	}
+
+	now := time.Now()
+	dir.children[base] = &memNode{
+		mode:    os.ModeSymlink | 0777,
+		modTime: now,
+		target:  oldname,
+	}
+	dir.modTime = now
+	return nil
+}
+
+// Readlink returns the target of the named symbolic link.
+func (m *MemFS) Readlink(name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, err := m.lookup(name, false)
+	if err != nil {
+		return "", pathError("readlink", name, err)
+	}
+
+	if !node.isSymlink() {
+		return "", pathError("readlink", name, os.ErrInvalid)
+	}
+	return node.target, nil
+}
+
+// Link creates `newname` as a hard link to the file `oldname`.
+func (m *MemFS) Link(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, err := m.lookup(oldname, false)
+	if err == nil && node.isDir() {
+		err = os.ErrPermission
+	}
+	if err != nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: err}
+	}
+
+	dir, base, err := m.parent(newname)
+	if err != nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: err}
+	}
+
+	if _, ok := dir.children[base]; ok {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: os.ErrExist}
+	}
+
+	dir.children[base] = node
+	dir.modTime = time.Now()
+	return nil
+}
+
+// memFile is an open file of a MemFS.
+type memFile struct {
+	fs     *MemFS
+	node   *memNode
+	name   string
+	flag   int
+	pos    int64
+	closed bool
+}
+
+// check validates that the file may be read or written to.
+func (f *memFile) check(op string, write bool) error {
+	switch {
+	case f.closed:
+		return pathError(op, f.name, os.ErrClosed)
+	case f.node.isDir():
+		return pathError(op, f.name, ErrIsDir)
+	case write && f.flag&(os.O_WRONLY|os.O_RDWR) == 0:
+		return pathError(op, f.name, os.ErrPermission)
+	case !write && f.flag&os.O_WRONLY != 0:
+		return pathError(op, f.name, os.ErrPermission)
+	}
+	return nil
+}
+
+func (f *memFile) readAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, f.node.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) writeAt(p []byte, off int64) int {
+	end := off + int64(len(p))
+	if size := int64(len(f.node.data)); end > size {
+		if end > int64(cap(f.node.data)) {
+			data := make([]byte, end, end*2)
+			copy(data, f.node.data)
+			f.node.data = data
+		} else {
+			// Spare capacity may hold stale bytes from before a truncation.
+			f.node.data = f.node.data[:end]
+			for i := size; i < end; i++ {
+				f.node.data[i] = 0
+			}
+		}
+	}
+
+	f.node.modTime = time.Now()
+	return copy(f.node.data[off:], p)
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("read", false); err != nil {
+		return 0, err
+	}
+
+	n, err := f.readAt(p, f.pos)
+	f.pos += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("read", false); err != nil {
+		return 0, err
+	}
+
+	if off < 0 {
+		return 0, pathError("read", f.name, os.ErrInvalid)
+	}
+	return f.readAt(p, off)
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("write", true); err != nil {
+		return 0, err
+	}
+
+	if f.flag&os.O_APPEND != 0 {
+		f.pos = int64(len(f.node.data))
+	}
+
+	n := f.writeAt(p, f.pos)
+	f.pos += int64(n)
+	return n, nil
+}
+
+func (f *memFile) WriteAt(p []byte, off int64) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("write", true); err != nil {
+		return 0, err
+	}
+
+	if off < 0 {
+		return 0, pathError("write", f.name, os.ErrInvalid)
+	}
+	return f.writeAt(p, off), nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return 0, pathError("seek", f.name, os.ErrClosed)
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.pos
+	case io.SeekEnd:
+		offset += int64(len(f.node.data))
+	default:
+		return 0, pathError("seek", f.name, os.ErrInvalid)
+	}
+
+	if offset < 0 {
+		return 0, pathError("seek", f.name, os.ErrInvalid)
+	}
+
+	f.pos = offset
+	return offset, nil
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return nil, pathError("stat", f.name, os.ErrClosed)
+	}
+	return f.node.info(path.Base(f.name)), nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("truncate", true); err != nil {
+		return err
+	}
+
+	if size < 0 {
+		return pathError("truncate", f.name, os.ErrInvalid)
+	}
+
+	if size > int64(len(f.node.data)) {
+		f.writeAt(make([]byte, size-int64(len(f.node.data))), int64(len(f.node.data)))
+	} else {
+		f.node.data = f.node.data[:size]
+		f.node.modTime = time.Now()
+	}
+	return nil
+}
+
+func (f *memFile) Sync() error {
+	return nil
+}
+
+func (f *memFile) Close() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return pathError("close", f.name, os.ErrClosed)
+	}
+	f.closed = true
+	return nil
+}
+
+// fileInfo is a snapshot of the metadata of a file.
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *fileInfo) Sys() interface{}   { return nil }
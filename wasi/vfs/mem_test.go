@@ -0,0 +1,86 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestMemFS(t *testing.T) {
+	fs := NewMemFS()
+	if err := MkdirAll(fs, "a/b", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(fs, "a/b/f.txt", []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Symlink("b/f.txt", "a/link"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ReadFile(fs, "a/link")
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("read %q, %v", data, err)
+	}
+
+	f, err := fs.OpenFile("a/b/f.txt", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("J"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("!")); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if data, _ := ReadFile(fs, "a/b/f.txt"); string(data) != "Jello!" {
+		t.Fatalf("read %q", data)
+	}
+
+	if err := fs.Rename("a/b/f.txt", "g.txt"); err != nil {
+		t.Fatal(err)
+	}
+	infos, err := fs.ReadDir(".")
+	if err != nil || len(infos) != 2 || infos[0].Name() != "a" || infos[1].Name() != "g.txt" {
+		t.Fatalf("listed %v, %v", infos, err)
+	}
+}
+
+func TestMemFSErrors(t *testing.T) {
+	fs := NewMemFS()
+	if err := MkdirAll(fs, "a/b", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Symlink("loop", "loop"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fs.OpenFile("missing", os.O_RDONLY, 0); !os.IsNotExist(err) {
+		t.Errorf("opening a missing file: %v", err)
+	}
+	if _, err := fs.OpenFile("a", os.O_WRONLY, 0); !errors.Is(err, ErrIsDir) {
+		t.Errorf("opening a directory for writing: %v", err)
+	}
+	if err := fs.Remove("a"); !errors.Is(err, ErrNotEmpty) {
+		t.Errorf("removing a non-empty directory: %v", err)
+	}
+	if _, err := fs.Stat("loop"); !errors.Is(err, ErrLoop) {
+		t.Errorf("following a symbolic link loop: %v", err)
+	}
+	if err := fs.Mkdir("a", 0755); !os.IsExist(err) {
+		t.Errorf("creating an existing directory: %v", err)
+	}
+
+	// Names are confined to the file system.
+	if err := WriteFile(fs, "../../escaped", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat("escaped"); err != nil {
+		t.Errorf("file written above the root: %v", err)
+	}
+}
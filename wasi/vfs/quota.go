@@ -0,0 +1,112 @@
+package vfs
+
+import (
+	"os"
+	"sync"
+)
+
+// QuotaFS limits the total number of bytes written to an underlying file
+// system. Writes are accounted for cumulatively: removing or truncating files
+// does not give back any quota.
+type QuotaFS struct {
+	FS
+
+	mu    sync.Mutex
+	limit int64
+	used  int64
+}
+
+// NewQuotaFS wraps a file system so that at most `limit` bytes may be written
+// to it. Writes beyond the limit fail with ErrQuotaExceeded.
+func NewQuotaFS(fsys FS, limit int64) *QuotaFS {
+	return &QuotaFS{
+		FS:    fsys,
+		limit: limit,
+	}
+}
+
+// Used returns the number of bytes written so far.
+func (q *QuotaFS) Used() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.used
+}
+
+// reserve accounts for `n` bytes about to be written.
+func (q *QuotaFS) reserve(n int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.used+n > q.limit {
+		return ErrQuotaExceeded
+	}
+	q.used += n
+	return nil
+}
+
+// release gives back bytes that were reserved but not written.
+func (q *QuotaFS) release(n int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.used -= n
+}
+
+func (q *QuotaFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := q.FS.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &quotaFile{File: f, quota: q, name: name}, nil
+}
+
+// quotaFile charges writes to the quota of a QuotaFS.
+type quotaFile struct {
+	File
+	quota *QuotaFS
+	name  string
+}
+
+func (f *quotaFile) Write(p []byte) (int, error) {
+	if err := f.quota.reserve(int64(len(p))); err != nil {
+		return 0, pathError("write", f.name, err)
+	}
+
+	n, err := f.File.Write(p)
+	f.quota.release(int64(len(p) - n))
+	return n, err
+}
+
+func (f *quotaFile) WriteAt(p []byte, off int64) (int, error) {
+	if err := f.quota.reserve(int64(len(p))); err != nil {
+		return 0, pathError("write", f.name, err)
+	}
+
+	n, err := f.File.WriteAt(p, off)
+	f.quota.release(int64(len(p) - n))
+	return n, err
+}
+
+// Truncate charges the bytes by which the file grows.
+func (f *quotaFile) Truncate(size int64) error {
+	info, err := f.File.Stat()
+	if err != nil {
+		return err
+	}
+
+	grow := size - info.Size()
+	if grow <= 0 {
+		return f.File.Truncate(size)
+	}
+
+	if err := f.quota.reserve(grow); err != nil {
+		return pathError("truncate", f.name, err)
+	}
+
+	if err := f.File.Truncate(size); err != nil {
+		f.quota.release(grow)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package vfs
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestQuotaFS(t *testing.T) {
+	q := NewQuotaFS(NewMemFS(), 10)
+
+	if err := WriteFile(q, "a", []byte("12345"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if q.Used() != 5 {
+		t.Fatalf("%d bytes used", q.Used())
+	}
+
+	// Writes are accounted for cumulatively, overwriting included.
+	f, err := q.OpenFile("a", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteAt([]byte("abc"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if q.Used() != 8 {
+		t.Fatalf("%d bytes used", q.Used())
+	}
+
+	// Shrinking is free, growing is charged.
+	if err := f.Truncate(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(3); err != nil {
+		t.Fatal(err)
+	}
+	if q.Used() != 10 {
+		t.Fatalf("%d bytes used", q.Used())
+	}
+
+	if _, err := f.Write([]byte("x")); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("writing beyond the quota: %v", err)
+	}
+	if err := f.Truncate(4); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("growing beyond the quota: %v", err)
+	}
+	if err := q.Remove("a"); err != nil {
+		t.Fatal(err)
+	}
+	if q.Used() != 10 {
+		t.Fatalf("removing a file gave back quota: %d bytes used", q.Used())
+	}
+}
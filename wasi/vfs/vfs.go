@@ -0,0 +1,143 @@
+// Package vfs provides the virtual file systems that back the file descriptors
+// of a WASI module.
+//
+// Names passed to a FS are slash-separated and relative to the root of the
+// file system, with "." denoting the root itself. Callers are expected to
+// clean names beforehand; names that escape the root are rejected.
+package vfs
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrReadOnly is returned for attempts to modify a read-only file system.
+	ErrReadOnly = errors.New("read-only file system")
+
+	// ErrNotDir is returned when a directory was expected.
+	ErrNotDir = errors.New("not a directory")
+
+	// ErrIsDir is returned when a directory was not expected.
+	ErrIsDir = errors.New("is a directory")
+
+	// ErrNotEmpty is returned when removing a non-empty directory.
+	ErrNotEmpty = errors.New("directory not empty")
+
+	// ErrLoop is returned when too many symbolic links were followed.
+	ErrLoop = errors.New("too many levels of symbolic links")
+
+	// ErrCrossDevice is returned when linking or renaming across file systems.
+	ErrCrossDevice = errors.New("cross-device link")
+
+	// ErrQuotaExceeded is returned when a write would exceed the quota of a QuotaFS.
+	ErrQuotaExceeded = errors.New("disk quota exceeded")
+
+	// ErrNotSupported is returned for operations a file system cannot perform.
+	ErrNotSupported = errors.New("operation not supported")
+)
+
+// FS is a hierarchical file system.
+type FS interface {
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+	Stat(name string) (os.FileInfo, error)
+	Lstat(name string) (os.FileInfo, error)
+	ReadDir(name string) ([]os.FileInfo, error)
+	Mkdir(name string, perm os.FileMode) error
+	Remove(name string) error
+	Rename(oldname, newname string) error
+	Chtimes(name string, atime, mtime time.Time) error
+	Symlink(oldname, newname string) error
+	Readlink(name string) (string, error)
+	Link(oldname, newname string) error
+}
+
+// File is an open file of a FS.
+type File interface {
+	io.Reader
+	io.Writer
+	io.Seeker
+	io.Closer
+	io.ReaderAt
+	io.WriterAt
+
+	Stat() (os.FileInfo, error)
+	Truncate(size int64) error
+	Sync() error
+}
+
+// Mount attaches a file system to a directory of the guest.
+type Mount struct {
+	Path string
+	FS   FS
+}
+
+// isWrite tells whether flags passed to OpenFile may modify a file.
+func isWrite(flag int) bool {
+	return flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0
+}
+
+// split cleans a name and splits it into its path elements. The root of the
+// file system has no elements.
+func split(name string) ([]string, error) {
+	name = path.Clean("/" + name)
+	if name == "/" {
+		return nil, nil
+	}
+	if strings.IndexByte(name, 0) != -1 {
+		return nil, os.ErrInvalid
+	}
+	return strings.Split(name[1:], "/"), nil
+}
+
+func pathError(op, name string, err error) error {
+	return &os.PathError{Op: op, Path: name, Err: err}
+}
+
+// ReadFile reads the whole named file.
+func ReadFile(fsys FS, name string) ([]byte, error) {
+	f, err := fsys.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ioutil.ReadAll(f)
+}
+
+// WriteFile writes data to the named file, creating it if necessary.
+func WriteFile(fsys FS, name string, data []byte, perm os.FileMode) error {
+	f, err := fsys.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// MkdirAll creates the named directory along with any missing parents.
+func MkdirAll(fsys FS, name string, perm os.FileMode) error {
+	elems, err := split(name)
+	if err != nil {
+		return err
+	}
+
+	for i := range elems {
+		dir := strings.Join(elems[:i+1], "/")
+		if err := fsys.Mkdir(dir, perm); err != nil {
+			if info, statErr := fsys.Stat(dir); statErr != nil || !info.IsDir() {
+				return err
+			}
+		}
+	}
+	return nil
+}
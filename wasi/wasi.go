@@ -0,0 +1,321 @@
+// Package wasi implements the WebAssembly System Interface (wasi_snapshot_preview1)
+// as an import resolver for modules executed with an exec.VirtualMachine.
+package wasi
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-interpreter/wagon/wasm"
+	"github.com/perlin-network/life/exec"
+	"github.com/perlin-network/life/wasi/vfs"
+)
+
+var _ exec.HostFunctionResolver = (*WASI)(nil)
+
+const (
+	i32 = wasm.ValueTypeI32
+	i64 = wasm.ValueTypeI64
+)
+
+// Config denotes the environment exposed to a WASI module.
+type Config struct {
+	// Args are the command-line arguments, including the program name.
+	Args []string
+
+	// Env holds environment variables in the form "KEY=value".
+	Env []string
+
+	// Stdin, Stdout and Stderr back file descriptors 0, 1 and 2. A nil reader
+	// behaves as an empty input and a nil writer discards all output.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Mounts are the file systems made available to the module as preopened
+	// directories, in the order of their file descriptors. Give each virtual
+	// machine its own mounts (and quotas) to keep them isolated.
+	Mounts []vfs.Mount
+
+	// Random is the source for random_get. Defaults to crypto/rand.
+	Random io.Reader
+
+	// Now returns the current wall-clock time. Defaults to time.Now.
+	Now func() time.Time
+
+	// Fallback resolves imports from modules other than wasi_snapshot_preview1.
+	Fallback exec.ImportResolver
+}
+
+// WASI is an exec.ImportResolver providing the wasi_snapshot_preview1 host
+// functions. A WASI instance holds per-process state such as the file
+// descriptor table and must not be shared between virtual machines.
+type WASI struct {
+	config Config
+	fds    *fdTable
+	start  time.Time
+	funcs  map[string]*exec.HostFunction
+}
+
+// New instantiates the WASI host environment with the given configuration.
+func New(config Config) (*WASI, error) {
+	if config.Random == nil {
+		config.Random = rand.Reader
+	}
+
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+
+	// File descriptors refer to mounts by pointer, so keep a private copy.
+	config.Mounts = append([]vfs.Mount(nil), config.Mounts...)
+
+	w := &WASI{
+		config: config,
+		fds:    newFDTable(),
+		start:  time.Now(),
+	}
+
+	w.fds.insert(&fileEntry{file: &readerFile{r: config.Stdin}, fileType: filetypeCharacterDevice, rightsBase: rightsStdio})
+	w.fds.insert(&fileEntry{file: &writerFile{w: config.Stdout}, fileType: filetypeCharacterDevice, rightsBase: rightsStdio})
+	w.fds.insert(&fileEntry{file: &writerFile{w: config.Stderr}, fileType: filetypeCharacterDevice, rightsBase: rightsStdio})
+
+	for i := range config.Mounts {
+		mount := &w.config.Mounts[i]
+
+		info, err := mount.FS.Stat(".")
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			return nil, fmt.Errorf("mount %s: root is not a directory", mount.Path)
+		}
+
+		w.fds.insert(&fileEntry{
+			mount:            mount,
+			path:             ".",
+			fileType:         filetypeDirectory,
+			rightsBase:       rightsDirectory,
+			rightsInheriting: rightsDirectory | rightsFile,
+			preopenPath:      mount.Path,
+		})
+	}
+
+	w.funcs = map[string]*exec.HostFunction{
+		"args_get":                w.syscall(w.argsGet, i32, i32),
+		"args_sizes_get":          w.syscall(w.argsSizesGet, i32, i32),
+		"environ_get":             w.syscall(w.environGet, i32, i32),
+		"environ_sizes_get":       w.syscall(w.environSizesGet, i32, i32),
+		"clock_res_get":           w.syscall(w.clockResGet, i32, i32),
+		"clock_time_get":          w.syscall(w.clockTimeGet, i32, i64, i32),
+		"fd_advise":               w.syscall(w.fdAdvise, i32, i64, i64, i32),
+		"fd_allocate":             w.syscall(w.fdAllocate, i32, i64, i64),
+		"fd_close":                w.syscall(w.fdClose, i32),
+		"fd_datasync":             w.syscall(w.fdDatasync, i32),
+		"fd_fdstat_get":           w.syscall(w.fdFdstatGet, i32, i32),
+		"fd_fdstat_set_flags":     w.syscall(w.fdFdstatSetFlags, i32, i32),
+		"fd_fdstat_set_rights":    w.syscall(w.fdFdstatSetRights, i32, i64, i64),
+		"fd_filestat_get":         w.syscall(w.fdFilestatGet, i32, i32),
+		"fd_filestat_set_size":    w.syscall(w.fdFilestatSetSize, i32, i64),
+		"fd_filestat_set_times":   w.syscall(w.fdFilestatSetTimes, i32, i64, i64, i32),
+		"fd_pread":                w.syscall(w.fdPread, i32, i32, i32, i64, i32),
+		"fd_prestat_get":          w.syscall(w.fdPrestatGet, i32, i32),
+		"fd_prestat_dir_name":     w.syscall(w.fdPrestatDirName, i32, i32, i32),
+		"fd_pwrite":               w.syscall(w.fdPwrite, i32, i32, i32, i64, i32),
+		"fd_read":                 w.syscall(w.fdRead, i32, i32, i32, i32),
+		"fd_readdir":              w.syscall(w.fdReaddir, i32, i32, i32, i64, i32),
+		"fd_renumber":             w.syscall(w.fdRenumber, i32, i32),
+		"fd_seek":                 w.syscall(w.fdSeek, i32, i64, i32, i32),
+		"fd_sync":                 w.syscall(w.fdSync, i32),
+		"fd_tell":                 w.syscall(w.fdTell, i32, i32),
+		"fd_write":                w.syscall(w.fdWrite, i32, i32, i32, i32),
+		"path_create_directory":   w.syscall(w.pathCreateDirectory, i32, i32, i32),
+		"path_filestat_get":       w.syscall(w.pathFilestatGet, i32, i32, i32, i32, i32),
+		"path_filestat_set_times": w.syscall(w.pathFilestatSetTimes, i32, i32, i32, i32, i64, i64, i32),
+		"path_link":               w.syscall(w.pathLink, i32, i32, i32, i32, i32, i32, i32),
+		"path_open":               w.syscall(w.pathOpen, i32, i32, i32, i32, i32, i64, i64, i32, i32),
+		"path_readlink":           w.syscall(w.pathReadlink, i32, i32, i32, i32, i32, i32),
+		"path_remove_directory":   w.syscall(w.pathRemoveDirectory, i32, i32, i32),
+		"path_rename":             w.syscall(w.pathRename, i32, i32, i32, i32, i32, i32),
+		"path_symlink":            w.syscall(w.pathSymlink, i32, i32, i32, i32, i32),
+		"path_unlink_file":        w.syscall(w.pathUnlinkFile, i32, i32, i32),
+		"poll_oneoff":             w.syscall(w.pollOneoff, i32, i32, i32, i32),
+		"proc_exit":               exec.NewRawHostFunction(wasm.FunctionSig{Form: 0x60, ParamTypes: []wasm.ValueType{i32}}, w.call(w.procExit)),
+		"proc_raise":              w.syscall(w.procRaise, i32),
+		"sched_yield":             w.syscall(w.schedYield),
+		"random_get":              w.syscall(w.randomGet, i32, i32),
+		"sock_accept":             w.syscall(w.sockAccept, i32, i32, i32),
+		"sock_recv":               w.syscall(w.sockRecv, i32, i32, i32, i32, i32, i32),
+		"sock_send":               w.syscall(w.sockSend, i32, i32, i32, i32, i32),
+		"sock_shutdown":           w.syscall(w.sockShutdown, i32, i32),
+	}
+
+	return w, nil
+}
+
+// ResolveHostFunction resolves a WASI host function along with its signature,
+// so that imports of the wrong type fail to link. Imports from other modules
+// are deferred to the fallback resolver if it is an exec.HostFunctionResolver.
+func (w *WASI) ResolveHostFunction(module, field string) *exec.HostFunction {
+	if module == ModuleName {
+		return w.funcs[field]
+	}
+
+	if hr, ok := w.config.Fallback.(exec.HostFunctionResolver); ok {
+		return hr.ResolveHostFunction(module, field)
+	}
+	return nil
+}
+
+// ResolveFunc resolves a WASI host function, deferring to the fallback
+// resolver for imports from other modules.
+func (w *WASI) ResolveFunc(module, field string) exec.FunctionImport {
+	if module == ModuleName {
+		if f, ok := w.funcs[field]; ok {
+			return f.FunctionImport()
+		}
+		panic(fmt.Errorf("unknown field: %s", field))
+	}
+
+	if w.config.Fallback != nil {
+		return w.config.Fallback.ResolveFunc(module, field)
+	}
+	panic(fmt.Errorf("unknown module: %s", module))
+}
+
+// ResolveGlobal defers to the fallback resolver; WASI does not export any
+// globals.
+func (w *WASI) ResolveGlobal(module, field string) int64 {
+	if module != ModuleName && w.config.Fallback != nil {
+		return w.config.Fallback.ResolveGlobal(module, field)
+	}
+	panic(fmt.Errorf("unknown global: %s %s", module, field))
+}
+
+// Close closes all file descriptors still held open by the module.
+func (w *WASI) Close() error {
+	w.fds.closeAll()
+	return nil
+}
+
+type syscallFunc func(vm *exec.VirtualMachine, mem memory, params []int64) Errno
+
+// syscall binds a WASI system call taking parameters of the given types as a
+// host function returning its errno.
+func (w *WASI) syscall(f syscallFunc, params ...wasm.ValueType) *exec.HostFunction {
+	sig := wasm.FunctionSig{Form: 0x60, ParamTypes: params, ReturnTypes: []wasm.ValueType{i32}}
+	return exec.NewRawHostFunction(sig, w.call(f))
+}
+
+// call adapts a WASI system call into a function import. Out of bounds guest
+// pointers are reported to the guest as ErrnoFault.
+func (w *WASI) call(f syscallFunc) exec.FunctionImport {
+	return func(vm *exec.VirtualMachine) (ret int64) {
+		defer func() {
+			if err := recover(); err != nil {
+				if err != errFault {
+					panic(err)
+				}
+				ret = int64(ErrnoFault)
+			}
+		}()
+
+		return int64(f(vm, memory(vm.Memory), vm.GetCurrentFrame().Locals))
+	}
+}
+
+// resolvePath resolves a guest path relative to the directory opened at fd,
+// which must hold the given rights, into a name within the mount of that
+// directory. Paths escaping the mount are rejected; the file system itself
+// keeps symbolic links from escaping.
+func (w *WASI) resolvePath(fd uint32, rights uint64, guestPath string) (*vfs.Mount, string, Errno) {
+	dir, errno := w.fds.getWithRights(fd, rights)
+	if errno != ErrnoSuccess {
+		return nil, "", errno
+	}
+
+	if !dir.isDir() {
+		return nil, "", ErrnoNotdir
+	}
+
+	if strings.IndexByte(guestPath, 0) != -1 {
+		return nil, "", ErrnoInval
+	}
+
+	if path.IsAbs(guestPath) {
+		return nil, "", ErrnoNotcapable
+	}
+
+	name := path.Join(dir.path, guestPath)
+	if name == ".." || strings.HasPrefix(name, "../") {
+		return nil, "", ErrnoNotcapable
+	}
+
+	return dir.mount, name, ErrnoSuccess
+}
+
+// errnoOf converts a Go error into the closest WASI error number.
+func errnoOf(err error) Errno {
+	var errno Errno
+
+	switch {
+	case err == nil:
+		return ErrnoSuccess
+	case errors.As(err, &errno):
+		return errno
+	case errors.Is(err, vfs.ErrReadOnly):
+		return ErrnoRofs
+	case errors.Is(err, vfs.ErrNotDir):
+		return ErrnoNotdir
+	case errors.Is(err, vfs.ErrIsDir):
+		return ErrnoIsdir
+	case errors.Is(err, vfs.ErrNotEmpty):
+		return ErrnoNotempty
+	case errors.Is(err, vfs.ErrLoop):
+		return ErrnoLoop
+	case errors.Is(err, vfs.ErrCrossDevice):
+		return ErrnoXdev
+	case errors.Is(err, vfs.ErrQuotaExceeded):
+		return ErrnoDquot
+	case errors.Is(err, vfs.ErrNotSupported):
+		return ErrnoNotsup
+	case errors.Is(err, os.ErrClosed):
+		return ErrnoBadf
+	case errors.Is(err, os.ErrInvalid):
+		return ErrnoInval
+	case errors.Is(err, syscall.ENOTDIR):
+		return ErrnoNotdir
+	case errors.Is(err, syscall.EISDIR):
+		return ErrnoIsdir
+	case errors.Is(err, syscall.ENOTEMPTY):
+		return ErrnoNotempty
+	case errors.Is(err, syscall.ELOOP):
+		return ErrnoLoop
+	case errors.Is(err, syscall.ENAMETOOLONG):
+		return ErrnoNametoolong
+	case errors.Is(err, syscall.EXDEV):
+		return ErrnoXdev
+	case errors.Is(err, syscall.ENOSPC):
+		return ErrnoNospc
+	case errors.Is(err, syscall.EROFS):
+		return ErrnoRofs
+	case errors.Is(err, syscall.EINVAL):
+		return ErrnoInval
+	case os.IsNotExist(err):
+		return ErrnoNoent
+	case os.IsExist(err):
+		return ErrnoExist
+	case os.IsPermission(err):
+		return ErrnoAcces
+	default:
+		return ErrnoIo
+	}
+}
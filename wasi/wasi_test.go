@@ -0,0 +1,123 @@
+package wasi
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/perlin-network/life/exec"
+	. "github.com/perlin-network/life/internal/wasmtest"
+	"github.com/perlin-network/life/wasi/vfs"
+)
+
+func TestHelloWorld(t *testing.T) {
+	m := &Module{
+		Types: [][]byte{
+			FuncType([]byte{I32, I32, I32, I32}, []byte{I32}),
+			FuncType([]byte{I32}, nil),
+			FuncType(nil, nil),
+		},
+		Imports: []Import{
+			ImportFunc(ModuleName, "fd_write", 0),
+			ImportFunc(ModuleName, "proc_exit", 1),
+		},
+		Funcs: []Func{{Type: 2, Body: Cat(
+			I32Const(1), I32Const(0), I32Const(1), I32Const(16), Call(0), []byte{0x1a}, // fd_write(stdout, iovec, 1, &n)
+			I32Const(3), Call(1),
+		)}},
+		Memories: [][]byte{Limits(1, -1)},
+		Exports:  [][]byte{Export("memory", KindMemory, 0), Export("_start", KindFunc, 2)},
+		Datas:    [][]byte{ActiveData(0, "\x08\x00\x00\x00\x06\x00\x00\x00hello\n")},
+	}
+
+	var stdout bytes.Buffer
+	w, err := New(Config{Stdout: &stdout})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	vm, err := exec.NewVirtualMachine(m.Bytes(), exec.VMConfig{}, w, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, _ := vm.GetFunctionExport("_start")
+
+	_, err = vm.Run(entry)
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.Code != 3 {
+		t.Fatalf("expected exit code 3, got %v", err)
+	}
+	if stdout.String() != "hello\n" {
+		t.Fatalf("wrote %q", stdout.String())
+	}
+	if n := le.Uint32(vm.Memory[16:]); n != 6 {
+		t.Fatalf("fd_write reported %d bytes written", n)
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	w, mem := newTestWASI(t)
+	if err := vfs.MkdirAll(w.config.Mounts[0].FS, "a/b", 0755); err != nil {
+		t.Fatal(err)
+	}
+	dir, errno := w.testPathOpen(mem, 3, "a", oflagDirectory, rightsDirectory, rightsDirectory|rightsFile)
+	if errno != ErrnoSuccess {
+		t.Fatalf("path_open: %v", errno)
+	}
+
+	for _, c := range []struct {
+		fd    uint32
+		path  string
+		name  string
+		errno Errno
+	}{
+		{3, "in.txt", "in.txt", ErrnoSuccess},
+		{3, "a/b/../c", "a/c", ErrnoSuccess},
+		{dir, "b", "a/b", ErrnoSuccess},
+		{dir, "..", ".", ErrnoSuccess},
+		{3, "..", "", ErrnoNotcapable},
+		{3, "a/../../etc/passwd", "", ErrnoNotcapable},
+		{dir, "../../in.txt", "", ErrnoNotcapable},
+		{3, "/etc/passwd", "", ErrnoNotcapable},
+		{3, "in.txt\x00", "", ErrnoInval},
+		{0, "in.txt", "", ErrnoNotdir},
+		{99, "in.txt", "", ErrnoBadf},
+	} {
+		_, name, errno := w.resolvePath(c.fd, 0, c.path)
+		if errno != c.errno || name != c.name {
+			t.Errorf("resolvePath(%d, %q) = %q, %v", c.fd, c.path, name, errno)
+		}
+	}
+}
+
+func TestUnknownImport(t *testing.T) {
+	w, err := New(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Module{
+		Types:   [][]byte{FuncType(nil, nil)},
+		Imports: []Import{ImportFunc(ModuleName, "no_such_call", 0)},
+	}
+	if _, err := exec.NewVirtualMachine(m.Bytes(), exec.VMConfig{}, w, nil); err == nil {
+		t.Fatal("expected an unknown WASI import to be rejected")
+	}
+}
+
+func TestImportSignatureMismatch(t *testing.T) {
+	w, err := New(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Module{
+		Types:   [][]byte{FuncType([]byte{I32, I64, I32, I32}, []byte{I32})},
+		Imports: []Import{ImportFunc(ModuleName, "fd_write", 0)},
+	}
+	_, err = exec.NewVirtualMachine(m.Bytes(), exec.VMConfig{}, w, nil)
+	var linkErr *exec.LinkError
+	if !errors.As(err, &linkErr) || len(linkErr.Imports) != 1 || !errors.Is(linkErr.Imports[0], exec.ErrSignatureMismatch) {
+		t.Fatalf("expected a signature mismatch, got %v", err)
+	}
+}